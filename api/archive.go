@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//ArchivedEventTypes are the Device Event types moved to the archive by ArchiveEvents.
+//Other Events (e.g. created and merged) are kept so every Device's history still starts with how it was added
+var ArchivedEventTypes = []string{"modified", "note"}
+
+//ArchivedEvent represents a Device Event moved to the archive. Archived is when it was moved
+type ArchivedEvent struct {
+	ExportedEvent
+	Archived time.Time `json:"archived"`
+}
+
+//allEventsTable is a derived table of every Device Event in device_log and device_log_archive, for history readers
+//that must include archived Events. Archived Events keep their device_log ids, so ids are unique across both
+const allEventsTable = "(SELECT id, device_id, user_id, user_name, date, type, content, source, source_conversation_id, batch_id, prev_hash, hash FROM device_log UNION ALL " +
+	"SELECT id, device_id, user_id, user_name, date, type, content, source, source_conversation_id, batch_id, prev_hash, hash FROM device_log_archive)"
+
+//archivedEventCriterion returns an SQL criterion matching the types in ArchivedEventTypes in the given table alias
+func archivedEventCriterion(alias string) string {
+	return fmt.Sprintf("%s.type IN ('%s')", alias, strings.Join(ArchivedEventTypes, "', '"))
+}
+
+//ArchiveEvents moves at most limit of the oldest Device Events with an ArchivedEventType from before the given date to the archive
+//and returns the number moved, or an error if one occurred
+func (s *TxStore) ArchiveEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	tx := s.tx
+
+	//the batch is bounded by id so the same rows are copied and deleted
+	var last sql.NullInt64
+	row := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(id) FROM (SELECT e.id FROM device_log AS e WHERE %s AND e.date < ? ORDER BY e.id LIMIT ?) AS batch;", archivedEventCriterion("e")), before, limit)
+	if err := row.Scan(&last); err != nil {
+		return 0, &Error{Description: "Could not query Events to archive", Type: ErrorTypeServer, Err: err}
+	}
+	if !last.Valid {
+		return 0, nil
+	}
+
+	where := fmt.Sprintf("WHERE %s AND e.date < ? AND e.id <= ?", archivedEventCriterion("e"))
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO device_log_archive(id, device_id, user_id, user_name, date, type, content, source, source_conversation_id, batch_id, prev_hash, hash, archived)
+	SELECT e.id, e.device_id, e.user_id, e.user_name, e.date, e.type, e.content, e.source, e.source_conversation_id, e.batch_id, e.prev_hash, e.hash, ? FROM device_log AS e %s;`, where), time.Now(), before, last.Int64); err != nil {
+		return 0, &Error{Description: "Could not archive Events", Type: ErrorTypeServer, Err: err}
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE e FROM device_log AS e %s;", where), before, last.Int64)
+	if err != nil {
+		return 0, &Error{Description: "Could not delete archived Events", Type: ErrorTypeServer, Err: err}
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, &Error{Description: "Could not read archived Event count", Type: ErrorTypeServer, Err: err}
+	}
+
+	return n, nil
+}
+
+//QueryArchivedEvents returns at most limit archived Device Events matching the given Device id and date range
+//(since inclusive, until exclusive), oldest first, or an error if one occurred. Zero values match all archived Events
+func (s *TxStore) QueryArchivedEvents(ctx context.Context, deviceID int64, since, until time.Time, limit int) ([]*ArchivedEvent, error) {
+	tx := s.tx
+
+	var criteria []string
+	var parameters []interface{}
+
+	if deviceID != 0 {
+		criteria = append(criteria, "e.device_id=?")
+		parameters = append(parameters, deviceID)
+	}
+
+	if !since.IsZero() {
+		criteria = append(criteria, "e.date>=?")
+		parameters = append(parameters, since)
+	}
+
+	if !until.IsZero() {
+		criteria = append(criteria, "e.date<?")
+		parameters = append(parameters, until)
+	}
+
+	var where string
+	if len(criteria) > 0 {
+		where = "WHERE " + strings.Join(criteria, " AND ")
+	}
+	parameters = append(parameters, limit)
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+SELECT e.id, e.date, e.device_id, d.serial_number, e.user_id, IFNULL(u.name, IFNULL(e.user_name, '')), e.type, e.content, e.source, e.source_conversation_id, e.archived
+	FROM device_log_archive AS e JOIN device AS d ON e.device_id = d.id LEFT JOIN user AS u ON e.user_id = u.id
+	%s ORDER BY e.date, e.id LIMIT ?;`, where), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query archived Events", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	events := []*ArchivedEvent{}
+
+	for rows.Next() {
+		e := new(ArchivedEvent)
+		var userID sql.NullInt64
+		var sourceType, conversationID sql.NullString
+		var content []byte
+
+		if err := rows.Scan(&(e.ID), &(e.Date), &(e.DeviceID), &(e.SerialNumber), &userID, &(e.UserName), &(e.Type), &content, &sourceType, &conversationID, &(e.Archived)); err != nil {
+			return nil, &Error{Description: "Could not scan archived Event row", Type: ErrorTypeServer, Err: err}
+		}
+		e.UserID = userID.Int64
+		e.Content = rawContent(content)
+		e.Source = scanEventSource(sourceType, conversationID)
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan archived Event rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//AssetTagGenerator generates asset tags for new Devices
+type AssetTagGenerator interface {
+	//Generate returns a new unique asset tag for the given (validated) Device, using s to check existing tags, or an error if one occurred
+	Generate(ctx context.Context, s *TxStore, device *Device) (string, error)
+}
+
+var assetTagGenerator AssetTagGenerator
+
+//SetAssetTagGenerator sets the AssetTagGenerator used for new Devices without an asset tag. If nil, asset tags aren't generated
+func SetAssetTagGenerator(g AssetTagGenerator) {
+	assetTagGenerator = g
+}
+
+//SequenceAssetTagGenerator generates asset tags of the form <Prefix><location prefix><year>-<sequence>, e.g. TCEA-HS2026-000123.
+//The location prefix is the nearest AssetTagPrefix in the Device's location path and is only used if PerLocation is true.
+//The year is only used if PerYear is true. Each combination of location prefix and year has its own sequence
+type SequenceAssetTagGenerator struct {
+	Prefix      string
+	Digits      int
+	PerLocation bool
+	PerYear     bool
+}
+
+//readAssetTagPrefix returns the nearest AssetTagPrefix in the given Location's path, or an error if one occurred
+func (s *TxStore) readAssetTagPrefix(ctx context.Context, location Location) (string, error) {
+	for location != "" {
+		l, err := s.readLocationDetail(ctx, location)
+		if err != nil || l == nil {
+			return "", err
+		}
+		if l.AssetTagPrefix != "" {
+			return l.AssetTagPrefix, nil
+		}
+		location = l.Parent
+	}
+	return "", nil
+}
+
+//nextAssetTagSequence atomically increments and returns the sequence for the given scope, or an error if one occurred
+func (s *TxStore) nextAssetTagSequence(ctx context.Context, scope string) (int64, error) {
+	tx := s.tx
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO asset_tag_sequence(scope, next) VALUES(?, LAST_INSERT_ID(1)) ON DUPLICATE KEY UPDATE next=LAST_INSERT_ID(next+1);", scope)
+	if err != nil {
+		return 0, &Error{Description: fmt.Sprintf("Could not increment asset tag sequence(%s)", scope), Type: ErrorTypeServer, Err: err}
+	}
+
+	seq, err := res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: fmt.Sprintf("Could not fetch asset tag sequence(%s)", scope), Type: ErrorTypeServer, Err: err}
+	}
+
+	return seq, nil
+}
+
+//Generate returns a new unique asset tag for the given Device, or an error if one occurred.
+//Generated tags that are already in use (e.g. entered by hand) are skipped
+func (g *SequenceAssetTagGenerator) Generate(ctx context.Context, s *TxStore, device *Device) (string, error) {
+	scope := g.Prefix
+
+	if g.PerLocation {
+		prefix, err := s.readAssetTagPrefix(ctx, device.Location)
+		if err != nil {
+			return "", err
+		}
+		scope += prefix
+	}
+
+	if g.PerYear {
+		scope += fmt.Sprintf("%d-", time.Now().Year())
+	}
+
+	for {
+		seq, err := s.nextAssetTagSequence(ctx, scope)
+		if err != nil {
+			return "", err
+		}
+
+		tag := fmt.Sprintf("%s%0*d", scope, g.Digits, seq)
+
+		dup, err := s.ReadDeviceByAssetTag(ctx, tag)
+		if err != nil {
+			return "", err
+		}
+		if dup == nil {
+			return tag, nil
+		}
+	}
+}
+
+//ReadDeviceByAssetTag returns the Device (without Events) with the given asset tag, or an error if one occurred.
+//Deleted Devices are returned with DeletedAt set.
+func (s *TxStore) ReadDeviceByAssetTag(ctx context.Context, assetTag string) (*Device, error) {
+	tx := s.tx
+
+	device := &Device{AssetTag: assetTag}
+
+	var deleted sql.NullTime
+	row := tx.QueryRowContext(ctx, "SELECT id, serial_number, model_id, status, location, deleted_at FROM device WHERE asset_tag=?", assetTag)
+	err := row.Scan(&(device.ID), &(device.SerialNumber), &(device.ModelID), &(device.Status), &(device.Location), &deleted)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query DeviceByAssetTag(%s)", assetTag), Type: ErrorTypeServer, Err: err}
+	}
+	device.DeletedAt = timePtr(deleted)
+
+	return device, nil
+}
+
+//validateAssetTag cleans and validates the given asset tag
+func validateAssetTag(assetTag string) (string, error) {
+	assetTag = strings.TrimSpace(assetTag)
+	if len(assetTag) > 255 {
+		return "", fieldError("asset_tag", "too_long", "asset_tag length (%d) was more than maximum allowed (%d)", len(assetTag), 255)
+	}
+	return assetTag, nil
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//attributionBatchSize is the maximum number of Devices attributed per query
+const attributionBatchSize = 1000
+
+//Attribution represents who made a change to a Device and when. UserID is 0 if the User has been deleted
+type Attribution struct {
+	UserID int64     `json:"user_id,omitempty"`
+	Name   string    `json:"name"`
+	Date   time.Time `json:"date"`
+}
+
+//readAttributions returns the Attribution for the Events matching the given criterion, keyed by Device id
+func (s *TxStore) readAttributions(ctx context.Context, criterion string, parameters []interface{}) (map[int64]*Attribution, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT e.device_id, e.user_id, IFNULL(u.name, IFNULL(e.user_name, '')), e.date FROM %s AS e LEFT JOIN user AS u ON e.user_id = u.id WHERE %s;", allEventsTable, criterion), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query Attributions", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	attributions := make(map[int64]*Attribution)
+
+	for rows.Next() {
+		var deviceID int64
+		var userID sql.NullInt64
+		a := new(Attribution)
+
+		if err = rows.Scan(&deviceID, &userID, &(a.Name), &(a.Date)); err != nil {
+			return nil, &Error{Description: "Could not scan Attribution row", Type: ErrorTypeServer, Err: err}
+		}
+		a.UserID = userID.Int64
+
+		attributions[deviceID] = a
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan Attribution rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return attributions, nil
+}
+
+//ReadDeviceAttributions populates the CreatedBy and ModifiedBy fields of the given Devices from their Events, or returns an error if one occurred
+func (s *TxStore) ReadDeviceAttributions(ctx context.Context, devices []*Device) error {
+	for start := 0; start < len(devices); start += attributionBatchSize {
+		end := start + attributionBatchSize
+		if end > len(devices) {
+			end = len(devices)
+		}
+		batch := devices[start:end]
+
+		placeholders := make([]string, len(batch))
+		parameters := make([]interface{}, len(batch))
+		for i, d := range batch {
+			placeholders[i] = "?"
+			parameters[i] = d.ID
+		}
+		in := strings.Join(placeholders, ", ")
+
+		created, err := s.readAttributions(ctx, fmt.Sprintf("e.type = 'created' AND e.device_id IN (%s)", in), parameters)
+		if err != nil {
+			return err
+		}
+
+		modified, err := s.readAttributions(ctx, fmt.Sprintf("e.id IN (SELECT MAX(id) FROM %s AS m WHERE type = 'modified' AND device_id IN (%s) GROUP BY device_id)", allEventsTable, in), parameters)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range batch {
+			d.CreatedBy = created[d.ID]
+			d.ModifiedBy = modified[d.ID]
+		}
+	}
+
+	return nil
+}
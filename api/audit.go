@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//AuditEntry represents a write request made by a User. EntityID is the id (or name) from the request path, if any.
+//Summary is the (redacted) request body. Source is set from the request EventSource when the AuditEntry is created
+type AuditEntry struct {
+	ID       int64        `json:"id"`
+	Date     time.Time    `json:"date"`
+	UserID   int64        `json:"user_id,omitempty"`
+	UserName string       `json:"user_name"`
+	Method   string       `json:"method"`
+	Path     string       `json:"path"`
+	Entity   string       `json:"entity"`
+	EntityID string       `json:"entity_id,omitempty"`
+	Summary  string       `json:"summary,omitempty"`
+	Code     int          `json:"code"`
+	Source   *EventSource `json:"source,omitempty"`
+}
+
+//maxAuditSummary is the maximum length of an AuditEntry Summary
+const maxAuditSummary = 4096
+
+//CreateAuditEntry records the given AuditEntry (ID is ignored and created), or returns an error if one occurred
+func (s *TxStore) CreateAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	tx := s.tx
+
+	if len(entry.Summary) > maxAuditSummary {
+		entry.Summary = entry.Summary[:maxAuditSummary]
+	}
+
+	if entry.Source == nil {
+		entry.Source = eventSource(ctx)
+	}
+	sourceType, conversationID := entry.Source.columns()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO audit_log(date, user_id, user_name, method, path, entity, entity_id, summary, code, source, source_conversation_id) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		entry.Date,
+		nullID(entry.UserID),
+		entry.UserName,
+		entry.Method,
+		entry.Path,
+		entry.Entity,
+		nullString(entry.EntityID),
+		nullString(entry.Summary),
+		entry.Code,
+		sourceType,
+		conversationID,
+	)
+	if err != nil {
+		return &Error{Description: "Could not insert AuditEntry", Type: ErrorTypeServer, Err: err}
+	}
+
+	entry.ID, err = res.LastInsertId()
+	if err != nil {
+		return &Error{Description: "Could not fetch AuditEntry id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//QueryAuditEntries returns the latest AuditEntries (at most limit) matching the given User id, entity, EventSource type, and date range,
+//or an error if one occurred. Zero values match all entries
+func (s *TxStore) QueryAuditEntries(ctx context.Context, userID int64, entity, source string, since, until time.Time, limit int) ([]*AuditEntry, error) {
+	tx := s.tx
+
+	var criteria []string
+	var parameters []interface{}
+
+	if userID != 0 {
+		criteria = append(criteria, "user_id=?")
+		parameters = append(parameters, userID)
+	}
+
+	if entity != "" {
+		criteria = append(criteria, "entity=?")
+		parameters = append(parameters, entity)
+	}
+
+	if source != "" {
+		criteria = append(criteria, "source=?")
+		parameters = append(parameters, source)
+	}
+
+	if !since.IsZero() {
+		criteria = append(criteria, "date>=?")
+		parameters = append(parameters, since)
+	}
+
+	if !until.IsZero() {
+		criteria = append(criteria, "date<?")
+		parameters = append(parameters, until)
+	}
+
+	var query string
+
+	if len(criteria) > 0 {
+		query = "WHERE " + strings.Join(criteria, " AND ")
+	}
+
+	parameters = append(parameters, limit)
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, date, user_id, user_name, method, path, entity, entity_id, summary, code, source, source_conversation_id FROM audit_log %s ORDER BY id DESC LIMIT ?;", query), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query AuditEntries", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+
+	for rows.Next() {
+		e := new(AuditEntry)
+		var uID sql.NullInt64
+		var entityID, summary, sourceType, conversationID sql.NullString
+
+		if err = rows.Scan(&(e.ID), &(e.Date), &uID, &(e.UserName), &(e.Method), &(e.Path), &(e.Entity), &entityID, &summary, &(e.Code), &sourceType, &conversationID); err != nil {
+			return nil, &Error{Description: "Could not scan AuditEntry row", Type: ErrorTypeServer, Err: err}
+		}
+
+		e.UserID = uID.Int64
+		e.EntityID = entityID.String
+		e.Summary = summary.String
+		e.Source = scanEventSource(sourceType, conversationID)
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan AuditEntry rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return entries, nil
+}
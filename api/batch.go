@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//EventBatch represents the Device Events created by one bulk operation (e.g. setting the Status of every Device in a Cart).
+//RevertedBy is the id of the EventBatch that reverted it, if any
+type EventBatch struct {
+	ID          int64         `json:"id"`
+	Date        time.Time     `json:"date"`
+	UserID      int64         `json:"user_id,omitempty"`
+	Description string        `json:"description"`
+	RevertedBy  int64         `json:"reverted_by,omitempty"`
+	Events      []*BatchEvent `json:"events"`
+}
+
+//BatchEvent represents a Device Event in an EventBatch. Modified Events have ModifiedContent; other Events have their stored content
+type BatchEvent struct {
+	DeviceID int64  `json:"device_id"`
+	Event    *Event `json:"event"`
+}
+
+//pendingEventBatch is the EventBatch for a bulk operation. It's created with the operation's first Event, so operations that
+//don't change anything don't leave empty batches
+type pendingEventBatch struct {
+	id          int64
+	description string
+}
+
+//withEventBatch returns a context where Events created are added to a new EventBatch with the given description.
+//If ctx is already in a batch, it's returned unchanged so nested bulk operations share their caller's batch
+func withEventBatch(ctx context.Context, description string) context.Context {
+	if _, ok := ctx.Value(BatchKey).(*pendingEventBatch); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, BatchKey, &pendingEventBatch{description: description})
+}
+
+//eventBatchID returns the id of the EventBatch for ctx, creating it if needed, 0 if ctx isn't in a batch, or an error if one occurred
+func (s *TxStore) eventBatchID(ctx context.Context) (int64, error) {
+	tx := s.tx
+
+	batch, ok := ctx.Value(BatchKey).(*pendingEventBatch)
+	if !ok {
+		return 0, nil
+	}
+	if batch.id != 0 {
+		return batch.id, nil
+	}
+
+	var userID int64
+	if user, ok := ctx.Value(UserKey).(*User); ok {
+		userID = user.ID
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO event_batch(date, user_id, description) VALUES(?, ?, ?);", time.Now(), nullID(userID), batch.description)
+	if err != nil {
+		return 0, &Error{Description: "Could not insert EventBatch", Type: ErrorTypeServer, Err: err}
+	}
+
+	if batch.id, err = res.LastInsertId(); err != nil {
+		return 0, &Error{Description: "Could not fetch EventBatch id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return batch.id, nil
+}
+
+//ReadEventBatch returns the EventBatch with the given id and its Events (including archived Events) in the order they were created,
+//nil if it doesn't exist, or an error if one occurred
+func (s *TxStore) ReadEventBatch(ctx context.Context, id int64) (*EventBatch, error) {
+	tx := s.tx
+
+	batch := &EventBatch{ID: id, Events: []*BatchEvent{}}
+	var userID, revertedBy sql.NullInt64
+
+	row := tx.QueryRowContext(ctx, "SELECT date, user_id, description, reverted_by FROM event_batch WHERE id=?;", id)
+	switch err := row.Scan(&(batch.Date), &userID, &(batch.Description), &revertedBy); {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query EventBatch(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+	batch.UserID = userID.Int64
+	batch.RevertedBy = revertedBy.Int64
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, device_id, user_id, date, type, content, source, source_conversation_id FROM %s AS e WHERE batch_id=? ORDER BY id;", allEventsTable), id)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query Events for EventBatch(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		be := &BatchEvent{Event: &Event{BatchID: id}}
+		var eUserID sql.NullInt64
+		var sourceType, conversationID sql.NullString
+		var content []byte
+
+		if err := rows.Scan(&(be.Event.ID), &(be.DeviceID), &eUserID, &(be.Event.Date), &(be.Event.Type), &content, &sourceType, &conversationID); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan Event row for EventBatch(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+		be.Event.UserID = eUserID.Int64
+		be.Event.Source = scanEventSource(sourceType, conversationID)
+
+		if be.Event.Type == "modified" {
+			var mod *ModifiedContent
+			if err := json.Unmarshal(content, &mod); err != nil {
+				return nil, &Error{Description: fmt.Sprintf("Could not unmarshal modified content json for EventBatch(%d)", id), Type: ErrorTypeServer, Err: err}
+			}
+			be.Event.Content = mod
+		} else {
+			be.Event.Content = rawContent(content)
+		}
+
+		batch.Events = append(batch.Events, be)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan Event rows for EventBatch(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return batch, nil
+}
+
+//RevertEventBatch undoes the changes made by the EventBatch with the given id, recording them in a new EventBatch,
+//and returns the new EventBatch, or an error if one occurred.
+//Only batches of Modified Events can be reverted, and only if none of the changed fields have been changed again since
+func (s *TxStore) RevertEventBatch(ctx context.Context, id int64) (*EventBatch, error) {
+	tx := s.tx
+
+	batch, err := s.ReadEventBatch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if batch == nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not revert EventBatch(%d)", id), Type: ErrorTypeUser, Err: errors.New("batch does not exist")}
+	}
+	if batch.RevertedBy != 0 {
+		return nil, &Error{Description: fmt.Sprintf("Could not revert EventBatch(%d)", id), Type: ErrorTypeUser, Err: fmt.Errorf("batch was already reverted by batch %d", batch.RevertedBy)}
+	}
+	if len(batch.Events) == 0 {
+		return nil, &Error{Description: fmt.Sprintf("Could not revert EventBatch(%d)", id), Type: ErrorTypeUser, Err: errors.New("batch has no events")}
+	}
+
+	ctx = context.WithValue(ctx, BatchKey, &pendingEventBatch{description: fmt.Sprintf("Revert batch %d: %s", id, batch.Description)})
+
+	//newest first, so Devices changed more than once in the batch end up with their original values
+	for i := len(batch.Events) - 1; i >= 0; i-- {
+		e := batch.Events[i]
+		c, ok := e.Event.Content.(*ModifiedContent)
+		if !ok {
+			return nil, &Error{Description: fmt.Sprintf("Could not revert EventBatch(%d)", id), Type: ErrorTypeUser, Err: fmt.Errorf("%s events can't be reverted", e.Event.Type)}
+		}
+		if err = s.revertModifiedEvent(ctx, e.DeviceID, c); err != nil {
+			return nil, err
+		}
+	}
+
+	revertID, err := s.eventBatchID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE event_batch SET reverted_by=? WHERE id=?;", revertID, id); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not update EventBatch(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	revert, err := s.ReadEventBatch(ctx, revertID)
+	if err != nil {
+		return nil, err
+	}
+
+	//nothing changed, so the batch wasn't reverted
+	if revert == nil || len(revert.Events) == 0 {
+		return nil, &Error{Description: fmt.Sprintf("Could not revert EventBatch(%d)", id), Type: ErrorTypeUser, Err: errors.New("reverting the batch didn't change any devices")}
+	}
+
+	return revert, nil
+}
+
+//revertModifiedEvent sets the fields in c on the Device with the given id back to their old values,
+//or returns an error if one occurred or a field no longer has its new value
+func (s *TxStore) revertModifiedEvent(ctx context.Context, deviceID int64, c *ModifiedContent) error {
+	tx := s.tx
+
+	device, err := s.ReadDevice(ctx, deviceID, false)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return &Error{Description: fmt.Sprintf("Could not revert Device(%d)", deviceID), Type: ErrorTypeUser, Err: errors.New("device does not exist or is deleted")}
+	}
+
+	var cartNumber sql.NullString
+	if err = tx.QueryRowContext(ctx, "SELECT c.number FROM device AS d LEFT JOIN cart AS c ON d.cart_id = c.id WHERE d.id=?;", deviceID).Scan(&cartNumber); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query Cart for Device(%d)", deviceID), Type: ErrorTypeServer, Err: err}
+	}
+
+	changed := func(f *ModifiedField) error {
+		return &Error{Description: fmt.Sprintf("Could not revert Device(%d)", deviceID), Type: ErrorTypeUser,
+			Err: fmt.Errorf("%s has changed since the batch", f.Name)}
+	}
+
+	var updateDevice bool
+	var cart *ModifiedField
+
+	for _, f := range c.Fields {
+		oldValue, _ := f.OldValue.(string)
+		newValue, _ := f.NewValue.(string)
+
+		switch f.Name {
+		case "serial_number":
+			if device.SerialNumber != newValue {
+				return changed(f)
+			}
+			device.SerialNumber = oldValue
+		case "asset_tag":
+			if device.AssetTag != newValue {
+				return changed(f)
+			}
+			device.AssetTag = oldValue
+		case "model_id":
+			oldID, _ := f.OldValue.(float64)
+			newID, _ := f.NewValue.(float64)
+			if device.ModelID != int64(newID) {
+				return changed(f)
+			}
+			device.ModelID = int64(oldID)
+		case "status":
+			if string(device.Status) != newValue {
+				return changed(f)
+			}
+			device.Status = Status(oldValue)
+		case "location":
+			if string(device.Location) != newValue {
+				return changed(f)
+			}
+			device.Location = Location(oldValue)
+		case "cart":
+			if cartNumber.String != newValue {
+				return changed(f)
+			}
+			cart = f
+			continue
+		default:
+			return &Error{Description: fmt.Sprintf("Could not revert Device(%d)", deviceID), Type: ErrorTypeUser, Err: fmt.Errorf("%s changes can't be reverted", f.Name)}
+		}
+		updateDevice = true
+	}
+
+	if updateDevice {
+		if err = s.UpdateDevice(ctx, device); err != nil {
+			return err
+		}
+	}
+
+	if cart != nil {
+		oldNumber, _ := cart.OldValue.(string)
+		newNumber, _ := cart.NewValue.(string)
+
+		var cartID int64
+		if oldNumber != "" {
+			switch err = tx.QueryRowContext(ctx, "SELECT id FROM cart WHERE number=?;", oldNumber).Scan(&cartID); {
+			case err == sql.ErrNoRows:
+				return &Error{Description: fmt.Sprintf("Could not revert Device(%d)", deviceID), Type: ErrorTypeUser, Err: fmt.Errorf("cart (%s) does not exist", oldNumber)}
+			case err != nil:
+				return &Error{Description: fmt.Sprintf("Could not query Cart(%s)", oldNumber), Type: ErrorTypeServer, Err: err}
+			}
+		}
+
+		if err = s.setDeviceCart(ctx, deviceID, cartID, newNumber, oldNumber); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,611 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/query"
+)
+
+//ReportDefinition limits
+const (
+	DefaultReportRows = 1000
+	MaxReportRows     = 10000
+
+	maxReportFilterDepth      = 8
+	maxReportFilterParameters = 100
+)
+
+//reportKind is the type of a report column
+type reportKind int
+
+const (
+	reportString reportKind = iota
+	reportInteger
+	reportNumber
+	reportDate
+)
+
+//reportField is a field a ReportDefinition can filter, group, or aggregate by
+type reportField struct {
+	column string
+	kind   reportKind
+}
+
+//reportEntity is an entity a ReportDefinition can report on
+type reportEntity struct {
+	from   string
+	fields map[string]*reportField
+	//scope returns an SQL criterion restricting the entity to what the request User may see
+	scope func(ctx context.Context, s *TxStore) (string, []interface{}, error)
+}
+
+var reportEntities = map[string]*reportEntity{
+	"device": {
+		from: "device AS d JOIN model AS m ON d.model_id = m.id LEFT JOIN category AS c ON m.category_id = c.id " +
+			"JOIN status AS st ON d.status = st.status JOIN location AS l ON d.location = l.location",
+		fields: map[string]*reportField{
+			"id":               {"d.id", reportInteger},
+			"serial_number":    {"d.serial_number", reportString},
+			"asset_tag":        {"d.asset_tag", reportString},
+			"status":           {"d.status", reportString},
+			"status_semantics": {"st.semantics", reportString},
+			"location":         {"d.location", reportString},
+			"location_type":    {"l.type", reportString},
+			"location_parent":  {"l.parent", reportString},
+			"cart_id":          {"d.cart_id", reportInteger},
+			"last_event_at":    {"d.last_event_at", reportDate},
+			"model_id":         {"m.id", reportInteger},
+			"manufacturer":     {"m.manufacturer", reportString},
+			"model":            {"m.model", reportString},
+			"category_id":      {"m.category_id", reportInteger},
+			"category":         {"c.name", reportString},
+			"eol_date":         {"m.eol_date", reportDate},
+			"eos_date":         {"m.eos_date", reportDate},
+		},
+		scope: func(ctx context.Context, s *TxStore) (string, []interface{}, error) {
+			return s.deviceScope(ctx, "d")
+		},
+	},
+	"model": {
+		from: "model AS m LEFT JOIN category AS c ON m.category_id = c.id",
+		fields: map[string]*reportField{
+			"id":           {"m.id", reportInteger},
+			"manufacturer": {"m.manufacturer", reportString},
+			"model":        {"m.model", reportString},
+			"category_id":  {"m.category_id", reportInteger},
+			"category":     {"c.name", reportString},
+			"eol_date":     {"m.eol_date", reportDate},
+			"eos_date":     {"m.eos_date", reportDate},
+			"created":      {"m.created", reportDate},
+		},
+		scope: func(ctx context.Context, s *TxStore) (string, []interface{}, error) {
+			return notDeleted("m"), nil, nil
+		},
+	},
+	"event": {
+		from: allEventsTable + " AS e JOIN device AS d ON e.device_id = d.id JOIN model AS m ON d.model_id = m.id " +
+			"LEFT JOIN category AS c ON m.category_id = c.id LEFT JOIN user AS u ON e.user_id = u.id",
+		fields: map[string]*reportField{
+			"id":           {"e.id", reportInteger},
+			"device_id":    {"e.device_id", reportInteger},
+			"type":         {"e.type", reportString},
+			"date":         {"e.date", reportDate},
+			"user_id":      {"e.user_id", reportInteger},
+			"user_name":    {"IFNULL(u.name, e.user_name)", reportString},
+			"source":       {"e.source", reportString},
+			"batch_id":     {"e.batch_id", reportInteger},
+			"status":       {"d.status", reportString},
+			"location":     {"d.location", reportString},
+			"model_id":     {"m.id", reportInteger},
+			"manufacturer": {"m.manufacturer", reportString},
+			"model":        {"m.model", reportString},
+			"category":     {"c.name", reportString},
+		},
+		scope: func(ctx context.Context, s *TxStore) (string, []interface{}, error) {
+			return s.deviceScope(ctx, "d")
+		},
+	},
+}
+
+//reportDateFormats are the MySQL DATE_FORMAT formats for grouping date fields
+var reportDateFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"month": "%Y-%m",
+	"year":  "%Y",
+}
+
+//ReportAggregate is an aggregate column in a ReportDefinition. Function is count, count_distinct, sum, avg, min, or max.
+//Field is required except for count; sum and avg require a numeric Field
+type ReportAggregate struct {
+	Function string `json:"function"`
+	Field    string `json:"field,omitempty"`
+}
+
+//name returns the ReportAggregate's column name in a ReportResult
+func (a *ReportAggregate) name() string {
+	if a.Field == "" {
+		return a.Function
+	}
+	return a.Function + "_" + a.Field
+}
+
+//ReportSort sorts a ReportResult by one of its Columns
+type ReportSort struct {
+	Column string         `json:"column"`
+	Sort   query.SortType `json:"sort"`
+}
+
+//ReportDefinition is a declarative report: Entity (device, model, or event) rows matching Filter, grouped by the GroupBy fields,
+//with an Aggregates column for each group (count if empty). Date fields can be grouped by day, month, or year with a suffix, e.g. date:month.
+//Rows are sorted by Sort, then the GroupBy columns. Limit defaults to DefaultReportRows and is at most MaxReportRows.
+//Events include archived Events
+type ReportDefinition struct {
+	Entity     string               `json:"entity"`
+	Filter     *query.ParameterTree `json:"filter,omitempty"`
+	GroupBy    []string             `json:"group_by,omitempty"`
+	Aggregates []*ReportAggregate   `json:"aggregates,omitempty"`
+	Sort       []*ReportSort        `json:"sort,omitempty"`
+	Limit      int                  `json:"limit,omitempty"`
+}
+
+//ReportResult is the result of running a ReportDefinition. Rows has a value for each of Columns.
+//Truncated is true if there were more than Limit rows. Cached is true if the result was generated earlier at Date
+type ReportResult struct {
+	Entity    string          `json:"entity"`
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated"`
+	Date      time.Time       `json:"date"`
+	Cached    bool            `json:"cached"`
+}
+
+//reportColumn is a selected column of a ReportDefinition
+type reportColumn struct {
+	name string
+	expr string
+	kind reportKind
+}
+
+//reportQuery builds the SQL for a ReportDefinition
+type reportQuery struct {
+	entity     *reportEntity
+	parameters []interface{}
+	count      int
+}
+
+//field returns the reportField for the given field name, or an error if the entity doesn't have it
+func (q *reportQuery) field(field string) (*reportField, error) {
+	f, ok := q.entity.fields[field]
+	if !ok {
+		return nil, fieldError("field", "invalid_field", "field (%s) must be a valid field", field)
+	}
+	return f, nil
+}
+
+//criterion returns the SQL criterion for the given query.Parameter, or an error if it's invalid
+func (q *reportQuery) criterion(p *query.Parameter) (string, error) {
+	if p == nil {
+		return "", fieldError("filter", "invalid_parameter", "parameter must not be null")
+	}
+
+	f, err := q.field(p.Field)
+	if err != nil {
+		return "", err
+	}
+
+	switch p.Operation {
+	case query.OperationIsNull:
+		return f.column + " IS NULL", nil
+	case query.OperationIsNotNull:
+		return f.column + " IS NOT NULL", nil
+	}
+
+	var value interface{}
+	switch v := p.Value.(type) {
+	case string:
+		value = v
+	case bool:
+		value = v
+	case float64:
+		value = v
+		if v == math.Trunc(v) {
+			value = int64(v)
+		}
+	default:
+		return "", fieldError("filter", "invalid_value", "value for %s must be a string, number, or boolean", p.Field)
+	}
+
+	like := func(pattern string) (string, error) {
+		s, ok := value.(string)
+		if !ok {
+			return "", fieldError("filter", "invalid_value", "value for %s must be a string", p.Field)
+		}
+		s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+		q.parameters = append(q.parameters, fmt.Sprintf(pattern, s))
+		return f.column + " LIKE ?", nil
+	}
+
+	var op string
+	switch p.Operation {
+	case query.OperationEquals:
+		op = "="
+	case query.OperationNotEquals:
+		op = "<>"
+	case query.OperationLessThan:
+		op = "<"
+	case query.OperationGreaterThan:
+		op = ">"
+	case query.OperationLessThanOrEqualTo:
+		op = "<="
+	case query.OperationGreaterThanOrEqualTo:
+		op = ">="
+	case query.OperationContains:
+		return like("%%%s%%")
+	case query.OperatationStartsWith:
+		return like("%s%%")
+	case query.OperationEndsWith:
+		return like("%%%s")
+	case query.OperationRegexp:
+		if _, ok := value.(string); !ok {
+			return "", fieldError("filter", "invalid_value", "value for %s must be a string", p.Field)
+		}
+		op = "REGEXP"
+	default:
+		return "", fieldError("filter", "invalid_operation", "operation (%d) must be a valid operation", p.Operation)
+	}
+
+	q.parameters = append(q.parameters, value)
+	return fmt.Sprintf("%s %s ?", f.column, op), nil
+}
+
+//tree returns the SQL criterion for the given query.ParameterTree at the given depth, or an error if it's invalid.
+//An empty tree returns an empty criterion
+func (q *reportQuery) tree(t *query.ParameterTree, depth int) (string, error) {
+	if depth > maxReportFilterDepth {
+		return "", fieldError("filter", "too_deep", "filter has more than %d levels", maxReportFilterDepth)
+	}
+
+	var criteria []string
+
+	for _, p := range t.Parameters {
+		q.count++
+		if q.count > maxReportFilterParameters {
+			return "", fieldError("filter", "too_many", "filter has more than %d parameters", maxReportFilterParameters)
+		}
+		c, err := q.criterion(p)
+		if err != nil {
+			return "", err
+		}
+		criteria = append(criteria, c)
+	}
+
+	for _, sub := range t.Trees {
+		if sub == nil {
+			continue
+		}
+		c, err := q.tree(sub, depth+1)
+		if err != nil {
+			return "", err
+		}
+		if c != "" {
+			criteria = append(criteria, c)
+		}
+	}
+
+	if len(criteria) == 0 {
+		return "", nil
+	}
+
+	switch t.Boolean {
+	case query.BooleanAND:
+		return "(" + strings.Join(criteria, " AND ") + ")", nil
+	case query.BooleanOR:
+		return "(" + strings.Join(criteria, " OR ") + ")", nil
+	case query.BooleanXOR:
+		return "(" + strings.Join(criteria, " XOR ") + ")", nil
+	case query.BooleanNOT:
+		return "(NOT (" + strings.Join(criteria, " AND ") + "))", nil
+	}
+
+	return "", fieldError("filter", "invalid_boolean", "boolean (%d) must be a valid boolean", t.Boolean)
+}
+
+//groupColumn returns the reportColumn for the given GroupBy field, or an error if it's invalid
+func (q *reportQuery) groupColumn(group string) (*reportColumn, error) {
+	name, unit := group, ""
+	if i := strings.Index(group, ":"); i != -1 {
+		name, unit = group[:i], group[i+1:]
+	}
+
+	f, err := q.field(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if unit == "" {
+		return &reportColumn{name: group, expr: f.column, kind: f.kind}, nil
+	}
+
+	format, ok := reportDateFormats[unit]
+	if !ok || f.kind != reportDate {
+		return nil, fieldError("group_by", "invalid_group", "group (%s) must be a field or a date field with :day, :month, or :year", group)
+	}
+
+	return &reportColumn{name: group, expr: "DATE_FORMAT(" + f.column + ", '" + format + "')", kind: reportString}, nil
+}
+
+//aggregateColumn returns the reportColumn for the given ReportAggregate, or an error if it's invalid
+func (q *reportQuery) aggregateColumn(a *ReportAggregate) (*reportColumn, error) {
+	if a == nil {
+		return nil, fieldError("aggregates", "invalid_aggregate", "aggregate must not be null")
+	}
+
+	if a.Function == "count" && a.Field == "" {
+		return &reportColumn{name: a.name(), expr: "COUNT(*)", kind: reportInteger}, nil
+	}
+
+	f, err := q.field(a.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a.Function {
+	case "count":
+		return &reportColumn{name: a.name(), expr: "COUNT(" + f.column + ")", kind: reportInteger}, nil
+	case "count_distinct":
+		return &reportColumn{name: a.name(), expr: "COUNT(DISTINCT " + f.column + ")", kind: reportInteger}, nil
+	case "min", "max":
+		return &reportColumn{name: a.name(), expr: strings.ToUpper(a.Function) + "(" + f.column + ")", kind: f.kind}, nil
+	case "sum", "avg":
+		if f.kind != reportInteger {
+			return nil, fieldError("aggregates", "invalid_aggregate", "%s field (%s) must be numeric", a.Function, a.Field)
+		}
+		return &reportColumn{name: a.name(), expr: strings.ToUpper(a.Function) + "(" + f.column + ")", kind: reportNumber}, nil
+	}
+
+	return nil, fieldError("aggregates", "invalid_aggregate", "function (%s) must be count, count_distinct, sum, avg, min, or max", a.Function)
+}
+
+//build validates the given ReportDefinition and returns its SQL (without parameters) and columns, or an error if it's invalid
+func (q *reportQuery) build(def *ReportDefinition, scope string, scopeParameters []interface{}) (string, []*reportColumn, error) {
+	where := ""
+	if def.Filter != nil {
+		c, err := q.tree(def.Filter, 1)
+		if err != nil {
+			return "", nil, err
+		}
+		where = c
+	}
+	if scope != "" {
+		if where != "" {
+			where += " AND "
+		}
+		where += scope
+		q.parameters = append(q.parameters, scopeParameters...)
+	}
+
+	var columns []*reportColumn
+	names := make(map[string]int)
+	add := func(c *reportColumn) error {
+		if _, ok := names[c.name]; ok {
+			return fieldError("group_by", "duplicate_column", "column (%s) is included more than once", c.name)
+		}
+		names[c.name] = len(columns) + 1
+		columns = append(columns, c)
+		return nil
+	}
+
+	for _, g := range def.GroupBy {
+		c, err := q.groupColumn(g)
+		if err != nil {
+			return "", nil, err
+		}
+		if err = add(c); err != nil {
+			return "", nil, err
+		}
+	}
+
+	aggregates := def.Aggregates
+	if len(aggregates) == 0 {
+		aggregates = []*ReportAggregate{{Function: "count"}}
+	}
+	for _, a := range aggregates {
+		c, err := q.aggregateColumn(a)
+		if err != nil {
+			return "", nil, err
+		}
+		if err = add(c); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var order []string
+	sorted := make(map[int]bool)
+	for _, s := range def.Sort {
+		if s == nil {
+			continue
+		}
+		i, ok := names[s.Column]
+		if !ok {
+			return "", nil, fieldError("sort", "invalid_column", "sort column (%s) must be a group_by or aggregate column", s.Column)
+		}
+		switch s.Sort {
+		case query.SortAscending:
+			order = append(order, strconv.Itoa(i)+" ASC")
+		case query.SortDescending:
+			order = append(order, strconv.Itoa(i)+" DESC")
+		case query.SortNone:
+			continue
+		default:
+			return "", nil, fieldError("sort", "invalid_sort", "sort (%d) must be a valid sort", s.Sort)
+		}
+		sorted[i] = true
+	}
+	for i := range def.GroupBy {
+		if !sorted[i+1] {
+			order = append(order, strconv.Itoa(i+1)+" ASC")
+		}
+	}
+
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		exprs[i] = c.expr
+	}
+
+	//DATE_FORMAT patterns contain %, so the query isn't built with fmt
+	sqlQuery := "SELECT " + strings.Join(exprs, ", ") + " FROM " + q.entity.from
+	if where != "" {
+		sqlQuery += " WHERE " + where
+	}
+	if len(def.GroupBy) > 0 {
+		groups := make([]string, len(def.GroupBy))
+		for i := range groups {
+			groups[i] = strconv.Itoa(i + 1)
+		}
+		sqlQuery += " GROUP BY " + strings.Join(groups, ", ")
+	}
+	if len(order) > 0 {
+		sqlQuery += " ORDER BY " + strings.Join(order, ", ")
+	}
+	sqlQuery += " LIMIT ?;"
+
+	return sqlQuery, columns, nil
+}
+
+//scanValue returns a pointer to scan a column of the given kind into, and a function returning the scanned value
+func scanValue(kind reportKind) (interface{}, func() interface{}) {
+	switch kind {
+	case reportInteger:
+		v := new(sql.NullInt64)
+		return v, func() interface{} {
+			if !v.Valid {
+				return nil
+			}
+			return v.Int64
+		}
+	case reportNumber:
+		v := new(sql.NullFloat64)
+		return v, func() interface{} {
+			if !v.Valid {
+				return nil
+			}
+			return v.Float64
+		}
+	case reportDate:
+		v := new(sql.NullTime)
+		return v, func() interface{} {
+			if !v.Valid {
+				return nil
+			}
+			return v.Time
+		}
+	}
+	v := new(sql.NullString)
+	return v, func() interface{} {
+		if !v.Valid {
+			return nil
+		}
+		return v.String
+	}
+}
+
+//RunReport runs the given ReportDefinition and returns its ReportResult, or an error if one occurred.
+//Results are restricted to the Locations the request User may access, and are cached with the other entities in the Cache
+func (s *TxStore) RunReport(ctx context.Context, def *ReportDefinition) (*ReportResult, error) {
+	tx := s.tx
+
+	entity, ok := reportEntities[def.Entity]
+	if !ok {
+		return nil, &Error{Description: "Could not validate ReportDefinition", Type: ErrorTypeUser,
+			Err: fieldError("entity", "invalid_entity", "entity (%s) must be device, model, or event", def.Entity)}
+	}
+
+	if def.Limit == 0 {
+		def.Limit = DefaultReportRows
+	}
+	if def.Limit < 0 || def.Limit > MaxReportRows {
+		return nil, &Error{Description: "Could not validate ReportDefinition", Type: ErrorTypeUser,
+			Err: fieldError("limit", "invalid_limit", "limit (%d) must be between 1 and %d", def.Limit, MaxReportRows)}
+	}
+
+	scope, scopeParameters, err := entity.scope(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &reportQuery{entity: entity}
+	sqlQuery, columns, err := q.build(def, scope, scopeParameters)
+	if err != nil {
+		return nil, &Error{Description: "Could not validate ReportDefinition", Type: ErrorTypeUser, Err: err}
+	}
+	parameters := append(q.parameters, def.Limit+1)
+
+	//the key includes the scope parameters, so Users with different Locations don't share results
+	buf, err := json.Marshal(struct {
+		SQL        string        `json:"sql"`
+		Parameters []interface{} `json:"parameters"`
+	}{sqlQuery, parameters})
+	if err != nil {
+		return nil, &Error{Description: "Could not marshal ReportDefinition", Type: ErrorTypeServer, Err: err}
+	}
+	sum := sha256.Sum256(buf)
+	key := "Report(" + hex.EncodeToString(sum[:]) + ")"
+
+	cache := requestCache(ctx)
+	if cached, ok := cache.Get(key); ok {
+		result := *(cached.(*ReportResult))
+		result.Cached = true
+		return &result, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, sqlQuery, parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query report", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	result := &ReportResult{Entity: def.Entity, Columns: make([]string, len(columns)), Rows: [][]interface{}{}, Date: time.Now()}
+	for i, c := range columns {
+		result.Columns[i] = c.name
+	}
+
+	dest := make([]interface{}, len(columns))
+	values := make([]func() interface{}, len(columns))
+	for i, c := range columns {
+		dest[i], values[i] = scanValue(c.kind)
+	}
+
+	for rows.Next() {
+		if len(result.Rows) == def.Limit {
+			result.Truncated = true
+			break
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, &Error{Description: "Could not scan report row", Type: ErrorTypeServer, Err: err}
+		}
+
+		row := make([]interface{}, len(columns))
+		for i, v := range values {
+			row[i] = v()
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan report rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	cache.Set(key, result)
+
+	return result, nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//Cache is a read-through cache for entities keyed by type and ID (e.g. "Device(1)")
+type Cache interface {
+	//Get returns the value for key and whether or not it was found
+	Get(key string) (value interface{}, ok bool)
+
+	//Set sets the value for key
+	Set(key string, value interface{})
+
+	//Delete removes the given keys
+	Delete(keys ...string)
+
+	//Flush removes all keys
+	Flush()
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+//MemoryCache represents a Cache that uses an in-memory map
+type MemoryCache struct {
+	store    map[string]*cacheEntry
+	duration time.Duration
+	mu       *sync.Mutex
+}
+
+//scavengeCache removes stale records every duration
+func scavengeCache(m *MemoryCache) {
+	for {
+		time.Sleep(m.duration)
+		now := time.Now()
+		m.mu.Lock()
+		for key, e := range m.store {
+			if e.expires.Before(now) {
+				delete(m.store, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+//NewMemoryCache returns a new MemoryCache with the given expiration duration
+func NewMemoryCache(duration time.Duration) *MemoryCache {
+	m := &MemoryCache{
+		store:    make(map[string]*cacheEntry),
+		duration: duration,
+		mu:       new(sync.Mutex),
+	}
+	go scavengeCache(m)
+	return m
+}
+
+//Get returns the value for key and whether or not it was found
+func (m *MemoryCache) Get(key string) (value interface{}, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.store[key]; ok {
+		if e.expires.After(time.Now()) {
+			return e.value, true
+		}
+		delete(m.store, key)
+	}
+	return nil, false
+}
+
+//Set sets the value for key
+func (m *MemoryCache) Set(key string, value interface{}) {
+	m.mu.Lock()
+	m.store[key] = &cacheEntry{value: value, expires: time.Now().Add(m.duration)}
+	m.mu.Unlock()
+}
+
+//Delete removes the given keys
+func (m *MemoryCache) Delete(keys ...string) {
+	m.mu.Lock()
+	for _, key := range keys {
+		delete(m.store, key)
+	}
+	m.mu.Unlock()
+}
+
+//Flush removes all keys
+func (m *MemoryCache) Flush() {
+	m.mu.Lock()
+	m.store = make(map[string]*cacheEntry)
+	m.mu.Unlock()
+}
+
+//RequestCache wraps a Cache for a single request transaction.
+//Keys invalidated by the request are removed immediately and again when Commit is called,
+//and once a request has invalidated anything it no longer populates the Cache with (uncommitted) reads.
+//A nil *RequestCache is valid and does nothing.
+type RequestCache struct {
+	cache   Cache
+	keys    []string
+	flushed bool
+	noFill  bool
+	mu      *sync.Mutex
+}
+
+//NewRequestCache returns a new RequestCache for the given Cache
+func NewRequestCache(c Cache) *RequestCache {
+	return &RequestCache{cache: c, mu: new(sync.Mutex)}
+}
+
+//NewReplicaRequestCache returns a new RequestCache for the given Cache for a request reading from a read replica.
+//It reads from the Cache but never populates it, since the replica may not have caught up with invalidated changes
+func NewReplicaRequestCache(c Cache) *RequestCache {
+	return &RequestCache{cache: c, noFill: true, mu: new(sync.Mutex)}
+}
+
+//Get returns the value for key and whether or not it was found
+func (c *RequestCache) Get(key string) (value interface{}, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+	return c.cache.Get(key)
+}
+
+//Set sets the value for key if the request hasn't invalidated anything
+func (c *RequestCache) Set(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.noFill || c.flushed || len(c.keys) > 0 {
+		return
+	}
+	c.cache.Set(key, value)
+}
+
+//Invalidate removes the given keys
+func (c *RequestCache) Invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.keys = append(c.keys, keys...)
+	c.mu.Unlock()
+	c.cache.Delete(keys...)
+}
+
+//Flush removes all keys
+func (c *RequestCache) Flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.flushed = true
+	c.mu.Unlock()
+	c.cache.Flush()
+}
+
+//Commit invalidates all keys invalidated during the request again. It should be called after the request transaction is committed
+func (c *RequestCache) Commit() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.flushed {
+		c.cache.Flush()
+		return
+	}
+	if len(c.keys) > 0 {
+		c.cache.Delete(c.keys...)
+	}
+}
+
+//requestCache returns the RequestCache for ctx, or nil if caching is disabled
+func requestCache(ctx context.Context) *RequestCache {
+	c, _ := ctx.Value(CacheKey).(*RequestCache)
+	return c
+}
+
+//cacheKey returns the Cache key for the given type and id
+func cacheKey(typ string, id int64) string {
+	return fmt.Sprintf("%s(%d)", typ, id)
+}
@@ -0,0 +1,441 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//Cart represents a device cart. Location is the Cart's home Location.
+//Capacity is the maximum number of Devices the Cart holds, or 0 if there is no limit. Count is populated for Reads
+type Cart struct {
+	ID       int64    `json:"id"`
+	Number   string   `json:"number"`
+	Location Location `json:"location"`
+	Capacity int64    `json:"capacity,omitempty"`
+	Count    int64    `json:"count"`
+}
+
+//Validate cleans and validates the given Cart
+func (c *Cart) Validate(ctx context.Context, s *TxStore) error {
+	c.Number = strings.TrimSpace(c.Number)
+
+	if err := ValidateString("number", c.Number, 50); err != nil {
+		return err
+	}
+
+	if err := c.Location.Validate(); err != nil {
+		return err
+	}
+
+	l, err := s.ReadLocation(ctx, c.Location)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return fieldError("location", "invalid_location", "location (%s) does not exist", c.Location)
+	}
+
+	if c.Capacity < 0 {
+		return fieldError("capacity", "negative", "capacity (%d) must not be negative", c.Capacity)
+	}
+
+	return nil
+}
+
+const cartSelectSQL = "SELECT c.id, c.number, c.location, IFNULL(c.capacity, 0), COUNT(d.id) FROM cart AS c LEFT JOIN device AS d ON d.cart_id = c.id AND d.deleted_at IS NULL"
+
+//scanCart scans a Cart selected with cartSelectSQL
+func scanCart(row interface{ Scan(...interface{}) error }) (*Cart, error) {
+	c := new(Cart)
+	err := row.Scan(&(c.ID), &(c.Number), &(c.Location), &(c.Capacity), &(c.Count))
+	return c, err
+}
+
+//CreateCart creates a new Cart with the given fields (ID is ignored and created) and returns its ID, or an error if one occurred
+func (s *TxStore) CreateCart(ctx context.Context, cart *Cart) (id int64, err error) {
+	tx := s.tx
+
+	if err = cart.Validate(ctx, s); err != nil {
+		return 0, &Error{Description: "Could not validate Cart", Type: ErrorTypeUser, Err: err}
+	}
+
+	if err = s.CheckLocationPermission(ctx, cart.Location); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO cart(number, location, capacity) VALUES(?, ?, ?);", cart.Number, cart.Location, nullID(cart.Capacity))
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			dup, newErr := s.ReadCartByNumber(ctx, cart.Number)
+			if newErr != nil {
+				return 0, newErr
+			}
+			return 0, &Error{Description: "Could not insert Cart", Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+		}
+		return 0, &Error{Description: "Could not insert Cart", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: "Could not fetch Cart id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return id, nil
+}
+
+//ReadCart returns the Cart with the given id, or an error if one occurred
+func (s *TxStore) ReadCart(ctx context.Context, id int64) (*Cart, error) {
+	tx := s.tx
+
+	cart, err := scanCart(tx.QueryRowContext(ctx, cartSelectSQL+" WHERE c.id=? GROUP BY c.id;", id))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return cart, nil
+}
+
+//ReadCartByNumber returns the Cart with the given number, or an error if one occurred
+func (s *TxStore) ReadCartByNumber(ctx context.Context, number string) (*Cart, error) {
+	tx := s.tx
+
+	cart, err := scanCart(tx.QueryRowContext(ctx, cartSelectSQL+" WHERE c.number=? GROUP BY c.id;", number))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query CartByNumber(%s)", number), Type: ErrorTypeServer, Err: err}
+	}
+
+	return cart, nil
+}
+
+//ReadCarts returns all Carts at the Locations the request User may access, or an error if one occurred
+func (s *TxStore) ReadCarts(ctx context.Context) ([]*Cart, error) {
+	tx := s.tx
+
+	scope, parameters, err := s.locationScope(ctx, "c.location")
+	if err != nil {
+		return nil, err
+	}
+
+	if scope != "" {
+		scope = "WHERE " + scope
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("%s %s GROUP BY c.id ORDER BY c.number;", cartSelectSQL, scope), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query Carts", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	carts := []*Cart{}
+
+	for rows.Next() {
+		c, err := scanCart(rows)
+		if err != nil {
+			return nil, &Error{Description: "Could not scan Cart row", Type: ErrorTypeServer, Err: err}
+		}
+
+		carts = append(carts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan Cart rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return carts, nil
+}
+
+//UpdateCart updates the fields for the given Cart (using the ID field), or returns an error if one occurred
+func (s *TxStore) UpdateCart(ctx context.Context, cart *Cart) error {
+	tx := s.tx
+
+	if err := cart.Validate(ctx, s); err != nil {
+		return &Error{Description: "Could not validate Cart", Type: ErrorTypeUser, Err: err}
+	}
+
+	oldCart, err := s.ReadCart(ctx, cart.ID)
+	if err != nil {
+		return err
+	}
+	if oldCart == nil {
+		return &Error{Description: "Could not update Cart", Type: ErrorTypeUser, Err: fmt.Errorf("cart (%d) does not exist", cart.ID)}
+	}
+
+	if err = s.CheckLocationPermission(ctx, oldCart.Location); err != nil {
+		return err
+	}
+
+	if err = s.CheckLocationPermission(ctx, cart.Location); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE cart SET number=?, location=?, capacity=? WHERE id=?;", cart.Number, cart.Location, nullID(cart.Capacity), cart.ID)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			dup, newErr := s.ReadCartByNumber(ctx, cart.Number)
+			if newErr != nil {
+				return newErr
+			}
+			return &Error{Description: fmt.Sprintf("Could not update Cart(%d)", cart.ID), Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+		}
+		return &Error{Description: fmt.Sprintf("Could not update Cart(%d)", cart.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//DeleteCart deletes the Cart with the given id, or returns an error if one occurred. Devices in the Cart are removed from it
+func (s *TxStore) DeleteCart(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	cart, err := s.ReadCart(ctx, id)
+	if err != nil || cart == nil {
+		return err
+	}
+
+	if err = s.CheckLocationPermission(ctx, cart.Location); err != nil {
+		return err
+	}
+
+	if err = s.UpdateCartDevices(ctx, id, nil); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM cart WHERE id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//readCartDeviceIDs returns the ids of the Devices in the Cart with the given id
+func (s *TxStore) readCartDeviceIDs(ctx context.Context, id int64) ([]int64, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM device WHERE cart_id=? AND deleted_at IS NULL ORDER BY id;", id)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query Devices for Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var deviceID int64
+		if err = rows.Scan(&deviceID); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan Device row for Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+		ids = append(ids, deviceID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan Device rows for Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return ids, nil
+}
+
+//ReadCartDevices returns the Devices (with Model populated) in the Cart with the given id, or an error if one occurred
+func (s *TxStore) ReadCartDevices(ctx context.Context, id int64) ([]*Device, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT d.id, d.serial_number, d.asset_tag, m.id, m.manufacturer, m.model, d.status, d.location FROM device AS d JOIN model AS m ON d.model_id = m.id WHERE d.cart_id=? AND d.deleted_at IS NULL ORDER BY d.id;", id)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query Devices for Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	devices := []*Device{}
+
+	for rows.Next() {
+		d := &Device{Model: new(Model)}
+		var assetTag sql.NullString
+		if err = rows.Scan(&(d.ID), &(d.SerialNumber), &assetTag, &(d.Model.ID), &(d.Model.Manufacturer), &(d.Model.Model), &(d.Status), &(d.Location)); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan Device row for Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+		d.AssetTag = assetTag.String
+
+		devices = append(devices, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan Device rows for Cart(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return devices, nil
+}
+
+//setDeviceCart moves the Device with the given id into the Cart with the given number (or out of its Cart if number is empty)
+//and records a Modified Event
+func (s *TxStore) setDeviceCart(ctx context.Context, deviceID int64, cartID int64, oldNumber, newNumber string) error {
+	tx := s.tx
+
+	if err := s.CheckDevicePermission(ctx, deviceID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE device SET cart_id=? WHERE id=?;", nullID(cartID), deviceID); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update Cart for Device(%d)", deviceID), Type: ErrorTypeServer, Err: err}
+	}
+
+	c := &ModifiedContent{Fields: []*ModifiedField{
+		&ModifiedField{Name: "cart", OldValue: oldNumber, NewValue: newNumber},
+	}}
+	if _, err := s.CreateModifiedEvent(ctx, deviceID, DeviceEventLocation, c); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not created Modified Event Device(%d)", deviceID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//UpdateCartDevices sets the Devices in the Cart with the given id to the given Device ids, moving them out of any other Cart,
+//or returns an error if one occurred. A Modified Event is created for each Device added or removed, all in one EventBatch
+func (s *TxStore) UpdateCartDevices(ctx context.Context, id int64, deviceIDs []int64) error {
+	tx := s.tx
+	ctx = withEventBatch(ctx, fmt.Sprintf("Update devices in cart %d", id))
+
+	cart, err := s.ReadCart(ctx, id)
+	if err != nil {
+		return err
+	}
+	if cart == nil {
+		return &Error{Description: "Could not update Cart Devices", Type: ErrorTypeUser, Err: fmt.Errorf("cart (%d) does not exist", id)}
+	}
+
+	if err = s.CheckLocationPermission(ctx, cart.Location); err != nil {
+		return err
+	}
+
+	keep := make(map[int64]bool)
+	for _, deviceID := range deviceIDs {
+		keep[deviceID] = true
+	}
+
+	if cart.Capacity > 0 && int64(len(keep)) > cart.Capacity {
+		return &Error{Description: "Could not update Cart Devices", Type: ErrorTypeUser,
+			Err: fmt.Errorf("cart (%s) holds at most %d devices", cart.Number, cart.Capacity)}
+	}
+
+	current, err := s.readCartDeviceIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[int64]bool)
+	for _, deviceID := range current {
+		existing[deviceID] = true
+		if !keep[deviceID] {
+			if err = s.setDeviceCart(ctx, deviceID, 0, cart.Number, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, deviceID := range deviceIDs {
+		if existing[deviceID] {
+			continue
+		}
+		existing[deviceID] = true
+
+		var oldNumber sql.NullString
+		row := tx.QueryRowContext(ctx, "SELECT c.number FROM device AS d LEFT JOIN cart AS c ON d.cart_id = c.id WHERE d.id=?;", deviceID)
+		err = row.Scan(&oldNumber)
+
+		switch {
+		case err == sql.ErrNoRows:
+			return &Error{Description: "Could not update Cart Devices", Type: ErrorTypeUser, Err: fmt.Errorf("device (%d) does not exist", deviceID)}
+		case err != nil:
+			return &Error{Description: fmt.Sprintf("Could not query Cart for Device(%d)", deviceID), Type: ErrorTypeServer, Err: err}
+		}
+
+		if err = s.setDeviceCart(ctx, deviceID, id, oldNumber.String, cart.Number); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//UpdateCartStatus sets the Status of every Device in the Cart with the given id, or returns an error if one occurred.
+//A Modified Event is created for each Device that changed, all in one EventBatch
+func (s *TxStore) UpdateCartStatus(ctx context.Context, id int64, status Status) error {
+	ctx = withEventBatch(ctx, fmt.Sprintf("Set status of devices in cart %d to %s", id, status))
+
+	ids, err := s.readCartDeviceIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, deviceID := range ids {
+		device, err := s.ReadDevice(ctx, deviceID, false)
+		if err != nil {
+			return err
+		}
+
+		if device.Status == status {
+			continue
+		}
+
+		device.Status = status
+		if err = s.UpdateDevice(ctx, device); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//CartReconciliation compares a Cart's contents to what is expected: Devices not at the Cart's home Location are Misplaced.
+//Statuses counts the Cart's Devices by Status
+type CartReconciliation struct {
+	Cart         *Cart            `json:"cart"`
+	OverCapacity bool             `json:"over_capacity"`
+	Misplaced    []*Device        `json:"misplaced"`
+	Statuses     map[Status]int64 `json:"statuses"`
+}
+
+//ReadCartReconciliations returns a CartReconciliation for every Cart the request User may access, or an error if one occurred
+func (s *TxStore) ReadCartReconciliations(ctx context.Context) ([]*CartReconciliation, error) {
+	carts, err := s.ReadCarts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recs := make([]*CartReconciliation, 0, len(carts))
+
+	for _, c := range carts {
+		devices, err := s.ReadCartDevices(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		rec := &CartReconciliation{
+			Cart:         c,
+			OverCapacity: c.Capacity > 0 && c.Count > c.Capacity,
+			Misplaced:    []*Device{},
+			Statuses:     make(map[Status]int64),
+		}
+
+		for _, d := range devices {
+			rec.Statuses[d.Status]++
+			if d.Location != c.Location {
+				rec.Misplaced = append(rec.Misplaced, d)
+			}
+		}
+
+		recs = append(recs, rec)
+	}
+
+	return recs, nil
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//Category represents a model category (e.g. Laptop, Tablet, Projector)
+type Category struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+//Validate cleans and validates the given Category
+func (c *Category) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+
+	return ValidateString("name", c.Name, 255)
+}
+
+//CreateCategory creates a new Category with the given fields (ID is ignored and created) and returns its ID, or an error if one occurred
+func (s *TxStore) CreateCategory(ctx context.Context, category *Category) (id int64, err error) {
+	tx := s.tx
+
+	if err = category.Validate(); err != nil {
+		return 0, &Error{Description: "Could not validate Category", Type: ErrorTypeUser, Err: err}
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO category(name) VALUES(?);", category.Name)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			dup, newErr := s.ReadCategoryByName(ctx, category.Name)
+			if newErr != nil {
+				return 0, newErr
+			}
+			return 0, &Error{Description: "Could not insert Category", Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+		}
+		return 0, &Error{Description: "Could not insert Category", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: "Could not fetch Category id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return id, nil
+}
+
+//ReadCategory returns the Category with the given id, or an error if one occurred.
+func (s *TxStore) ReadCategory(ctx context.Context, id int64) (*Category, error) {
+	tx := s.tx
+
+	category := &Category{ID: id}
+
+	row := tx.QueryRowContext(ctx, "SELECT name FROM category WHERE id=?", id)
+	err := row.Scan(&(category.Name))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query Category(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return category, nil
+}
+
+//ReadCategoryByName returns the Category with the given name, or an error if one occurred.
+func (s *TxStore) ReadCategoryByName(ctx context.Context, name string) (*Category, error) {
+	tx := s.tx
+
+	category := &Category{Name: name}
+
+	row := tx.QueryRowContext(ctx, "SELECT id FROM category WHERE name=?", name)
+	err := row.Scan(&(category.ID))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query CategoryByName(%s)", name), Type: ErrorTypeServer, Err: err}
+	}
+
+	return category, nil
+}
+
+//ReadCategories returns all Categories, or an error if one occurred
+func (s *TxStore) ReadCategories(ctx context.Context) ([]*Category, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, name FROM category ORDER BY name;")
+	if err != nil {
+		return nil, &Error{Description: "Could not query Categories", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var categories []*Category
+
+	for rows.Next() {
+		c := new(Category)
+		err = rows.Scan(&(c.ID), &(c.Name))
+		if err != nil {
+			return nil, &Error{Description: "Could not scan Category row", Type: ErrorTypeServer, Err: err}
+		}
+
+		categories = append(categories, c)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, &Error{Description: "Could not scan Category rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return categories, nil
+}
+
+//UpdateCategory updates the fields for the given Category (using the ID field), or returns an error if one occurred
+func (s *TxStore) UpdateCategory(ctx context.Context, category *Category) error {
+	tx := s.tx
+
+	if err := category.Validate(); err != nil {
+		return &Error{Description: "Could not validate Category", Type: ErrorTypeUser, Err: err}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE category SET name=? WHERE id=?;", category.Name, category.ID)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			dup, newErr := s.ReadCategoryByName(ctx, category.Name)
+			if newErr != nil {
+				return newErr
+			}
+			return &Error{Description: fmt.Sprintf("Could not update Category(%d)", category.ID), Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+		}
+		return &Error{Description: fmt.Sprintf("Could not update Category(%d)", category.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	//cached Models embed their Category
+	requestCache(ctx).Flush()
+
+	return nil
+}
+
+//DeleteCategory deletes the Category with the given id, or returns an error if one occurred.
+//Models in the Category become uncategorized.
+func (s *TxStore) DeleteCategory(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "UPDATE model SET category_id=NULL WHERE category_id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not uncategorize Models for Category(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM category WHERE id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Category(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	//cached Models embed their Category
+	requestCache(ctx).Flush()
+
+	return nil
+}
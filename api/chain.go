@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//Device Events are hash chained: each Event stores the hash of the Event before it (prev_hash) and a hash of its own fields and prev_hash.
+//Changing, removing, or reordering a chained Event breaks the chain at the next Event, and removing the newest Events is detected
+//by comparing the last Event with the chain head in event_chain. Archived Events keep their hashes, so the chain spans device_log and
+//device_log_archive. Events created before the chain was added aren't chained
+
+//chainedEventFields are the Event fields covered by an Event's hash
+type chainedEventFields struct {
+	PrevHash       string `json:"prev_hash"`
+	DeviceID       int64  `json:"device_id"`
+	UserID         int64  `json:"user_id"`
+	Date           int64  `json:"date"`
+	Type           string `json:"type"`
+	Content        string `json:"content"`
+	Source         string `json:"source"`
+	ConversationID string `json:"source_conversation_id"`
+	BatchID        int64  `json:"batch_id"`
+}
+
+//hash returns the hex encoded SHA-256 hash of the fields
+func (f *chainedEventFields) hash() (string, error) {
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+//chainEvent locks the event chain head until the transaction ends, so Events are chained one at a time,
+//and returns the hash of the last chained Event (empty if there isn't one) and the hash for the given Event for the Device with the given id,
+//or an error if one occurred
+func (s *TxStore) chainEvent(ctx context.Context, deviceID int64, event *Event, content []byte) (prevHash, hash string, err error) {
+	tx := s.tx
+
+	var last sql.NullString
+	if err = tx.QueryRowContext(ctx, "SELECT hash FROM event_chain WHERE id=1 FOR UPDATE;").Scan(&last); err != nil {
+		return "", "", &Error{Description: "Could not query event chain", Type: ErrorTypeServer, Err: err}
+	}
+
+	var source string
+	var conversationID string
+	if event.Source != nil {
+		source, conversationID = event.Source.Type, event.Source.ConversationID
+	}
+
+	fields := &chainedEventFields{
+		PrevHash:       last.String,
+		DeviceID:       deviceID,
+		UserID:         event.UserID,
+		Date:           event.Date.Unix(),
+		Type:           event.Type,
+		Content:        string(content),
+		Source:         source,
+		ConversationID: conversationID,
+		BatchID:        event.BatchID,
+	}
+
+	if hash, err = fields.hash(); err != nil {
+		return "", "", &Error{Description: "Could not hash event", Type: ErrorTypeServer, Err: err}
+	}
+
+	return last.String, hash, nil
+}
+
+//advanceEventChain sets the Event with the given id and hash as the event chain head, or returns an error if one occurred
+func (s *TxStore) advanceEventChain(ctx context.Context, eventID int64, hash string) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "UPDATE event_chain SET first_id=IFNULL(first_id, ?), last_id=?, hash=? WHERE id=1;", eventID, eventID, hash); err != nil {
+		return &Error{Description: "Could not update event chain", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//EventChainVerification is the result of verifying part of the event hash chain.
+//Checked Events were verified, ending with LastID and LastHash; pass LastID as after to continue verifying from there.
+//Complete is true if LastID is the chain head (HeadID and HeadHash). If Valid is false, BrokenID is the first Event that failed and Reason says why.
+//Auditors can record HeadHash and check later that it's still part of the chain
+type EventChainVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	LastID   int64  `json:"last_id,omitempty"`
+	LastHash string `json:"last_hash,omitempty"`
+	Complete bool   `json:"complete"`
+	HeadID   int64  `json:"head_id,omitempty"`
+	HeadHash string `json:"head_hash,omitempty"`
+	BrokenID int64  `json:"broken_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+//VerifyEventChain verifies at most limit chained Device Events (including archived Events) after the Event with the given id
+//(0 to start at the beginning of the chain) and returns the result, or an error if one occurred
+func (s *TxStore) VerifyEventChain(ctx context.Context, after int64, limit int) (*EventChainVerification, error) {
+	tx := s.tx
+
+	v := &EventChainVerification{Valid: true}
+
+	var firstID, headID sql.NullInt64
+	var headHash sql.NullString
+	if err := tx.QueryRowContext(ctx, "SELECT first_id, last_id, hash FROM event_chain WHERE id=1;").Scan(&firstID, &headID, &headHash); err != nil {
+		return nil, &Error{Description: "Could not query event chain", Type: ErrorTypeServer, Err: err}
+	}
+	v.HeadID, v.HeadHash = headID.Int64, headHash.String
+
+	if !firstID.Valid {
+		v.Complete = true
+		return v, nil
+	}
+
+	const events = allEventsTable + " AS e"
+
+	//prevHash is the hash the next Event must have as its prev_hash
+	var prevHash string
+	if after != 0 {
+		var hash sql.NullString
+		switch err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT hash FROM %s WHERE id=?;", events), after).Scan(&hash); {
+		case err == sql.ErrNoRows || (err == nil && !hash.Valid):
+			return nil, &Error{Description: "Could not verify event chain", Type: ErrorTypeUser, Err: fmt.Errorf("event (%d) is not chained", after)}
+		case err != nil:
+			return nil, &Error{Description: fmt.Sprintf("Could not query Event(%d)", after), Type: ErrorTypeServer, Err: err}
+		}
+		prevHash = hash.String
+		v.LastID, v.LastHash = after, prevHash
+	} else {
+		after = firstID.Int64 - 1
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, device_id, user_id, date, type, content, source, source_conversation_id, batch_id, prev_hash, hash FROM %s WHERE id > ? ORDER BY id LIMIT ?;", events), after, limit)
+	if err != nil {
+		return nil, &Error{Description: "Could not query chained Events", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	broken := func(id int64, reason string) {
+		v.Valid = false
+		v.BrokenID = id
+		v.Reason = reason
+	}
+
+	for rows.Next() {
+		var id int64
+		var userID, batchID sql.NullInt64
+		var sourceType, conversationID, eventPrevHash, hash sql.NullString
+		var date time.Time
+		var content []byte
+		f := new(chainedEventFields)
+
+		if err := rows.Scan(&id, &(f.DeviceID), &userID, &date, &(f.Type), &content, &sourceType, &conversationID, &batchID, &eventPrevHash, &hash); err != nil {
+			return nil, &Error{Description: "Could not scan chained Event row", Type: ErrorTypeServer, Err: err}
+		}
+		f.PrevHash = eventPrevHash.String
+		f.UserID = userID.Int64
+		f.Date = date.Unix()
+		f.Content = string(content)
+		f.Source = sourceType.String
+		f.ConversationID = conversationID.String
+		f.BatchID = batchID.Int64
+
+		if !hash.Valid {
+			broken(id, "event is not chained")
+			break
+		}
+		if f.PrevHash != prevHash {
+			broken(id, "previous hash doesn't match the previous event; an event was changed, removed, or inserted before it")
+			break
+		}
+
+		sum, err := f.hash()
+		if err != nil {
+			return nil, &Error{Description: "Could not hash chained Event", Type: ErrorTypeServer, Err: err}
+		}
+		if sum != hash.String {
+			broken(id, "hash doesn't match the event; the event was changed")
+			break
+		}
+
+		prevHash = hash.String
+		v.Checked++
+		v.LastID, v.LastHash = id, prevHash
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan chained Event rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	if v.Valid && v.Checked < limit {
+		//every Event after after was checked, so the last one must be the head
+		if v.LastID != v.HeadID || v.LastHash != v.HeadHash {
+			broken(v.HeadID, "last event doesn't match the chain head; events were removed from the end of the chain")
+		} else {
+			v.Complete = true
+		}
+	}
+
+	return v, nil
+}
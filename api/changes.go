@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+//DeviceChange types
+const (
+	DeviceChangeCreated = "created"
+	DeviceChangeUpdated = "updated"
+	DeviceChangeDeleted = "deleted"
+)
+
+//DeviceChange represents a Device that was created, updated, or deleted since a cursor. Date is the time of the latest change
+type DeviceChange struct {
+	DeviceID int64     `json:"device_id"`
+	Type     string    `json:"type"`
+	Date     time.Time `json:"date"`
+}
+
+//DeviceChanges represents a page of DeviceChanges. Cursor should be passed to the next call.
+//If More is true, there are more changes after Cursor
+type DeviceChanges struct {
+	Changes []*DeviceChange `json:"changes"`
+	Cursor  string          `json:"cursor"`
+	More    bool            `json:"more"`
+}
+
+//ParseDeviceChangesCursor parses a cursor returned in DeviceChanges. An empty cursor starts at the beginning
+func ParseDeviceChangesCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("cursor (%s) must be a cursor returned by a previous call", cursor)
+	}
+
+	return id, nil
+}
+
+//ReadDeviceChanges returns the Devices changed after the given cursor, examining at most limit Events, or an error if one occurred.
+//Changes are ordered by when they happened and restricted to the Locations the request User may access
+func (s *TxStore) ReadDeviceChanges(ctx context.Context, cursor int64, limit int) (*DeviceChanges, error) {
+	tx := s.tx
+
+	permitted, err := s.readPermittedLocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed map[Location]bool
+	if permitted != nil {
+		allowed = make(map[Location]bool)
+		for _, l := range permitted {
+			allowed[l] = true
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT e.id, e.device_id, e.date, e.type, d.location FROM device_log AS e JOIN device AS d ON e.device_id = d.id WHERE e.id > ? ORDER BY e.id LIMIT ?;", cursor, limit)
+	if err != nil {
+		return nil, &Error{Description: "Could not query DeviceChanges", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	changes := &DeviceChanges{Changes: []*DeviceChange{}}
+	byDevice := make(map[int64]*DeviceChange)
+	last := cursor
+	count := 0
+
+	for rows.Next() {
+		var (
+			id, deviceID int64
+			date         time.Time
+			typ          string
+			location     Location
+		)
+
+		if err = rows.Scan(&id, &deviceID, &date, &typ, &location); err != nil {
+			return nil, &Error{Description: "Could not scan DeviceChange row", Type: ErrorTypeServer, Err: err}
+		}
+
+		last = id
+		count++
+
+		if allowed != nil && !allowed[location] {
+			continue
+		}
+
+		c, ok := byDevice[deviceID]
+		if !ok {
+			c = &DeviceChange{DeviceID: deviceID, Type: DeviceChangeUpdated}
+			byDevice[deviceID] = c
+			changes.Changes = append(changes.Changes, c)
+		}
+
+		switch typ {
+		case "created":
+			c.Type = DeviceChangeCreated
+		case "deleted":
+			c.Type = DeviceChangeDeleted
+		case "restored":
+			c.Type = DeviceChangeUpdated
+		}
+		c.Date = date
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan DeviceChange rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	changes.Cursor = strconv.FormatInt(last, 10)
+	changes.More = count == limit
+
+	return changes, nil
+}
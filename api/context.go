@@ -2,8 +2,17 @@ package api
 
 type contextKey int
 
-//TransactionKey is the context key for the database transaction for a request
-const TransactionKey contextKey = 0
-
 //UserKey is the context key for the user for a request
 const UserKey contextKey = 1
+
+//CacheKey is the context key for the RequestCache for a request. If not set, caching is disabled
+const CacheKey contextKey = 3
+
+//FeedKey is the context key for the RequestFeed for a request. If not set, FeedEvents aren't published
+const FeedKey contextKey = 4
+
+//SourceKey is the context key for the EventSource for a request. If not set, Events are created without a source
+const SourceKey contextKey = 5
+
+//BatchKey is the context key for the EventBatch Events are being added to. If not set, Events aren't part of a batch
+const BatchKey contextKey = 6
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+//Period is the length of time report counts are grouped by
+type Period string
+
+//Periods
+const (
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+)
+
+//maxReportPeriods is the most Periods a report date range may be split into
+const maxReportPeriods = 366
+
+//start returns the start of the Period containing t, in the server's time zone. Weeks start on Monday
+func (p Period) start(t time.Time) time.Time {
+	t = t.In(time.Local)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+
+	switch p {
+	case PeriodWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+	}
+	return day
+}
+
+//next returns the start of the Period after the one starting at start
+func (p Period) next(start time.Time) time.Time {
+	switch p {
+	case PeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+//periodStarts returns the starts of the Periods overlapping the date range (since inclusive, until exclusive),
+//or an error if the Period is invalid or the range is empty or has more than maxReportPeriods Periods
+func periodStarts(p Period, since, until time.Time) ([]time.Time, error) {
+	if p != PeriodDay && p != PeriodWeek && p != PeriodMonth {
+		return nil, &Error{Description: "Could not validate period", Type: ErrorTypeUser, Err: fmt.Errorf("period (%s) must be %s, %s, or %s", p, PeriodDay, PeriodWeek, PeriodMonth)}
+	}
+	if !since.Before(until) {
+		return nil, &Error{Description: "Could not validate date range", Type: ErrorTypeUser, Err: fmt.Errorf("since (%s) must be before until (%s)", since.Format("2006-01-02"), until.Format("2006-01-02"))}
+	}
+
+	var starts []time.Time
+	for t := p.start(since); t.Before(until); t = p.next(t) {
+		if len(starts) == maxReportPeriods {
+			return nil, &Error{Description: "Could not validate date range", Type: ErrorTypeUser, Err: fmt.Errorf("date range has more than %d %ss", maxReportPeriods, p)}
+		}
+		starts = append(starts, t)
+	}
+
+	return starts, nil
+}
+
+//Contributions represents the Device Events a User created in a Period, starting at Start.
+//StatusChanges are the Modified Events that changed a Device's Status; Changes are all Modified Events, including StatusChanges
+type Contributions struct {
+	Start          time.Time `json:"start"`
+	DevicesCreated int       `json:"devices_created"`
+	NotesAdded     int       `json:"notes_added"`
+	StatusChanges  int       `json:"status_changes"`
+	Changes        int       `json:"changes"`
+}
+
+//add adds the Event with the given type and content
+func (c *Contributions) add(typ string, content []byte) {
+	switch typ {
+	case "created":
+		c.DevicesCreated++
+	case "note":
+		c.NotesAdded++
+	case "modified":
+		c.Changes++
+		if _, ok := eventStatus(typ, content); ok {
+			c.StatusChanges++
+		}
+	}
+}
+
+//UserContributions represents a User's Contributions in each Period of a ContributionReport, and their Total (starting at the report's Since).
+//UserID is 0 if the Events were recorded without a User
+type UserContributions struct {
+	UserID   int64            `json:"user_id,omitempty"`
+	UserName string           `json:"user_name"`
+	Total    *Contributions   `json:"total"`
+	Periods  []*Contributions `json:"periods"`
+}
+
+//ContributionReport represents the Device Events each User created in a date range (Since inclusive, Until exclusive), grouped by Period.
+//Users are sorted by their total number of Events, most first
+type ContributionReport struct {
+	Period Period               `json:"period"`
+	Since  time.Time            `json:"since"`
+	Until  time.Time            `json:"until"`
+	Users  []*UserContributions `json:"users"`
+}
+
+//ReadContributionReport returns a ContributionReport for the given Period and date range, or an error if one occurred.
+//Events are restricted to Devices in the Locations the request User may access. Archived Events are counted
+func (s *TxStore) ReadContributionReport(ctx context.Context, period Period, since, until time.Time) (*ContributionReport, error) {
+	tx := s.tx
+
+	starts, err := periodStarts(period, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := []interface{}{since, until}
+	where := "WHERE e.type IN ('created', 'note', 'modified') AND e.date >= ? AND e.date < ?"
+
+	scope, scopeParameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		where += " AND " + scope
+		parameters = append(parameters, scopeParameters...)
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT e.user_id, IFNULL(u.name, IFNULL(e.user_name, '')), e.date, e.type, e.content FROM %s AS e JOIN device AS d ON e.device_id = d.id LEFT JOIN user AS u ON e.user_id = u.id %s;", allEventsTable, where), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query ContributionReport events", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	//Period indexes by start
+	index := make(map[int64]int, len(starts))
+	for i, t := range starts {
+		index[t.Unix()] = i
+	}
+
+	//Events recorded without a User are grouped by the recorded name
+	type userKey struct {
+		id   int64
+		name string
+	}
+	users := make(map[userKey]*UserContributions)
+
+	for rows.Next() {
+		var (
+			userID  sql.NullInt64
+			name    string
+			date    time.Time
+			typ     string
+			content []byte
+		)
+
+		if err = rows.Scan(&userID, &name, &date, &typ, &content); err != nil {
+			return nil, &Error{Description: "Could not scan ContributionReport event row", Type: ErrorTypeServer, Err: err}
+		}
+
+		key := userKey{id: userID.Int64}
+		if !userID.Valid {
+			key.name = name
+		}
+
+		u, ok := users[key]
+		if !ok {
+			u = &UserContributions{UserID: userID.Int64, UserName: name, Total: &Contributions{Start: since}, Periods: make([]*Contributions, len(starts))}
+			for i, t := range starts {
+				u.Periods[i] = &Contributions{Start: t}
+			}
+			users[key] = u
+		}
+
+		u.Total.add(typ, content)
+		u.Periods[index[period.start(date).Unix()]].add(typ, content)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan ContributionReport event rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	report := &ContributionReport{Period: period, Since: since, Until: until, Users: []*UserContributions{}}
+	for _, u := range users {
+		report.Users = append(report.Users, u)
+	}
+
+	total := func(c *Contributions) int {
+		return c.DevicesCreated + c.NotesAdded + c.Changes
+	}
+	sort.Slice(report.Users, func(i, j int) bool {
+		ti, tj := total(report.Users[i].Total), total(report.Users[j].Total)
+		if ti != tj {
+			return ti > tj
+		}
+		return report.Users[i].UserName < report.Users[j].UserName
+	})
+
+	return report, nil
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//cronSearchYears is how far ahead CronSchedule.Next searches for a matching time
+const cronSearchYears = 5
+
+//cronMacros are the supported shorthand cron expressions
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+//cronField is the range of a cron expression field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+//CronSchedule is a parsed cron expression: minute, hour, day of month, month, and day of week (0 or 7 is Sunday).
+//Fields may be *, a number, a range (a-b), or a comma separated list of them, each optionally followed by a step (/n).
+//If both day fields are restricted, a time matches if either matches. Times are in the server's time zone
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+//ParseCronSchedule parses the given cron expression or one of @hourly, @daily, @weekly, @monthly, or @yearly,
+//or returns an error if it's invalid
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if m, ok := cronMacros[spec]; ok {
+		spec = m
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("schedule (%s) must have %d fields", spec, len(cronFields))
+	}
+
+	bits := make([]uint64, len(parts))
+	for i, p := range parts {
+		b, err := parseCronField(p, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+
+	c := &CronSchedule{minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4], domStar: parts[2] == "*", dowStar: parts[4] == "*"}
+
+	//7 is also Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	return c, nil
+}
+
+//parseCronField returns the values in the given field as a bitset, or an error if it's invalid
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i != -1 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("%s step (%s) must be a positive number", f.name, part[i+1:])
+			}
+			rng, step = part[:i], s
+		}
+
+		start, end := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err error
+			if start, err = parseCronValue(rng[:i], f); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(rng[i+1:], f); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("%s range (%s) must not be reversed", f.name, rng)
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rng, f); err != nil {
+				return 0, err
+			}
+			//a single value with a step runs until the end of the range
+			if step == 1 {
+				end = start
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+//parseCronValue parses a single value in the given field, or returns an error if it's invalid
+func parseCronValue(value string, f cronField) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s (%s) must be a number", f.name, value)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s (%d) must be between %d and %d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+//matchesDay returns true if the day of t matches the day of month and day of week fields
+func (c *CronSchedule) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+//Next returns the first matching time after t, or the zero time if none matches within cronSearchYears years
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	t = t.In(time.Local)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, time.Local)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.Local)
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.Local)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.Local)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
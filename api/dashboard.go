@@ -0,0 +1,388 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/query"
+)
+
+//DashboardWidgetTypes
+const (
+	DashboardWidgetCount    = "count"
+	DashboardWidgetTop      = "top"
+	DashboardWidgetActivity = "activity"
+	DashboardWidgetAlerts   = "alerts"
+)
+
+//Dashboard limits
+const (
+	MaxDashboardWidgets       = 20
+	DefaultDashboardItems     = 10
+	MaxDashboardItems         = 50
+	maxDashboardWidgetsLength = 64 * 1024
+)
+
+//DashboardWidget is a widget on a User's Dashboard:
+//count counts Entity rows (device, model, or event) matching Filter (see ReportDefinition);
+//top lists the Limit most common values of Field for Entity rows matching Filter;
+//activity lists the Limit latest Device Events;
+//alerts lists over capacity Locations, Models past their end-of-life or end-of-support dates, and, if Status is set,
+//Devices in Status for more than Days days
+type DashboardWidget struct {
+	Type   string               `json:"type"`
+	Title  string               `json:"title"`
+	Entity string               `json:"entity,omitempty"`
+	Filter *query.ParameterTree `json:"filter,omitempty"`
+	Field  string               `json:"field,omitempty"`
+	Limit  int                  `json:"limit,omitempty"`
+	Status Status               `json:"status,omitempty"`
+	Days   int                  `json:"days,omitempty"`
+}
+
+//DefaultDashboardWidgets returns the widgets for Users who haven't configured their Dashboard
+func DefaultDashboardWidgets() []*DashboardWidget {
+	return []*DashboardWidget{
+		{Type: DashboardWidgetCount, Title: "Devices", Entity: "device"},
+		{Type: DashboardWidgetTop, Title: "Devices by status", Entity: "device", Field: "status", Limit: DefaultDashboardItems},
+		{Type: DashboardWidgetTop, Title: "Devices by location", Entity: "device", Field: "location", Limit: DefaultDashboardItems},
+		{Type: DashboardWidgetActivity, Title: "Recent activity", Limit: DefaultDashboardItems},
+		{Type: DashboardWidgetAlerts, Title: "Alerts"},
+	}
+}
+
+//report returns the ReportDefinition for a count or top DashboardWidget
+func (w *DashboardWidget) report() *ReportDefinition {
+	def := &ReportDefinition{Entity: w.Entity, Filter: w.Filter}
+	if w.Type == DashboardWidgetTop {
+		def.GroupBy = []string{w.Field}
+		def.Sort = []*ReportSort{{Column: "count", Sort: query.SortDescending}}
+		def.Limit = w.Limit
+	}
+	return def
+}
+
+//Validate cleans and validates the given DashboardWidget
+func (w *DashboardWidget) Validate() error {
+	w.Title = normalizeSpace(w.Title)
+	if err := ValidateString("title", w.Title, 255); err != nil {
+		return err
+	}
+
+	validateLimit := func() error {
+		if w.Limit == 0 {
+			w.Limit = DefaultDashboardItems
+		}
+		if w.Limit < 1 || w.Limit > MaxDashboardItems {
+			return fieldError("limit", "invalid_limit", "limit (%d) must be between 1 and %d", w.Limit, MaxDashboardItems)
+		}
+		return nil
+	}
+
+	switch w.Type {
+	case DashboardWidgetCount, DashboardWidgetTop:
+		if w.Type == DashboardWidgetTop {
+			if err := validateLimit(); err != nil {
+				return err
+			}
+		} else {
+			w.Field, w.Limit = "", 0
+		}
+		w.Status, w.Days = "", 0
+
+		entity, ok := reportEntities[w.Entity]
+		if !ok {
+			return fieldError("entity", "invalid_entity", "entity (%s) must be device, model, or event", w.Entity)
+		}
+		q := &reportQuery{entity: entity}
+		if _, _, err := q.build(w.report(), "", nil); err != nil {
+			return err
+		}
+	case DashboardWidgetActivity:
+		w.Entity, w.Filter, w.Field, w.Status, w.Days = "", nil, "", "", 0
+		return validateLimit()
+	case DashboardWidgetAlerts:
+		w.Entity, w.Filter, w.Field, w.Limit = "", nil, "", 0
+		if w.Status == "" {
+			w.Days = 0
+		} else if w.Days < 1 {
+			return fieldError("days", "invalid_days", "days (%d) must be at least 1 when status is set", w.Days)
+		}
+	default:
+		return fieldError("type", "invalid_type", "type (%s) must be %s, %s, %s, or %s", w.Type, DashboardWidgetCount, DashboardWidgetTop, DashboardWidgetActivity, DashboardWidgetAlerts)
+	}
+
+	return nil
+}
+
+//ReadDashboardWidgets returns the DashboardWidgets for the User with the given id (DefaultDashboardWidgets if they haven't configured any),
+//or an error if one occurred
+func (s *TxStore) ReadDashboardWidgets(ctx context.Context, userID int64) ([]*DashboardWidget, error) {
+	tx := s.tx
+
+	var buf []byte
+	err := tx.QueryRowContext(ctx, "SELECT widgets FROM user_dashboard WHERE user_id=?;", userID).Scan(&buf)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return DefaultDashboardWidgets(), nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query DashboardWidgets for User(%d)", userID), Type: ErrorTypeServer, Err: err}
+	}
+
+	var widgets []*DashboardWidget
+	if err = json.Unmarshal(buf, &widgets); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not unmarshal DashboardWidgets for User(%d)", userID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return widgets, nil
+}
+
+//UpdateDashboardWidgets replaces the DashboardWidgets for the User with the given id, or returns an error if one occurred.
+//If widgets is empty, the User gets DefaultDashboardWidgets
+func (s *TxStore) UpdateDashboardWidgets(ctx context.Context, userID int64, widgets []*DashboardWidget) error {
+	tx := s.tx
+
+	if len(widgets) == 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM user_dashboard WHERE user_id=?;", userID); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not delete DashboardWidgets for User(%d)", userID), Type: ErrorTypeServer, Err: err}
+		}
+		return nil
+	}
+
+	if len(widgets) > MaxDashboardWidgets {
+		return &Error{Description: "Could not validate DashboardWidgets", Type: ErrorTypeUser,
+			Err: fieldError("widgets", "too_many", "widgets (%d) was more than maximum allowed (%d)", len(widgets), MaxDashboardWidgets)}
+	}
+
+	for i, w := range widgets {
+		if w == nil {
+			return &Error{Description: "Could not validate DashboardWidgets", Type: ErrorTypeUser, Err: fieldError("widgets", "invalid_widget", "widget %d must not be null", i)}
+		}
+		if err := w.Validate(); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not validate DashboardWidget %d", i), Type: ErrorTypeUser, Err: err}
+		}
+	}
+
+	buf, err := json.Marshal(widgets)
+	if err != nil {
+		return &Error{Description: "Could not marshal DashboardWidgets", Type: ErrorTypeServer, Err: err}
+	}
+	if len(buf) > maxDashboardWidgetsLength {
+		return &Error{Description: "Could not validate DashboardWidgets", Type: ErrorTypeUser,
+			Err: fieldError("widgets", "too_long", "widgets length (%d) was more than maximum allowed (%d)", len(buf), maxDashboardWidgetsLength)}
+	}
+
+	if _, err = tx.ExecContext(ctx, "INSERT INTO user_dashboard(user_id, widgets, updated) VALUES(?, ?, ?) ON DUPLICATE KEY UPDATE widgets=VALUES(widgets), updated=VALUES(updated);",
+		userID, buf, time.Now(),
+	); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update DashboardWidgets for User(%d)", userID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//DashboardTopItem is a value in a top DashboardWidget and the number of rows with it
+type DashboardTopItem struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+//DashboardActivity is a recent Device Event in an activity DashboardWidget
+type DashboardActivity struct {
+	EventID      int64     `json:"event_id"`
+	DeviceID     int64     `json:"device_id"`
+	SerialNumber string    `json:"serial_number"`
+	Date         time.Time `json:"date"`
+	Type         string    `json:"type"`
+	UserName     string    `json:"user_name"`
+}
+
+//DashboardAlertTypes
+const (
+	DashboardAlertOverCapacity = "over_capacity"
+	DashboardAlertPastEOL      = "past_eol"
+	DashboardAlertPastEOS      = "past_eos"
+	DashboardAlertOverdue      = "overdue"
+)
+
+//DashboardAlert is an alert in an alerts DashboardWidget. Count is the number of Devices the alert is about
+type DashboardAlert struct {
+	Type     string   `json:"type"`
+	Message  string   `json:"message"`
+	Count    int      `json:"count"`
+	Location Location `json:"location,omitempty"`
+	ModelID  int64    `json:"model_id,omitempty"`
+	Status   Status   `json:"status,omitempty"`
+}
+
+//DashboardWidgetResult is a DashboardWidget and its data: Count for count widgets, Top for top widgets,
+//Activity for activity widgets, or Alerts for alerts widgets
+type DashboardWidgetResult struct {
+	Widget   *DashboardWidget     `json:"widget"`
+	Count    int64                `json:"count"`
+	Top      []*DashboardTopItem  `json:"top,omitempty"`
+	Activity []*DashboardActivity `json:"activity,omitempty"`
+	Alerts   []*DashboardAlert    `json:"alerts,omitempty"`
+}
+
+//Dashboard is a snapshot of every DashboardWidget on a User's Dashboard, in order
+type Dashboard struct {
+	Date    time.Time                `json:"date"`
+	Widgets []*DashboardWidgetResult `json:"widgets"`
+}
+
+//ReadDashboard returns the request User's Dashboard, or an error if one occurred.
+//Devices and Events are restricted to the Locations the request User may access
+func (s *TxStore) ReadDashboard(ctx context.Context) (*Dashboard, error) {
+	user := ctx.Value(UserKey).(*User)
+
+	widgets, err := s.ReadDashboardWidgets(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	dashboard := &Dashboard{Date: time.Now(), Widgets: make([]*DashboardWidgetResult, len(widgets))}
+
+	for i, w := range widgets {
+		r := &DashboardWidgetResult{Widget: w}
+
+		switch w.Type {
+		case DashboardWidgetCount:
+			result, err := s.RunReport(ctx, w.report())
+			if err != nil {
+				return nil, err
+			}
+			if len(result.Rows) > 0 {
+				r.Count, _ = result.Rows[0][0].(int64)
+			}
+		case DashboardWidgetTop:
+			result, err := s.RunReport(ctx, w.report())
+			if err != nil {
+				return nil, err
+			}
+			r.Top = make([]*DashboardTopItem, len(result.Rows))
+			for j, row := range result.Rows {
+				count, _ := row[1].(int64)
+				r.Top[j] = &DashboardTopItem{Value: row[0], Count: count}
+			}
+		case DashboardWidgetActivity:
+			if r.Activity, err = s.readDashboardActivity(ctx, w.Limit); err != nil {
+				return nil, err
+			}
+		case DashboardWidgetAlerts:
+			if r.Alerts, err = s.readDashboardAlerts(ctx, w.Status, w.Days); err != nil {
+				return nil, err
+			}
+		}
+
+		dashboard.Widgets[i] = r
+	}
+
+	return dashboard, nil
+}
+
+//readDashboardActivity returns the limit latest Device Events, or an error if one occurred
+func (s *TxStore) readDashboardActivity(ctx context.Context, limit int) ([]*DashboardActivity, error) {
+	tx := s.tx
+
+	scope, parameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+SELECT e.id, e.device_id, d.serial_number, e.date, e.type, IFNULL(u.name, IFNULL(e.user_name, ''))
+	FROM device_log AS e JOIN device AS d ON e.device_id = d.id LEFT JOIN user AS u ON e.user_id = u.id
+	WHERE %s
+	ORDER BY e.id DESC LIMIT ?;`, scope), append(parameters, limit)...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query Dashboard activity", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	activity := []*DashboardActivity{}
+
+	for rows.Next() {
+		a := new(DashboardActivity)
+		if err = rows.Scan(&(a.EventID), &(a.DeviceID), &(a.SerialNumber), &(a.Date), &(a.Type), &(a.UserName)); err != nil {
+			return nil, &Error{Description: "Could not scan Dashboard activity row", Type: ErrorTypeServer, Err: err}
+		}
+		activity = append(activity, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan Dashboard activity rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return activity, nil
+}
+
+//readDashboardAlerts returns the current DashboardAlerts, including Devices in the given Status for more than days days if status isn't empty,
+//or an error if one occurred
+func (s *TxStore) readDashboardAlerts(ctx context.Context, status Status, days int) ([]*DashboardAlert, error) {
+	alerts := []*DashboardAlert{}
+
+	sc, err := s.readStatsScope(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats := new(Stats)
+	if err = readStatsOverCapacity(ctx, s.tx, sc, stats); err != nil {
+		return nil, err
+	}
+	for _, l := range stats.OverCapacity {
+		alerts = append(alerts, &DashboardAlert{
+			Type:     DashboardAlertOverCapacity,
+			Message:  fmt.Sprintf("%s is over capacity (%d/%d)", l.Location, l.Count, l.Capacity),
+			Count:    l.Count,
+			Location: Location(l.Location),
+		})
+	}
+
+	eol, err := s.ReadEOLReport(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range eol.Models {
+		if m.Count == 0 {
+			continue
+		}
+		if m.PastEOL {
+			alerts = append(alerts, &DashboardAlert{
+				Type:    DashboardAlertPastEOL,
+				Message: fmt.Sprintf("%s %s is past its end-of-life date", m.Manufacturer, m.Model),
+				Count:   m.Count,
+				ModelID: m.ID,
+			})
+		}
+		if m.PastEOS {
+			alerts = append(alerts, &DashboardAlert{
+				Type:    DashboardAlertPastEOS,
+				Message: fmt.Sprintf("%s %s is past its end-of-support date", m.Manufacturer, m.Model),
+				Count:   m.Count,
+				ModelID: m.ID,
+			})
+		}
+	}
+
+	if status != "" {
+		report, err := s.ReadStatusDurationReport(ctx, status, days)
+		if err != nil {
+			return nil, err
+		}
+		if len(report.Overdue) > 0 {
+			alerts = append(alerts, &DashboardAlert{
+				Type:    DashboardAlertOverdue,
+				Message: fmt.Sprintf("%d devices have been %s for more than %d days", len(report.Overdue), status, days),
+				Count:   len(report.Overdue),
+				Status:  status,
+			})
+		}
+	}
+
+	return alerts, nil
+}
@@ -5,35 +5,46 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/go-sql-driver/mysql"
 )
 
 //DeviceEventLocation is the EventLocation for the Device type
 var DeviceEventLocation = EventLocation{
-	Type:    "Device",
-	Table:   "device_log",
-	IDField: "device_id",
+	Type:        "Device",
+	Table:       "device_log",
+	IDField:     "device_id",
+	EntityTable: "device",
+	Chained:     true,
 }
 
 //Device represents an inventoried device. ModelID is populated for Create, Read, and Update. Model is populated for Queries.
+//Links is populated by the device read endpoint. CreatedBy and ModifiedBy are only populated by ReadDeviceAttributions.
 type Device struct {
-	ID           int64    `json:"id"`
-	SerialNumber string   `json:"serial_number"`
-	ModelID      int64    `json:"model_id,omitempty"`
-	Status       Status   `json:"status"`
-	Location     Location `json:"location"`
-	Model        *Model   `json:"model,omitempty"`
-	Events       []*Event `json:"events,omitempty"`
+	ID           int64         `json:"id"`
+	SerialNumber string        `json:"serial_number"`
+	AssetTag     string        `json:"asset_tag,omitempty"`
+	ModelID      int64         `json:"model_id,omitempty"`
+	Status       Status        `json:"status"`
+	Location     Location      `json:"location"`
+	LastEventAt  *time.Time    `json:"last_event_at,omitempty"`
+	Model        *Model        `json:"model,omitempty"`
+	Links        []*DeviceLink `json:"links,omitempty"`
+	CreatedBy    *Attribution  `json:"created_by,omitempty"`
+	ModifiedBy   *Attribution  `json:"modified_by,omitempty"`
+	Events       []*Event      `json:"events,omitempty"`
+	DeletedAt    *time.Time    `json:"deleted_at,omitempty"`
 }
 
 //ReadModel resolves the ModelID field to a Model.
-func (d *Device) ReadModel(ctx context.Context) (*Model, error) {
-	return ReadModel(ctx, d.ModelID)
+func (d *Device) ReadModel(ctx context.Context, s *TxStore) (*Model, error) {
+	return s.ReadModel(ctx, d.ModelID)
 }
 
 //Validate cleans and validates the given Device
-func (d *Device) Validate(ctx context.Context) error {
+func (d *Device) Validate(ctx context.Context, s *TxStore) error {
 	d.SerialNumber = strings.TrimSpace(d.SerialNumber)
 	d.Status = Status(strings.TrimSpace(string(d.Status)))
 	d.Location = Location(strings.TrimSpace(string(d.Location)))
@@ -42,7 +53,12 @@ func (d *Device) Validate(ctx context.Context) error {
 		return err
 	}
 
-	statuses, err := ReadStatuses(ctx)
+	var err error
+	if d.AssetTag, err = validateAssetTag(d.AssetTag); err != nil {
+		return err
+	}
+
+	statuses, err := s.ReadStatuses(ctx)
 	if err != nil {
 		return err
 	}
@@ -53,10 +69,10 @@ func (d *Device) Validate(ctx context.Context) error {
 		}
 	}
 	if !ok {
-		return fmt.Errorf("status (%s) must be a valid status", d.Status)
+		return fieldError("status", "invalid_status", "status (%s) must be a valid status", d.Status)
 	}
 
-	locations, err := ReadLocations(ctx)
+	locations, err := s.ReadLocations(ctx)
 	if err != nil {
 		return err
 	}
@@ -67,37 +83,48 @@ func (d *Device) Validate(ctx context.Context) error {
 		}
 	}
 	if !ok {
-		return fmt.Errorf("location (%s) must be a valid location", d.Location)
+		return fieldError("location", "invalid_location", "location (%s) must be a valid location", d.Location)
 	}
 
-	if model, err := d.ReadModel(ctx); model == nil || err != nil {
-		return fmt.Errorf("model (%d) must be a valid model", d.ModelID)
+	if model, err := d.ReadModel(ctx, s); model == nil || err != nil {
+		return fieldError("model_id", "invalid_model", "model (%d) must be a valid model", d.ModelID)
 	}
 
 	return nil
 }
 
 //CreateDevice creates a new Device with the given fields (ID and Events are ignored and created) and returns its ID, or an error if one occurred
-func CreateDevice(ctx context.Context, device *Device) (id int64, err error) {
+func (s *TxStore) CreateDevice(ctx context.Context, device *Device) (id int64, err error) {
 
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+	tx := s.tx
 
-	if err = device.Validate(ctx); err != nil {
+	if err = device.Validate(ctx, s); err != nil {
 		if _, ok := err.(*Error); ok {
 			return 0, err
 		}
 		return 0, &Error{Description: "Could not validate Device", Type: ErrorTypeUser, Err: err}
 	}
 
-	res, err := tx.Exec("INSERT INTO device(serial_number, model_id, status, location) VALUES(?, ?, ?, ?);",
+	if err = s.CheckLocationPermission(ctx, device.Location); err != nil {
+		return 0, err
+	}
+
+	if device.AssetTag == "" && assetTagGenerator != nil {
+		if device.AssetTag, err = assetTagGenerator.Generate(ctx, s, device); err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO device(serial_number, asset_tag, model_id, status, location) VALUES(?, ?, ?, ?, ?);",
 		device.SerialNumber,
+		nullString(device.AssetTag),
 		device.ModelID,
 		device.Status,
 		device.Location,
 	)
 	if err != nil {
 		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
-			dup, newErr := ReadDeviceBySerialNumber(ctx, device.SerialNumber, false)
+			dup, newErr := s.readDuplicateDevice(ctx, device)
 			if newErr != nil {
 				return 0, newErr
 			}
@@ -118,7 +145,11 @@ func CreateDevice(ctx context.Context, device *Device) (id int64, err error) {
 		&CreatedField{Name: "location", Value: device.Location},
 	}}
 
-	if _, err := CreateCreatedEvent(ctx, id, DeviceEventLocation, c); err != nil {
+	if device.AssetTag != "" {
+		c.Fields = append(c.Fields, &CreatedField{Name: "asset_tag", Value: device.AssetTag})
+	}
+
+	if _, err := s.CreateCreatedEvent(ctx, id, DeviceEventLocation, c); err != nil {
 		return 0, &Error{Description: "Could not add Created Event", Type: ErrorTypeServer, Err: err}
 	}
 
@@ -127,24 +158,36 @@ func CreateDevice(ctx context.Context, device *Device) (id int64, err error) {
 }
 
 //ReadDevice returns the Device with the given id, or an error if one occurred.
-//If includeEvents is true the Events field will be populated
-func ReadDevice(ctx context.Context, id int64, includeEvents bool) (*Device, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//If includeEvents is true the Events field will be populated. The Device (without Events) is read through the request Cache
+func (s *TxStore) ReadDevice(ctx context.Context, id int64, includeEvents bool) (*Device, error) {
+	tx := s.tx
+	cache := requestCache(ctx)
+	key := cacheKey(DeviceEventLocation.Type, id)
 
 	device := &Device{ID: id}
 
-	row := tx.QueryRow("SELECT serial_number, model_id, status, location FROM device WHERE id=?", id)
-	err := row.Scan(&(device.SerialNumber), &(device.ModelID), &(device.Status), &(device.Location))
+	if cached, ok := cache.Get(key); ok {
+		*device = cached.(Device)
+	} else {
+		var assetTag sql.NullString
+		var lastEvent sql.NullTime
+		row := tx.QueryRowContext(ctx, "SELECT serial_number, asset_tag, model_id, status, location, last_event_at FROM device WHERE id=? AND deleted_at IS NULL", id)
+		err := row.Scan(&(device.SerialNumber), &assetTag, &(device.ModelID), &(device.Status), &(device.Location), &lastEvent)
+
+		switch {
+		case err == sql.ErrNoRows:
+			return nil, nil
+		case err != nil:
+			return nil, &Error{Description: fmt.Sprintf("Could not query Device(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+		device.AssetTag = assetTag.String
+		device.LastEventAt = timePtr(lastEvent)
 
-	switch {
-	case err == sql.ErrNoRows:
-		return nil, nil
-	case err != nil:
-		return nil, &Error{Description: fmt.Sprintf("Could not query Device(%d)", id), Type: ErrorTypeServer, Err: err}
+		cache.Set(key, *device)
 	}
 
 	if includeEvents {
-		events, err := ReadEvents(ctx, id, DeviceEventLocation)
+		events, err := s.ReadEvents(ctx, id, DeviceEventLocation)
 		if err != nil {
 			return nil, err
 		}
@@ -156,14 +199,17 @@ func ReadDevice(ctx context.Context, id int64, includeEvents bool) (*Device, err
 }
 
 //ReadDeviceBySerialNumber returns the Device with the given Serial Number, or an error if one occurred.
+//Deleted Devices are returned with DeletedAt set.
 //If includeEvents is true the Events field will be populated
-func ReadDeviceBySerialNumber(ctx context.Context, serialNumber string, includeEvents bool) (*Device, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) ReadDeviceBySerialNumber(ctx context.Context, serialNumber string, includeEvents bool) (*Device, error) {
+	tx := s.tx
 
 	device := &Device{SerialNumber: serialNumber}
 
-	row := tx.QueryRow("SELECT id, model_id, status, location FROM device WHERE serial_number=?", serialNumber)
-	err := row.Scan(&(device.ID), &(device.ModelID), &(device.Status), &(device.Location))
+	var assetTag sql.NullString
+	var lastEvent, deleted sql.NullTime
+	row := tx.QueryRowContext(ctx, "SELECT id, asset_tag, model_id, status, location, last_event_at, deleted_at FROM device WHERE serial_number=?", serialNumber)
+	err := row.Scan(&(device.ID), &assetTag, &(device.ModelID), &(device.Status), &(device.Location), &lastEvent, &deleted)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -171,9 +217,12 @@ func ReadDeviceBySerialNumber(ctx context.Context, serialNumber string, includeE
 	case err != nil:
 		return nil, &Error{Description: fmt.Sprintf("Could not query DeviceBySerialNumber(%s)", serialNumber), Type: ErrorTypeServer, Err: err}
 	}
+	device.AssetTag = assetTag.String
+	device.LastEventAt = timePtr(lastEvent)
+	device.DeletedAt = timePtr(deleted)
 
 	if includeEvents {
-		events, err := ReadEvents(ctx, device.ID, DeviceEventLocation)
+		events, err := s.ReadEvents(ctx, device.ID, DeviceEventLocation)
 		if err != nil {
 			return nil, err
 		}
@@ -184,21 +233,45 @@ func ReadDeviceBySerialNumber(ctx context.Context, serialNumber string, includeE
 	return device, nil
 }
 
+//readDuplicateDevice returns the existing Device with the same serial number or asset tag as the given Device, or an error if one occurred
+func (s *TxStore) readDuplicateDevice(ctx context.Context, device *Device) (*Device, error) {
+	dup, err := s.ReadDeviceBySerialNumber(ctx, device.SerialNumber, false)
+	if err != nil || (dup != nil && dup.ID != device.ID) || device.AssetTag == "" {
+		return dup, err
+	}
+
+	return s.ReadDeviceByAssetTag(ctx, device.AssetTag)
+}
+
 //UpdateDevice updates the fields for the given Device (using the ID field, Events are ignored), or returns an error if one occurred
-func UpdateDevice(ctx context.Context, device *Device) error {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) UpdateDevice(ctx context.Context, device *Device) error {
+	tx := s.tx
 
-	if err := device.Validate(ctx); err != nil {
+	if err := device.Validate(ctx, s); err != nil {
 		return &Error{Description: "Could not validate Device", Type: ErrorTypeUser, Err: err}
 	}
 
-	oldDevice, err := ReadDevice(ctx, device.ID, false)
+	oldDevice, err := s.ReadDevice(ctx, device.ID, false)
 	if err != nil {
 		return &Error{Description: fmt.Sprintf("Could not read old Device(%d)", device.ID), Type: ErrorTypeServer, Err: err}
 	}
 
-	_, err = tx.Exec("UPDATE device SET serial_number=?, model_id=?, status=?, location=? WHERE id=?;",
+	if err = s.CheckLocationPermission(ctx, oldDevice.Location); err != nil {
+		return err
+	}
+
+	if err = s.CheckLocationPermission(ctx, device.Location); err != nil {
+		return err
+	}
+
+	//asset tags can be changed but not removed
+	if device.AssetTag == "" {
+		device.AssetTag = oldDevice.AssetTag
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE device SET serial_number=?, asset_tag=?, model_id=?, status=?, location=? WHERE id=?;",
 		device.SerialNumber,
+		nullString(device.AssetTag),
 		device.ModelID,
 		device.Status,
 		device.Location,
@@ -206,7 +279,7 @@ func UpdateDevice(ctx context.Context, device *Device) error {
 	)
 	if err != nil {
 		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
-			dup, newErr := ReadDeviceBySerialNumber(ctx, device.SerialNumber, false)
+			dup, newErr := s.readDuplicateDevice(ctx, device)
 			if newErr != nil {
 				return newErr
 			}
@@ -221,6 +294,10 @@ func UpdateDevice(ctx context.Context, device *Device) error {
 		c.Fields = append(c.Fields, &ModifiedField{Name: "serial_number", OldValue: oldDevice.SerialNumber, NewValue: device.SerialNumber})
 	}
 
+	if oldDevice.AssetTag != device.AssetTag {
+		c.Fields = append(c.Fields, &ModifiedField{Name: "asset_tag", OldValue: oldDevice.AssetTag, NewValue: device.AssetTag})
+	}
+
 	if oldDevice.ModelID != device.ModelID {
 		c.Fields = append(c.Fields, &ModifiedField{Name: "model_id", OldValue: oldDevice.ModelID, NewValue: device.ModelID})
 	}
@@ -233,16 +310,16 @@ func UpdateDevice(ctx context.Context, device *Device) error {
 		c.Fields = append(c.Fields, &ModifiedField{Name: "location", OldValue: oldDevice.Location, NewValue: device.Location})
 	}
 
-	_, err = CreateModifiedEvent(ctx, device.ID, DeviceEventLocation, c)
+	_, err = s.CreateModifiedEvent(ctx, device.ID, DeviceEventLocation, c)
 	if err != nil {
 		return &Error{Description: fmt.Sprintf("Could not created Modified Event Device(%d)", device.ID), Type: ErrorTypeServer, Err: err}
 	}
 	return nil
 }
 
-//QueryDevice returns all Devices matching the given serial number, manufacturer, model, status, or location, or an error if one occurred.
-func QueryDevice(ctx context.Context, serialNumber, manufacturer, model, status, location string) ([]*Device, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//QueryDevice returns all Devices matching the given serial number, manufacturer, model, category, status, or location, or an error if one occurred.
+func (s *TxStore) QueryDevice(ctx context.Context, serialNumber, manufacturer, model, category, status, location string) ([]*Device, error) {
+	tx := s.tx
 
 	var criteria []string
 	var parameters []interface{}
@@ -262,6 +339,11 @@ func QueryDevice(ctx context.Context, serialNumber, manufacturer, model, status,
 		parameters = append(parameters, fmt.Sprintf("%%%s%%", model))
 	}
 
+	if category != "" {
+		criteria = append(criteria, "c.name LIKE ?")
+		parameters = append(parameters, fmt.Sprintf("%%%s%%", category))
+	}
+
 	if status != "" {
 		criteria = append(criteria, "d.status LIKE ?")
 		parameters = append(parameters, fmt.Sprintf("%%%s%%", status))
@@ -272,13 +354,23 @@ func QueryDevice(ctx context.Context, serialNumber, manufacturer, model, status,
 		parameters = append(parameters, fmt.Sprintf("%%%s%%", location))
 	}
 
+	scope, scopeParameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+
+	if scope != "" {
+		criteria = append(criteria, scope)
+		parameters = append(parameters, scopeParameters...)
+	}
+
 	var query string
 
 	if len(criteria) > 0 {
 		query = "WHERE " + strings.Join(criteria, " AND ")
 	}
 
-	rows, err := tx.Query(fmt.Sprintf("SELECT d.id, d.serial_number, m.id, m.manufacturer, m.model, d.status, d.location FROM device AS d JOIN model AS m ON d.model_id = m.id %s ORDER BY d.id;", query), parameters...)
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT d.id, d.serial_number, m.id, m.manufacturer, m.model, d.status, d.location FROM device AS d JOIN model AS m ON d.model_id = m.id LEFT JOIN category AS c ON m.category_id = c.id %s ORDER BY d.id;", query), parameters...)
 	if err != nil {
 		return nil, &Error{Description: "Could not query Devices", Type: ErrorTypeServer, Err: err}
 	}
@@ -306,22 +398,84 @@ func QueryDevice(ctx context.Context, serialNumber, manufacturer, model, status,
 
 const simpleQueryDeviceSQL = `
 SELECT d.id, d.serial_number, m.id, m.manufacturer, m.model, d.status, d.location
-	FROM device AS d JOIN model AS m ON d.model_id = m.id WHERE
+	FROM device AS d JOIN model AS m ON d.model_id = m.id WHERE (
 		d.serial_number LIKE ? OR
+		d.asset_tag LIKE ? OR
 		d.status LIKE ? OR
 		d.location LIKE ? OR
 		m.manufacturer LIKE ? OR
 		m.model LIKE ?
+	) %s
 	ORDER BY d.id;
 `
 
+const fullTextQueryDeviceSQL = `
+SELECT d.id, d.serial_number, m.id, m.manufacturer, m.model, d.status, d.location
+	FROM device AS d JOIN model AS m ON d.model_id = m.id WHERE (
+		MATCH(d.serial_number, d.asset_tag, d.status, d.location) AGAINST(? IN BOOLEAN MODE) OR
+		MATCH(m.manufacturer, m.model) AGAINST(? IN BOOLEAN MODE)
+	) %s
+	ORDER BY (
+		MATCH(d.serial_number, d.asset_tag, d.status, d.location) AGAINST(? IN BOOLEAN MODE) +
+		MATCH(m.manufacturer, m.model) AGAINST(? IN BOOLEAN MODE)
+	) DESC, d.id;
+`
+
+//fullTextMinLength is the shortest word the full-text index contains (InnoDB's default innodb_ft_min_token_size)
+const fullTextMinLength = 3
+
+//fullTextQuery returns a boolean mode full-text query requiring every word in search as a prefix,
+//or false if search has a word too short to be indexed
+func fullTextQuery(search string) (string, bool) {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "", false
+	}
+
+	for i, w := range words {
+		if len([]rune(w)) < fullTextMinLength {
+			return "", false
+		}
+		words[i] = "+" + w + "*"
+	}
+
+	return strings.Join(words, " "), true
+}
+
 //SimpleQueryDevice returns all Devices matching the given search (searching all fields), or an error if one occurred.
-func SimpleQueryDevice(ctx context.Context, search string) ([]*Device, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//Searches use the full-text index, matching every word as a prefix and ordering by relevance, unless a word is too short to be indexed
+func (s *TxStore) SimpleQueryDevice(ctx context.Context, search string) ([]*Device, error) {
+	tx := s.tx
+
+	//short words aren't in the full-text index, so fall back to (unindexed) LIKE
+	query := simpleQueryDeviceSQL
+	var parameters []interface{}
+	if ft, ok := fullTextQuery(search); ok {
+		query = fullTextQueryDeviceSQL
+		parameters = []interface{}{ft, ft}
+	} else {
+		pattern := fmt.Sprintf("%%%s%%", search)
+		parameters = []interface{}{pattern, pattern, pattern, pattern, pattern, pattern}
+	}
+
+	scope, scopeParameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
 
-	s := fmt.Sprintf("%%%s%%", search)
+	if scope != "" {
+		scope = "AND " + scope
+		parameters = append(parameters, scopeParameters...)
+	}
+
+	//the relevance ordering repeats the full-text query after the scope parameters
+	if query == fullTextQueryDeviceSQL {
+		parameters = append(parameters, parameters[0], parameters[0])
+	}
 
-	rows, err := tx.Query(simpleQueryDeviceSQL, s, s, s, s, s)
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(query, scope), parameters...)
 	if err != nil {
 		return nil, &Error{Description: "Could not query Devices", Type: ErrorTypeServer, Err: err}
 	}
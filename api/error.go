@@ -1,6 +1,11 @@
 package api
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
 
 //ErrorType are APIError types
 type ErrorType int
@@ -10,6 +15,7 @@ const (
 	ErrorTypeUser ErrorType = iota
 	ErrorTypeServer
 	ErrorTypeDuplicate
+	ErrorTypeForbidden
 )
 
 //Error wraps errors in the API
@@ -25,6 +31,36 @@ func (e *Error) Error() string {
 		return fmt.Sprintf("User Error: %s: %v", e.Description, e.Err)
 	} else if e.Type == ErrorTypeServer {
 		return fmt.Sprintf("Server Error: %s: %v", e.Description, e.Err)
+	} else if e.Type == ErrorTypeForbidden {
+		return fmt.Sprintf("Forbidden Error: %s: %v", e.Description, e.Err)
 	}
 	return fmt.Sprintf("Duplicate Error (ID: %d): %s: %v", e.DuplicateID, e.Description, e.Err)
 }
+
+//IsRetryable returns true if err is (or is an *Error wrapping) a MySQL deadlock or lock wait timeout.
+//The transaction should be rolled back and retried from the start
+func IsRetryable(err error) bool {
+	if e, ok := err.(*Error); ok {
+		err = e.Err
+	}
+
+	var mErr *mysql.MySQLError
+	return errors.As(err, &mErr) && (mErr.Number == 1213 || mErr.Number == 1205)
+}
+
+//FieldError is a validation error for a single request field.
+//Code is a stable, machine readable reason (e.g. invalid_status) and Message is a human readable description
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+//fieldError returns a *FieldError for the given field and code with a formatted message
+func fieldError(field, code, format string, a ...interface{}) error {
+	return &FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, a...)}
+}
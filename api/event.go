@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -40,57 +41,158 @@ type ModifiedContent struct {
 	Fields []*ModifiedField `json:"fields"`
 }
 
+//MergedContent represents content for a merged event, recording the Model a device had before it was merged into another.
+//OldModel and NewModel are snapshots taken at the time of the merge
+type MergedContent struct {
+	OldModel *Model `json:"old_model"`
+	NewModel *Model `json:"new_model"`
+}
+
+//EventSource types
+const (
+	EventSourceWeb     = "web"
+	EventSourceChatbot = "chatbot"
+	EventSourceSystem  = "system"
+)
+
+//EventSource represents how an Event was made: by a User directly (web), by a chatbot acting for a User, or by the server itself (system).
+//ConversationID identifies the chatbot conversation
+type EventSource struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+//eventSource returns the EventSource for the request, or nil if there isn't one
+func eventSource(ctx context.Context) *EventSource {
+	source, _ := ctx.Value(SourceKey).(*EventSource)
+	return source
+}
+
+//columns returns the values stored for the EventSource. A nil EventSource is stored as NULL
+func (e *EventSource) columns() (typ, conversationID sql.NullString) {
+	if e == nil {
+		return typ, conversationID
+	}
+	return sql.NullString{String: e.Type, Valid: true}, sql.NullString{String: e.ConversationID, Valid: e.ConversationID != ""}
+}
+
+//scanEventSource returns the EventSource stored in the given columns, or nil if the Event was created without one
+func scanEventSource(typ, conversationID sql.NullString) *EventSource {
+	if !typ.Valid {
+		return nil
+	}
+	return &EventSource{Type: typ.String, ConversationID: conversationID.String}
+}
+
 //Event represents an event that has happened.
 //UserID should be used when creating and Event and User is used when reading and Event.
+//If the User has been deleted, UserID is 0 and User only contains the User's name.
+//Source is set from the request EventSource when the Event is created; Events created before sources were recorded don't have one.
+//BatchID is set if the Event was created by a bulk operation
 type Event struct {
-	ID      int64       `json:"-"`
-	Date    time.Time   `json:"date"`
-	UserID  int64       `json:"user_id"`
-	User    *User       `json:"_user,omitempty"`
-	Type    string      `json:"type"`
-	Content interface{} `json:"content"`
+	ID      int64        `json:"-"`
+	Date    time.Time    `json:"date"`
+	UserID  int64        `json:"user_id"`
+	User    *User        `json:"_user,omitempty"`
+	Type    string       `json:"type"`
+	Content interface{}  `json:"content"`
+	Source  *EventSource `json:"source,omitempty"`
+	BatchID int64        `json:"batch_id,omitempty"`
 }
 
-//EventLocation contains information needed to add events for the given type
+//EventLocation contains information needed to add events for the given type.
+//If EntityTable is set, its last_event_at column is updated when an Event is created.
+//If Chained is set, Events are added to the event hash chain (see chain.go)
 type EventLocation struct {
-	Type    string
-	Table   string
-	IDField string
+	Type        string
+	Table       string
+	IDField     string
+	EntityTable string
+	Chained     bool
 }
 
-//CreateEvent creates a new Event for the given type and id with the given fields (ID is ignored and created) and returns its ID or an error if one occurred
-func CreateEvent(ctx context.Context, id int64, el EventLocation, event *Event) (eventID int64, err error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//CreateEvent creates a new Event for the given type and id with the given fields (ID is ignored and created) and returns its ID or an error if one occurred.
+//The entity with the given type and id is invalidated in the request Cache.
+//Chained Events' dates are truncated to the second, as they're stored, so their hashes can be verified
+func (s *TxStore) CreateEvent(ctx context.Context, id int64, el EventLocation, event *Event) (eventID int64, err error) {
+	tx := s.tx
 
 	content, err := json.Marshal(event.Content)
 	if err != nil {
 		return 0, &Error{Description: "Could not marshal content json", Type: ErrorTypeServer, Err: err}
 	}
 
-	res, err := tx.Exec(fmt.Sprintf("INSERT INTO %s(%s, user_id, date, type, content) VALUES(?, ?, ?, ?, ?);", el.Table, el.IDField),
-		id,
-		event.UserID,
-		event.Date,
-		event.Type,
-		content,
-	)
+	if event.Source == nil {
+		event.Source = eventSource(ctx)
+	}
+	sourceType, conversationID := event.Source.columns()
+
+	if event.BatchID == 0 {
+		if event.BatchID, err = s.eventBatchID(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	var prevHash, hash string
+	if el.Chained {
+		event.Date = event.Date.Truncate(time.Second)
+		if prevHash, hash, err = s.chainEvent(ctx, id, event, content); err != nil {
+			return 0, err
+		}
+	}
+
+	columns := "user_id, date, type, content, source, source_conversation_id, batch_id"
+	placeholders := "?, ?, ?, ?, ?, ?, ?"
+	parameters := []interface{}{id, nullID(event.UserID), event.Date, event.Type, content, sourceType, conversationID, nullID(event.BatchID)}
+
+	if el.Chained {
+		columns += ", prev_hash, hash"
+		placeholders += ", ?, ?"
+		parameters = append(parameters, sql.NullString{String: prevHash, Valid: prevHash != ""}, hash)
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s(%s, %s) VALUES(?, %s);", el.Table, el.IDField, columns, placeholders), parameters...)
 	if err != nil {
 		return 0, &Error{Description: "Could not insert event", Type: ErrorTypeServer, Err: err}
 	}
 
-	id, err = res.LastInsertId()
+	if el.EntityTable != "" {
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET last_event_at=GREATEST(IFNULL(last_event_at, ?), ?) WHERE id=?;", el.EntityTable), event.Date, event.Date, id); err != nil {
+			return 0, &Error{Description: fmt.Sprintf("Could not update last event for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	//every change to an entity is recorded with an Event
+	requestCache(ctx).Invalidate(cacheKey(el.Type, id))
+
+	if el.Type == DeviceEventLocation.Type {
+		if err = s.addDeviceFeedEvent(ctx, id, event); err != nil {
+			return 0, err
+		}
+		if err = s.queueDeviceWebhooks(ctx, id, event); err != nil {
+			return 0, err
+		}
+	}
+
+	eventID, err = res.LastInsertId()
 	if err != nil {
 		return 0, &Error{Description: "Could not fetch event id", Type: ErrorTypeServer, Err: err}
 	}
 
-	return id, nil
+	if el.Chained {
+		if err = s.advanceEventChain(ctx, eventID, hash); err != nil {
+			return 0, err
+		}
+	}
+
+	return eventID, nil
 }
 
 //CreateCreatedEvent creates a new Created Event for the given type, id, and content
-func CreateCreatedEvent(ctx context.Context, id int64, el EventLocation, c *CreatedContent) (eventID int64, err error) {
+func (s *TxStore) CreateCreatedEvent(ctx context.Context, id int64, el EventLocation, c *CreatedContent) (eventID int64, err error) {
 	user := ctx.Value(UserKey).(*User)
 
-	return CreateEvent(ctx, id, el, &Event{
+	return s.CreateEvent(ctx, id, el, &Event{
 		Date:    time.Now(),
 		UserID:  user.ID,
 		Type:    "created",
@@ -99,7 +201,7 @@ func CreateCreatedEvent(ctx context.Context, id int64, el EventLocation, c *Crea
 }
 
 //CreateNoteEvent creates a new Note Event for the given type and id with the given note text
-func CreateNoteEvent(ctx context.Context, id int64, el EventLocation, note string) (eventID int64, err error) {
+func (s *TxStore) CreateNoteEvent(ctx context.Context, id int64, el EventLocation, note string) (eventID int64, err error) {
 	if note == "" {
 		return 0, &Error{Description: "Could not validate note", Type: ErrorTypeUser, Err: errors.New("note cannot be empty")}
 	}
@@ -107,7 +209,7 @@ func CreateNoteEvent(ctx context.Context, id int64, el EventLocation, note strin
 
 	user := ctx.Value(UserKey).(*User)
 
-	return CreateEvent(ctx, id, el, &Event{
+	return s.CreateEvent(ctx, id, el, &Event{
 		Date:    time.Now(),
 		UserID:  user.ID,
 		Type:    "note",
@@ -116,10 +218,10 @@ func CreateNoteEvent(ctx context.Context, id int64, el EventLocation, note strin
 }
 
 //CreateModifiedEvent creates a new Modified Event for the given type, id, and content
-func CreateModifiedEvent(ctx context.Context, id int64, el EventLocation, c *ModifiedContent) (eventID int64, err error) {
+func (s *TxStore) CreateModifiedEvent(ctx context.Context, id int64, el EventLocation, c *ModifiedContent) (eventID int64, err error) {
 	user := ctx.Value(UserKey).(*User)
 
-	return CreateEvent(ctx, id, el, &Event{
+	return s.CreateEvent(ctx, id, el, &Event{
 		Date:    time.Now(),
 		UserID:  user.ID,
 		Type:    "modified",
@@ -127,24 +229,68 @@ func CreateModifiedEvent(ctx context.Context, id int64, el EventLocation, c *Mod
 	})
 }
 
+//CreateMergedEvent creates a new Merged Event for the given type, id, and content
+func (s *TxStore) CreateMergedEvent(ctx context.Context, id int64, el EventLocation, c *MergedContent) (eventID int64, err error) {
+	user := ctx.Value(UserKey).(*User)
+
+	return s.CreateEvent(ctx, id, el, &Event{
+		Date:    time.Now(),
+		UserID:  user.ID,
+		Type:    "merged",
+		Content: c,
+	})
+}
+
 //ReadEvents returns the events for the given type and id, or an error if one occurred
-func ReadEvents(ctx context.Context, id int64, el EventLocation) ([]*Event, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) ReadEvents(ctx context.Context, id int64, el EventLocation) ([]*Event, error) {
+	events, err := s.ReadEventsByIDs(ctx, []int64{id}, el)
+	if err != nil {
+		return nil, err
+	}
+	return events[id], nil
+}
+
+//ReadEventsByIDs returns the events for the given type and ids keyed by id, or an error if one occurred.
+//The events for all ids, and the Users and Models they reference, are read in one query each
+func (s *TxStore) ReadEventsByIDs(ctx context.Context, ids []int64, el EventLocation) (map[int64][]*Event, error) {
+	tx := s.tx
+
+	byID := make(map[int64][]*Event)
+	if len(ids) == 0 {
+		return byID, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	parameters := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		parameters[i] = id
+	}
 
 	var events []*Event
 
-	rows, err := tx.Query(fmt.Sprintf("SELECT id, user_id, date, type, content FROM %s WHERE %s=? ORDER BY date;", el.Table, el.IDField), id)
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s, id, user_id, user_name, date, type, content, source, source_conversation_id, batch_id FROM %s WHERE %s IN (%s) ORDER BY date;", el.IDField, el.Table, el.IDField, strings.Join(placeholders, ", ")), parameters...)
 	if err != nil {
-		return nil, &Error{Description: fmt.Sprintf("Could not query events for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
+		return nil, &Error{Description: fmt.Sprintf("Could not query events for %s", el.Type), Type: ErrorTypeServer, Err: err}
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		e := new(Event)
+		var id int64
+		var userID, batchID sql.NullInt64
+		var userName, sourceType, conversationID sql.NullString
 		var content []byte
 
-		if err := rows.Scan(&(e.ID), &(e.UserID), &(e.Date), &(e.Type), &content); err != nil {
-			return nil, &Error{Description: fmt.Sprintf("Could not scan event row for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
+		if err := rows.Scan(&id, &(e.ID), &userID, &userName, &(e.Date), &(e.Type), &content, &sourceType, &conversationID, &batchID); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan event row for %s", el.Type), Type: ErrorTypeServer, Err: err}
+		}
+		e.Source = scanEventSource(sourceType, conversationID)
+		e.BatchID = batchID.Int64
+
+		e.UserID = userID.Int64
+		if !userID.Valid {
+			e.User = &User{Name: userName.String}
 		}
 
 		if e.Type == "created" {
@@ -167,87 +313,92 @@ func ReadEvents(ctx context.Context, id int64, el EventLocation) ([]*Event, erro
 				return nil, &Error{Description: fmt.Sprintf("Could not unmarshal modified content json for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
 			}
 			e.Content = mod
+
+		} else if e.Type == "merged" {
+			var merged *MergedContent
+			if err := json.Unmarshal(content, &merged); err != nil {
+				return nil, &Error{Description: fmt.Sprintf("Could not unmarshal merged content json for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
+			}
+			e.Content = merged
 		}
 
 		events = append(events, e)
+		byID[id] = append(byID[id], e)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, &Error{Description: fmt.Sprintf("Could not scan event rows for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
+		return nil, &Error{Description: fmt.Sprintf("Could not scan event rows for %s", el.Type), Type: ErrorTypeServer, Err: err}
 	}
 
-	userCache := make(map[int64]*User)
-	modelCache := make(map[int64]*Model)
+	//collect the Users and Models referenced by events so they can be read in one query each
+	var userIDs, modelIDs []int64
+	seenUsers := make(map[int64]bool)
+	seenModels := make(map[int64]bool)
+	addModel := func(v interface{}) {
+		if id := int64(v.(float64)); !seenModels[id] {
+			seenModels[id] = true
+			modelIDs = append(modelIDs, id)
+		}
+	}
 
-	//populate models for created and modified events
 	for _, e := range events {
-		if user, ok := userCache[e.UserID]; ok {
-			e.User = user
-		} else {
-			user, err := ReadUser(ctx, e.UserID)
-			if err != nil {
-				return nil, &Error{Description: fmt.Sprintf("Could not read event user for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
-			}
-			e.User = user
-			userCache[e.UserID] = user
+		//deleted Users are already populated
+		if e.User == nil && !seenUsers[e.UserID] {
+			seenUsers[e.UserID] = true
+			userIDs = append(userIDs, e.UserID)
 		}
 
 		if e.Type == "created" {
-			content := e.Content.(*CreatedContent)
-			for _, f := range content.Fields {
+			for _, f := range e.Content.(*CreatedContent).Fields {
 				if f.Name == "model_id" {
-					newID := int64(f.Value.(float64))
-
-					if model, ok := modelCache[newID]; ok {
-						f.Model = model
-					} else {
-						model, err := ReadModel(ctx, newID)
-						if err != nil {
-							return nil, &Error{Description: fmt.Sprintf("Could not read created event model for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
-						}
-
-						f.Model = model
-						modelCache[newID] = model
-					}
+					addModel(f.Value)
 					break
 				}
 			}
 		} else if e.Type == "modified" {
-			content := e.Content.(*ModifiedContent)
-			for _, f := range content.Fields {
+			for _, f := range e.Content.(*ModifiedContent).Fields {
 				if f.Name == "model_id" {
-					oldID := int64(f.OldValue.(float64))
-					newID := int64(f.NewValue.(float64))
-
-					if oldModel, ok := modelCache[oldID]; ok {
-						f.OldModel = oldModel
-					} else {
-						oldModel, err := ReadModel(ctx, oldID)
-						if err != nil {
-							return nil, &Error{Description: fmt.Sprintf("Could not read modified event oldModel for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
-						}
-
-						f.OldModel = oldModel
-						modelCache[oldID] = oldModel
-					}
-
-					if newModel, ok := modelCache[newID]; ok {
-						f.NewModel = newModel
-					} else {
-						newModel, err := ReadModel(ctx, newID)
-						if err != nil {
-							return nil, &Error{Description: fmt.Sprintf("Could not read modified event newModel for %s(%d)", el.Type, id), Type: ErrorTypeServer, Err: err}
-						}
-
-						f.NewModel = newModel
-						modelCache[newID] = newModel
-					}
+					addModel(f.OldValue)
+					addModel(f.NewValue)
+					break
+				}
+			}
+		}
+	}
+
+	users, err := s.ReadUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not read event users for %s", el.Type), Type: ErrorTypeServer, Err: err}
+	}
+
+	models, err := s.ReadModelsByIDs(ctx, modelIDs)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not read event models for %s", el.Type), Type: ErrorTypeServer, Err: err}
+	}
 
+	//populate users, and models for created and modified events
+	for _, e := range events {
+		if e.User == nil {
+			e.User = users[e.UserID]
+		}
+
+		if e.Type == "created" {
+			for _, f := range e.Content.(*CreatedContent).Fields {
+				if f.Name == "model_id" {
+					f.Model = models[int64(f.Value.(float64))]
+					break
+				}
+			}
+		} else if e.Type == "modified" {
+			for _, f := range e.Content.(*ModifiedContent).Fields {
+				if f.Name == "model_id" {
+					f.OldModel = models[int64(f.OldValue.(float64))]
+					f.NewModel = models[int64(f.NewValue.(float64))]
 					break
 				}
 			}
 		}
 	}
 
-	return events, nil
+	return byID, nil
 }
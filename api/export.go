@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//ExportedEvent represents a Device Event in an event export. Content is the Event's stored content.
+//UserName is the User's current name, or the name recorded when the User was deleted
+type ExportedEvent struct {
+	ID           int64           `json:"id"`
+	Date         time.Time       `json:"date"`
+	DeviceID     int64           `json:"device_id"`
+	SerialNumber string          `json:"serial_number"`
+	UserID       int64           `json:"user_id,omitempty"`
+	UserName     string          `json:"user_name"`
+	Type         string          `json:"type"`
+	Content      json.RawMessage `json:"content"`
+	Source       *EventSource    `json:"source,omitempty"`
+}
+
+//rawContent returns stored Event content as JSON. Events without content are null
+func rawContent(content []byte) json.RawMessage {
+	if len(content) == 0 {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(content)
+}
+
+//ExportEvents calls f with each Device Event matching the given Device id and date range (since inclusive, until exclusive),
+//in the order they were created, or returns an error if one occurred. Zero values match all Events.
+//Events are read one row at a time so large exports aren't held in memory. Events of deleted Devices are included.
+//If f returns an error, the export is stopped and the error is returned
+func (s *TxStore) ExportEvents(ctx context.Context, deviceID int64, since, until time.Time, f func(*ExportedEvent) error) error {
+	tx := s.tx
+
+	var criteria []string
+	var parameters []interface{}
+
+	if deviceID != 0 {
+		criteria = append(criteria, "e.device_id=?")
+		parameters = append(parameters, deviceID)
+	}
+
+	if !since.IsZero() {
+		criteria = append(criteria, "e.date>=?")
+		parameters = append(parameters, since)
+	}
+
+	if !until.IsZero() {
+		criteria = append(criteria, "e.date<?")
+		parameters = append(parameters, until)
+	}
+
+	var where string
+	if len(criteria) > 0 {
+		where = "WHERE " + strings.Join(criteria, " AND ")
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+SELECT e.id, e.date, e.device_id, d.serial_number, e.user_id, IFNULL(u.name, IFNULL(e.user_name, '')), e.type, e.content, e.source, e.source_conversation_id
+	FROM %s AS e JOIN device AS d ON e.device_id = d.id LEFT JOIN user AS u ON e.user_id = u.id
+	%s ORDER BY e.id;`, allEventsTable, where), parameters...)
+	if err != nil {
+		return &Error{Description: "Could not query events for export", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := new(ExportedEvent)
+		var userID sql.NullInt64
+		var sourceType, conversationID sql.NullString
+		var content []byte
+
+		if err := rows.Scan(&(e.ID), &(e.Date), &(e.DeviceID), &(e.SerialNumber), &userID, &(e.UserName), &(e.Type), &content, &sourceType, &conversationID); err != nil {
+			return &Error{Description: "Could not scan exported event row", Type: ErrorTypeServer, Err: err}
+		}
+		e.UserID = userID.Int64
+		e.Content = rawContent(content)
+		e.Source = scanEventSource(sourceType, conversationID)
+
+		if err := f(e); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return &Error{Description: "Could not scan exported event rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//FeedEventTypes
+const (
+	FeedEventTypeDevice = "device"
+	FeedEventTypeModel  = "model"
+)
+
+//feedBufferSize is the number of FeedEvents buffered for each subscriber. Events for slow subscribers are dropped
+const feedBufferSize = 64
+
+//FeedEvent represents a change to a Device or Model published to Feed subscribers.
+//Location and Status are the Device's values after the change, and Content is the Device Event's content
+type FeedEvent struct {
+	Type     string      `json:"type"`
+	ID       int64       `json:"id"`
+	Event    string      `json:"event"`
+	Date     time.Time   `json:"date"`
+	UserID   int64       `json:"user_id,omitempty"`
+	Location Location    `json:"location,omitempty"`
+	Status   Status      `json:"status,omitempty"`
+	Content  interface{} `json:"-"`
+}
+
+//Feed publishes FeedEvents to subscribers
+type Feed struct {
+	subscribers map[chan *FeedEvent]struct{}
+	closed      bool
+	mu          *sync.Mutex
+}
+
+//NewFeed returns a new Feed
+func NewFeed() *Feed {
+	return &Feed{subscribers: make(map[chan *FeedEvent]struct{}), mu: new(sync.Mutex)}
+}
+
+//Subscribe returns a channel that receives every FeedEvent published until Unsubscribe is called.
+//The channel is closed when the Feed is closed
+func (f *Feed) Subscribe() chan *FeedEvent {
+	c := make(chan *FeedEvent, feedBufferSize)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		close(c)
+		return c
+	}
+	f.subscribers[c] = struct{}{}
+	return c
+}
+
+//Unsubscribe stops sending FeedEvents to the given channel
+func (f *Feed) Unsubscribe(c chan *FeedEvent) {
+	f.mu.Lock()
+	delete(f.subscribers, c)
+	f.mu.Unlock()
+}
+
+//Close closes all subscriber channels so streams can end (e.g. when the server is shutting down)
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for c := range f.subscribers {
+		close(c)
+		delete(f.subscribers, c)
+	}
+}
+
+//Publish sends the given FeedEvents to all subscribers without blocking
+func (f *Feed) Publish(events ...*FeedEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.subscribers {
+		for _, e := range events {
+			select {
+			case c <- e:
+			default:
+			}
+		}
+	}
+}
+
+//RequestFeed collects FeedEvents for a single request transaction and publishes them when Commit is called.
+//A nil *RequestFeed is valid and does nothing.
+type RequestFeed struct {
+	feed   *Feed
+	events []*FeedEvent
+	mu     *sync.Mutex
+}
+
+//NewRequestFeed returns a new RequestFeed for the given Feed
+func NewRequestFeed(f *Feed) *RequestFeed {
+	return &RequestFeed{feed: f, mu: new(sync.Mutex)}
+}
+
+//Add adds the given FeedEvent to be published on Commit
+func (f *RequestFeed) Add(e *FeedEvent) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	f.events = append(f.events, e)
+	f.mu.Unlock()
+}
+
+//Commit publishes all FeedEvents added during the request. It should be called after the request transaction is committed
+func (f *RequestFeed) Commit() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.events) > 0 {
+		f.feed.Publish(f.events...)
+	}
+}
+
+//requestFeed returns the RequestFeed for ctx, or nil if the Feed is disabled
+func requestFeed(ctx context.Context) *RequestFeed {
+	f, _ := ctx.Value(FeedKey).(*RequestFeed)
+	return f
+}
+
+//addDeviceFeedEvent adds a FeedEvent for the given Device Event to the request Feed
+func (s *TxStore) addDeviceFeedEvent(ctx context.Context, id int64, event *Event) error {
+	feed := requestFeed(ctx)
+	if feed == nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "created", "modified", "note":
+	default:
+		return nil
+	}
+
+	tx := s.tx
+
+	//the Device's Location is used to filter the FeedEvent for Users with Location permissions
+	var location Location
+	var status Status
+	row := tx.QueryRowContext(ctx, "SELECT location, status FROM device WHERE id=?;", id)
+	if err := row.Scan(&location, &status); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query Location for Device(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	feed.Add(&FeedEvent{Type: FeedEventTypeDevice, ID: id, Event: event.Type, Date: event.Date, UserID: event.UserID, Location: location, Status: status, Content: event.Content})
+
+	return nil
+}
+
+//addModelFeedEvent adds a FeedEvent for the given Model change to the request Feed
+func addModelFeedEvent(ctx context.Context, id int64, typ string) {
+	e := &FeedEvent{Type: FeedEventTypeModel, ID: id, Event: typ, Date: time.Now()}
+	if user, ok := ctx.Value(UserKey).(*User); ok {
+		e.UserID = user.ID
+	}
+	requestFeed(ctx).Add(e)
+}
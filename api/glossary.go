@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//GlossaryTerm represents an organization-specific term (e.g. "MAC lab") and what it means (e.g. "Room 214")
+type GlossaryTerm struct {
+	ID         int64  `json:"id"`
+	Term       string `json:"term"`
+	Definition string `json:"definition"`
+}
+
+//Validate cleans and validates the given GlossaryTerm
+func (g *GlossaryTerm) Validate() error {
+	g.Term = normalizeSpace(g.Term)
+	g.Definition = strings.TrimSpace(g.Definition)
+
+	if err := ValidateString("term", g.Term, 255); err != nil {
+		return err
+	}
+
+	return ValidateString("definition", g.Definition, 65535)
+}
+
+//CreateGlossaryTerm creates a new GlossaryTerm with the given fields (ID is ignored and created) and returns its ID, or an error if one occurred
+func (s *TxStore) CreateGlossaryTerm(ctx context.Context, term *GlossaryTerm) (id int64, err error) {
+	tx := s.tx
+
+	if err = term.Validate(); err != nil {
+		return 0, &Error{Description: "Could not validate GlossaryTerm", Type: ErrorTypeUser, Err: err}
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO glossary(term, definition) VALUES(?, ?);", term.Term, term.Definition)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			dup, newErr := s.ReadGlossaryTermByTerm(ctx, term.Term)
+			if newErr != nil {
+				return 0, newErr
+			}
+			return 0, &Error{Description: "Could not insert GlossaryTerm", Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+		}
+		return 0, &Error{Description: "Could not insert GlossaryTerm", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: "Could not fetch GlossaryTerm id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return id, nil
+}
+
+//ReadGlossaryTerm returns the GlossaryTerm with the given id, or an error if one occurred
+func (s *TxStore) ReadGlossaryTerm(ctx context.Context, id int64) (*GlossaryTerm, error) {
+	tx := s.tx
+
+	term := &GlossaryTerm{ID: id}
+
+	row := tx.QueryRowContext(ctx, "SELECT term, definition FROM glossary WHERE id=?", id)
+	err := row.Scan(&(term.Term), &(term.Definition))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query GlossaryTerm(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return term, nil
+}
+
+//ReadGlossaryTermByTerm returns the GlossaryTerm with the given term, or an error if one occurred
+func (s *TxStore) ReadGlossaryTermByTerm(ctx context.Context, t string) (*GlossaryTerm, error) {
+	tx := s.tx
+
+	term := &GlossaryTerm{Term: t}
+
+	row := tx.QueryRowContext(ctx, "SELECT id, definition FROM glossary WHERE term=?", t)
+	err := row.Scan(&(term.ID), &(term.Definition))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query GlossaryTermByTerm(%s)", t), Type: ErrorTypeServer, Err: err}
+	}
+
+	return term, nil
+}
+
+//ReadGlossaryTerms returns all GlossaryTerms, or an error if one occurred.
+//If q isn't empty, only terms containing q or contained in q (e.g. terms mentioned in a sentence) are returned
+func (s *TxStore) ReadGlossaryTerms(ctx context.Context, q string) ([]*GlossaryTerm, error) {
+	tx := s.tx
+
+	var where string
+	var parameters []interface{}
+
+	if q = normalizeSpace(q); q != "" {
+		where = "WHERE term LIKE ? OR ? LIKE CONCAT('%', term, '%')"
+		parameters = append(parameters, "%"+q+"%", q)
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, term, definition FROM glossary %s ORDER BY term;", where), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query GlossaryTerms", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	terms := []*GlossaryTerm{}
+
+	for rows.Next() {
+		g := new(GlossaryTerm)
+		if err = rows.Scan(&(g.ID), &(g.Term), &(g.Definition)); err != nil {
+			return nil, &Error{Description: "Could not scan GlossaryTerm row", Type: ErrorTypeServer, Err: err}
+		}
+
+		terms = append(terms, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan GlossaryTerm rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return terms, nil
+}
+
+//UpdateGlossaryTerm updates the fields for the given GlossaryTerm (using the ID field), or returns an error if one occurred
+func (s *TxStore) UpdateGlossaryTerm(ctx context.Context, term *GlossaryTerm) error {
+	tx := s.tx
+
+	if err := term.Validate(); err != nil {
+		return &Error{Description: "Could not validate GlossaryTerm", Type: ErrorTypeUser, Err: err}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE glossary SET term=?, definition=? WHERE id=?;", term.Term, term.Definition, term.ID)
+	if err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			dup, newErr := s.ReadGlossaryTermByTerm(ctx, term.Term)
+			if newErr != nil {
+				return newErr
+			}
+			return &Error{Description: fmt.Sprintf("Could not update GlossaryTerm(%d)", term.ID), Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+		}
+		return &Error{Description: fmt.Sprintf("Could not update GlossaryTerm(%d)", term.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//DeleteGlossaryTerm deletes the GlossaryTerm with the given id, or returns an error if one occurred
+func (s *TxStore) DeleteGlossaryTerm(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM glossary WHERE id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete GlossaryTerm(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
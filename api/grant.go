@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//MaxGrantDuration is the longest a Grant may last
+const MaxGrantDuration = 366 * 24 * time.Hour
+
+//GrantEventLocation is the EventLocation for Grant events. Grants have created (granted), modified (revoked), and expired events
+var GrantEventLocation = EventLocation{Type: "grant", Table: "user_grant_log", IDField: "grant_id"}
+
+//Grant represents temporary access for a User: the admin Role, access to a Location, or both, from Starts until Expires.
+//Expired is set once the expiry has been recorded; access ends at Expires regardless
+type Grant struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Role      string     `json:"role,omitempty"`
+	Location  Location   `json:"location,omitempty"`
+	Starts    time.Time  `json:"starts"`
+	Expires   time.Time  `json:"expires"`
+	GrantedBy int64      `json:"granted_by,omitempty"`
+	Revoked   *time.Time `json:"revoked,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+//Active returns true if the Grant is in effect at the given time
+func (g *Grant) Active(t time.Time) bool {
+	return g.Revoked == nil && !t.Before(g.Starts) && t.Before(g.Expires)
+}
+
+//Validate validates the given Grant
+func (g *Grant) Validate() error {
+	if g.Role != "" && g.Role != RoleAdmin {
+		return fieldError("role", "invalid_role", "role (%s) must be empty or %s", g.Role, RoleAdmin)
+	}
+
+	if g.Role == "" && g.Location == "" {
+		return fieldError("role", "required", "role or location must be set")
+	}
+
+	if g.Starts.IsZero() {
+		g.Starts = time.Now()
+	}
+
+	if !g.Expires.After(g.Starts) {
+		return fieldError("expires", "invalid_date", "expires must be after starts")
+	}
+
+	if !g.Expires.After(time.Now()) {
+		return fieldError("expires", "invalid_date", "expires must be in the future")
+	}
+
+	if g.Expires.Sub(g.Starts) > MaxGrantDuration {
+		return fieldError("expires", "too_long", "grant cannot last longer than %d days", MaxGrantDuration/(24*time.Hour))
+	}
+
+	return nil
+}
+
+//CreateGrant creates a new Grant with the given fields (ID, GrantedBy, Revoked, and Expired are ignored and created) and returns its ID,
+//or an error if one occurred. A granted Event is recorded
+func (s *TxStore) CreateGrant(ctx context.Context, grant *Grant) (id int64, err error) {
+	tx := s.tx
+	user := ctx.Value(UserKey).(*User)
+
+	if err = grant.Validate(); err != nil {
+		return 0, &Error{Description: "Could not validate Grant", Type: ErrorTypeUser, Err: err}
+	}
+
+	if grant.Location != "" {
+		loc, lErr := s.ReadLocation(ctx, grant.Location)
+		if lErr != nil {
+			return 0, lErr
+		}
+		if loc == nil {
+			return 0, &Error{Description: "Could not validate Grant", Type: ErrorTypeUser, Err: fieldError("location", "invalid_location", "location (%s) must be a valid location", grant.Location)}
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO user_grant(user_id, role, location, starts, expires, granted_by) VALUES(?, ?, ?, ?, ?, ?);",
+		grant.UserID,
+		nullString(grant.Role),
+		nullString(string(grant.Location)),
+		grant.Starts,
+		grant.Expires,
+		nullID(user.ID),
+	)
+	if err != nil {
+		return 0, &Error{Description: "Could not insert Grant", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: "Could not fetch Grant id", Type: ErrorTypeServer, Err: err}
+	}
+
+	c := &CreatedContent{Fields: []*CreatedField{
+		{Name: "role", Value: grant.Role},
+		{Name: "location", Value: grant.Location},
+		{Name: "starts", Value: grant.Starts},
+		{Name: "expires", Value: grant.Expires},
+	}}
+
+	if _, err = s.CreateCreatedEvent(ctx, id, GrantEventLocation, c); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+//scanGrant scans a Grant from the given row
+func scanGrant(row interface{ Scan(...interface{}) error }) (*Grant, error) {
+	g := new(Grant)
+	var role, location sql.NullString
+	var grantedBy sql.NullInt64
+	var revoked sql.NullTime
+
+	if err := row.Scan(&(g.ID), &(g.UserID), &role, &location, &(g.Starts), &(g.Expires), &grantedBy, &revoked, &(g.Expired)); err != nil {
+		return nil, err
+	}
+
+	g.Role = role.String
+	g.Location = Location(location.String)
+	g.GrantedBy = grantedBy.Int64
+	g.Revoked = timePtr(revoked)
+
+	return g, nil
+}
+
+const grantColumns = "id, user_id, role, location, starts, expires, granted_by, revoked, expired"
+
+//ReadGrant returns the Grant with the given id, or an error if one occurred
+func (s *TxStore) ReadGrant(ctx context.Context, id int64) (*Grant, error) {
+	tx := s.tx
+
+	g, err := scanGrant(tx.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM user_grant WHERE id=?;", grantColumns), id))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query Grant(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return g, nil
+}
+
+//ReadUserGrants returns all Grants (including past ones) for the User with the given id, newest first, or an error if one occurred
+func (s *TxStore) ReadUserGrants(ctx context.Context, userID int64) ([]*Grant, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM user_grant WHERE user_id=? ORDER BY starts DESC, id DESC;", grantColumns), userID)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query Grants for User(%d)", userID), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	grants := []*Grant{}
+
+	for rows.Next() {
+		g, err := scanGrant(rows)
+		if err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan Grant row for User(%d)", userID), Type: ErrorTypeServer, Err: err}
+		}
+		grants = append(grants, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan Grant rows for User(%d)", userID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return grants, nil
+}
+
+//RevokeGrant ends the Grant with the given id now and records a modified Event, or returns an error if one occurred
+func (s *TxStore) RevokeGrant(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	g, err := s.ReadGrant(ctx, id)
+	if err != nil {
+		return err
+	}
+	if g == nil {
+		return &Error{Description: fmt.Sprintf("Could not revoke Grant(%d)", id), Type: ErrorTypeUser, Err: errors.New("grant does not exist")}
+	}
+	if g.Revoked != nil || g.Expired {
+		return &Error{Description: fmt.Sprintf("Could not revoke Grant(%d)", id), Type: ErrorTypeUser, Err: errors.New("grant has already ended")}
+	}
+
+	now := time.Now()
+
+	if _, err = tx.ExecContext(ctx, "UPDATE user_grant SET revoked=? WHERE id=?;", now, id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not revoke Grant(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	c := &ModifiedContent{Fields: []*ModifiedField{{Name: "revoked", OldValue: nil, NewValue: now}}}
+	if _, err = s.CreateModifiedEvent(ctx, id, GrantEventLocation, c); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//ExpireGrants records an expired Event for every unrevoked Grant past its expiry that hasn't been recorded yet
+//and returns the number of Grants expired, or an error if one occurred
+func (s *TxStore) ExpireGrants(ctx context.Context) (int, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, expires FROM user_grant WHERE expires <= ? AND revoked IS NULL AND expired = FALSE FOR UPDATE;", time.Now())
+	if err != nil {
+		return 0, &Error{Description: "Could not query expired Grants", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	expires := make(map[int64]time.Time)
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		var t time.Time
+		if err = rows.Scan(&id, &t); err != nil {
+			return 0, &Error{Description: "Could not scan expired Grant row", Type: ErrorTypeServer, Err: err}
+		}
+		ids = append(ids, id)
+		expires[id] = t
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, &Error{Description: "Could not scan expired Grant rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	for _, id := range ids {
+		if _, err = tx.ExecContext(ctx, "UPDATE user_grant SET expired=TRUE WHERE id=?;", id); err != nil {
+			return 0, &Error{Description: fmt.Sprintf("Could not expire Grant(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+
+		//expiry isn't done by a User
+		if _, err = s.CreateEvent(ctx, id, GrantEventLocation, &Event{Date: expires[id], Type: "expired"}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ids), nil
+}
+
+//readActiveGrants returns the Grants in effect now for the User with the given id, or an error if one occurred
+func (s *TxStore) readActiveGrants(ctx context.Context, userID int64) ([]*Grant, error) {
+	grants, err := s.ReadUserGrants(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var active []*Grant
+	now := time.Now()
+	for _, g := range grants {
+		if g.Active(now) {
+			active = append(active, g)
+		}
+	}
+
+	return active, nil
+}
+
+//ApplyUserGrants gives the given User the admin Role if they have an active admin Grant, or returns an error if one occurred.
+//Location Grants are applied when checking Location permissions
+func (s *TxStore) ApplyUserGrants(ctx context.Context, user *User) error {
+	if user.IsAdmin() {
+		return nil
+	}
+
+	active, err := s.readActiveGrants(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range active {
+		if g.Role == RoleAdmin {
+			user.Role = RoleAdmin
+		}
+	}
+
+	return nil
+}
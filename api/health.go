@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+//HealthCheck is the result of a single service self-check
+type HealthCheck struct {
+	ID        int64     `json:"id"`
+	Date      time.Time `json:"date"`
+	OK        bool      `json:"ok"`
+	DBLatency float64   `json:"db_latency_ms"`
+
+	//queue depths: pending webhook deliveries, due report schedules, and models and locations waiting for admin review
+	WebhookQueue int `json:"webhook_queue"`
+	ReportQueue  int `json:"report_queue"`
+	ReviewQueue  int `json:"review_queue"`
+
+	Error string `json:"error,omitempty"`
+}
+
+//ReadQueueDepths sets the queue depths of the given HealthCheck, or returns an error if one occurred
+func (s *TxStore) ReadQueueDepths(ctx context.Context, c *HealthCheck) error {
+	tx := s.tx
+
+	row := tx.QueryRowContext(ctx, `SELECT
+	(SELECT COUNT(*) FROM webhook_delivery WHERE status=?),
+	(SELECT COUNT(*) FROM report_schedule WHERE disabled=FALSE AND next_run <= ?),
+	(SELECT COUNT(*) FROM model WHERE reviewed=FALSE AND deleted_at IS NULL);`, WebhookDeliveryPending, c.Date)
+	if err := row.Scan(&(c.WebhookQueue), &(c.ReportQueue), &(c.ReviewQueue)); err != nil {
+		return &Error{Description: "Could not query queue depths", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//CreateHealthCheck records the given HealthCheck (ID is ignored and created) and deletes HealthChecks older than retention,
+//or returns an error if one occurred
+func (s *TxStore) CreateHealthCheck(ctx context.Context, c *HealthCheck, retention time.Duration) error {
+	tx := s.tx
+
+	var checkErr sql.NullString
+	if c.Error != "" {
+		checkErr = sql.NullString{String: c.Error, Valid: true}
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO health_check(date, ok, db_latency_ms, webhook_queue, report_queue, review_queue, error) VALUES(?, ?, ?, ?, ?, ?, ?);",
+		c.Date, c.OK, c.DBLatency, c.WebhookQueue, c.ReportQueue, c.ReviewQueue, checkErr,
+	)
+	if err != nil {
+		return &Error{Description: "Could not insert HealthCheck", Type: ErrorTypeServer, Err: err}
+	}
+
+	c.ID, err = res.LastInsertId()
+	if err != nil {
+		return &Error{Description: "Could not fetch HealthCheck id", Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM health_check WHERE date < ?;", c.Date.Add(-retention)); err != nil {
+		return &Error{Description: "Could not delete old HealthChecks", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//ReadHealthChecks returns the HealthChecks between since and until (if not zero), oldest first, or an error if one occurred
+func (s *TxStore) ReadHealthChecks(ctx context.Context, since, until time.Time) ([]*HealthCheck, error) {
+	tx := s.tx
+
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, date, ok, db_latency_ms, webhook_queue, report_queue, review_queue, IFNULL(error, '') FROM health_check WHERE date >= ? AND date < ? ORDER BY date, id;", since, until)
+	if err != nil {
+		return nil, &Error{Description: "Could not query HealthChecks", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	checks := make([]*HealthCheck, 0)
+	for rows.Next() {
+		c := new(HealthCheck)
+		if err = rows.Scan(&(c.ID), &(c.Date), &(c.OK), &(c.DBLatency), &(c.WebhookQueue), &(c.ReportQueue), &(c.ReviewQueue), &(c.Error)); err != nil {
+			return nil, &Error{Description: "Could not scan HealthCheck row", Type: ErrorTypeServer, Err: err}
+		}
+		checks = append(checks, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan HealthCheck rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const invitationTokenLen = 32
+
+//Invitation represents a pending invitation for someone to create their own User
+type Invitation struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	InvitedBy int64     `json:"invited_by"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+//hashToken returns a hash of the given invitation or Login revocation token. Tokens are random, so a fast hash is sufficient
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//CreateInvitation creates an Invitation for the given email from the given User, replacing any pending Invitation for the email.
+//It returns the Invitation and its token (which is only available now), or an error if one occurred
+func (s *TxStore) CreateInvitation(ctx context.Context, email string, invitedBy int64, ttl time.Duration) (*Invitation, string, error) {
+	tx := s.tx
+
+	//validate email the same way a User would be
+	if err := (&User{Email: email, Name: email}).Validate(); err != nil {
+		return nil, "", &Error{Description: "Could not validate Invitation", Type: ErrorTypeUser, Err: err}
+	}
+
+	dup, err := s.ReadUserByEmail(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+	if dup != nil {
+		return nil, "", &Error{Description: "Could not create Invitation", Type: ErrorTypeDuplicate, Err: errors.New("user already exists"), DuplicateID: dup.ID}
+	}
+
+	buf := make([]byte, invitationTokenLen)
+	if _, err = rand.Read(buf); err != nil {
+		return nil, "", &Error{Description: "Could not generate Invitation token", Type: ErrorTypeServer, Err: err}
+	}
+	token := hex.EncodeToString(buf)
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_invitation WHERE email=?;", email); err != nil {
+		return nil, "", &Error{Description: fmt.Sprintf("Could not delete Invitations for %s", email), Type: ErrorTypeServer, Err: err}
+	}
+
+	now := time.Now()
+	inv := &Invitation{Email: email, InvitedBy: invitedBy, Created: now, Expires: now.Add(ttl)}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO user_invitation(email, hash, invited_by, created, expires) VALUES(?, ?, ?, ?, ?);",
+		inv.Email,
+		hashToken(token),
+		nullID(inv.InvitedBy),
+		inv.Created,
+		inv.Expires,
+	)
+	if err != nil {
+		return nil, "", &Error{Description: "Could not insert Invitation", Type: ErrorTypeServer, Err: err}
+	}
+
+	inv.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, "", &Error{Description: "Could not fetch Invitation id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return inv, token, nil
+}
+
+//AcceptInvitation creates a User for the Invitation with the given token with the given name and password, and removes the Invitation.
+//It returns the new User's id, or an error if one occurred
+func (s *TxStore) AcceptInvitation(ctx context.Context, token, name, password string) (id int64, err error) {
+	tx := s.tx
+
+	var invID int64
+	var email string
+	var expires time.Time
+
+	row := tx.QueryRowContext(ctx, "SELECT id, email, expires FROM user_invitation WHERE hash=? FOR UPDATE;", hashToken(token))
+	err = row.Scan(&invID, &email, &expires)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, &Error{Description: "Could not accept Invitation", Type: ErrorTypeUser, Err: errors.New("invalid invitation token")}
+	case err != nil:
+		return 0, &Error{Description: "Could not query Invitation", Type: ErrorTypeServer, Err: err}
+	}
+
+	if expires.Before(time.Now()) {
+		return 0, &Error{Description: "Could not accept Invitation", Type: ErrorTypeUser, Err: errors.New("invitation has expired")}
+	}
+
+	if password == "" {
+		return 0, &Error{Description: "Could not validate password", Type: ErrorTypeUser, Err: errors.New("password cannot be empty")}
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return 0, &Error{Description: "Could not hash password", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = s.CreateUser(ctx, &User{Email: email, Hash: hash, Name: normalizeSpace(name)})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM user_invitation WHERE id=?;", invID); err != nil {
+		return 0, &Error{Description: fmt.Sprintf("Could not delete Invitation(%d)", invID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return id, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//DeviceLink represents a labeled link to an external record about a Device (e.g. a support case or purchase receipt)
+type DeviceLink struct {
+	ID       int64  `json:"id"`
+	DeviceID int64  `json:"device_id"`
+	Label    string `json:"label"`
+	URL      string `json:"url"`
+}
+
+//Validate cleans and validates the given DeviceLink
+func (l *DeviceLink) Validate() error {
+	l.Label = normalizeSpace(l.Label)
+	l.URL = strings.TrimSpace(l.URL)
+
+	if err := ValidateString("label", l.Label, 255); err != nil {
+		return err
+	}
+
+	if err := ValidateString("url", l.URL, 2048); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(l.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fieldError("url", "invalid_url", "url (%s) must be a valid http or https URL", l.URL)
+	}
+
+	return nil
+}
+
+//CreateDeviceLink creates a new DeviceLink with the given fields (ID is ignored and created) and returns its ID, or an error if one occurred
+func (s *TxStore) CreateDeviceLink(ctx context.Context, link *DeviceLink) (id int64, err error) {
+	tx := s.tx
+
+	if err = link.Validate(); err != nil {
+		return 0, &Error{Description: "Could not validate DeviceLink", Type: ErrorTypeUser, Err: err}
+	}
+
+	if err = s.CheckDevicePermission(ctx, link.DeviceID); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO device_link(device_id, label, url) VALUES(?, ?, ?);", link.DeviceID, link.Label, link.URL)
+	if err != nil {
+		return 0, &Error{Description: "Could not insert DeviceLink", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: "Could not fetch DeviceLink id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return id, nil
+}
+
+//ReadDeviceLink returns the DeviceLink with the given id, or an error if one occurred
+func (s *TxStore) ReadDeviceLink(ctx context.Context, id int64) (*DeviceLink, error) {
+	tx := s.tx
+
+	link := &DeviceLink{ID: id}
+
+	row := tx.QueryRowContext(ctx, "SELECT device_id, label, url FROM device_link WHERE id=?", id)
+	err := row.Scan(&(link.DeviceID), &(link.Label), &(link.URL))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query DeviceLink(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return link, nil
+}
+
+//ReadDeviceLinks returns the DeviceLinks for the Device with the given id, or an error if one occurred
+func (s *TxStore) ReadDeviceLinks(ctx context.Context, deviceID int64) ([]*DeviceLink, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, label, url FROM device_link WHERE device_id=? ORDER BY label, id;", deviceID)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query DeviceLinks for Device(%d)", deviceID), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	links := []*DeviceLink{}
+
+	for rows.Next() {
+		l := &DeviceLink{DeviceID: deviceID}
+		if err = rows.Scan(&(l.ID), &(l.Label), &(l.URL)); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan DeviceLink row for Device(%d)", deviceID), Type: ErrorTypeServer, Err: err}
+		}
+
+		links = append(links, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan DeviceLink rows for Device(%d)", deviceID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return links, nil
+}
+
+//UpdateDeviceLink updates the label and URL for the given DeviceLink (using the ID field), or returns an error if one occurred
+func (s *TxStore) UpdateDeviceLink(ctx context.Context, link *DeviceLink) error {
+	tx := s.tx
+
+	if err := link.Validate(); err != nil {
+		return &Error{Description: "Could not validate DeviceLink", Type: ErrorTypeUser, Err: err}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE device_link SET label=?, url=? WHERE id=?;", link.Label, link.URL, link.ID); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update DeviceLink(%d)", link.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//DeleteDeviceLink deletes the DeviceLink with the given id, or returns an error if one occurred
+func (s *TxStore) DeleteDeviceLink(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM device_link WHERE id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete DeviceLink(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
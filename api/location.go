@@ -4,6 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 //Location is an allowed location
@@ -21,25 +27,33 @@ func (s Location) Value() (driver.Value, error) {
 	return string(s), nil
 }
 
-//ReadLocations returns all Locations, or an error if one occurred
-func ReadLocations(ctx context.Context) ([]Location, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//locationsCacheKey is the Cache key for the list of all Locations
+const locationsCacheKey = "Locations"
+
+//ReadLocations returns all Locations, or an error if one occurred. The Locations are read through the request Cache
+func (s *TxStore) ReadLocations(ctx context.Context) ([]Location, error) {
+	tx := s.tx
+	cache := requestCache(ctx)
+
+	if cached, ok := cache.Get(locationsCacheKey); ok {
+		return append([]Location(nil), cached.([]Location)...), nil
+	}
 
 	var locations []Location
 
-	rows, err := tx.Query("SELECT location FROM location;")
+	rows, err := tx.QueryContext(ctx, "SELECT location FROM location;")
 	if err != nil {
 		return nil, &Error{Description: "Could not query Locations", Type: ErrorTypeServer, Err: err}
 	}
 
 	for rows.Next() {
-		var s Location
-		err = rows.Scan(&s)
+		var location Location
+		err = rows.Scan(&location)
 		if err != nil {
 			return nil, &Error{Description: "Could not scan Location row", Type: ErrorTypeServer, Err: err}
 		}
 
-		locations = append(locations, s)
+		locations = append(locations, location)
 	}
 
 	err = rows.Err()
@@ -47,5 +61,545 @@ func ReadLocations(ctx context.Context) ([]Location, error) {
 		return nil, &Error{Description: "Could not scan Location rows", Type: ErrorTypeServer, Err: err}
 	}
 
+	cache.Set(locationsCacheKey, append([]Location(nil), locations...))
+
 	return locations, nil
 }
+
+//ReadLocation returns the given Location if it exists, or an error if one occurred.
+func (s *TxStore) ReadLocation(ctx context.Context, location Location) (*Location, error) {
+	tx := s.tx
+
+	var l Location
+
+	row := tx.QueryRowContext(ctx, "SELECT location FROM location WHERE location=?", location)
+	err := row.Scan(&l)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	return &l, nil
+}
+
+//Validate cleans and validates the given Location
+func (s *Location) Validate() error {
+	*s = Location(strings.TrimSpace(string(*s)))
+	return ValidateString("location", string(*s), 255)
+}
+
+//CreateLocation creates a new Location, or returns an error if one occurred
+func (s *TxStore) CreateLocation(ctx context.Context, location Location) error {
+	tx := s.tx
+
+	if err := location.Validate(); err != nil {
+		return &Error{Description: "Could not validate Location", Type: ErrorTypeUser, Err: err}
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO location(location, created) VALUES(?, ?);", location, time.Now()); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			return &Error{Description: fmt.Sprintf("Could not insert Location(%s)", location), Type: ErrorTypeDuplicate, Err: err}
+		}
+		return &Error{Description: fmt.Sprintf("Could not insert Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	requestCache(ctx).Invalidate(locationsCacheKey)
+
+	return nil
+}
+
+//ReadLocationDeviceCount returns the number of Devices at the given Location, or an error if one occurred
+func (s *TxStore) ReadLocationDeviceCount(ctx context.Context, location Location) (int, error) {
+	tx := s.tx
+
+	var count int
+
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM device WHERE location=?;", location)
+	if err := row.Scan(&count); err != nil {
+		return 0, &Error{Description: fmt.Sprintf("Could not query Device count for Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	return count, nil
+}
+
+//RenameLocation renames the given Location, or returns an error if one occurred.
+//If cascade is true, Devices at the old Location are moved to the new Location with a Modified Event for each (in one EventBatch);
+//otherwise renaming a Location that Devices reference is an error.
+func (s *TxStore) RenameLocation(ctx context.Context, oldLocation, newLocation Location, cascade bool) error {
+	tx := s.tx
+	ctx = withEventBatch(ctx, fmt.Sprintf("Rename location %s to %s", oldLocation, newLocation))
+
+	count, err := s.ReadLocationDeviceCount(ctx, oldLocation)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 && !cascade {
+		return &Error{Description: fmt.Sprintf("Could not rename Location(%s)", oldLocation), Type: ErrorTypeUser,
+			Err: fmt.Errorf("location is referenced by %d devices and cascade is false", count)}
+	}
+
+	if err = s.CreateLocation(ctx, newLocation); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE location AS n, location AS o SET n.type=o.type, n.parent=o.parent, n.description=o.description, n.contact_name=o.contact_name, n.contact_email=o.contact_email, n.contact_phone=o.contact_phone, n.capacity=o.capacity, n.asset_tag_prefix=o.asset_tag_prefix WHERE n.location=? AND o.location=?;", newLocation, oldLocation); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not copy LocationDetail from Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE location SET parent=? WHERE parent=?;", newLocation, oldLocation); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not move child Locations from Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM device WHERE location=?;", oldLocation)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query Devices for Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not scan Device row for Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not scan Device rows for Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE device SET location=? WHERE location=?;", newLocation, oldLocation); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not move Devices from Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	for _, id := range ids {
+		c := &ModifiedContent{Fields: []*ModifiedField{
+			&ModifiedField{Name: "location", OldValue: oldLocation, NewValue: newLocation},
+		}}
+		if _, err = s.CreateModifiedEvent(ctx, id, DeviceEventLocation, c); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not created Modified Event Device(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE cart SET location=? WHERE location=?;", newLocation, oldLocation); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not move Carts from Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE user_location SET location=? WHERE location=?;", newLocation, oldLocation); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not move User grants from Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE user_grant SET location=? WHERE location=?;", newLocation, oldLocation); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not move temporary Grants from Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM location WHERE location=?;", oldLocation); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Location(%s)", oldLocation), Type: ErrorTypeServer, Err: err}
+	}
+
+	requestCache(ctx).Invalidate(locationsCacheKey)
+
+	return nil
+}
+
+//DeleteLocation deletes the given Location, or returns an error if one occurred.
+//Deleting a Location that Devices, Carts, Users, or Grants reference or that has child Locations is an error.
+func (s *TxStore) DeleteLocation(ctx context.Context, location Location) error {
+	tx := s.tx
+
+	count, err := s.ReadLocationDeviceCount(ctx, location)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete Location(%s)", location), Type: ErrorTypeUser,
+			Err: fmt.Errorf("location is referenced by %d devices", count)}
+	}
+
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM cart WHERE location=?;", location)
+	if err = row.Scan(&count); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query Cart count for Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	if count > 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete Location(%s)", location), Type: ErrorTypeUser,
+			Err: fmt.Errorf("location is the home of %d carts", count)}
+	}
+
+	//deleting a User's only Location (or Location Grant) would leave them unrestricted, so they must be removed first
+	row = tx.QueryRowContext(ctx, "SELECT COUNT(user_id) FROM user_location WHERE location=?;", location)
+	if err = row.Scan(&count); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query User count for Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	if count > 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete Location(%s)", location), Type: ErrorTypeUser,
+			Err: fmt.Errorf("location is granted to %d users", count)}
+	}
+
+	row = tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM user_grant WHERE location=?;", location)
+	if err = row.Scan(&count); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query Grant count for Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	if count > 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete Location(%s)", location), Type: ErrorTypeUser,
+			Err: fmt.Errorf("location is referenced by %d grants", count)}
+	}
+
+	children, err := s.readLocationChildren(ctx, location)
+	if err != nil {
+		return err
+	}
+
+	if len(children) > 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete Location(%s)", location), Type: ErrorTypeUser,
+			Err: fmt.Errorf("location is the parent of %d locations", len(children))}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM location WHERE location=?;", location); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	requestCache(ctx).Invalidate(locationsCacheKey)
+
+	return nil
+}
+
+//LocationType is the level of a Location in the location hierarchy
+type LocationType string
+
+//LocationTypes, from highest to lowest
+const (
+	LocationTypeCampus   LocationType = "campus"
+	LocationTypeBuilding LocationType = "building"
+	LocationTypeRoom     LocationType = "room"
+)
+
+//locationTypeRanks orders LocationTypes from highest to lowest
+var locationTypeRanks = map[LocationType]int{
+	LocationTypeCampus:   1,
+	LocationTypeBuilding: 2,
+	LocationTypeRoom:     3,
+}
+
+//LocationDetail represents a Location's place in the location hierarchy, its metadata, and who to contact about it.
+//Capacity is the maximum number of Devices the Location should hold, or 0 if there is no limit.
+//AssetTagPrefix is used for generated asset tags of Devices in the Location or its children.
+//Path (from the top of the hierarchy down to and including Location) and Children are populated for Reads
+type LocationDetail struct {
+	Location       Location     `json:"location"`
+	Type           LocationType `json:"type,omitempty"`
+	Parent         Location     `json:"parent,omitempty"`
+	Description    string       `json:"description,omitempty"`
+	ContactName    string       `json:"contact_name,omitempty"`
+	ContactEmail   string       `json:"contact_email,omitempty"`
+	ContactPhone   string       `json:"contact_phone,omitempty"`
+	Capacity       int64        `json:"capacity,omitempty"`
+	AssetTagPrefix string       `json:"asset_tag_prefix,omitempty"`
+	Path           []Location   `json:"path,omitempty"`
+	Children       []Location   `json:"children,omitempty"`
+}
+
+//Validate cleans and validates the given LocationDetail
+func (l *LocationDetail) Validate(ctx context.Context, s *TxStore) error {
+	l.Type = LocationType(strings.TrimSpace(string(l.Type)))
+	l.Parent = Location(strings.TrimSpace(string(l.Parent)))
+	l.Description = strings.TrimSpace(l.Description)
+	l.ContactName = strings.TrimSpace(l.ContactName)
+	l.ContactEmail = strings.TrimSpace(l.ContactEmail)
+	l.ContactPhone = strings.TrimSpace(l.ContactPhone)
+	l.AssetTagPrefix = strings.TrimSpace(l.AssetTagPrefix)
+
+	if _, ok := locationTypeRanks[l.Type]; l.Type != "" && !ok {
+		return fieldError("type", "invalid_type", "type (%s) must be one of %s, %s, or %s", l.Type, LocationTypeCampus, LocationTypeBuilding, LocationTypeRoom)
+	}
+
+	if len(l.Description) > 65535 {
+		return fieldError("description", "too_long", "description length (%d) was more than maximum allowed (%d)", len(l.Description), 65535)
+	}
+
+	if len(l.ContactName) > 255 {
+		return fieldError("contact_name", "too_long", "contact_name length (%d) was more than maximum allowed (%d)", len(l.ContactName), 255)
+	}
+
+	if l.ContactEmail != "" {
+		if e, err := mail.ParseAddress(fmt.Sprintf("Contact <%s>", l.ContactEmail)); err != nil || e.Address != l.ContactEmail || len(l.ContactEmail) > 255 {
+			return fieldError("contact_email", "invalid_email", "contact_email (%s) must be a valid email", l.ContactEmail)
+		}
+	}
+
+	if len(l.ContactPhone) > 50 {
+		return fieldError("contact_phone", "too_long", "contact_phone length (%d) was more than maximum allowed (%d)", len(l.ContactPhone), 50)
+	}
+
+	if len(l.AssetTagPrefix) > 20 {
+		return fieldError("asset_tag_prefix", "too_long", "asset_tag_prefix length (%d) was more than maximum allowed (%d)", len(l.AssetTagPrefix), 20)
+	}
+
+	if l.Capacity < 0 {
+		return fieldError("capacity", "negative", "capacity (%d) must not be negative", l.Capacity)
+	}
+
+	if l.Parent == "" {
+		return nil
+	}
+
+	//walk up the hierarchy from the parent to check for cycles and type ordering
+	parent := l.Parent
+	for i := 0; parent != ""; i++ {
+		if parent == l.Location {
+			return fieldError("parent", "invalid_parent", "parent (%s) must not be the location or one of its children", l.Parent)
+		}
+
+		p, err := s.readLocationDetail(ctx, parent)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			return fieldError("parent", "invalid_parent", "parent (%s) must be a valid location", parent)
+		}
+
+		if i == 0 && l.Type != "" && p.Type != "" && locationTypeRanks[p.Type] >= locationTypeRanks[l.Type] {
+			return fieldError("parent", "invalid_parent", "parent (%s) type (%s) must be above type (%s)", p.Location, p.Type, l.Type)
+		}
+
+		parent = p.Parent
+	}
+
+	return nil
+}
+
+//readLocationDetail returns the LocationDetail (without Path or Children) for the given Location, or an error if one occurred
+func (s *TxStore) readLocationDetail(ctx context.Context, location Location) (*LocationDetail, error) {
+	tx := s.tx
+
+	l := new(LocationDetail)
+	var typ, parent, description, contactName, contactEmail, contactPhone, assetTagPrefix sql.NullString
+	var capacity sql.NullInt64
+
+	row := tx.QueryRowContext(ctx, "SELECT location, type, parent, description, contact_name, contact_email, contact_phone, capacity, asset_tag_prefix FROM location WHERE location=?", location)
+	err := row.Scan(&(l.Location), &typ, &parent, &description, &contactName, &contactEmail, &contactPhone, &capacity, &assetTagPrefix)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query LocationDetail(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	l.Type = LocationType(typ.String)
+	l.Parent = Location(parent.String)
+	l.Description = description.String
+	l.ContactName = contactName.String
+	l.ContactEmail = contactEmail.String
+	l.ContactPhone = contactPhone.String
+	l.Capacity = capacity.Int64
+	l.AssetTagPrefix = assetTagPrefix.String
+
+	return l, nil
+}
+
+//readLocationChildren returns the child Locations of the given Location, or an error if one occurred
+func (s *TxStore) readLocationChildren(ctx context.Context, location Location) ([]Location, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT location FROM location WHERE parent=? ORDER BY location;", location)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query children of Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var children []Location
+
+	for rows.Next() {
+		var l Location
+		if err = rows.Scan(&l); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan child row of Location(%s)", location), Type: ErrorTypeServer, Err: err}
+		}
+		children = append(children, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan child rows of Location(%s)", location), Type: ErrorTypeServer, Err: err}
+	}
+
+	return children, nil
+}
+
+//readLocationDescendants returns the given Location and all Locations below it in the hierarchy, or an error if one occurred
+func (s *TxStore) readLocationDescendants(ctx context.Context, location Location) ([]Location, error) {
+	locations := []Location{location}
+
+	//the hierarchy can't have cycles (see LocationDetail.Validate)
+	for i := 0; i < len(locations); i++ {
+		children, err := s.readLocationChildren(ctx, locations[i])
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, children...)
+	}
+
+	return locations, nil
+}
+
+//ReadLocationDetail returns the LocationDetail for the given Location, or an error if one occurred.
+func (s *TxStore) ReadLocationDetail(ctx context.Context, location Location) (*LocationDetail, error) {
+	l, err := s.readLocationDetail(ctx, location)
+	if err != nil || l == nil {
+		return nil, err
+	}
+
+	l.Path = []Location{l.Location}
+	for parent := l.Parent; parent != ""; {
+		p, err := s.readLocationDetail(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			break
+		}
+		l.Path = append([]Location{p.Location}, l.Path...)
+		parent = p.Parent
+	}
+
+	if l.Children, err = s.readLocationChildren(ctx, location); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+//UpdateLocationDetail updates the hierarchy and metadata fields for the given LocationDetail (using the Location field, Path and Children are ignored),
+//or returns an error if one occurred
+func (s *TxStore) UpdateLocationDetail(ctx context.Context, detail *LocationDetail) error {
+	tx := s.tx
+
+	if err := detail.Validate(ctx, s); err != nil {
+		if _, ok := err.(*Error); ok {
+			return err
+		}
+		return &Error{Description: "Could not validate LocationDetail", Type: ErrorTypeUser, Err: err}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE location SET type=?, parent=?, description=?, contact_name=?, contact_email=?, contact_phone=?, capacity=?, asset_tag_prefix=? WHERE location=?;",
+		nullString(string(detail.Type)),
+		nullString(string(detail.Parent)),
+		nullString(detail.Description),
+		nullString(detail.ContactName),
+		nullString(detail.ContactEmail),
+		nullString(detail.ContactPhone),
+		nullID(detail.Capacity),
+		nullString(detail.AssetTagPrefix),
+		detail.Location,
+	)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update LocationDetail(%s)", detail.Location), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//LocationTree represents a Location and its descendants
+type LocationTree struct {
+	Location Location        `json:"location"`
+	Type     LocationType    `json:"type,omitempty"`
+	Children []*LocationTree `json:"children,omitempty"`
+}
+
+//ReadLocationTree returns the location hierarchy as a list of top-level LocationTrees, or an error if one occurred
+func (s *TxStore) ReadLocationTree(ctx context.Context) ([]*LocationTree, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT location, type, parent FROM location ORDER BY location;")
+	if err != nil {
+		return nil, &Error{Description: "Could not query LocationTree", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	nodes := make(map[Location]*LocationTree)
+	parents := make(map[Location]Location)
+	var order []Location
+
+	for rows.Next() {
+		n := new(LocationTree)
+		var typ, parent sql.NullString
+		if err = rows.Scan(&(n.Location), &typ, &parent); err != nil {
+			return nil, &Error{Description: "Could not scan LocationTree row", Type: ErrorTypeServer, Err: err}
+		}
+		n.Type = LocationType(typ.String)
+
+		nodes[n.Location] = n
+		parents[n.Location] = Location(parent.String)
+		order = append(order, n.Location)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan LocationTree rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	var roots []*LocationTree
+
+	for _, l := range order {
+		if p, ok := nodes[parents[l]]; ok {
+			p.Children = append(p.Children, nodes[l])
+		} else {
+			roots = append(roots, nodes[l])
+		}
+	}
+
+	return roots, nil
+}
+
+//LocationUtilization represents how full a Location is. Capacity is 0 if the Location has no limit
+type LocationUtilization struct {
+	Location     Location `json:"location"`
+	Capacity     int64    `json:"capacity"`
+	Count        int64    `json:"count"`
+	ContactName  string   `json:"contact_name,omitempty"`
+	ContactEmail string   `json:"contact_email,omitempty"`
+}
+
+//OverCapacity returns true if the Location has more Devices than its Capacity
+func (u *LocationUtilization) OverCapacity() bool {
+	return u.Capacity > 0 && u.Count > u.Capacity
+}
+
+//ReadLocationUtilization returns the LocationUtilization for the given Location, or an error if one occurred.
+//The contact is the nearest one in the Location's path
+func (s *TxStore) ReadLocationUtilization(ctx context.Context, location Location) (*LocationUtilization, error) {
+	l, err := s.readLocationDetail(ctx, location)
+	if err != nil || l == nil {
+		return nil, err
+	}
+
+	count, err := s.ReadLocationDeviceCount(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &LocationUtilization{Location: location, Capacity: l.Capacity, Count: int64(count)}
+
+	for p := l; p != nil; {
+		if p.ContactEmail != "" {
+			u.ContactName = p.ContactName
+			u.ContactEmail = p.ContactEmail
+			break
+		}
+		if p.Parent == "" {
+			break
+		}
+		if p, err = s.readLocationDetail(ctx, p.Parent); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const loginRevokeTokenLen = 32
+
+//Login represents a successful authentication by a User
+type Login struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Date      time.Time `json:"date"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+//CreateLogin records the given Login (ID is ignored and created) and returns whether or not it's from a new device:
+//a user agent or IP address the User hasn't logged in from before, or an error if one occurred
+func (s *TxStore) CreateLogin(ctx context.Context, login *Login) (newDevice bool, err error) {
+	tx := s.tx
+
+	if len(login.UserAgent) > 512 {
+		login.UserAgent = login.UserAgent[:512]
+	}
+
+	var agents, ips sql.NullInt64
+
+	row := tx.QueryRowContext(ctx, "SELECT SUM(user_agent=?), SUM(ip=?) FROM user_login WHERE user_id=?;", login.UserAgent, login.IP, login.UserID)
+	if err = row.Scan(&agents, &ips); err != nil {
+		return false, &Error{Description: fmt.Sprintf("Could not query Logins for User(%d)", login.UserID), Type: ErrorTypeServer, Err: err}
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO user_login(user_id, date, ip, user_agent) VALUES(?, ?, ?, ?);",
+		login.UserID,
+		login.Date,
+		login.IP,
+		login.UserAgent,
+	)
+	if err != nil {
+		return false, &Error{Description: "Could not insert Login", Type: ErrorTypeServer, Err: err}
+	}
+
+	login.ID, err = res.LastInsertId()
+	if err != nil {
+		return false, &Error{Description: "Could not fetch Login id", Type: ErrorTypeServer, Err: err}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE user SET last_login_at=?, last_login_ip=?, last_activity_at=? WHERE id=?;", login.Date, login.IP, login.Date, login.UserID)
+	if err != nil {
+		return false, &Error{Description: fmt.Sprintf("Could not update last login for User(%d)", login.UserID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return agents.Int64 == 0 || ips.Int64 == 0, nil
+}
+
+//CreateLoginRevocation creates a token for the Login with the given id that can be used once before ttl has passed
+//to sign its User out everywhere (see RevokeLogin). It returns the token (which is only available now), or an error if one occurred
+func (s *TxStore) CreateLoginRevocation(ctx context.Context, id int64, ttl time.Duration) (string, error) {
+	tx := s.tx
+
+	buf := make([]byte, loginRevokeTokenLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", &Error{Description: "Could not generate Login revocation token", Type: ErrorTypeServer, Err: err}
+	}
+	token := hex.EncodeToString(buf)
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user_login SET revoke_hash=?, revoke_expires=? WHERE id=?;", hashToken(token), time.Now().Add(ttl), id); err != nil {
+		return "", &Error{Description: fmt.Sprintf("Could not update Login(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return token, nil
+}
+
+//RevokeLogin uses the given Login revocation token and returns its Login, whose User's sessions should be revoked,
+//or an error if one occurred. Each token can only be used once
+func (s *TxStore) RevokeLogin(ctx context.Context, token string) (*Login, error) {
+	tx := s.tx
+
+	login := new(Login)
+	var expires time.Time
+
+	row := tx.QueryRowContext(ctx, "SELECT id, user_id, date, ip, user_agent, revoke_expires FROM user_login WHERE revoke_hash=? FOR UPDATE;", hashToken(token))
+	switch err := row.Scan(&(login.ID), &(login.UserID), &(login.Date), &(login.IP), &(login.UserAgent), &expires); {
+	case err == sql.ErrNoRows:
+		return nil, &Error{Description: "Could not revoke Login", Type: ErrorTypeUser, Err: errors.New("invalid or used revocation token")}
+	case err != nil:
+		return nil, &Error{Description: "Could not query Login", Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user_login SET revoke_hash=NULL, revoke_expires=NULL WHERE id=?;", login.ID); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not update Login(%d)", login.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	if expires.Before(time.Now()) {
+		return nil, &Error{Description: "Could not revoke Login", Type: ErrorTypeUser, Err: errors.New("revocation token has expired")}
+	}
+
+	return login, nil
+}
+
+//AuthFailure represents a failed or blocked authentication attempt. UserID is 0 if the email doesn't match a User
+type AuthFailure struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Date      time.Time `json:"date"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason"`
+}
+
+//CreateAuthFailure records the given AuthFailure (ID is ignored and created), or returns an error if one occurred
+func (s *TxStore) CreateAuthFailure(ctx context.Context, failure *AuthFailure) error {
+	tx := s.tx
+
+	if len(failure.Email) > 255 {
+		failure.Email = failure.Email[:255]
+	}
+
+	if len(failure.UserAgent) > 512 {
+		failure.UserAgent = failure.UserAgent[:512]
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO auth_failure(email, user_id, date, ip, user_agent, reason) VALUES(?, ?, ?, ?, ?, ?);",
+		failure.Email,
+		nullID(failure.UserID),
+		failure.Date,
+		failure.IP,
+		failure.UserAgent,
+		failure.Reason,
+	)
+	if err != nil {
+		return &Error{Description: "Could not insert AuthFailure", Type: ErrorTypeServer, Err: err}
+	}
+
+	failure.ID, err = res.LastInsertId()
+	if err != nil {
+		return &Error{Description: "Could not fetch AuthFailure id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
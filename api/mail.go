@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+//Mailer is an interface to an arbitrary email backend
+type Mailer interface {
+	//Send sends a plain text email with the given subject and body to the given addresses
+	Send(to []string, subject, body string) error
+	//SendMessage sends the given Message to the given addresses
+	SendMessage(to []string, msg *Message) error
+}
+
+//Attachment is a file attached to a Message
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+//Message is an email with a plain text Body, an optional HTML body, and optional Attachments
+type Message struct {
+	Subject     string
+	Body        string
+	HTML        string
+	Attachments []*Attachment
+}
+
+//SMTPMailer represents a Mailer that sends through an SMTP server
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+//NewSMTPMailer returns a new SMTPMailer for the given server address (host:port) and From address.
+//If username is empty, no authentication is used
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+//writeHeaders writes the common message headers to msg
+func (m *SMTPMailer) writeHeaders(msg *bytes.Buffer, to []string, subject string) {
+	fmt.Fprintf(msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+}
+
+//Send sends a plain text email with the given subject and body to the given addresses
+func (m *SMTPMailer) Send(to []string, subject, body string) error {
+	msg := new(bytes.Buffer)
+	m.writeHeaders(msg, to, subject)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(m.addr, m.auth, m.from, to, msg.Bytes())
+}
+
+//writeTextPart writes a quoted-printable text part with the given content type to w
+func writeTextPart(w *multipart.Writer, contentType, body string) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err = qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+//writeAttachment writes the given Attachment as a base64 encoded part to w
+func writeAttachment(w *multipart.Writer, a *Attachment) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", a.ContentType)
+	h.Set("Content-Transfer-Encoding", "base64")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	//base64 lines must be at most 76 characters
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	for len(enc) > 76 {
+		if _, err = fmt.Fprintf(part, "%s\r\n", enc[:76]); err != nil {
+			return err
+		}
+		enc = enc[76:]
+	}
+	_, err = fmt.Fprintf(part, "%s\r\n", enc)
+	return err
+}
+
+//SendMessage sends the given Message to the given addresses
+func (m *SMTPMailer) SendMessage(to []string, msg *Message) error {
+	buf := new(bytes.Buffer)
+	m.writeHeaders(buf, to, msg.Subject)
+
+	mixed := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed.Boundary())
+
+	if msg.HTML == "" {
+		if err := writeTextPart(mixed, "text/plain", msg.Body); err != nil {
+			return fmt.Errorf("Could not write body: %v", err)
+		}
+	} else {
+		//the alternative parts are written first so the part header can include their boundary
+		body := new(bytes.Buffer)
+		alt := multipart.NewWriter(body)
+		if err := writeTextPart(alt, "text/plain", msg.Body); err != nil {
+			return fmt.Errorf("Could not write body: %v", err)
+		}
+		if err := writeTextPart(alt, "text/html", msg.HTML); err != nil {
+			return fmt.Errorf("Could not write HTML body: %v", err)
+		}
+		if err := alt.Close(); err != nil {
+			return fmt.Errorf("Could not write body: %v", err)
+		}
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", alt.Boundary()))
+		part, err := mixed.CreatePart(h)
+		if err != nil {
+			return fmt.Errorf("Could not write body: %v", err)
+		}
+		if _, err = body.WriteTo(part); err != nil {
+			return fmt.Errorf("Could not write body: %v", err)
+		}
+	}
+
+	for _, a := range msg.Attachments {
+		if err := writeAttachment(mixed, a); err != nil {
+			return fmt.Errorf("Could not write attachment %s: %v", a.Name, err)
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return fmt.Errorf("Could not write message: %v", err)
+	}
+
+	return smtp.SendMail(m.addr, m.auth, m.from, to, buf.Bytes())
+}
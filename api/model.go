@@ -3,50 +3,106 @@ package api
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
-//Model represents a device model
+//Model represents a device model. CategoryID is populated for Create, Read, and Update. Category is populated for Reads and Queries.
+//EOLDate and EOSDate are the optional end-of-life and end-of-support dates for the Model.
 type Model struct {
-	ID           int64  `json:"id"`
-	Manufacturer string `json:"manufacturer"`
-	Model        string `json:"model"`
+	ID           int64      `json:"id"`
+	Manufacturer string     `json:"manufacturer"`
+	Model        string     `json:"model"`
+	CategoryID   int64      `json:"category_id,omitempty"`
+	Category     *Category  `json:"category,omitempty"`
+	EOLDate      *time.Time `json:"eol_date,omitempty"`
+	EOSDate      *time.Time `json:"eos_date,omitempty"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
 }
 
 //Validate cleans and validates the given Model
-func (m *Model) Validate() error {
-	m.Manufacturer = strings.TrimSpace(m.Manufacturer)
-	m.Model = strings.TrimSpace(m.Model)
+func (m *Model) Validate(ctx context.Context, s *TxStore) error {
+	m.Manufacturer = normalizeSpace(m.Manufacturer)
+	m.Model = normalizeSpace(m.Model)
 
 	if err := ValidateString("manufacturer", m.Manufacturer, 255); err != nil {
 		return err
 	}
 
-	return ValidateString("model", m.Model, 255)
+	if err := ValidateString("model", m.Model, 255); err != nil {
+		return err
+	}
+
+	if m.CategoryID != 0 {
+		if category, err := s.ReadCategory(ctx, m.CategoryID); category == nil || err != nil {
+			return fieldError("category_id", "invalid_category", "category (%d) must be a valid category", m.CategoryID)
+		}
+	}
+
+	if m.EOLDate != nil && m.EOSDate != nil && m.EOSDate.Before(*m.EOLDate) {
+		return fieldError("eos_date", "invalid_date", "eos_date (%s) must not be before eol_date (%s)", m.EOSDate.Format("2006-01-02"), m.EOLDate.Format("2006-01-02"))
+	}
+
+	return nil
+}
+
+//scanCategory sets the Category fields of the Model from the given nullable columns
+func (m *Model) scanCategory(id sql.NullInt64, name sql.NullString) {
+	if !id.Valid {
+		return
+	}
+	m.CategoryID = id.Int64
+	m.Category = &Category{ID: id.Int64, Name: name.String}
 }
 
 //CreateModel creates a new Model with the given fields (ID and Events are ignored and created) and returns its ID, or an error if one occurred
-func CreateModel(ctx context.Context, model *Model) (id int64, err error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) CreateModel(ctx context.Context, model *Model) (id int64, err error) {
+	tx := s.tx
 
-	if err = model.Validate(); err != nil {
+	if err = model.Validate(ctx, s); err != nil {
 		return 0, &Error{Description: "Could not validate Model", Type: ErrorTypeUser, Err: err}
 	}
 
-	res, err := tx.Exec("INSERT INTO model(manufacturer, model) VALUES(?, ?);",
+	dup, err := s.ReadModelByManufacturerAndModel(ctx, model.Manufacturer, model.Model)
+	if err != nil {
+		return 0, err
+	}
+	if dup != nil {
+		return 0, &Error{Description: "Could not insert Model", Type: ErrorTypeDuplicate, Err: fmt.Errorf("model matches existing Model(%d) (%s %s)", dup.ID, dup.Manufacturer, dup.Model), DuplicateID: dup.ID}
+	}
+
+	if err = s.checkVocabularyQuota(ctx); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO model(manufacturer, model, manufacturer_key, model_key, category_id, eol_date, eos_date, created, reviewed) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?);",
 		model.Manufacturer,
 		model.Model,
+		normalizeKey(model.Manufacturer),
+		normalizeKey(model.Model),
+		nullID(model.CategoryID),
+		nullTime(model.EOLDate),
+		nullTime(model.EOSDate),
+		time.Now(),
+		vocabularyReviewed(ctx),
 	)
 	if err != nil {
 		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
-			dup, newErr := ReadModelByManufacturerAndModel(ctx, model.Manufacturer, model.Model)
+			//a concurrent insert may not be visible to this transaction yet
+			dup, newErr := s.ReadModelByManufacturerAndModel(ctx, model.Manufacturer, model.Model)
 			if newErr != nil {
 				return 0, newErr
 			}
-			return 0, &Error{Description: "Could not insert Model", Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+			e := &Error{Description: "Could not insert Model", Type: ErrorTypeDuplicate, Err: err}
+			if dup != nil {
+				e.DuplicateID = dup.ID
+			}
+			return 0, e
 		}
 		return 0, &Error{Description: "Could not insert Model", Type: ErrorTypeServer, Err: err}
 	}
@@ -56,17 +112,32 @@ func CreateModel(ctx context.Context, model *Model) (id int64, err error) {
 		return 0, &Error{Description: "Could not fetch Model id", Type: ErrorTypeServer, Err: err}
 	}
 
+	addModelFeedEvent(ctx, id, "created")
+	if err = s.queueModelWebhooks(ctx, id, WebhookEventModelCreated); err != nil {
+		return 0, err
+	}
+
 	return id, nil
 }
 
-//ReadModel returns the Model with the given id, or an error if one occurred.
-func ReadModel(ctx context.Context, id int64) (*Model, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//ReadModel returns the Model with the given id, or an error if one occurred. The Model is read through the request Cache
+func (s *TxStore) ReadModel(ctx context.Context, id int64) (*Model, error) {
+	tx := s.tx
+	cache := requestCache(ctx)
+	key := cacheKey("Model", id)
+
+	if cached, ok := cache.Get(key); ok {
+		model := cached.(Model)
+		return &model, nil
+	}
 
 	model := &Model{ID: id}
+	var categoryID sql.NullInt64
+	var categoryName sql.NullString
+	var eolDate, eosDate sql.NullTime
 
-	row := tx.QueryRow("SELECT manufacturer, model FROM model WHERE id=?", id)
-	err := row.Scan(&(model.Manufacturer), &(model.Model))
+	row := tx.QueryRowContext(ctx, "SELECT m.manufacturer, m.model, c.id, c.name, m.eol_date, m.eos_date FROM model AS m LEFT JOIN category AS c ON m.category_id = c.id WHERE m.id=? AND m.deleted_at IS NULL", id)
+	err := row.Scan(&(model.Manufacturer), &(model.Model), &categoryID, &categoryName, &eolDate, &eosDate)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -75,17 +146,88 @@ func ReadModel(ctx context.Context, id int64) (*Model, error) {
 		return nil, &Error{Description: fmt.Sprintf("Could not query Model(%d)", id), Type: ErrorTypeServer, Err: err}
 	}
 
+	model.scanCategory(categoryID, categoryName)
+	model.EOLDate = timePtr(eolDate)
+	model.EOSDate = timePtr(eosDate)
+
+	cache.Set(key, *model)
+
 	return model, nil
 }
 
+//ReadModelsByIDs returns the Models with the given ids, keyed by id, or an error if one occurred.
+//Models that don't exist aren't included. Deleted Models are included (with DeletedAt set) so history can still show them
+func (s *TxStore) ReadModelsByIDs(ctx context.Context, ids []int64) (map[int64]*Model, error) {
+	tx := s.tx
+	cache := requestCache(ctx)
+
+	models := make(map[int64]*Model)
+
+	var placeholders []string
+	var parameters []interface{}
+	for _, id := range ids {
+		if cached, ok := cache.Get(cacheKey("Model", id)); ok {
+			model := cached.(Model)
+			models[id] = &model
+			continue
+		}
+		placeholders = append(placeholders, "?")
+		parameters = append(parameters, id)
+	}
+
+	if len(parameters) == 0 {
+		return models, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT m.id, m.manufacturer, m.model, c.id, c.name, m.eol_date, m.eos_date, m.deleted_at FROM model AS m LEFT JOIN category AS c ON m.category_id = c.id WHERE m.id IN (%s)", strings.Join(placeholders, ", ")), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query Models", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		model := new(Model)
+		var categoryID sql.NullInt64
+		var categoryName sql.NullString
+		var eolDate, eosDate, deleted sql.NullTime
+
+		if err = rows.Scan(&(model.ID), &(model.Manufacturer), &(model.Model), &categoryID, &categoryName, &eolDate, &eosDate, &deleted); err != nil {
+			return nil, &Error{Description: "Could not scan Model row", Type: ErrorTypeServer, Err: err}
+		}
+
+		model.scanCategory(categoryID, categoryName)
+		model.EOLDate = timePtr(eolDate)
+		model.EOSDate = timePtr(eosDate)
+		model.DeletedAt = timePtr(deleted)
+
+		//ReadModel doesn't return deleted Models, so they aren't cached
+		if !deleted.Valid {
+			cache.Set(cacheKey("Model", model.ID), *model)
+		}
+		models[model.ID] = model
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan Model rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return models, nil
+}
+
 //ReadModelByManufacturerAndModel returns the Model with the given Manufacturer and Model, or an error if one occurred.
-func ReadModelByManufacturerAndModel(ctx context.Context, manufacturer, model string) (*Model, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//Matching is case-insensitive and ignores repeated whitespace (using the unique normalized key columns);
+//the returned Model contains the stored (canonical) names. Deleted Models are returned with DeletedAt set.
+func (s *TxStore) ReadModelByManufacturerAndModel(ctx context.Context, manufacturer, model string) (*Model, error) {
+	tx := s.tx
 
-	newModel := &Model{Manufacturer: manufacturer, Model: model}
+	newModel := new(Model)
+	var deleted sql.NullTime
 
-	row := tx.QueryRow("SELECT id FROM model WHERE manufacturer=? AND model=?", manufacturer, model)
-	err := row.Scan(&(newModel.ID))
+	row := tx.QueryRowContext(ctx, "SELECT id, manufacturer, model, deleted_at FROM model WHERE manufacturer_key=? AND model_key=?",
+		normalizeKey(manufacturer),
+		normalizeKey(model),
+	)
+	err := row.Scan(&(newModel.ID), &(newModel.Manufacturer), &(newModel.Model), &deleted)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -93,61 +235,90 @@ func ReadModelByManufacturerAndModel(ctx context.Context, manufacturer, model st
 	case err != nil:
 		return nil, &Error{Description: fmt.Sprintf("Could not query ModelByManufacturerAndModel(%s %s)", manufacturer, model), Type: ErrorTypeServer, Err: err}
 	}
+	newModel.DeletedAt = timePtr(deleted)
 
 	return newModel, nil
 }
 
 //UpdateModel updates the fields for the given Model (using the ID field, Events are ignored), or returns an error if one occurred
-func UpdateModel(ctx context.Context, model *Model) error {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) UpdateModel(ctx context.Context, model *Model) error {
+	tx := s.tx
 
-	if err := model.Validate(); err != nil {
+	if err := model.Validate(ctx, s); err != nil {
 		return &Error{Description: "Could not validate Model", Type: ErrorTypeUser, Err: err}
 	}
 
-	_, err := tx.Exec("UPDATE model SET manufacturer=?, model=? WHERE id=?;",
+	dup, err := s.ReadModelByManufacturerAndModel(ctx, model.Manufacturer, model.Model)
+	if err != nil {
+		return err
+	}
+	if dup != nil && dup.ID != model.ID {
+		return &Error{Description: fmt.Sprintf("Could not update Model(%d)", model.ID), Type: ErrorTypeDuplicate, Err: fmt.Errorf("model matches existing Model(%d) (%s %s)", dup.ID, dup.Manufacturer, dup.Model), DuplicateID: dup.ID}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE model SET manufacturer=?, model=?, manufacturer_key=?, model_key=?, category_id=?, eol_date=?, eos_date=? WHERE id=?;",
 		model.Manufacturer,
 		model.Model,
+		normalizeKey(model.Manufacturer),
+		normalizeKey(model.Model),
+		nullID(model.CategoryID),
+		nullTime(model.EOLDate),
+		nullTime(model.EOSDate),
 		model.ID,
 	)
 	if err != nil {
 		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
-			dup, newErr := ReadModelByManufacturerAndModel(ctx, model.Manufacturer, model.Model)
+			dup, newErr := s.ReadModelByManufacturerAndModel(ctx, model.Manufacturer, model.Model)
 			if newErr != nil {
 				return newErr
 			}
-			return &Error{Description: fmt.Sprintf("Could not update Model(%d)", model.ID), Type: ErrorTypeDuplicate, Err: err, DuplicateID: dup.ID}
+			e := &Error{Description: fmt.Sprintf("Could not update Model(%d)", model.ID), Type: ErrorTypeDuplicate, Err: err}
+			if dup != nil {
+				e.DuplicateID = dup.ID
+			}
+			return e
 		}
 		return &Error{Description: fmt.Sprintf("Could not update Model(%d)", model.ID), Type: ErrorTypeServer, Err: err}
 	}
 
+	requestCache(ctx).Invalidate(cacheKey("Model", model.ID))
+	addModelFeedEvent(ctx, model.ID, "modified")
+	if err = s.queueModelWebhooks(ctx, model.ID, WebhookEventModelModified); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-//QueryModel returns all Models matching the given manufacturer and model or an error if one occurred.
-func QueryModel(ctx context.Context, manufacturer, model string) ([]*Model, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//QueryModel returns all Models matching the given manufacturer, model, and category or an error if one occurred.
+func (s *TxStore) QueryModel(ctx context.Context, manufacturer, model, category string) ([]*Model, error) {
+	tx := s.tx
 
-	var criteria []string
+	criteria := []string{notDeleted("m")}
 	var parameters []interface{}
 
 	if manufacturer != "" {
-		criteria = append(criteria, "manufacturer LIKE ?")
+		criteria = append(criteria, "m.manufacturer LIKE ?")
 		parameters = append(parameters, fmt.Sprintf("%%%s%%", manufacturer))
 	}
 
 	if model != "" {
-		criteria = append(criteria, "model LIKE ?")
+		criteria = append(criteria, "m.model LIKE ?")
 		parameters = append(parameters, fmt.Sprintf("%%%s%%", model))
 	}
 
+	if category != "" {
+		criteria = append(criteria, "c.name LIKE ?")
+		parameters = append(parameters, fmt.Sprintf("%%%s%%", category))
+	}
+
 	var query string
 
 	if len(criteria) > 0 {
 		query = "WHERE " + strings.Join(criteria, " AND ")
 	}
 
-	rows, err := tx.Query(fmt.Sprintf("SELECT id, manufacturer, model FROM model %s ORDER BY manufacturer, model;", query), parameters...)
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT m.id, m.manufacturer, m.model, c.id, c.name, m.eol_date, m.eos_date FROM model AS m LEFT JOIN category AS c ON m.category_id = c.id %s ORDER BY m.manufacturer, m.model;", query), parameters...)
 	if err != nil {
 		return nil, &Error{Description: "Could not query Models", Type: ErrorTypeServer, Err: err}
 	}
@@ -157,10 +328,16 @@ func QueryModel(ctx context.Context, manufacturer, model string) ([]*Model, erro
 
 	for rows.Next() {
 		m := new(Model)
-		err = rows.Scan(&(m.ID), &(m.Manufacturer), &(m.Model))
+		var categoryID sql.NullInt64
+		var categoryName sql.NullString
+		var eolDate, eosDate sql.NullTime
+		err = rows.Scan(&(m.ID), &(m.Manufacturer), &(m.Model), &categoryID, &categoryName, &eolDate, &eosDate)
 		if err != nil {
 			return nil, &Error{Description: "Could not scan Model row", Type: ErrorTypeServer, Err: err}
 		}
+		m.scanCategory(categoryID, categoryName)
+		m.EOLDate = timePtr(eolDate)
+		m.EOSDate = timePtr(eosDate)
 
 		models = append(models, m)
 	}
@@ -172,3 +349,270 @@ func QueryModel(ctx context.Context, manufacturer, model string) ([]*Model, erro
 
 	return models, nil
 }
+
+//ModelMerge represents merging one Model into another. DeviceIDs are the Devices that are moved to ToModel
+//(each receiving a Merged Event), and EventIDs are the existing Events whose model_id references are rewritten to ToModel
+type ModelMerge struct {
+	FromModel   *Model  `json:"from_model"`
+	ToModel     *Model  `json:"to_model"`
+	DeviceIDs   []int64 `json:"device_ids"`
+	DeviceCount int     `json:"device_count"`
+	EventIDs    []int64 `json:"event_ids"`
+	EventCount  int     `json:"event_count"`
+}
+
+//modelMergeEvent is an existing Event whose content references a merged Model
+type modelMergeEvent struct {
+	id      int64
+	content interface{}
+}
+
+//rewriteModelID replaces fromID with toID in the given model_id value, returning whether or not it was replaced
+func rewriteModelID(value *interface{}, fromID, toID int64) bool {
+	if v, ok := (*value).(float64); ok && int64(v) == fromID {
+		*value = toID
+		return true
+	}
+	return false
+}
+
+//readModelMergeEvents returns the existing Events with content referencing the given Model, rewritten to reference toID
+func (s *TxStore) readModelMergeEvents(ctx context.Context, fromID, toID int64) ([]*modelMergeEvent, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, type, content FROM %s WHERE type IN ('created', 'modified') AND content LIKE ?;", DeviceEventLocation.Table), `%"model_id"%`)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query events for Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var events []*modelMergeEvent
+
+	for rows.Next() {
+		var id int64
+		var typ string
+		var content []byte
+
+		if err = rows.Scan(&id, &typ, &content); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan event row for Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+		}
+
+		rewritten := false
+
+		if typ == "created" {
+			var created *CreatedContent
+			if err = json.Unmarshal(content, &created); err != nil {
+				return nil, &Error{Description: fmt.Sprintf("Could not unmarshal created content json for event(%d)", id), Type: ErrorTypeServer, Err: err}
+			}
+			for _, f := range created.Fields {
+				if f.Name == "model_id" && rewriteModelID(&(f.Value), fromID, toID) {
+					rewritten = true
+				}
+			}
+			if rewritten {
+				events = append(events, &modelMergeEvent{id: id, content: created})
+			}
+		} else {
+			var mod *ModifiedContent
+			if err = json.Unmarshal(content, &mod); err != nil {
+				return nil, &Error{Description: fmt.Sprintf("Could not unmarshal modified content json for event(%d)", id), Type: ErrorTypeServer, Err: err}
+			}
+			for _, f := range mod.Fields {
+				if f.Name == "model_id" {
+					if rewriteModelID(&(f.OldValue), fromID, toID) {
+						rewritten = true
+					}
+					if rewriteModelID(&(f.NewValue), fromID, toID) {
+						rewritten = true
+					}
+				}
+			}
+			if rewritten {
+				events = append(events, &modelMergeEvent{id: id, content: mod})
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan event rows for Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return events, nil
+}
+
+//PreviewModelMerge returns the ModelMerge that merging the Model with fromID into the Model with toID would perform
+//without changing anything, or an error if one occurred
+func (s *TxStore) PreviewModelMerge(ctx context.Context, fromID, toID int64) (*ModelMerge, error) {
+	merge, _, err := s.previewModelMerge(ctx, fromID, toID)
+	return merge, err
+}
+
+func (s *TxStore) previewModelMerge(ctx context.Context, fromID, toID int64) (*ModelMerge, []*modelMergeEvent, error) {
+	tx := s.tx
+
+	if fromID == toID {
+		return nil, nil, &Error{Description: "Could not validate ModelMerge", Type: ErrorTypeUser, Err: errors.New("cannot merge a model into itself")}
+	}
+
+	merge := &ModelMerge{DeviceIDs: []int64{}, EventIDs: []int64{}}
+
+	var err error
+	if merge.FromModel, err = s.ReadModel(ctx, fromID); err != nil {
+		return nil, nil, err
+	}
+	if merge.FromModel == nil {
+		return nil, nil, &Error{Description: "Could not validate ModelMerge", Type: ErrorTypeUser, Err: fmt.Errorf("model (%d) must be a valid model", fromID)}
+	}
+
+	if merge.ToModel, err = s.ReadModel(ctx, toID); err != nil {
+		return nil, nil, err
+	}
+	if merge.ToModel == nil {
+		return nil, nil, &Error{Description: "Could not validate ModelMerge", Type: ErrorTypeUser, Err: fmt.Errorf("into (%d) must be a valid model", toID)}
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM device WHERE model_id=? ORDER BY id;", fromID)
+	if err != nil {
+		return nil, nil, &Error{Description: fmt.Sprintf("Could not query Devices for Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, nil, &Error{Description: fmt.Sprintf("Could not scan Device row for Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+		}
+		merge.DeviceIDs = append(merge.DeviceIDs, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, &Error{Description: fmt.Sprintf("Could not scan Device rows for Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+	}
+
+	events, err := s.readModelMergeEvents(ctx, fromID, toID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, e := range events {
+		merge.EventIDs = append(merge.EventIDs, e.id)
+	}
+
+	merge.DeviceCount = len(merge.DeviceIDs)
+	merge.EventCount = len(merge.EventIDs)
+
+	return merge, events, nil
+}
+
+//MergeModel merges the Model with fromID into the Model with toID and deletes it, returning the ModelMerge performed, or an error if one occurred.
+//Each moved Device receives a single Merged Event (in one EventBatch), and existing Events referencing the old Model are rewritten to reference the new Model
+func (s *TxStore) MergeModel(ctx context.Context, fromID, toID int64) (*ModelMerge, error) {
+	tx := s.tx
+	ctx = withEventBatch(ctx, fmt.Sprintf("Merge model %d into model %d", fromID, toID))
+
+	merge, events, err := s.previewModelMerge(ctx, fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range events {
+		content, err := json.Marshal(e.content)
+		if err != nil {
+			return nil, &Error{Description: "Could not marshal content json", Type: ErrorTypeServer, Err: err}
+		}
+
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET content=? WHERE id=?;", DeviceEventLocation.Table), content, e.id); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not rewrite event(%d)", e.id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE device SET model_id=? WHERE model_id=?;", toID, fromID); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not move Devices from Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+	}
+
+	c := &MergedContent{OldModel: merge.FromModel, NewModel: merge.ToModel}
+	for _, id := range merge.DeviceIDs {
+		if _, err = s.CreateMergedEvent(ctx, id, DeviceEventLocation, c); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not create Merged Event Device(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM model WHERE id=?;", fromID); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not delete Model(%d)", fromID), Type: ErrorTypeServer, Err: err}
+	}
+
+	requestCache(ctx).Invalidate(cacheKey("Model", fromID))
+
+	return merge, nil
+}
+
+//migratedModelMerge is a Model merged by the migration that added normalized Model keys, and the Devices it moved
+type migratedModelMerge struct {
+	from      *Model
+	toID      int64
+	deviceIDs []int64
+}
+
+//RecordMigratedModelMerges adds a Merged Event (by the server, in one EventBatch per merged Model) to each Device moved
+//by the migration that merged Models with the same normalized manufacturer and model, and returns the number of Events created,
+//or an error if one occurred. Each Device is only given an Event once, so this is safe to run every time the server starts
+func (s *TxStore) RecordMigratedModelMerges(ctx context.Context) (int, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT k.from_model_id, k.manufacturer, k.model, k.category_id, k.to_model_id, d.device_id FROM model_key_merge AS k "+
+		"JOIN model_key_merge_device AS d ON k.from_model_id = d.from_model_id WHERE d.recorded = FALSE ORDER BY k.from_model_id, d.device_id FOR UPDATE;")
+	if err != nil {
+		return 0, &Error{Description: "Could not query migrated ModelMerges", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var merges []*migratedModelMerge
+	for rows.Next() {
+		var (
+			from       = new(Model)
+			categoryID sql.NullInt64
+			toID       int64
+			deviceID   int64
+		)
+		if err = rows.Scan(&from.ID, &from.Manufacturer, &from.Model, &categoryID, &toID, &deviceID); err != nil {
+			return 0, &Error{Description: "Could not scan migrated ModelMerge row", Type: ErrorTypeServer, Err: err}
+		}
+		from.CategoryID = categoryID.Int64
+
+		if len(merges) == 0 || merges[len(merges)-1].from.ID != from.ID {
+			merges = append(merges, &migratedModelMerge{from: from, toID: toID})
+		}
+		merges[len(merges)-1].deviceIDs = append(merges[len(merges)-1].deviceIDs, deviceID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, &Error{Description: "Could not scan migrated ModelMerge rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	var count int
+	for _, m := range merges {
+		to, err := s.ReadModel(ctx, m.toID)
+		if err != nil {
+			return count, err
+		}
+		//the Model may have been merged or deleted since
+		if to == nil {
+			to = &Model{ID: m.toID}
+		}
+
+		batchCtx := withEventBatch(ctx, fmt.Sprintf("Merge model %d into model %d", m.from.ID, m.toID))
+		c := &MergedContent{OldModel: m.from, NewModel: to}
+		for _, id := range m.deviceIDs {
+			if _, err = s.CreateEvent(batchCtx, id, DeviceEventLocation, &Event{Date: time.Now(), Type: "merged", Content: c}); err != nil {
+				return count, &Error{Description: fmt.Sprintf("Could not create Merged Event Device(%d)", id), Type: ErrorTypeServer, Err: err}
+			}
+			count++
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE model_key_merge_device SET recorded = TRUE WHERE from_model_id=?;", m.from.ID); err != nil {
+			return count, &Error{Description: fmt.Sprintf("Could not record migrated ModelMerge for Model(%d)", m.from.ID), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//PasswordAlgorithms
+const (
+	PasswordAlgorithmBcrypt   = "bcrypt"
+	PasswordAlgorithmArgon2id = "argon2id"
+)
+
+//argon2id parameters. Time, memory (in KiB), and threads are defaults for PasswordConfig
+const (
+	argon2idTime    = 3
+	argon2idMemory  = 64 * 1024
+	argon2idThreads = 2
+	argon2idKeyLen  = 32
+	argon2idSaltLen = 16
+)
+
+var argon2idPrefix = []byte("$argon2id$")
+
+//PasswordConfig configures how new password hashes are generated. Argon2idMemory is in KiB
+type PasswordConfig struct {
+	Algorithm       string
+	BcryptCost      int
+	Argon2idTime    uint32
+	Argon2idMemory  uint32
+	Argon2idThreads uint8
+}
+
+var passwordConfig = &PasswordConfig{
+	Algorithm:       PasswordAlgorithmArgon2id,
+	BcryptCost:      12,
+	Argon2idTime:    argon2idTime,
+	Argon2idMemory:  argon2idMemory,
+	Argon2idThreads: argon2idThreads,
+}
+
+//SetPasswordConfig sets the PasswordConfig used for new password hashes, or returns an error if it is invalid.
+//Existing hashes that don't match the config are rehashed the next time the User authenticates
+func SetPasswordConfig(config *PasswordConfig) error {
+	if config.Algorithm != PasswordAlgorithmBcrypt && config.Algorithm != PasswordAlgorithmArgon2id {
+		return fmt.Errorf("unknown password algorithm: %s", config.Algorithm)
+	}
+	if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost (%d) must be between %d and %d", config.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if config.Argon2idTime < 1 {
+		return fmt.Errorf("argon2id time (%d) must be at least 1", config.Argon2idTime)
+	}
+	if config.Argon2idThreads < 1 {
+		return fmt.Errorf("argon2id threads (%d) must be at least 1", config.Argon2idThreads)
+	}
+	//argon2 requires at least 8 KiB per thread
+	if config.Argon2idMemory < 8*uint32(config.Argon2idThreads) {
+		return fmt.Errorf("argon2id memory (%d KiB) must be at least %d KiB", config.Argon2idMemory, 8*uint32(config.Argon2idThreads))
+	}
+	passwordConfig = config
+	return nil
+}
+
+//hashPassword returns a hash for the given password using the current PasswordConfig
+func hashPassword(password string) ([]byte, error) {
+	if passwordConfig.Algorithm == PasswordAlgorithmArgon2id {
+		salt := make([]byte, argon2idSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		c := passwordConfig
+		key := argon2.IDKey([]byte(password), salt, c.Argon2idTime, c.Argon2idMemory, c.Argon2idThreads, argon2idKeyLen)
+		return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, c.Argon2idMemory, c.Argon2idTime, c.Argon2idThreads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		)), nil
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), passwordConfig.BcryptCost)
+}
+
+//argon2idParams are the parameters parsed from an encoded argon2id hash
+type argon2idParams struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+//parseArgon2id parses an encoded argon2id hash
+func parseArgon2id(hash []byte) (*argon2idParams, error) {
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 6 {
+		return nil, errors.New("invalid argon2id hash")
+	}
+
+	p := new(argon2idParams)
+
+	if _, err := fmt.Sscanf(string(parts[2]), "v=%d", &(p.version)); err != nil {
+		return nil, fmt.Errorf("invalid argon2id version: %v", err)
+	}
+	if _, err := fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d", &(p.memory), &(p.time), &(p.threads)); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(string(parts[4])); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(string(parts[5])); err != nil {
+		return nil, fmt.Errorf("invalid argon2id key: %v", err)
+	}
+
+	return p, nil
+}
+
+//comparePassword returns nil if the given password matches the given bcrypt or argon2id hash, or an error if not
+func comparePassword(hash []byte, password string) error {
+	if !bytes.HasPrefix(hash, argon2idPrefix) {
+		return bcrypt.CompareHashAndPassword(hash, []byte(password))
+	}
+
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return errors.New("hashedPassword is not the hash of the given password")
+	}
+
+	return nil
+}
+
+//passwordNeedsRehash returns true if the given hash wasn't generated with the current PasswordConfig
+func passwordNeedsRehash(hash []byte) bool {
+	if passwordConfig.Algorithm == PasswordAlgorithmArgon2id {
+		p, err := parseArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		c := passwordConfig
+		return p.version != argon2.Version || p.memory != c.Argon2idMemory || p.time != c.Argon2idTime || p.threads != c.Argon2idThreads
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return true
+	}
+	return cost != passwordConfig.BcryptCost
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//readPermittedLocations returns the Locations the request User may access (their granted Locations, active Location Grants,
+//and all descendants), or nil if the User is not restricted by Location. Admins are never restricted.
+//Users who have ever had a Location Grant are restricted, so access doesn't widen when a Grant expires
+func (s *TxStore) readPermittedLocations(ctx context.Context) ([]Location, error) {
+	user, ok := ctx.Value(UserKey).(*User)
+	if !ok || user.IsAdmin() {
+		return nil, nil
+	}
+
+	userLocations, err := s.ReadUserLocations(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := s.ReadUserGrants(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, restricted := grantedLocations(userLocations, grants, time.Now())
+	if !restricted {
+		return nil, nil
+	}
+
+	tree, err := s.ReadLocationTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return permittedLocations(tree, granted), nil
+}
+
+//grantedLocations returns the given User Locations plus the Locations of the Grants active at time t,
+//and whether the User is restricted by Location: they have User Locations or have ever had a Location Grant
+func grantedLocations(userLocations []Location, grants []*Grant, t time.Time) (granted []Location, restricted bool) {
+	granted = append(granted, userLocations...)
+	restricted = len(userLocations) > 0
+
+	for _, g := range grants {
+		if g.Location == "" {
+			continue
+		}
+		restricted = true
+		if g.Active(t) {
+			granted = append(granted, g.Location)
+		}
+	}
+
+	return granted, restricted
+}
+
+//permittedLocations returns the Locations in tree that are granted or descend from a granted Location.
+//The result is never nil, so a restricted User with nothing granted may access no Locations
+func permittedLocations(tree []*LocationTree, granted []Location) []Location {
+	grants := make(map[Location]bool)
+	for _, l := range granted {
+		grants[l] = true
+	}
+
+	permitted := []Location{}
+	var walk func(nodes []*LocationTree, inherited bool)
+	walk = func(nodes []*LocationTree, inherited bool) {
+		for _, n := range nodes {
+			ok := inherited || grants[n.Location]
+			if ok {
+				permitted = append(permitted, n.Location)
+			}
+			walk(n.Children, ok)
+		}
+	}
+	walk(tree, false)
+
+	return permitted
+}
+
+//ReadPermittedLocations returns the Locations the request User may access, or nil if the User may access all Locations
+func (s *TxStore) ReadPermittedLocations(ctx context.Context) ([]Location, error) {
+	return s.readPermittedLocations(ctx)
+}
+
+//locationScope returns an SQL criterion (and its parameters) restricting the given location column to the
+//Locations the request User may access, or an empty criterion if the User is not restricted
+func (s *TxStore) locationScope(ctx context.Context, column string) (string, []interface{}, error) {
+	permitted, err := s.readPermittedLocations(ctx)
+	if err != nil || permitted == nil {
+		return "", nil, err
+	}
+
+	if len(permitted) == 0 {
+		return "1=0", nil, nil
+	}
+
+	placeholders := make([]string, len(permitted))
+	parameters := make([]interface{}, len(permitted))
+	for i, l := range permitted {
+		placeholders[i] = "?"
+		parameters[i] = l
+	}
+
+	return fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")), parameters, nil
+}
+
+//CheckLocationPermission returns an error if the request User may not access the given Location
+func (s *TxStore) CheckLocationPermission(ctx context.Context, location Location) error {
+	permitted, err := s.readPermittedLocations(ctx)
+	if err != nil || permitted == nil {
+		return err
+	}
+
+	for _, l := range permitted {
+		if l == location {
+			return nil
+		}
+	}
+
+	return &Error{Description: "Could not check Location permission", Type: ErrorTypeForbidden, Err: fmt.Errorf("location (%s) is outside of the user's permitted locations", location)}
+}
+
+//CheckDevicePermission returns an error if the request User may not access the Device with the given id.
+//No error is returned if the Device doesn't exist
+func (s *TxStore) CheckDevicePermission(ctx context.Context, id int64) error {
+	device, err := s.ReadDevice(ctx, id, false)
+	if err != nil || device == nil {
+		return err
+	}
+
+	return s.CheckLocationPermission(ctx, device.Location)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPermittedLocations(t *testing.T) {
+	now := time.Now()
+	revoked := now.Add(-time.Hour)
+
+	tree := []*LocationTree{
+		{Location: "North", Children: []*LocationTree{
+			{Location: "North/Library"},
+			{Location: "North/Gym"},
+		}},
+		{Location: "South"},
+	}
+
+	tests := []struct {
+		name          string
+		userLocations []Location
+		grants        []*Grant
+		want          []Location //nil means unrestricted
+	}{
+		{
+			name: "unrestricted",
+			want: nil,
+		},
+		{
+			name:   "role grant only",
+			grants: []*Grant{{Role: RoleAdmin, Starts: now.Add(-time.Hour), Expires: now.Add(time.Hour)}},
+			want:   nil,
+		},
+		{
+			name:          "user location with descendants",
+			userLocations: []Location{"North"},
+			want:          []Location{"North", "North/Library", "North/Gym"},
+		},
+		{
+			name:   "active grant",
+			grants: []*Grant{{Location: "South", Starts: now.Add(-time.Hour), Expires: now.Add(time.Hour)}},
+			want:   []Location{"South"},
+		},
+		{
+			name:   "expired grant",
+			grants: []*Grant{{Location: "South", Starts: now.Add(-2 * time.Hour), Expires: now.Add(-time.Hour)}},
+			want:   []Location{},
+		},
+		{
+			name:   "revoked grant",
+			grants: []*Grant{{Location: "South", Starts: now.Add(-2 * time.Hour), Expires: now.Add(time.Hour), Revoked: &revoked}},
+			want:   []Location{},
+		},
+		{
+			name:   "future grant",
+			grants: []*Grant{{Location: "South", Starts: now.Add(time.Hour), Expires: now.Add(2 * time.Hour)}},
+			want:   []Location{},
+		},
+		{
+			name:          "expired grant with user location",
+			userLocations: []Location{"North/Gym"},
+			grants:        []*Grant{{Location: "South", Starts: now.Add(-2 * time.Hour), Expires: now.Add(-time.Hour)}},
+			want:          []Location{"North/Gym"},
+		},
+	}
+
+	for _, test := range tests {
+		granted, restricted := grantedLocations(test.userLocations, test.grants, now)
+		if restricted != (test.want != nil) {
+			t.Errorf("%s: restricted = %v, want %v", test.name, restricted, test.want != nil)
+			continue
+		}
+		if !restricted {
+			continue
+		}
+
+		permitted := permittedLocations(tree, granted)
+		if permitted == nil {
+			t.Errorf("%s: permitted is nil, which would allow every location", test.name)
+			continue
+		}
+		if !reflect.DeepEqual(permitted, test.want) {
+			t.Errorf("%s: permitted = %v, want %v", test.name, permitted, test.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//recommendation thresholds
+const (
+	recommendationOutOfServiceDays = 60
+	recommendationInactiveDays     = 365
+	recommendationEOLWarningDays   = 180
+)
+
+//Recommendation represents a suggested next action for a Device. Reason explains which rule produced it
+type Recommendation struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+//statusSince returns the time the Device changed to its current Status, based on its Events
+func statusSince(device *Device) time.Time {
+	var since time.Time
+	for _, e := range device.Events {
+		switch c := e.Content.(type) {
+		case *CreatedContent:
+			since = e.Date
+		case *ModifiedContent:
+			for _, f := range c.Fields {
+				if f.Name == "status" {
+					since = e.Date
+				}
+			}
+		}
+	}
+	return since
+}
+
+//ReadDeviceRecommendations returns suggested next actions for the Device with the given id based on its state and history,
+//or an error if one occurred. If the Device doesn't exist, nil is returned
+func (s *TxStore) ReadDeviceRecommendations(ctx context.Context, id int64) ([]*Recommendation, error) {
+	device, err := s.ReadDevice(ctx, id, true)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	recs := []*Recommendation{}
+
+	status, err := s.ReadStatusDetail(ctx, device.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != nil && status.Semantics == StatusSemanticsOutOfService {
+		if since := statusSince(device); !since.IsZero() {
+			if days := int(now.Sub(since).Hours() / 24); days > recommendationOutOfServiceDays {
+				recs = append(recs, &Recommendation{
+					Action: "Consider retirement",
+					Reason: fmt.Sprintf("Device has been %s for %d days", device.Status, days),
+				})
+			}
+		}
+	}
+
+	retired := status != nil && status.Semantics == StatusSemanticsRetired
+
+	model, err := device.ReadModel(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if model != nil && !retired {
+		switch {
+		case model.EOSDate != nil && model.EOSDate.Before(now):
+			recs = append(recs, &Recommendation{
+				Action: "Replace device",
+				Reason: fmt.Sprintf("%s %s reached end of support on %s", model.Manufacturer, model.Model, model.EOSDate.Format("2006-01-02")),
+			})
+		case model.EOLDate != nil && model.EOLDate.Before(now):
+			recs = append(recs, &Recommendation{
+				Action: "Plan replacement",
+				Reason: fmt.Sprintf("%s %s reached end of life on %s", model.Manufacturer, model.Model, model.EOLDate.Format("2006-01-02")),
+			})
+		case model.EOLDate != nil && model.EOLDate.Before(now.AddDate(0, 0, recommendationEOLWarningDays)):
+			recs = append(recs, &Recommendation{
+				Action: "Budget for replacement",
+				Reason: fmt.Sprintf("%s %s reaches end of life on %s", model.Manufacturer, model.Model, model.EOLDate.Format("2006-01-02")),
+			})
+		}
+	}
+
+	if n := len(device.Events); n > 0 && !retired {
+		if days := int(now.Sub(device.Events[n-1].Date).Hours() / 24); days > recommendationInactiveDays {
+			recs = append(recs, &Recommendation{
+				Action: "Verify location",
+				Reason: fmt.Sprintf("Device hasn't had any activity for %d days", days),
+			})
+		}
+	}
+
+	u, err := s.ReadLocationUtilization(ctx, device.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	if u != nil && u.OverCapacity() && !retired {
+		recs = append(recs, &Recommendation{
+			Action: "Relocate device",
+			Reason: fmt.Sprintf("%s is over capacity (%d/%d)", u.Location, u.Count, u.Capacity),
+		})
+	}
+
+	return recs, nil
+}
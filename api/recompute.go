@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+)
+
+//CountDevices returns the total number of Devices, or an error if one occurred
+func (s *TxStore) CountDevices(ctx context.Context) (int64, error) {
+	tx := s.tx
+
+	var count int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM device;").Scan(&count); err != nil {
+		return 0, &Error{Description: "Could not count Devices", Type: ErrorTypeServer, Err: err}
+	}
+
+	return count, nil
+}
+
+//RecomputeDevices rebuilds derived data (e.g. last_event_at) for at most limit Devices with ids after afterID.
+//It returns the last Device id recomputed and the number of Devices recomputed, or an error if one occurred
+func (s *TxStore) RecomputeDevices(ctx context.Context, afterID int64, limit int) (lastID int64, n int, err error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM device WHERE id > ? ORDER BY id LIMIT ?;", afterID, limit)
+	if err != nil {
+		return 0, 0, &Error{Description: "Could not query Devices", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return 0, 0, &Error{Description: "Could not scan Device row", Type: ErrorTypeServer, Err: err}
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, 0, &Error{Description: "Could not scan Device rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	if len(ids) == 0 {
+		return afterID, 0, nil
+	}
+
+	lastID = ids[len(ids)-1]
+
+	_, err = tx.ExecContext(ctx, "UPDATE device AS d SET d.last_event_at=(SELECT MAX(e.date) FROM device_log AS e WHERE e.device_id = d.id) WHERE d.id > ? AND d.id <= ?;", afterID, lastID)
+	if err != nil {
+		return 0, 0, &Error{Description: "Could not update Device last events", Type: ErrorTypeServer, Err: err}
+	}
+
+	//a Device that hasn't changed since before the retention cutoff has its newest Event in the archive
+	_, err = tx.ExecContext(ctx, `
+UPDATE device AS d JOIN (SELECT device_id, MAX(date) AS date FROM device_log_archive WHERE device_id > ? AND device_id <= ? GROUP BY device_id) AS a ON a.device_id = d.id
+	SET d.last_event_at=a.date WHERE d.last_event_at IS NULL OR d.last_event_at < a.date;`, afterID, lastID)
+	if err != nil {
+		return 0, 0, &Error{Description: "Could not update Device last archived events", Type: ErrorTypeServer, Err: err}
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = cacheKey(DeviceEventLocation.Type, id)
+	}
+	requestCache(ctx).Invalidate(keys...)
+
+	return lastID, len(ids), nil
+}
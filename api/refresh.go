@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+//RefreshCounts represents the number of Devices in a RefreshReport group, by Location and by Model (most first)
+type RefreshCounts struct {
+	Count     int              `json:"count"`
+	Locations map[Location]int `json:"locations"`
+	Models    []*StatsModel    `json:"models"`
+}
+
+//refreshCounter counts Devices for a RefreshCounts
+type refreshCounter struct {
+	counts *RefreshCounts
+	models map[int64]*StatsModel
+}
+
+func newRefreshCounter() *refreshCounter {
+	return &refreshCounter{counts: &RefreshCounts{Locations: make(map[Location]int), Models: []*StatsModel{}}, models: make(map[int64]*StatsModel)}
+}
+
+func (c *refreshCounter) add(location Location, model *StatsModel) {
+	c.counts.Count++
+	c.counts.Locations[location]++
+
+	m, ok := c.models[model.ID]
+	if !ok {
+		m = &StatsModel{ID: model.ID, Manufacturer: model.Manufacturer, Model: model.Model}
+		c.models[model.ID] = m
+		c.counts.Models = append(c.counts.Models, m)
+	}
+	m.Count++
+}
+
+func (c *refreshCounter) finish() *RefreshCounts {
+	sort.Slice(c.counts.Models, func(i, j int) bool {
+		if c.counts.Models[i].Count != c.counts.Models[j].Count {
+			return c.counts.Models[i].Count > c.counts.Models[j].Count
+		}
+		return c.counts.Models[i].ID < c.counts.Models[j].ID
+	})
+	return c.counts
+}
+
+//RefreshYear represents the Devices added in Year. Year is 0 for Devices without a created Event
+type RefreshYear struct {
+	Year    int            `json:"year"`
+	Devices *RefreshCounts `json:"devices"`
+}
+
+//RefreshMonth represents the Devices reaching the replacement age in the month starting at Month
+type RefreshMonth struct {
+	Month   time.Time      `json:"month"`
+	Devices *RefreshCounts `json:"devices"`
+}
+
+//RefreshReport represents Device ages for refresh planning. A Device's age is the time since it was created.
+//Years groups Devices by the year they were added, oldest first. PastAge are the Devices already at least AgeYears old,
+//and Projection has the Devices reaching AgeYears in each of the next Months months, starting with the current month
+type RefreshReport struct {
+	Date       time.Time       `json:"date"`
+	AgeYears   int             `json:"age_years"`
+	Months     int             `json:"months"`
+	Years      []*RefreshYear  `json:"years"`
+	PastAge    *RefreshCounts  `json:"past_age"`
+	Projection []*RefreshMonth `json:"projection"`
+}
+
+//ReadRefreshReport returns a RefreshReport for the given replacement age in years and number of months to project,
+//or an error if one occurred. Devices are restricted to the Locations the request User may access
+func (s *TxStore) ReadRefreshReport(ctx context.Context, ageYears, months int) (*RefreshReport, error) {
+	tx := s.tx
+
+	if ageYears < 1 {
+		return nil, &Error{Description: "Could not validate age_years", Type: ErrorTypeUser, Err: fmt.Errorf("age_years (%d) must be at least 1", ageYears)}
+	}
+	if months < 0 {
+		return nil, &Error{Description: "Could not validate months", Type: ErrorTypeUser, Err: fmt.Errorf("months (%d) must not be negative", months)}
+	}
+
+	scope, parameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+SELECT d.location, m.id, m.manufacturer, m.model,
+	(SELECT MIN(e.date) FROM device_log AS e WHERE e.device_id = d.id AND e.type = 'created')
+	FROM device AS d JOIN model AS m ON d.model_id = m.id
+	WHERE %s;`, scope), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query RefreshReport", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+
+	report := &RefreshReport{Date: now, AgeYears: ageYears, Months: months, Years: []*RefreshYear{}, Projection: make([]*RefreshMonth, months)}
+
+	years := make(map[int]*refreshCounter)
+	pastAge := newRefreshCounter()
+	projection := make([]*refreshCounter, months)
+	for i := range projection {
+		projection[i] = newRefreshCounter()
+	}
+
+	for rows.Next() {
+		var location Location
+		var created sql.NullTime
+		model := new(StatsModel)
+
+		if err = rows.Scan(&location, &(model.ID), &(model.Manufacturer), &(model.Model), &created); err != nil {
+			return nil, &Error{Description: "Could not scan RefreshReport row", Type: ErrorTypeServer, Err: err}
+		}
+
+		var year int
+		if created.Valid {
+			year = created.Time.In(time.Local).Year()
+		}
+		if years[year] == nil {
+			years[year] = newRefreshCounter()
+		}
+		years[year].add(location, model)
+
+		if !created.Valid {
+			continue
+		}
+
+		replace := created.Time.In(time.Local).AddDate(ageYears, 0, 0)
+		if !replace.After(now) {
+			pastAge.add(location, model)
+			continue
+		}
+
+		month := (replace.Year()-thisMonth.Year())*12 + int(replace.Month()-thisMonth.Month())
+		if month < months {
+			projection[month].add(location, model)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan RefreshReport rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	for year, c := range years {
+		report.Years = append(report.Years, &RefreshYear{Year: year, Devices: c.finish()})
+	}
+	sort.Slice(report.Years, func(i, j int) bool {
+		return report.Years[i].Year < report.Years[j].Year
+	})
+
+	report.PastAge = pastAge.finish()
+
+	for i, c := range projection {
+		report.Projection[i] = &RefreshMonth{Month: thisMonth.AddDate(0, i, 0), Devices: c.finish()}
+	}
+
+	return report, nil
+}
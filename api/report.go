@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+//EOLReportModel represents a Model past or approaching its end-of-life or end-of-support date
+type EOLReportModel struct {
+	ID           int64      `json:"id"`
+	Manufacturer string     `json:"manufacturer"`
+	Model        string     `json:"model"`
+	EOLDate      *time.Time `json:"eol_date,omitempty"`
+	EOSDate      *time.Time `json:"eos_date,omitempty"`
+	PastEOL      bool       `json:"past_eol"`
+	PastEOS      bool       `json:"past_eos"`
+	Count        int        `json:"count"`
+}
+
+//EOLReport represents device counts for Models past or within Days of their end-of-life or end-of-support dates
+type EOLReport struct {
+	Date   time.Time         `json:"date"`
+	Days   int               `json:"days"`
+	Models []*EOLReportModel `json:"models"`
+}
+
+const eolReportSQL = `
+SELECT m.id, m.manufacturer, m.model, m.eol_date, m.eos_date, COUNT(d.id)
+	FROM model AS m LEFT JOIN device AS d ON d.model_id = m.id AND d.deleted_at IS NULL WHERE
+		m.deleted_at IS NULL AND (
+			m.eol_date <= ? OR
+			m.eos_date <= ?
+		)
+	GROUP BY m.id, m.manufacturer, m.model, m.eol_date, m.eos_date
+	ORDER BY LEAST(IFNULL(m.eol_date, '9999-12-31'), IFNULL(m.eos_date, '9999-12-31')), m.manufacturer, m.model;
+`
+
+//ReadEOLReport returns an EOLReport for Models past or within the given number of days of their
+//end-of-life or end-of-support dates, or an error if one occurred.
+func (s *TxStore) ReadEOLReport(ctx context.Context, days int) (*EOLReport, error) {
+	tx := s.tx
+
+	now := time.Now()
+	cutoff := now.AddDate(0, 0, days)
+
+	report := &EOLReport{Date: now, Days: days}
+
+	rows, err := tx.QueryContext(ctx, eolReportSQL, cutoff, cutoff)
+	if err != nil {
+		return nil, &Error{Description: "Could not query EOLReport", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := new(EOLReportModel)
+		var eolDate, eosDate sql.NullTime
+
+		sErr := rows.Scan(&(m.ID), &(m.Manufacturer), &(m.Model), &eolDate, &eosDate, &(m.Count))
+		if sErr != nil {
+			return nil, &Error{Description: "Could not scan EOLReport row", Type: ErrorTypeServer, Err: sErr}
+		}
+
+		m.EOLDate = timePtr(eolDate)
+		m.EOSDate = timePtr(eosDate)
+		m.PastEOL = m.EOLDate != nil && m.EOLDate.Before(now)
+		m.PastEOS = m.EOSDate != nil && m.EOSDate.Before(now)
+
+		report.Models = append(report.Models, m)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, &Error{Description: "Could not scan EOLReport rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return report, nil
+}
+
+//StatusDurationGroup represents how long Devices of a Model or Manufacturer spent in a Status.
+//Count, MedianDays, and MeanDays only include completed stays; Ongoing is the number of Devices currently in the Status
+type StatusDurationGroup struct {
+	ID           int64   `json:"id,omitempty"`
+	Manufacturer string  `json:"manufacturer"`
+	Model        string  `json:"model,omitempty"`
+	Count        int     `json:"count"`
+	MedianDays   float64 `json:"median_days"`
+	MeanDays     float64 `json:"mean_days"`
+	Ongoing      int     `json:"ongoing"`
+}
+
+//StatusDurationDevice represents a Device that has been in a Status since Entered, for Days
+type StatusDurationDevice struct {
+	ID           int64     `json:"id"`
+	SerialNumber string    `json:"serial_number"`
+	Manufacturer string    `json:"manufacturer"`
+	Model        string    `json:"model"`
+	Location     Location  `json:"location"`
+	Entered      time.Time `json:"entered"`
+	Days         float64   `json:"days"`
+}
+
+//StatusDurationReport represents how long Devices spent in a Status, for all Devices (Total) and grouped by Model and Manufacturer.
+//If OverDays is greater than 0, Overdue lists the Devices that have been in the Status for more than OverDays days, longest first
+type StatusDurationReport struct {
+	Status        Status                  `json:"status"`
+	Total         *StatusDurationGroup    `json:"total"`
+	Models        []*StatusDurationGroup  `json:"models"`
+	Manufacturers []*StatusDurationGroup  `json:"manufacturers"`
+	OverDays      int                     `json:"over_days,omitempty"`
+	Overdue       []*StatusDurationDevice `json:"overdue,omitempty"`
+}
+
+//statusDurations collects stay durations (in days) for a StatusDurationGroup
+type statusDurations struct {
+	group *StatusDurationGroup
+	days  []float64
+}
+
+func (d *statusDurations) finish() *StatusDurationGroup {
+	g := d.group
+	g.Count = len(d.days)
+	if g.Count == 0 {
+		return g
+	}
+
+	sort.Float64s(d.days)
+
+	var total float64
+	for _, day := range d.days {
+		total += day
+	}
+	g.MeanDays = total / float64(g.Count)
+
+	if g.Count%2 == 1 {
+		g.MedianDays = d.days[g.Count/2]
+	} else {
+		g.MedianDays = (d.days[g.Count/2-1] + d.days[g.Count/2]) / 2
+	}
+
+	return g
+}
+
+//eventStatus returns the status set by the given created or modified event content, if any
+func eventStatus(typ string, content []byte) (Status, bool) {
+	var c struct {
+		Fields []struct {
+			Name     string      `json:"name"`
+			Value    interface{} `json:"value"`
+			NewValue interface{} `json:"new_value"`
+		} `json:"fields"`
+	}
+
+	if err := json.Unmarshal(content, &c); err != nil {
+		return "", false
+	}
+
+	for _, f := range c.Fields {
+		if f.Name != "status" {
+			continue
+		}
+		v := f.Value
+		if typ == "modified" {
+			v = f.NewValue
+		}
+		if str, ok := v.(string); ok {
+			return Status(str), true
+		}
+	}
+
+	return "", false
+}
+
+//ReadStatusDurationReport returns a StatusDurationReport for the given Status based on Device events, listing Devices in the Status
+//for more than overDays days if overDays is greater than 0, or an error if one occurred.
+//Devices are grouped by their current Model and restricted to the Locations the request User may access
+func (s *TxStore) ReadStatusDurationReport(ctx context.Context, status Status, overDays int) (*StatusDurationReport, error) {
+	tx := s.tx
+
+	if status == "" {
+		return nil, &Error{Description: "Could not validate status", Type: ErrorTypeUser, Err: errors.New("status cannot be empty")}
+	}
+	if overDays < 0 {
+		return nil, &Error{Description: "Could not validate over_days", Type: ErrorTypeUser, Err: fmt.Errorf("over_days (%d) must not be negative", overDays)}
+	}
+
+	var parameters []interface{}
+	where := "WHERE e.type IN ('created', 'modified')"
+
+	scope, scopeParameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		where += " AND " + scope
+		parameters = append(parameters, scopeParameters...)
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT e.device_id, e.date, e.type, e.content, m.id, m.manufacturer, m.model, d.serial_number, d.location FROM %s AS e JOIN device AS d ON e.device_id = d.id JOIN model AS m ON d.model_id = m.id %s ORDER BY e.device_id, e.date, e.id;", allEventsTable, where), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query StatusDurationReport events", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	total := &statusDurations{group: new(StatusDurationGroup)}
+	models := make(map[int64]*statusDurations)
+	manufacturers := make(map[string]*statusDurations)
+	overdue := []*StatusDurationDevice{}
+	now := time.Now()
+
+	var (
+		current  int64 = -1
+		entered  time.Time
+		inStatus bool
+		modelID  int64
+		manuf    string
+		device   *StatusDurationDevice
+	)
+
+	//record adds a stay (or an ongoing stay if end is zero) for the current Device
+	record := func(end time.Time) {
+		md := models[modelID]
+		mf, ok := manufacturers[manuf]
+		if !ok {
+			mf = &statusDurations{group: &StatusDurationGroup{Manufacturer: manuf}}
+			manufacturers[manuf] = mf
+		}
+
+		if end.IsZero() {
+			total.group.Ongoing++
+			md.group.Ongoing++
+			mf.group.Ongoing++
+
+			if days := now.Sub(entered).Hours() / 24; overDays > 0 && days > float64(overDays) {
+				device.Entered, device.Days = entered, days
+				overdue = append(overdue, device)
+			}
+			return
+		}
+
+		days := end.Sub(entered).Hours() / 24
+		total.days = append(total.days, days)
+		md.days = append(md.days, days)
+		mf.days = append(mf.days, days)
+	}
+
+	for rows.Next() {
+		var (
+			deviceID     int64
+			date         time.Time
+			typ          string
+			content      []byte
+			id           int64
+			manufacturer string
+			model        string
+			serialNumber string
+			location     Location
+		)
+
+		if err = rows.Scan(&deviceID, &date, &typ, &content, &id, &manufacturer, &model, &serialNumber, &location); err != nil {
+			return nil, &Error{Description: "Could not scan StatusDurationReport event row", Type: ErrorTypeServer, Err: err}
+		}
+
+		if deviceID != current {
+			if inStatus {
+				record(time.Time{})
+			}
+			current, inStatus, modelID, manuf = deviceID, false, id, manufacturer
+			device = &StatusDurationDevice{ID: deviceID, SerialNumber: serialNumber, Manufacturer: manufacturer, Model: model, Location: location}
+		}
+
+		if models[id] == nil {
+			models[id] = &statusDurations{group: &StatusDurationGroup{ID: id, Manufacturer: manufacturer, Model: model}}
+		}
+
+		st, ok := eventStatus(typ, content)
+		if !ok {
+			continue
+		}
+
+		if inStatus && st != status {
+			record(date)
+			inStatus = false
+		} else if !inStatus && st == status {
+			entered = date
+			inStatus = true
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan StatusDurationReport event rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	if inStatus {
+		record(time.Time{})
+	}
+
+	report := &StatusDurationReport{Status: status, Total: total.finish(), Models: []*StatusDurationGroup{}, Manufacturers: []*StatusDurationGroup{}}
+
+	if overDays > 0 {
+		sort.Slice(overdue, func(i, j int) bool {
+			return overdue[i].Days > overdue[j].Days
+		})
+		report.OverDays, report.Overdue = overDays, overdue
+	}
+
+	for _, md := range models {
+		if len(md.days) > 0 || md.group.Ongoing > 0 {
+			report.Models = append(report.Models, md.finish())
+		}
+	}
+
+	for _, mf := range manufacturers {
+		report.Manufacturers = append(report.Manufacturers, mf.finish())
+	}
+
+	//slowest first
+	sort.Slice(report.Models, func(i, j int) bool {
+		return report.Models[i].MedianDays > report.Models[j].MedianDays
+	})
+	sort.Slice(report.Manufacturers, func(i, j int) bool {
+		return report.Manufacturers[i].MedianDays > report.Manufacturers[j].MedianDays
+	})
+
+	return report, nil
+}
@@ -0,0 +1,467 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ScheduledReports
+const (
+	ScheduledReportStats   = "stats"
+	ScheduledReportOverdue = "overdue"
+	ScheduledReportBroken  = "broken"
+)
+
+//ScheduledReportFormats
+const (
+	ScheduledReportFormatCSV  = "csv"
+	ScheduledReportFormatHTML = "html"
+)
+
+//maxReportRecipients is the most recipients a ReportSchedule may have
+const maxReportRecipients = 50
+
+//ReportSchedule represents a report emailed to Recipients on a cron Schedule (see CronSchedule).
+//Report is stats (a Stats snapshot), overdue (Devices in Status for more than Days days), or broken (Devices in an out of service Status).
+//Format is csv (attachments) or html (the email body). NextRun is empty while the ReportSchedule is disabled.
+//LastError is the error from the last run, if it failed
+type ReportSchedule struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Report     string     `json:"report"`
+	Schedule   string     `json:"schedule"`
+	Format     string     `json:"format"`
+	Recipients []string   `json:"recipients"`
+	Status     Status     `json:"status,omitempty"`
+	Days       int        `json:"days,omitempty"`
+	Disabled   bool       `json:"disabled"`
+	Created    time.Time  `json:"created"`
+	CreatedBy  int64      `json:"created_by,omitempty"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+//Validate cleans and validates the given ReportSchedule
+func (r *ReportSchedule) Validate() error {
+	r.Name = normalizeSpace(r.Name)
+	r.Schedule = strings.Join(strings.Fields(r.Schedule), " ")
+	r.Status = Status(strings.TrimSpace(string(r.Status)))
+
+	if err := ValidateString("name", r.Name, 255); err != nil {
+		return err
+	}
+
+	switch r.Report {
+	case ScheduledReportStats, ScheduledReportBroken:
+		r.Status, r.Days = "", 0
+	case ScheduledReportOverdue:
+		if r.Status == "" {
+			return fieldError("status", "required", "status must not be empty for %s reports", r.Report)
+		}
+		if r.Days < 1 {
+			return fieldError("days", "invalid_days", "days (%d) must be at least 1 for %s reports", r.Days, r.Report)
+		}
+	default:
+		return fieldError("report", "invalid_report", "report (%s) must be %s, %s, or %s", r.Report, ScheduledReportStats, ScheduledReportOverdue, ScheduledReportBroken)
+	}
+
+	if err := ValidateString("schedule", r.Schedule, 255); err != nil {
+		return err
+	}
+	c, err := ParseCronSchedule(r.Schedule)
+	if err != nil {
+		return fieldError("schedule", "invalid_schedule", "schedule (%s) must be a valid cron expression: %v", r.Schedule, err)
+	}
+	if c.Next(time.Now()).IsZero() {
+		return fieldError("schedule", "invalid_schedule", "schedule (%s) never runs", r.Schedule)
+	}
+
+	if r.Format != ScheduledReportFormatCSV && r.Format != ScheduledReportFormatHTML {
+		return fieldError("format", "invalid_format", "format (%s) must be %s or %s", r.Format, ScheduledReportFormatCSV, ScheduledReportFormatHTML)
+	}
+
+	if len(r.Recipients) == 0 {
+		return fieldError("recipients", "required", "recipients must not be empty")
+	}
+	if len(r.Recipients) > maxReportRecipients {
+		return fieldError("recipients", "too_many", "recipients (%d) was more than maximum allowed (%d)", len(r.Recipients), maxReportRecipients)
+	}
+	for i, to := range r.Recipients {
+		to = strings.TrimSpace(to)
+		if e, err := mail.ParseAddress(fmt.Sprintf("Recipient <%s>", to)); err != nil || e.Address != to {
+			return fieldError("recipients", "invalid_email", "recipient (%s) must be a valid email", to)
+		}
+		r.Recipients[i] = to
+	}
+	if len(strings.Join(r.Recipients, ",")) > 4096 {
+		return fieldError("recipients", "too_long", "recipients length was more than maximum allowed (%d)", 4096)
+	}
+
+	return nil
+}
+
+//nextRun returns the ReportSchedule's next run after now, or nil if it's disabled. The ReportSchedule must be valid
+func (r *ReportSchedule) nextRun(now time.Time) *time.Time {
+	if r.Disabled {
+		return nil
+	}
+	c, err := ParseCronSchedule(r.Schedule)
+	if err != nil {
+		return nil
+	}
+	next := c.Next(now)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+//CreateReportSchedule creates a new ReportSchedule with the given fields (ID, Created, CreatedBy, NextRun, LastRun, and LastError are ignored and created)
+//and returns its ID, or an error if one occurred
+func (s *TxStore) CreateReportSchedule(ctx context.Context, schedule *ReportSchedule) (id int64, err error) {
+	tx := s.tx
+	user := ctx.Value(UserKey).(*User)
+
+	if err = schedule.Validate(); err != nil {
+		return 0, &Error{Description: "Could not validate ReportSchedule", Type: ErrorTypeUser, Err: err}
+	}
+
+	schedule.Created = time.Now()
+	schedule.CreatedBy = user.ID
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO report_schedule(name, report, schedule, format, recipients, status, days, disabled, created, created_by, next_run) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		schedule.Name,
+		schedule.Report,
+		schedule.Schedule,
+		schedule.Format,
+		strings.Join(schedule.Recipients, ","),
+		nullString(string(schedule.Status)),
+		schedule.Days,
+		schedule.Disabled,
+		schedule.Created,
+		nullID(schedule.CreatedBy),
+		nullTime(schedule.nextRun(schedule.Created)),
+	)
+	if err != nil {
+		return 0, &Error{Description: "Could not insert ReportSchedule", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: "Could not fetch ReportSchedule id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return id, nil
+}
+
+//scanReportSchedule scans a ReportSchedule from the given row
+func scanReportSchedule(row interface{ Scan(...interface{}) error }) (*ReportSchedule, error) {
+	r := new(ReportSchedule)
+	var recipients string
+	var status, lastError sql.NullString
+	var createdBy sql.NullInt64
+	var nextRun, lastRun sql.NullTime
+
+	if err := row.Scan(&(r.ID), &(r.Name), &(r.Report), &(r.Schedule), &(r.Format), &recipients, &status, &(r.Days), &(r.Disabled),
+		&(r.Created), &createdBy, &nextRun, &lastRun, &lastError); err != nil {
+		return nil, err
+	}
+
+	r.Recipients = []string{}
+	if recipients != "" {
+		r.Recipients = strings.Split(recipients, ",")
+	}
+	r.Status = Status(status.String)
+	r.CreatedBy = createdBy.Int64
+	r.NextRun = timePtr(nextRun)
+	r.LastRun = timePtr(lastRun)
+	r.LastError = lastError.String
+
+	return r, nil
+}
+
+const reportScheduleColumns = "id, name, report, schedule, format, recipients, status, days, disabled, created, created_by, next_run, last_run, last_error"
+
+//ReadReportSchedule returns the ReportSchedule with the given id, or an error if one occurred
+func (s *TxStore) ReadReportSchedule(ctx context.Context, id int64) (*ReportSchedule, error) {
+	tx := s.tx
+
+	r, err := scanReportSchedule(tx.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM report_schedule WHERE id=?;", reportScheduleColumns), id))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query ReportSchedule(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return r, nil
+}
+
+//ReadReportSchedules returns all ReportSchedules, or an error if one occurred
+func (s *TxStore) ReadReportSchedules(ctx context.Context) ([]*ReportSchedule, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM report_schedule ORDER BY id;", reportScheduleColumns))
+	if err != nil {
+		return nil, &Error{Description: "Could not query ReportSchedules", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	schedules := []*ReportSchedule{}
+
+	for rows.Next() {
+		r, err := scanReportSchedule(rows)
+		if err != nil {
+			return nil, &Error{Description: "Could not scan ReportSchedule row", Type: ErrorTypeServer, Err: err}
+		}
+		schedules = append(schedules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan ReportSchedule rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return schedules, nil
+}
+
+//UpdateReportSchedule updates the Name, Report, Schedule, Format, Recipients, Status, Days, and Disabled fields
+//for the given ReportSchedule (using the ID field) and reschedules its next run, or returns an error if one occurred
+func (s *TxStore) UpdateReportSchedule(ctx context.Context, schedule *ReportSchedule) error {
+	tx := s.tx
+
+	if err := schedule.Validate(); err != nil {
+		return &Error{Description: "Could not validate ReportSchedule", Type: ErrorTypeUser, Err: err}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE report_schedule SET name=?, report=?, schedule=?, format=?, recipients=?, status=?, days=?, disabled=?, next_run=? WHERE id=?;",
+		schedule.Name,
+		schedule.Report,
+		schedule.Schedule,
+		schedule.Format,
+		strings.Join(schedule.Recipients, ","),
+		nullString(string(schedule.Status)),
+		schedule.Days,
+		schedule.Disabled,
+		nullTime(schedule.nextRun(time.Now())),
+		schedule.ID,
+	)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update ReportSchedule(%d)", schedule.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//DeleteReportSchedule deletes the ReportSchedule with the given id, or returns an error if one occurred
+func (s *TxStore) DeleteReportSchedule(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM report_schedule WHERE id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete ReportSchedule(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//QueueReportSchedule makes the enabled ReportSchedule with the given id due at now, so it runs without waiting for its next scheduled run,
+//or returns an error if one occurred
+func (s *TxStore) QueueReportSchedule(ctx context.Context, id int64, now time.Time) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "UPDATE report_schedule SET next_run=? WHERE id=? AND disabled=FALSE;", now, id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not queue ReportSchedule(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//ClaimDueReportSchedules returns up to limit enabled ReportSchedules that are due at now, and records them as run at now
+//and schedules their next runs, or returns an error if one occurred.
+//The ReportSchedules are locked until the transaction ends, so each run is only claimed once
+func (s *TxStore) ClaimDueReportSchedules(ctx context.Context, now time.Time, limit int) ([]*ReportSchedule, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM report_schedule WHERE disabled=FALSE AND next_run <= ? ORDER BY next_run, id LIMIT ? FOR UPDATE;", reportScheduleColumns), now, limit)
+	if err != nil {
+		return nil, &Error{Description: "Could not query due ReportSchedules", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var schedules []*ReportSchedule
+
+	for rows.Next() {
+		r, err := scanReportSchedule(rows)
+		if err != nil {
+			return nil, &Error{Description: "Could not scan due ReportSchedule row", Type: ErrorTypeServer, Err: err}
+		}
+		schedules = append(schedules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan due ReportSchedule rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	for _, r := range schedules {
+		r.LastRun = &now
+		r.NextRun = r.nextRun(now)
+		if _, err = tx.ExecContext(ctx, "UPDATE report_schedule SET next_run=?, last_run=? WHERE id=?;", nullTime(r.NextRun), now, r.ID); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not update ReportSchedule(%d)", r.ID), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	return schedules, nil
+}
+
+//RecordReportScheduleRun records the result of the last run of the ReportSchedule with the given id, or returns an error if one occurred.
+//If runErr is nil, the run succeeded
+func (s *TxStore) RecordReportScheduleRun(ctx context.Context, id int64, runErr error) error {
+	tx := s.tx
+
+	var lastError sql.NullString
+	if runErr != nil {
+		lastError = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE report_schedule SET last_error=? WHERE id=?;", lastError, id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update ReportSchedule(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//ReportTable is a titled table of report results, for rendering reports as CSV or HTML
+type ReportTable struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+//ReadScheduledReport returns the results of the given ReportSchedule's report as ReportTables, or an error if one occurred.
+//Devices are restricted to the Locations the request User may access
+func (s *TxStore) ReadScheduledReport(ctx context.Context, schedule *ReportSchedule) ([]*ReportTable, error) {
+	switch schedule.Report {
+	case ScheduledReportStats:
+		return s.readStatsReportTables(ctx)
+	case ScheduledReportOverdue:
+		return s.readOverdueReportTables(ctx, schedule.Status, schedule.Days)
+	case ScheduledReportBroken:
+		return s.readBrokenReportTables(ctx)
+	}
+	return nil, &Error{Description: "Could not read scheduled report", Type: ErrorTypeUser, Err: fmt.Errorf("report (%s) is invalid", schedule.Report)}
+}
+
+//readStatsReportTables returns a Stats snapshot as ReportTables
+func (s *TxStore) readStatsReportTables(ctx context.Context) ([]*ReportTable, error) {
+	stats, err := s.ReadStats(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ReportTable{Title: "Summary", Columns: []string{"Metric", "Count"}, Rows: [][]string{
+		{"Devices", strconv.Itoa(stats.DeviceCount)},
+		{"Models", strconv.Itoa(stats.ModelCount)},
+		{"Locations", strconv.Itoa(stats.LocationCount)},
+	}}
+
+	statuses := &ReportTable{Title: "Statuses", Columns: []string{"Status", "Count"}}
+	for _, st := range stats.Statuses {
+		statuses.Rows = append(statuses.Rows, []string{st.Status, strconv.Itoa(st.Count)})
+	}
+
+	locationTable := func(title string, locations []*StatsLocation) *ReportTable {
+		t := &ReportTable{Title: title, Columns: []string{"Location", "Count", "Capacity", "Utilization"}}
+		for _, l := range locations {
+			capacity, utilization := "", ""
+			if l.Capacity != 0 {
+				capacity = strconv.Itoa(l.Capacity)
+				utilization = fmt.Sprintf("%.0f%%", l.Utilization*100)
+			}
+			t.Rows = append(t.Rows, []string{l.Location, strconv.Itoa(l.Count), capacity, utilization})
+		}
+		return t
+	}
+
+	models := &ReportTable{Title: "Models", Columns: []string{"Manufacturer", "Model", "Count"}}
+	for _, m := range stats.Models {
+		models.Rows = append(models.Rows, []string{m.Manufacturer, m.Model, strconv.Itoa(m.Count)})
+	}
+
+	categories := &ReportTable{Title: "Categories", Columns: []string{"Category", "Count"}}
+	for _, c := range stats.Categories {
+		categories.Rows = append(categories.Rows, []string{c.Category, strconv.Itoa(c.Count)})
+	}
+
+	return []*ReportTable{
+		summary,
+		statuses,
+		locationTable("Locations", stats.Locations),
+		locationTable("Over Capacity", stats.OverCapacity),
+		models,
+		categories,
+	}, nil
+}
+
+//readOverdueReportTables returns the Devices in the given Status for more than days days as a ReportTable
+func (s *TxStore) readOverdueReportTables(ctx context.Context, status Status, days int) ([]*ReportTable, error) {
+	report, err := s.ReadStatusDurationReport(ctx, status, days)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &ReportTable{
+		Title:   fmt.Sprintf("Devices in %s for more than %d days", status, days),
+		Columns: []string{"ID", "Serial Number", "Manufacturer", "Model", "Location", "Entered", "Days"},
+	}
+	for _, d := range report.Overdue {
+		t.Rows = append(t.Rows, []string{
+			strconv.FormatInt(d.ID, 10), d.SerialNumber, d.Manufacturer, d.Model, string(d.Location),
+			d.Entered.In(time.Local).Format("2006-01-02"), fmt.Sprintf("%.1f", d.Days),
+		})
+	}
+
+	return []*ReportTable{t}, nil
+}
+
+//readBrokenReportTables returns the Devices in an out of service Status as a ReportTable
+func (s *TxStore) readBrokenReportTables(ctx context.Context) ([]*ReportTable, error) {
+	tx := s.tx
+
+	scope, parameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+SELECT d.id, d.serial_number, IFNULL(d.asset_tag, ''), m.manufacturer, m.model, d.status, d.location
+	FROM device AS d JOIN model AS m ON d.model_id = m.id JOIN status AS st ON d.status = st.status
+	WHERE st.semantics = ? AND %s
+	ORDER BY d.status, d.location, d.serial_number;`, scope), append([]interface{}{StatusSemanticsOutOfService}, parameters...)...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query out of service Devices", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	t := &ReportTable{Title: "Out of service devices", Columns: []string{"ID", "Serial Number", "Asset Tag", "Manufacturer", "Model", "Status", "Location"}}
+
+	for rows.Next() {
+		var id int64
+		var serialNumber, assetTag, manufacturer, model, status, location string
+		if err = rows.Scan(&id, &serialNumber, &assetTag, &manufacturer, &model, &status, &location); err != nil {
+			return nil, &Error{Description: "Could not scan out of service Device row", Type: ErrorTypeServer, Err: err}
+		}
+		t.Rows = append(t.Rows, []string{strconv.FormatInt(id, 10), serialNumber, assetTag, manufacturer, model, status, location})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan out of service Device rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return []*ReportTable{t}, nil
+}
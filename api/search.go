@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//SearchResult types
+const (
+	SearchTypeDevice   = "device"
+	SearchTypeModel    = "model"
+	SearchTypeUser     = "user"
+	SearchTypeLocation = "location"
+	SearchTypeNote     = "note"
+)
+
+//SearchResult represents a single entity matching a search. ID is the Device, Model, or User id (notes use their Device's id)
+//and Key is the Location name. Rank is 3 for exact matches, 2 for prefix matches, and 1 for other matches
+type SearchResult struct {
+	Type     string `json:"type"`
+	ID       int64  `json:"id,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+	Rank     int    `json:"rank"`
+}
+
+//rankSQL returns an SQL expression ranking how well the given columns match a search, and its parameters
+func rankSQL(q string, columns ...string) (string, []interface{}) {
+	var exprs []string
+	var parameters []interface{}
+
+	for _, col := range columns {
+		exprs = append(exprs, fmt.Sprintf("CASE WHEN %s = ? THEN 3 WHEN %s LIKE ? THEN 2 WHEN %s LIKE ? THEN 1 ELSE 0 END", col, col, col))
+		parameters = append(parameters, q, q+"%", "%"+q+"%")
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], parameters
+	}
+
+	return fmt.Sprintf("GREATEST(%s)", strings.Join(exprs, ", ")), parameters
+}
+
+//searchQuery runs the given ranked search query (ordered by rank and limited) and scans each row with scan
+func (s *TxStore) searchQuery(ctx context.Context, typ, query string, parameters []interface{}, scan func(*sql.Rows) (*SearchResult, error)) ([]*SearchResult, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, query, parameters...)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not search %ss", typ), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+
+	for rows.Next() {
+		r, err := scan(rows)
+		if err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan %s search row", typ), Type: ErrorTypeServer, Err: err}
+		}
+		r.Type = typ
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan %s search rows", typ), Type: ErrorTypeServer, Err: err}
+	}
+
+	return results, nil
+}
+
+func (s *TxStore) searchDevices(ctx context.Context, q string, limit int) ([]*SearchResult, error) {
+	rank, parameters := rankSQL(q, "d.serial_number", "d.asset_tag")
+
+	where := "HAVING score > 0"
+	scope, scopeParameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		where = "WHERE " + scope + " " + where
+		parameters = append(parameters, scopeParameters...)
+	}
+	parameters = append(parameters, limit)
+
+	return s.searchQuery(ctx, SearchTypeDevice, fmt.Sprintf("SELECT d.id, d.serial_number, m.manufacturer, m.model, d.location, %s AS score FROM device AS d JOIN model AS m ON d.model_id = m.id %s ORDER BY score DESC, d.serial_number LIMIT ?;", rank, where), parameters,
+		func(rows *sql.Rows) (*SearchResult, error) {
+			r := new(SearchResult)
+			var manufacturer, model, location string
+			err := rows.Scan(&(r.ID), &(r.Title), &manufacturer, &model, &location, &(r.Rank))
+			r.Subtitle = fmt.Sprintf("%s %s - %s", manufacturer, model, location)
+			return r, err
+		})
+}
+
+func (s *TxStore) searchModels(ctx context.Context, q string, limit int) ([]*SearchResult, error) {
+	rank, parameters := rankSQL(q, "m.manufacturer", "m.model", "CONCAT(m.manufacturer, ' ', m.model)")
+	parameters = append(parameters, limit)
+
+	return s.searchQuery(ctx, SearchTypeModel, fmt.Sprintf("SELECT m.id, m.manufacturer, m.model, %s AS score FROM model AS m WHERE m.deleted_at IS NULL HAVING score > 0 ORDER BY score DESC, m.manufacturer, m.model LIMIT ?;", rank), parameters,
+		func(rows *sql.Rows) (*SearchResult, error) {
+			r := new(SearchResult)
+			var manufacturer, model string
+			err := rows.Scan(&(r.ID), &manufacturer, &model, &(r.Rank))
+			r.Title = fmt.Sprintf("%s %s", manufacturer, model)
+			return r, err
+		})
+}
+
+func (s *TxStore) searchUsers(ctx context.Context, q string, limit int) ([]*SearchResult, error) {
+	rank, parameters := rankSQL(q, "u.name", "u.email")
+	parameters = append(parameters, limit)
+
+	return s.searchQuery(ctx, SearchTypeUser, fmt.Sprintf("SELECT u.id, u.name, u.email, %s AS score FROM user AS u WHERE u.deleted_at IS NULL HAVING score > 0 ORDER BY score DESC, u.name LIMIT ?;", rank), parameters,
+		func(rows *sql.Rows) (*SearchResult, error) {
+			r := new(SearchResult)
+			err := rows.Scan(&(r.ID), &(r.Title), &(r.Subtitle), &(r.Rank))
+			return r, err
+		})
+}
+
+func (s *TxStore) searchLocations(ctx context.Context, q string, limit int) ([]*SearchResult, error) {
+	rank, parameters := rankSQL(q, "l.location", "l.description")
+	parameters = append(parameters, limit)
+
+	return s.searchQuery(ctx, SearchTypeLocation, fmt.Sprintf("SELECT l.location, IFNULL(l.parent, ''), %s AS score FROM location AS l HAVING score > 0 ORDER BY score DESC, l.location LIMIT ?;", rank), parameters,
+		func(rows *sql.Rows) (*SearchResult, error) {
+			r := new(SearchResult)
+			err := rows.Scan(&(r.Key), &(r.Subtitle), &(r.Rank))
+			r.Title = r.Key
+			return r, err
+		})
+}
+
+func (s *TxStore) searchNotes(ctx context.Context, q string, limit int) ([]*SearchResult, error) {
+	where, parameters, order, orderParameters := noteMatchSQL(q)
+	scope, scopeParameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		where += " AND " + scope
+		parameters = append(parameters, scopeParameters...)
+	}
+	parameters = append(append(parameters, orderParameters...), limit)
+
+	return s.searchQuery(ctx, SearchTypeNote, fmt.Sprintf("SELECT e.device_id, d.serial_number, e.content FROM device_log AS e JOIN device AS d ON e.device_id = d.id WHERE %s ORDER BY %s LIMIT ?;", where, order), parameters,
+		func(rows *sql.Rows) (*SearchResult, error) {
+			r := &SearchResult{Rank: 1}
+			var content []byte
+			if err := rows.Scan(&(r.ID), &(r.Subtitle), &content); err != nil {
+				return nil, err
+			}
+			var note *NoteContent
+			if err := json.Unmarshal(content, &note); err != nil || note == nil {
+				return nil, errors.New("invalid note content")
+			}
+			r.Title = note.Note
+			return r, nil
+		})
+}
+
+//Search returns Devices, Models, Users, Locations, and notes matching q, at most limit of each type, ordered by Rank,
+//or an error if one occurred. Devices and notes are restricted to the Locations the request User may access
+func (s *TxStore) Search(ctx context.Context, q string, limit int) ([]*SearchResult, error) {
+	q = normalizeSpace(q)
+	if q == "" {
+		return nil, &Error{Description: "Could not validate search", Type: ErrorTypeUser, Err: errors.New("q cannot be empty")}
+	}
+
+	results := []*SearchResult{}
+
+	for _, search := range []func(context.Context, string, int) ([]*SearchResult, error){
+		s.searchDevices, s.searchModels, s.searchUsers, s.searchLocations, s.searchNotes,
+	} {
+		r, err := search(ctx, q, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+
+	return results, nil
+}
+
+//NoteMatch represents a note Event matching a note search and the Device it was added to
+type NoteMatch struct {
+	Event  *Event  `json:"event"`
+	Device *Device `json:"device"`
+}
+
+//noteMatchSQL returns an SQL criterion matching note Events (with table alias e) containing q and its parameters,
+//and an ORDER BY expression ranking the matches and its parameters.
+//The full-text index is used unless q has a word too short to be indexed
+func noteMatchSQL(q string) (where string, parameters []interface{}, order string, orderParameters []interface{}) {
+	if ft, ok := fullTextQuery(q); ok {
+		return "e.type = 'note' AND MATCH(e.content) AGAINST(? IN BOOLEAN MODE)", []interface{}{ft},
+			"MATCH(e.content) AGAINST(? IN BOOLEAN MODE) DESC, e.date DESC", []interface{}{ft}
+	}
+
+	return "e.type = 'note' AND e.content LIKE ?", []interface{}{"%" + q + "%"}, "e.date DESC", nil
+}
+
+//SearchNotes returns at most limit note Events containing q, most relevant first, with the Device each was added to,
+//or an error if one occurred. Notes are restricted to Devices the request User may access
+func (s *TxStore) SearchNotes(ctx context.Context, q string, limit int) ([]*NoteMatch, error) {
+	tx := s.tx
+
+	q = normalizeSpace(q)
+	if q == "" {
+		return nil, &Error{Description: "Could not validate note search", Type: ErrorTypeUser, Err: errors.New("q cannot be empty")}
+	}
+
+	where, parameters, order, orderParameters := noteMatchSQL(q)
+	scope, scopeParameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		where += " AND " + scope
+		parameters = append(parameters, scopeParameters...)
+	}
+	parameters = append(append(parameters, orderParameters...), limit)
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+SELECT e.id, e.user_id, e.user_name, e.date, e.content, e.source, e.source_conversation_id, d.id, d.serial_number, d.asset_tag, d.model_id, d.status, d.location, d.last_event_at
+	FROM device_log AS e JOIN device AS d ON e.device_id = d.id
+	WHERE %s ORDER BY %s LIMIT ?;`, where, order), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not search notes", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	matches := []*NoteMatch{}
+	var userIDs []int64
+	seenUsers := make(map[int64]bool)
+
+	for rows.Next() {
+		e := &Event{Type: "note"}
+		d := new(Device)
+		var userID sql.NullInt64
+		var userName, assetTag, sourceType, conversationID sql.NullString
+		var lastEvent sql.NullTime
+		var content []byte
+
+		if err := rows.Scan(&(e.ID), &userID, &userName, &(e.Date), &content, &sourceType, &conversationID,
+			&(d.ID), &(d.SerialNumber), &assetTag, &(d.ModelID), &(d.Status), &(d.Location), &lastEvent); err != nil {
+			return nil, &Error{Description: "Could not scan note search row", Type: ErrorTypeServer, Err: err}
+		}
+
+		var note *NoteContent
+		if err := json.Unmarshal(content, &note); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not unmarshal note content json for Device(%d)", d.ID), Type: ErrorTypeServer, Err: err}
+		}
+		e.Content = note
+		e.Source = scanEventSource(sourceType, conversationID)
+
+		e.UserID = userID.Int64
+		if !userID.Valid {
+			e.User = &User{Name: userName.String}
+		} else if !seenUsers[e.UserID] {
+			seenUsers[e.UserID] = true
+			userIDs = append(userIDs, e.UserID)
+		}
+
+		d.AssetTag = assetTag.String
+		d.LastEventAt = timePtr(lastEvent)
+
+		matches = append(matches, &NoteMatch{Event: e, Device: d})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan note search rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	users, err := s.ReadUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, &Error{Description: "Could not read note search users", Type: ErrorTypeServer, Err: err}
+	}
+
+	for _, m := range matches {
+		if m.Event.User == nil {
+			m.Event.User = users[m.Event.UserID]
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+//MaxSimulationChanges is the most SimulationChanges a single simulation may apply
+const MaxSimulationChanges = 20
+
+//SimulationChange is a proposed bulk change. Devices matching every set criterion (Manufacturer through PastEOL) are given
+//SetStatus and/or SetLocation, or are removed from the inventory if Remove is true.
+//MinAgeYears matches Devices created at least that many years ago
+type SimulationChange struct {
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	ModelID      int64    `json:"model_id,omitempty"`
+	CategoryID   int64    `json:"category_id,omitempty"`
+	Status       Status   `json:"status,omitempty"`
+	Location     Location `json:"location,omitempty"`
+	MinAgeYears  float64  `json:"min_age_years,omitempty"`
+	PastEOL      bool     `json:"past_eol,omitempty"`
+	SetStatus    Status   `json:"set_status,omitempty"`
+	SetLocation  Location `json:"set_location,omitempty"`
+	Remove       bool     `json:"remove,omitempty"`
+}
+
+//Validate validates the given SimulationChange
+func (c *SimulationChange) Validate() error {
+	if c.SetStatus == "" && c.SetLocation == "" && !c.Remove {
+		return fieldError("set_status", "required", "set_status, set_location, or remove must be set")
+	}
+	if c.Remove && (c.SetStatus != "" || c.SetLocation != "") {
+		return fieldError("remove", "conflict", "remove cannot be combined with set_status or set_location")
+	}
+	if c.MinAgeYears < 0 {
+		return fieldError("min_age_years", "negative", "min_age_years (%g) must not be negative", c.MinAgeYears)
+	}
+	return nil
+}
+
+//SimulationGroup represents the Device count for a Status, Location, or Model before and after a simulation.
+//ID is only set for Models
+type SimulationGroup struct {
+	ID     int64  `json:"id,omitempty"`
+	Key    string `json:"key"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+}
+
+//Simulation represents the result of applying SimulationChanges, in order, to the current inventory without committing them.
+//Matched is the number of Devices changed by at least one SimulationChange
+type Simulation struct {
+	Changes   []*SimulationChange `json:"changes"`
+	Matched   int                 `json:"matched"`
+	Before    int                 `json:"before"`
+	After     int                 `json:"after"`
+	Statuses  []*SimulationGroup  `json:"statuses"`
+	Locations []*SimulationGroup  `json:"locations"`
+	Models    []*SimulationGroup  `json:"models"`
+}
+
+//simulatedDevice is a Device as seen by a simulation
+type simulatedDevice struct {
+	modelID      int64
+	manufacturer string
+	model        string
+	categoryID   int64
+	eolDate      *time.Time
+	created      *time.Time
+	status       Status
+	location     Location
+	removed      bool
+}
+
+func (d *simulatedDevice) matches(c *SimulationChange, now time.Time) bool {
+	switch {
+	case d.removed:
+		return false
+	case c.Manufacturer != "" && c.Manufacturer != d.manufacturer:
+		return false
+	case c.ModelID != 0 && c.ModelID != d.modelID:
+		return false
+	case c.CategoryID != 0 && c.CategoryID != d.categoryID:
+		return false
+	case c.Status != "" && c.Status != d.status:
+		return false
+	case c.Location != "" && c.Location != d.location:
+		return false
+	case c.PastEOL && (d.eolDate == nil || !d.eolDate.Before(now)):
+		return false
+	}
+
+	if c.MinAgeYears > 0 {
+		cutoff := now.Add(-time.Duration(c.MinAgeYears * 365.25 * 24 * float64(time.Hour)))
+		if d.created == nil || d.created.After(cutoff) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//simulationCounter counts Devices before and after a simulation for one grouping
+type simulationCounter struct {
+	groups map[string]*SimulationGroup
+}
+
+func (sc *simulationCounter) group(id int64, key string) *SimulationGroup {
+	k := fmt.Sprintf("%d\x00%s", id, key)
+	g, ok := sc.groups[k]
+	if !ok {
+		g = &SimulationGroup{ID: id, Key: key}
+		sc.groups[k] = g
+	}
+	return g
+}
+
+//sorted returns the groups ordered by the largest change first, then by key
+func (sc *simulationCounter) sorted() []*SimulationGroup {
+	groups := make([]*SimulationGroup, 0, len(sc.groups))
+	for _, g := range sc.groups {
+		groups = append(groups, g)
+	}
+
+	abs := func(i int) int {
+		if i < 0 {
+			return -i
+		}
+		return i
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		di, dj := abs(groups[i].After-groups[i].Before), abs(groups[j].After-groups[j].Before)
+		if di != dj {
+			return di > dj
+		}
+		return groups[i].Key < groups[j].Key
+	})
+
+	return groups
+}
+
+//Simulate applies the given SimulationChanges, in order, to the current inventory and returns the resulting counts
+//without changing anything, or an error if one occurred. Devices are restricted to the Locations the request User may access
+func (s *TxStore) Simulate(ctx context.Context, changes []*SimulationChange) (*Simulation, error) {
+	tx := s.tx
+
+	if len(changes) == 0 {
+		return nil, &Error{Description: "Could not validate Simulation", Type: ErrorTypeUser, Err: fieldError("changes", "required", "changes cannot be empty")}
+	}
+	if len(changes) > MaxSimulationChanges {
+		return nil, &Error{Description: "Could not validate Simulation", Type: ErrorTypeUser, Err: fieldError("changes", "too_long", "changes cannot have more than %d entries", MaxSimulationChanges)}
+	}
+	for i, c := range changes {
+		if c == nil {
+			return nil, &Error{Description: "Could not validate Simulation", Type: ErrorTypeUser, Err: fieldError(fmt.Sprintf("changes[%d]", i), "required", "change %d cannot be null", i)}
+		}
+		if err := c.Validate(); err != nil {
+			if e, ok := err.(*FieldError); ok {
+				err = &FieldError{Field: fmt.Sprintf("changes[%d].%s", i, e.Field), Code: e.Code, Message: fmt.Sprintf("change %d: %s", i, e.Message)}
+			}
+			return nil, &Error{Description: "Could not validate Simulation", Type: ErrorTypeUser, Err: err}
+		}
+	}
+
+	var where string
+	criterion, parameters, err := s.deviceScope(ctx, "d")
+	if err != nil {
+		return nil, err
+	}
+	if criterion != "" {
+		where = "WHERE " + criterion
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT d.model_id, m.manufacturer, m.model, m.category_id, m.eol_date, d.status, d.location,
+		(SELECT MIN(e.date) FROM device_log AS e WHERE e.device_id = d.id AND e.type = 'created')
+		FROM device AS d JOIN model AS m ON d.model_id = m.id %s;`, where), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query Simulation Devices", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var devices []*simulatedDevice
+
+	for rows.Next() {
+		d := new(simulatedDevice)
+		var categoryID sql.NullInt64
+		var eolDate, created sql.NullTime
+
+		if err = rows.Scan(&(d.modelID), &(d.manufacturer), &(d.model), &categoryID, &eolDate, &(d.status), &(d.location), &created); err != nil {
+			return nil, &Error{Description: "Could not scan Simulation Device row", Type: ErrorTypeServer, Err: err}
+		}
+
+		d.categoryID = categoryID.Int64
+		d.eolDate = timePtr(eolDate)
+		d.created = timePtr(created)
+		devices = append(devices, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan Simulation Device rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	statuses := &simulationCounter{groups: make(map[string]*SimulationGroup)}
+	locations := &simulationCounter{groups: make(map[string]*SimulationGroup)}
+	models := &simulationCounter{groups: make(map[string]*SimulationGroup)}
+
+	sim := &Simulation{Changes: changes, Before: len(devices)}
+	now := time.Now()
+
+	for _, d := range devices {
+		statuses.group(0, string(d.status)).Before++
+		locations.group(0, string(d.location)).Before++
+		models.group(d.modelID, d.manufacturer+" "+d.model).Before++
+
+		changed := false
+		for _, c := range changes {
+			if !d.matches(c, now) {
+				continue
+			}
+			changed = true
+			if c.Remove {
+				d.removed = true
+				continue
+			}
+			if c.SetStatus != "" {
+				d.status = c.SetStatus
+			}
+			if c.SetLocation != "" {
+				d.location = c.SetLocation
+			}
+		}
+
+		if changed {
+			sim.Matched++
+		}
+		if d.removed {
+			continue
+		}
+
+		sim.After++
+		statuses.group(0, string(d.status)).After++
+		locations.group(0, string(d.location)).After++
+		models.group(d.modelID, d.manufacturer+" "+d.model).After++
+	}
+
+	sim.Statuses = statuses.sorted()
+	sim.Locations = locations.sorted()
+	sim.Models = models.sorted()
+
+	return sim, nil
+}
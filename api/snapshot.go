@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+//InventorySnapshot represents the inventory as it existed at the end of Date, reconstructed from Device Events.
+//Devices have Model populated. Statuses and Locations count Devices by Status and Location
+type InventorySnapshot struct {
+	Date      time.Time        `json:"date"`
+	Count     int              `json:"count"`
+	Statuses  map[Status]int   `json:"statuses"`
+	Locations map[Location]int `json:"locations"`
+	Devices   []*Device        `json:"devices"`
+}
+
+//applySnapshotField sets the Device field with the given name to the given event value
+func applySnapshotField(d *Device, name string, value interface{}) {
+	switch name {
+	case "serial_number":
+		if v, ok := value.(string); ok {
+			d.SerialNumber = v
+		}
+	case "asset_tag":
+		if v, ok := value.(string); ok {
+			d.AssetTag = v
+		}
+	case "model_id":
+		//JSON numbers decode as float64
+		if v, ok := value.(float64); ok {
+			d.ModelID = int64(v)
+		}
+	case "status":
+		if v, ok := value.(string); ok {
+			d.Status = Status(v)
+		}
+	case "location":
+		if v, ok := value.(string); ok {
+			d.Location = Location(v)
+		}
+	}
+}
+
+//applySnapshotEvent applies the given created, modified, deleted, or restored event to d
+func applySnapshotEvent(d *Device, typ string, date time.Time, content []byte) error {
+	switch typ {
+	case "deleted":
+		d.DeletedAt = &date
+		return nil
+	case "restored":
+		d.DeletedAt = nil
+		return nil
+	}
+
+	var c struct {
+		Fields []struct {
+			Name     string      `json:"name"`
+			Value    interface{} `json:"value"`
+			NewValue interface{} `json:"new_value"`
+		} `json:"fields"`
+	}
+
+	if err := json.Unmarshal(content, &c); err != nil {
+		return err
+	}
+
+	for _, f := range c.Fields {
+		if typ == "created" {
+			applySnapshotField(d, f.Name, f.Value)
+		} else {
+			applySnapshotField(d, f.Name, f.NewValue)
+		}
+	}
+
+	return nil
+}
+
+//ReadInventorySnapshot returns an InventorySnapshot for the end of the given day (in the server's time zone), or an error if one occurred.
+//Devices are restricted to the Locations the request User may access, based on where they were at the time
+func (s *TxStore) ReadInventorySnapshot(ctx context.Context, date time.Time) (*InventorySnapshot, error) {
+	tx := s.tx
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	end := day.AddDate(0, 0, 1)
+
+	permitted, err := s.readPermittedLocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed map[Location]bool
+	if permitted != nil {
+		allowed = make(map[Location]bool)
+		for _, l := range permitted {
+			allowed[l] = true
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT device_id, type, date, content FROM %s AS e WHERE type IN ('created', 'modified', 'deleted', 'restored') AND date < ? ORDER BY device_id, date, id;", allEventsTable), end)
+	if err != nil {
+		return nil, &Error{Description: "Could not query InventorySnapshot events", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	devices := make(map[int64]*Device)
+	var ids []int64
+
+	for rows.Next() {
+		var (
+			id      int64
+			typ     string
+			date    time.Time
+			content []byte
+		)
+
+		if err = rows.Scan(&id, &typ, &date, &content); err != nil {
+			return nil, &Error{Description: "Could not scan InventorySnapshot event row", Type: ErrorTypeServer, Err: err}
+		}
+
+		d, ok := devices[id]
+		if !ok {
+			//a Device only exists once it's been created
+			if typ != "created" {
+				continue
+			}
+			d = &Device{ID: id}
+			devices[id] = d
+			ids = append(ids, id)
+		}
+
+		if err = applySnapshotEvent(d, typ, date, content); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not parse event content for Device(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan InventorySnapshot event rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	snapshot := &InventorySnapshot{
+		Date:      day,
+		Statuses:  make(map[Status]int),
+		Locations: make(map[Location]int),
+		Devices:   []*Device{},
+	}
+
+	models := make(map[int64]*Model)
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		d := devices[id]
+
+		//soft deleted Devices are hidden, as they are from reports
+		if d.DeletedAt != nil {
+			continue
+		}
+
+		if allowed != nil && !allowed[d.Location] {
+			continue
+		}
+
+		m, ok := models[d.ModelID]
+		if !ok {
+			if m, err = s.ReadModel(ctx, d.ModelID); err != nil {
+				return nil, err
+			}
+			models[d.ModelID] = m
+		}
+		d.Model = m
+
+		snapshot.Statuses[d.Status]++
+		snapshot.Locations[d.Location]++
+		snapshot.Devices = append(snapshot.Devices, d)
+	}
+
+	snapshot.Count = len(snapshot.Devices)
+
+	return snapshot, nil
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//Devices, Models, and Users are soft deleted by setting their deleted_at column.
+//Deleted rows are hidden from reads by id, queries, search, stats, and reports, but are kept so history
+//(Events and their Users and Models) is intact and they can be restored.
+//Unique columns still apply to deleted rows, so lookups by a unique key (e.g. ReadDeviceBySerialNumber)
+//return deleted rows with DeletedAt set, and duplicate errors point at the deleted row to restore
+
+//notDeleted returns an SQL criterion matching rows of the given table alias that haven't been deleted
+func notDeleted(alias string) string {
+	return alias + ".deleted_at IS NULL"
+}
+
+//deviceScope returns an SQL criterion (and its parameters) restricting Devices with the given table alias to
+//those that haven't been deleted and are in the Locations the request User may access
+func (s *TxStore) deviceScope(ctx context.Context, alias string) (string, []interface{}, error) {
+	scope, parameters, err := s.locationScope(ctx, alias+".location")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if scope == "" {
+		return notDeleted(alias), nil, nil
+	}
+
+	return notDeleted(alias) + " AND " + scope, parameters, nil
+}
+
+//softDelete marks the row in table with the given id as deleted, or returns an error if it doesn't exist or is already deleted.
+//typ is the entity type used in errors, e.g. Device
+func (s *TxStore) softDelete(ctx context.Context, table, typ string, id int64) error {
+	tx := s.tx
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET deleted_at=? WHERE id=? AND deleted_at IS NULL;", table), time.Now(), id)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete %s(%d)", typ, id), Type: ErrorTypeServer, Err: err}
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete %s(%d)", typ, id), Type: ErrorTypeServer, Err: err}
+	} else if n == 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete %s(%d)", typ, id), Type: ErrorTypeUser, Err: fmt.Errorf("%s does not exist", typ)}
+	}
+
+	return nil
+}
+
+//restore clears the deleted mark of the row in table with the given id, or returns an error if it doesn't exist or isn't deleted.
+//typ is the entity type used in errors, e.g. Device
+func (s *TxStore) restore(ctx context.Context, table, typ string, id int64) error {
+	tx := s.tx
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET deleted_at=NULL WHERE id=? AND deleted_at IS NOT NULL;", table), id)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not restore %s(%d)", typ, id), Type: ErrorTypeServer, Err: err}
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not restore %s(%d)", typ, id), Type: ErrorTypeServer, Err: err}
+	} else if n == 0 {
+		return &Error{Description: fmt.Sprintf("Could not restore %s(%d)", typ, id), Type: ErrorTypeUser, Err: fmt.Errorf("deleted %s does not exist", typ)}
+	}
+
+	return nil
+}
+
+//DeleteDevice soft deletes the Device with the given id and records a deleted Event, or returns an error if one occurred
+func (s *TxStore) DeleteDevice(ctx context.Context, id int64) error {
+	if err := s.CheckDevicePermission(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.softDelete(ctx, "device", DeviceEventLocation.Type, id); err != nil {
+		return err
+	}
+
+	user := ctx.Value(UserKey).(*User)
+	if _, err := s.CreateEvent(ctx, id, DeviceEventLocation, &Event{Date: time.Now(), UserID: user.ID, Type: "deleted"}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//RestoreDevice restores the deleted Device with the given id and records a restored Event, or returns an error if one occurred.
+//The Device's Model must not be deleted
+func (s *TxStore) RestoreDevice(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	var location Location
+	var modelDeleted bool
+	row := tx.QueryRowContext(ctx, "SELECT d.location, m.deleted_at IS NOT NULL FROM device AS d JOIN model AS m ON d.model_id = m.id WHERE d.id=?;", id)
+	switch err := row.Scan(&location, &modelDeleted); {
+	case err == sql.ErrNoRows:
+		return &Error{Description: fmt.Sprintf("Could not restore Device(%d)", id), Type: ErrorTypeUser, Err: errors.New("deleted Device does not exist")}
+	case err != nil:
+		return &Error{Description: fmt.Sprintf("Could not query Device(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	if err := s.CheckLocationPermission(ctx, location); err != nil {
+		return err
+	}
+
+	if modelDeleted {
+		return &Error{Description: fmt.Sprintf("Could not restore Device(%d)", id), Type: ErrorTypeUser, Err: errors.New("Device's Model is deleted; restore the Model first")}
+	}
+
+	if err := s.restore(ctx, "device", DeviceEventLocation.Type, id); err != nil {
+		return err
+	}
+
+	user := ctx.Value(UserKey).(*User)
+	if _, err := s.CreateEvent(ctx, id, DeviceEventLocation, &Event{Date: time.Now(), UserID: user.ID, Type: "restored"}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//DeleteModel soft deletes the Model with the given id, or returns an error if one occurred.
+//Models used by Devices that aren't deleted can't be deleted
+func (s *TxStore) DeleteModel(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM device WHERE model_id=? AND deleted_at IS NULL;", id).Scan(&count); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query Devices for Model(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+	if count > 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete Model(%d)", id), Type: ErrorTypeUser, Err: fmt.Errorf("Model is used by %d devices", count)}
+	}
+
+	if err := s.softDelete(ctx, "model", "Model", id); err != nil {
+		return err
+	}
+
+	requestCache(ctx).Invalidate(cacheKey("Model", id))
+
+	return nil
+}
+
+//RestoreModel restores the deleted Model with the given id, or returns an error if one occurred
+func (s *TxStore) RestoreModel(ctx context.Context, id int64) error {
+	if err := s.restore(ctx, "model", "Model", id); err != nil {
+		return err
+	}
+
+	requestCache(ctx).Invalidate(cacheKey("Model", id))
+
+	return nil
+}
+
+//RestoreUser restores the deleted User with the given id, or returns an error if one occurred
+func (s *TxStore) RestoreUser(ctx context.Context, id int64) error {
+	return s.restore(ctx, "user", "User", id)
+}
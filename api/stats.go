@@ -3,12 +3,22 @@ package api
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
-//StatsLocation represents Location Stats
+//statsTimeout is the combined timeout for all Stats queries
+const statsTimeout = 30 * time.Second
+
+//StatsLocation represents Location Stats. Capacity and Utilization (Count / Capacity) are 0 if the Location has no limit
 type StatsLocation struct {
-	Location string `json:"location"`
-	Count    int    `json:"count"`
+	Location    string  `json:"location"`
+	Count       int     `json:"count"`
+	Capacity    int     `json:"capacity,omitempty"`
+	Utilization float64 `json:"utilization,omitempty"`
 }
 
 //StatsModel represents Model Stats
@@ -19,6 +29,13 @@ type StatsModel struct {
 	Count        int    `json:"count"`
 }
 
+//StatsCategory represents Category Stats. Uncategorized devices have an ID of 0.
+type StatsCategory struct {
+	ID       int64  `json:"id"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
 //StatsStatus represents Status Stats
 type StatsStatus struct {
 	Status string `json:"status"`
@@ -28,7 +45,9 @@ type StatsStatus struct {
 //Stats represents device statistics (top 10, etc)
 type Stats struct {
 	Locations     []*StatsLocation `json:"locations"`
+	OverCapacity  []*StatsLocation `json:"over_capacity"`
 	Models        []*StatsModel    `json:"models"`
+	Categories    []*StatsCategory `json:"categories"`
 	Statuses      []*StatsStatus   `json:"statuses"`
 	DeviceCount   int              `json:"device_count"`
 	ModelCount    int              `json:"model_count"`
@@ -36,58 +55,229 @@ type Stats struct {
 	Devices       []*Device        `json:"devices"`
 }
 
-//ReadStats returns Stats, or an error if one occurred.
-func ReadStats(ctx context.Context) (*Stats, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//StatsFilter restricts Stats to Devices matching all of its non-zero fields. Location matches the Location and the Locations below it
+type StatsFilter struct {
+	Location   Location `json:"location,omitempty"`
+	ModelID    int64    `json:"model_id,omitempty"`
+	Status     Status   `json:"status,omitempty"`
+	CategoryID int64    `json:"category_id,omitempty"`
+}
+
+//statsScope restricts Stats queries to the Locations the request User may access and a StatsFilter.
+//criterion only restricts the location column (with the alias d), so it also applies to Location queries;
+//deviceCriterion has the rest of the StatsFilter
+type statsScope struct {
+	criterion        string
+	parameters       []interface{}
+	deviceCriterion  string
+	deviceParameters []interface{}
+}
+
+//readStatsScope returns the statsScope for the request User and the given StatsFilter (nil for no filter), or an error if one occurred
+func (s *TxStore) readStatsScope(ctx context.Context, f *StatsFilter) (*statsScope, error) {
+	criterion, parameters, err := s.locationScope(ctx, "d.location")
+	if err != nil {
+		return nil, err
+	}
+	sc := &statsScope{criterion: criterion, parameters: parameters}
+
+	if f == nil {
+		return sc, nil
+	}
+
+	and := func(criteria, criterion string) string {
+		if criteria == "" {
+			return criterion
+		}
+		return criteria + " AND " + criterion
+	}
+
+	if f.Location != "" {
+		l, err := s.readLocationDetail(ctx, f.Location)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			return nil, &Error{Description: "Could not validate StatsFilter", Type: ErrorTypeUser, Err: fmt.Errorf("location (%s) does not exist", f.Location)}
+		}
+
+		locations, err := s.readLocationDescendants(ctx, f.Location)
+		if err != nil {
+			return nil, err
+		}
+
+		placeholders := make([]string, len(locations))
+		for i, l := range locations {
+			placeholders[i] = "?"
+			sc.parameters = append(sc.parameters, l)
+		}
+		sc.criterion = and(sc.criterion, fmt.Sprintf("d.location IN (%s)", strings.Join(placeholders, ", ")))
+	}
+
+	if f.ModelID != 0 {
+		sc.deviceCriterion = and(sc.deviceCriterion, "d.model_id=?")
+		sc.deviceParameters = append(sc.deviceParameters, f.ModelID)
+	}
+
+	if f.Status != "" {
+		sc.deviceCriterion = and(sc.deviceCriterion, "d.status=?")
+		sc.deviceParameters = append(sc.deviceParameters, f.Status)
+	}
+
+	if f.CategoryID != 0 {
+		sc.deviceCriterion = and(sc.deviceCriterion, "d.model_id IN (SELECT id FROM model WHERE category_id=?)")
+		sc.deviceParameters = append(sc.deviceParameters, f.CategoryID)
+	}
+
+	return sc, nil
+}
+
+//where returns a WHERE clause for the scope's location criterion, or an empty string if it is unrestricted
+func (sc *statsScope) where() string {
+	if sc.criterion == "" {
+		return ""
+	}
+	return "WHERE " + sc.criterion
+}
+
+//deviceWhere returns a WHERE clause for the scope that also excludes deleted Devices (with the alias d)
+func (sc *statsScope) deviceWhere() string {
+	where := "WHERE " + notDeleted("d")
+	if sc.criterion != "" {
+		where += " AND " + sc.criterion
+	}
+	if sc.deviceCriterion != "" {
+		where += " AND " + sc.deviceCriterion
+	}
+	return where
+}
+
+//allParameters returns the parameters for deviceWhere
+func (sc *statsScope) allParameters() []interface{} {
+	return append(append([]interface{}{}, sc.parameters...), sc.deviceParameters...)
+}
+
+//statsQuery is a single independent Stats query
+type statsQuery func(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error
+
+//ReadStats returns Stats for Devices matching the given StatsFilter (nil for all Devices), or an error if one occurred.
+//If the TxStore has a DB, the queries are run concurrently on separate read-only transactions.
+//Device Stats are restricted to the Locations the request User may access. LocationCount is only restricted by the filter's Location,
+//and ModelCount isn't filtered
+func (s *TxStore) ReadStats(ctx context.Context, filter *StatsFilter) (*Stats, error) {
+	stats := new(Stats)
+
+	sc, err := s.readStatsScope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []statsQuery{
+		readStatsDeviceCount,
+		readStatsModelCount,
+		readStatsLocationCount,
+		readStatsLocations,
+		readStatsOverCapacity,
+		readStatsModels,
+		readStatsCategories,
+		readStatsStatuses,
+		readStatsDevices,
+	}
+
+	if s.db == nil {
+		tx := s.tx
+		for _, q := range queries {
+			if err := q(ctx, tx, sc, stats); err != nil {
+				return nil, err
+			}
+		}
+		return stats, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, statsTimeout)
+	defer cancel()
+
+	g, gctx := errgroup.WithContext(ctx)
 
-	s := new(Stats)
+	for _, q := range queries {
+		q := q
+		g.Go(func() error {
+			tx, err := s.db.BeginTx(gctx, &sql.TxOptions{ReadOnly: true})
+			if err != nil {
+				return &Error{Description: "Could not begin Stats transaction", Type: ErrorTypeServer, Err: err}
+			}
+			defer tx.Rollback()
 
-	//DeviceCount
-	row := tx.QueryRow("SELECT COUNT(id) FROM device;")
+			return q(gctx, tx, sc, stats)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func readStatsDeviceCount(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	row := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(d.id) FROM device AS d %s;", sc.deviceWhere()), sc.allParameters()...)
 	err := row.Scan(&(s.DeviceCount))
 
 	switch {
 	case err == sql.ErrNoRows:
-		return nil, &Error{Description: "Could not query Stats.DeviceCount: ErrNoRows", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.DeviceCount: ErrNoRows", Type: ErrorTypeServer, Err: err}
 	case err != nil:
-		return nil, &Error{Description: "Could not query Stats.DeviceCount", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.DeviceCount", Type: ErrorTypeServer, Err: err}
 	}
 
-	//ModelCount
-	row = tx.QueryRow("SELECT COUNT(id) FROM model;")
-	err = row.Scan(&(s.ModelCount))
+	return nil
+}
+
+func readStatsModelCount(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM model WHERE deleted_at IS NULL;")
+	err := row.Scan(&(s.ModelCount))
 
 	switch {
 	case err == sql.ErrNoRows:
-		return nil, &Error{Description: "Could not query Stats.ModelCount: ErrNoRows", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.ModelCount: ErrNoRows", Type: ErrorTypeServer, Err: err}
 	case err != nil:
-		return nil, &Error{Description: "Could not query Stats.ModelCount", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.ModelCount", Type: ErrorTypeServer, Err: err}
 	}
 
-	//LocationCount
-	row = tx.QueryRow("SELECT COUNT(location) FROM location;")
-	err = row.Scan(&(s.LocationCount))
+	return nil
+}
+
+func readStatsLocationCount(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	row := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(d.location) FROM location AS d %s;", sc.where()), sc.parameters...)
+	err := row.Scan(&(s.LocationCount))
 
 	switch {
 	case err == sql.ErrNoRows:
-		return nil, &Error{Description: "Could not query Stats.LocationCount: ErrNoRows", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.LocationCount: ErrNoRows", Type: ErrorTypeServer, Err: err}
 	case err != nil:
-		return nil, &Error{Description: "Could not query Stats.LocationCount", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.LocationCount", Type: ErrorTypeServer, Err: err}
 	}
 
-	//Locations
-	rows, err := tx.Query("SELECT location, COUNT(id) as c FROM device GROUP BY location ORDER BY c DESC LIMIT 10;")
+	return nil
+}
+
+func readStatsLocations(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT d.location, COUNT(d.id) as c, IFNULL(l.capacity, 0) FROM device AS d JOIN location AS l ON d.location = l.location %s GROUP BY d.location, l.capacity ORDER BY c DESC LIMIT 10;", sc.deviceWhere()), sc.allParameters()...)
 	if err != nil {
-		return nil, &Error{Description: "Could not query Stats.Locations", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.Locations", Type: ErrorTypeServer, Err: err}
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		l := new(StatsLocation)
 
-		sErr := rows.Scan(&(l.Location), &(l.Count))
+		sErr := rows.Scan(&(l.Location), &(l.Count), &(l.Capacity))
 		if sErr != nil {
-			return nil, &Error{Description: "Could not scan Stats.Locations row", Type: ErrorTypeServer, Err: sErr}
+			return &Error{Description: "Could not scan Stats.Locations row", Type: ErrorTypeServer, Err: sErr}
+		}
+
+		if l.Capacity > 0 {
+			l.Utilization = float64(l.Count) / float64(l.Capacity)
 		}
 
 		s.Locations = append(s.Locations, l)
@@ -95,13 +285,43 @@ func ReadStats(ctx context.Context) (*Stats, error) {
 
 	err = rows.Err()
 	if err != nil {
-		return nil, &Error{Description: "Could not scan Stats.Locations rows", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not scan Stats.Locations rows", Type: ErrorTypeServer, Err: err}
 	}
 
-	//Models
-	rows, err = tx.Query("SELECT d.model_id, m.manufacturer, m.model, COUNT(d.id) as c FROM device AS d JOIN model AS m ON d.model_id = m.id GROUP BY d.model_id ORDER BY c DESC LIMIT 10;")
+	return nil
+}
+
+func readStatsOverCapacity(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT d.location, COUNT(d.id) as c, l.capacity FROM device AS d JOIN location AS l ON d.location = l.location %s GROUP BY d.location, l.capacity HAVING l.capacity > 0 AND c > l.capacity ORDER BY c / l.capacity DESC;", sc.deviceWhere()), sc.allParameters()...)
 	if err != nil {
-		return nil, &Error{Description: "Could not query Stats.Models", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.OverCapacity", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l := new(StatsLocation)
+
+		sErr := rows.Scan(&(l.Location), &(l.Count), &(l.Capacity))
+		if sErr != nil {
+			return &Error{Description: "Could not scan Stats.OverCapacity row", Type: ErrorTypeServer, Err: sErr}
+		}
+		l.Utilization = float64(l.Count) / float64(l.Capacity)
+
+		s.OverCapacity = append(s.OverCapacity, l)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return &Error{Description: "Could not scan Stats.OverCapacity rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+func readStatsModels(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT d.model_id, m.manufacturer, m.model, COUNT(d.id) as c FROM device AS d JOIN model AS m ON d.model_id = m.id %s GROUP BY d.model_id ORDER BY c DESC LIMIT 10;", sc.deviceWhere()), sc.allParameters()...)
+	if err != nil {
+		return &Error{Description: "Could not query Stats.Models", Type: ErrorTypeServer, Err: err}
 	}
 	defer rows.Close()
 
@@ -110,7 +330,7 @@ func ReadStats(ctx context.Context) (*Stats, error) {
 
 		sErr := rows.Scan(&(m.ID), &(m.Manufacturer), &(m.Model), &(m.Count))
 		if sErr != nil {
-			return nil, &Error{Description: "Could not scan Stats.Models row", Type: ErrorTypeServer, Err: sErr}
+			return &Error{Description: "Could not scan Stats.Models row", Type: ErrorTypeServer, Err: sErr}
 		}
 
 		s.Models = append(s.Models, m)
@@ -118,13 +338,42 @@ func ReadStats(ctx context.Context) (*Stats, error) {
 
 	err = rows.Err()
 	if err != nil {
-		return nil, &Error{Description: "Could not scan Stats.Models rows", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not scan Stats.Models rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+func readStatsCategories(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT IFNULL(cat.id, 0), IFNULL(cat.name, ''), COUNT(d.id) as c FROM device AS d JOIN model AS m ON d.model_id = m.id LEFT JOIN category AS cat ON m.category_id = cat.id %s GROUP BY cat.id, cat.name ORDER BY c DESC;", sc.deviceWhere()), sc.allParameters()...)
+	if err != nil {
+		return &Error{Description: "Could not query Stats.Categories", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := new(StatsCategory)
+
+		sErr := rows.Scan(&(c.ID), &(c.Category), &(c.Count))
+		if sErr != nil {
+			return &Error{Description: "Could not scan Stats.Categories row", Type: ErrorTypeServer, Err: sErr}
+		}
+
+		s.Categories = append(s.Categories, c)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return &Error{Description: "Could not scan Stats.Categories rows", Type: ErrorTypeServer, Err: err}
 	}
 
-	//Statuses
-	rows, err = tx.Query("SELECT status, COUNT(id) as c FROM device GROUP BY status ORDER BY c DESC LIMIT 10;")
+	return nil
+}
+
+func readStatsStatuses(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT d.status, COUNT(d.id) as c FROM device AS d %s GROUP BY d.status ORDER BY c DESC LIMIT 10;", sc.deviceWhere()), sc.allParameters()...)
 	if err != nil {
-		return nil, &Error{Description: "Could not query Stats.Statuses", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.Statuses", Type: ErrorTypeServer, Err: err}
 	}
 	defer rows.Close()
 
@@ -133,7 +382,7 @@ func ReadStats(ctx context.Context) (*Stats, error) {
 
 		sErr := rows.Scan(&(st.Status), &(st.Count))
 		if sErr != nil {
-			return nil, &Error{Description: "Could not scan Stats.Statuses row", Type: ErrorTypeServer, Err: sErr}
+			return &Error{Description: "Could not scan Stats.Statuses row", Type: ErrorTypeServer, Err: sErr}
 		}
 
 		s.Statuses = append(s.Statuses, st)
@@ -141,13 +390,16 @@ func ReadStats(ctx context.Context) (*Stats, error) {
 
 	err = rows.Err()
 	if err != nil {
-		return nil, &Error{Description: "Could not scan Stats.Statuses rows", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not scan Stats.Statuses rows", Type: ErrorTypeServer, Err: err}
 	}
 
-	//Devices
-	rows, err = tx.Query("SELECT d.id, d.serial_number, m.id, m.manufacturer, m.model, d.status, d.location FROM device AS d JOIN model AS m ON d.model_id = m.id ORDER BY d.id DESC LIMIT 10;")
+	return nil
+}
+
+func readStatsDevices(ctx context.Context, tx *sql.Tx, sc *statsScope, s *Stats) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT d.id, d.serial_number, m.id, m.manufacturer, m.model, d.status, d.location FROM device AS d JOIN model AS m ON d.model_id = m.id %s ORDER BY d.id DESC LIMIT 10;", sc.deviceWhere()), sc.allParameters()...)
 	if err != nil {
-		return nil, &Error{Description: "Could not query Stats.Devices", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not query Stats.Devices", Type: ErrorTypeServer, Err: err}
 	}
 	defer rows.Close()
 
@@ -155,7 +407,7 @@ func ReadStats(ctx context.Context) (*Stats, error) {
 		d := &Device{Model: new(Model)}
 		sErr := rows.Scan(&(d.ID), &(d.SerialNumber), &(d.Model.ID), &(d.Model.Manufacturer), &(d.Model.Model), &(d.Status), &(d.Location))
 		if sErr != nil {
-			return nil, &Error{Description: "Could not scan Stats.Devices row", Type: ErrorTypeServer, Err: sErr}
+			return &Error{Description: "Could not scan Stats.Devices row", Type: ErrorTypeServer, Err: sErr}
 		}
 
 		s.Devices = append(s.Devices, d)
@@ -163,8 +415,98 @@ func ReadStats(ctx context.Context) (*Stats, error) {
 
 	err = rows.Err()
 	if err != nil {
-		return nil, &Error{Description: "Could not scan Stats.Device rows", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not scan Stats.Device rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//StatsPeriod represents Device activity in a Period starting at Start.
+//Devices is the number of Devices created by the end of the Period; StatusChanges counts Status changes, and Statuses counts them by the new Status
+//(e.g. check-outs are changes to a "Checked Out" Status)
+type StatsPeriod struct {
+	Start          time.Time      `json:"start"`
+	DevicesCreated int            `json:"devices_created"`
+	Devices        int            `json:"devices"`
+	StatusChanges  int            `json:"status_changes"`
+	Statuses       map[Status]int `json:"statuses"`
+}
+
+//StatsTimeSeries represents Device activity in a date range (Since inclusive, Until exclusive), grouped by Period
+type StatsTimeSeries struct {
+	Period  Period         `json:"period"`
+	Since   time.Time      `json:"since"`
+	Until   time.Time      `json:"until"`
+	Periods []*StatsPeriod `json:"periods"`
+}
+
+//ReadStatsTimeSeries returns a StatsTimeSeries for the given Period and date range and Devices matching the given StatsFilter
+//(nil for all Devices), or an error if one occurred. Devices are filtered by their current values.
+//Device Stats are restricted to the Locations the request User may access. Deleted Devices aren't counted; archived Events are
+func (s *TxStore) ReadStatsTimeSeries(ctx context.Context, period Period, since, until time.Time, filter *StatsFilter) (*StatsTimeSeries, error) {
+	tx := s.tx
+
+	starts, err := periodStarts(period, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := s.readStatsScope(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &StatsTimeSeries{Period: period, Since: since, Until: until, Periods: make([]*StatsPeriod, len(starts))}
+	index := make(map[int64]int, len(starts))
+	for i, t := range starts {
+		ts.Periods[i] = &StatsPeriod{Start: t, Statuses: make(map[Status]int)}
+		index[t.Unix()] = i
+	}
+
+	var devices int
+	row := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(e.id) FROM device_log AS e JOIN device AS d ON e.device_id = d.id %s AND e.type = 'created' AND e.date < ?;", sc.deviceWhere()), append(sc.allParameters(), since)...)
+	if err = row.Scan(&devices); err != nil {
+		return nil, &Error{Description: "Could not query StatsTimeSeries device count", Type: ErrorTypeServer, Err: err}
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT e.date, e.type, e.content FROM %s AS e JOIN device AS d ON e.device_id = d.id %s AND e.type IN ('created', 'modified') AND e.date >= ? AND e.date < ?;", allEventsTable, sc.deviceWhere()), append(sc.allParameters(), since, until)...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query StatsTimeSeries events", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			date    time.Time
+			typ     string
+			content []byte
+		)
+
+		if err = rows.Scan(&date, &typ, &content); err != nil {
+			return nil, &Error{Description: "Could not scan StatsTimeSeries event row", Type: ErrorTypeServer, Err: err}
+		}
+
+		p := ts.Periods[index[period.start(date).Unix()]]
+
+		if typ == "created" {
+			p.DevicesCreated++
+			continue
+		}
+
+		if status, ok := eventStatus(typ, content); ok {
+			p.StatusChanges++
+			p.Statuses[status]++
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan StatsTimeSeries event rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	for _, p := range ts.Periods {
+		devices += p.DevicesCreated
+		p.Devices = devices
 	}
 
-	return s, nil
+	return ts, nil
 }
@@ -4,6 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 //Status is an allowed status
@@ -21,25 +26,33 @@ func (s Status) Value() (driver.Value, error) {
 	return string(s), nil
 }
 
-//ReadStatuses returns all Statuses, or an error if one occurred
-func ReadStatuses(ctx context.Context) ([]Status, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+//statusesCacheKey is the Cache key for the list of all Statuses
+const statusesCacheKey = "Statuses"
+
+//ReadStatuses returns all Statuses in display order, or an error if one occurred. The Statuses are read through the request Cache
+func (s *TxStore) ReadStatuses(ctx context.Context) ([]Status, error) {
+	tx := s.tx
+	cache := requestCache(ctx)
+
+	if cached, ok := cache.Get(statusesCacheKey); ok {
+		return append([]Status(nil), cached.([]Status)...), nil
+	}
 
 	var statuses []Status
 
-	rows, err := tx.Query("SELECT status FROM status;")
+	rows, err := tx.QueryContext(ctx, "SELECT status FROM status ORDER BY sort_order, status;")
 	if err != nil {
 		return nil, &Error{Description: "Could not query Statuses", Type: ErrorTypeServer, Err: err}
 	}
 
 	for rows.Next() {
-		var s Status
-		err = rows.Scan(&s)
+		var status Status
+		err = rows.Scan(&status)
 		if err != nil {
 			return nil, &Error{Description: "Could not scan Status row", Type: ErrorTypeServer, Err: err}
 		}
 
-		statuses = append(statuses, s)
+		statuses = append(statuses, status)
 	}
 
 	err = rows.Err()
@@ -47,5 +60,275 @@ func ReadStatuses(ctx context.Context) ([]Status, error) {
 		return nil, &Error{Description: "Could not scan Status rows", Type: ErrorTypeServer, Err: err}
 	}
 
+	cache.Set(statusesCacheKey, append([]Status(nil), statuses...))
+
 	return statuses, nil
 }
+
+//ReadStatus returns the given Status if it exists, or an error if one occurred.
+func (s *TxStore) ReadStatus(ctx context.Context, status Status) (*Status, error) {
+	tx := s.tx
+
+	var st Status
+
+	row := tx.QueryRowContext(ctx, "SELECT status FROM status WHERE status=?", status)
+	err := row.Scan(&st)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query Status(%s)", status), Type: ErrorTypeServer, Err: err}
+	}
+
+	return &st, nil
+}
+
+//Validate cleans and validates the given Status
+func (s *Status) Validate() error {
+	*s = Status(strings.TrimSpace(string(*s)))
+	return ValidateString("status", string(*s), 50)
+}
+
+//CreateStatus creates a new Status, or returns an error if one occurred
+func (s *TxStore) CreateStatus(ctx context.Context, status Status) error {
+	tx := s.tx
+
+	if err := status.Validate(); err != nil {
+		return &Error{Description: "Could not validate Status", Type: ErrorTypeUser, Err: err}
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO status(status) VALUES(?);", status); err != nil {
+		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+			return &Error{Description: fmt.Sprintf("Could not insert Status(%s)", status), Type: ErrorTypeDuplicate, Err: err}
+		}
+		return &Error{Description: fmt.Sprintf("Could not insert Status(%s)", status), Type: ErrorTypeServer, Err: err}
+	}
+
+	requestCache(ctx).Invalidate(statusesCacheKey)
+
+	return nil
+}
+
+//ReadStatusDeviceCount returns the number of Devices with the given Status, or an error if one occurred
+func (s *TxStore) ReadStatusDeviceCount(ctx context.Context, status Status) (int, error) {
+	tx := s.tx
+
+	var count int
+
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM device WHERE status=?;", status)
+	if err := row.Scan(&count); err != nil {
+		return 0, &Error{Description: fmt.Sprintf("Could not query Device count for Status(%s)", status), Type: ErrorTypeServer, Err: err}
+	}
+
+	return count, nil
+}
+
+//RenameStatus renames the given Status, or returns an error if one occurred.
+//If cascade is true, Devices with the old Status are changed to the new Status with a Modified Event for each (in one EventBatch);
+//otherwise renaming a Status that Devices reference is an error.
+func (s *TxStore) RenameStatus(ctx context.Context, oldStatus, newStatus Status, cascade bool) error {
+	tx := s.tx
+	ctx = withEventBatch(ctx, fmt.Sprintf("Rename status %s to %s", oldStatus, newStatus))
+
+	count, err := s.ReadStatusDeviceCount(ctx, oldStatus)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 && !cascade {
+		return &Error{Description: fmt.Sprintf("Could not rename Status(%s)", oldStatus), Type: ErrorTypeUser,
+			Err: fmt.Errorf("status is referenced by %d devices and cascade is false", count)}
+	}
+
+	if err = s.CreateStatus(ctx, newStatus); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE status AS n, status AS o SET n.color=o.color, n.sort_order=o.sort_order, n.semantics=o.semantics WHERE n.status=? AND o.status=?;", newStatus, oldStatus); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not copy StatusDetail from Status(%s)", oldStatus), Type: ErrorTypeServer, Err: err}
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM device WHERE status=?;", oldStatus)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query Devices for Status(%s)", oldStatus), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not scan Device row for Status(%s)", oldStatus), Type: ErrorTypeServer, Err: err}
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not scan Device rows for Status(%s)", oldStatus), Type: ErrorTypeServer, Err: err}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE device SET status=? WHERE status=?;", newStatus, oldStatus); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not change Devices from Status(%s)", oldStatus), Type: ErrorTypeServer, Err: err}
+	}
+
+	for _, id := range ids {
+		c := &ModifiedContent{Fields: []*ModifiedField{
+			&ModifiedField{Name: "status", OldValue: oldStatus, NewValue: newStatus},
+		}}
+		if _, err = s.CreateModifiedEvent(ctx, id, DeviceEventLocation, c); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not created Modified Event Device(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM status WHERE status=?;", oldStatus); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Status(%s)", oldStatus), Type: ErrorTypeServer, Err: err}
+	}
+
+	requestCache(ctx).Invalidate(statusesCacheKey)
+
+	return nil
+}
+
+//DeleteStatus deletes the given Status, or returns an error if one occurred.
+//Deleting a Status that Devices reference is an error.
+func (s *TxStore) DeleteStatus(ctx context.Context, status Status) error {
+	tx := s.tx
+
+	count, err := s.ReadStatusDeviceCount(ctx, status)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return &Error{Description: fmt.Sprintf("Could not delete Status(%s)", status), Type: ErrorTypeUser,
+			Err: fmt.Errorf("status is referenced by %d devices", count)}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM status WHERE status=?;", status); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Status(%s)", status), Type: ErrorTypeServer, Err: err}
+	}
+
+	requestCache(ctx).Invalidate(statusesCacheKey)
+
+	return nil
+}
+
+//StatusSemantics is the meaning of a Status for reporting
+type StatusSemantics string
+
+//StatusSemantics
+const (
+	StatusSemanticsInService    StatusSemantics = "in_service"
+	StatusSemanticsOutOfService StatusSemantics = "out_of_service"
+	StatusSemanticsRetired      StatusSemantics = "retired"
+)
+
+var colorRegexp = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+
+//StatusDetail represents display and reporting metadata for a Status
+type StatusDetail struct {
+	Status    Status          `json:"status"`
+	Color     string          `json:"color,omitempty"`
+	SortOrder int             `json:"sort_order"`
+	Semantics StatusSemantics `json:"semantics,omitempty"`
+}
+
+//Validate cleans and validates the given StatusDetail
+func (s *StatusDetail) Validate() error {
+	s.Color = strings.TrimSpace(s.Color)
+	s.Semantics = StatusSemantics(strings.TrimSpace(string(s.Semantics)))
+
+	if s.Color != "" && !colorRegexp.MatchString(s.Color) {
+		return fieldError("color", "invalid_color", "color (%s) must be a hex color (e.g. #00ff00)", s.Color)
+	}
+
+	switch s.Semantics {
+	case "", StatusSemanticsInService, StatusSemanticsOutOfService, StatusSemanticsRetired:
+	default:
+		return fieldError("semantics", "invalid_semantics", "semantics (%s) must be one of %s, %s, or %s", s.Semantics, StatusSemanticsInService, StatusSemanticsOutOfService, StatusSemanticsRetired)
+	}
+
+	return nil
+}
+
+//ReadStatusDetail returns the StatusDetail for the given Status, or an error if one occurred.
+func (s *TxStore) ReadStatusDetail(ctx context.Context, status Status) (*StatusDetail, error) {
+	tx := s.tx
+
+	detail := new(StatusDetail)
+	var color, semantics sql.NullString
+
+	row := tx.QueryRowContext(ctx, "SELECT status, color, sort_order, semantics FROM status WHERE status=?", status)
+	err := row.Scan(&(detail.Status), &color, &(detail.SortOrder), &semantics)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query StatusDetail(%s)", status), Type: ErrorTypeServer, Err: err}
+	}
+
+	detail.Color = color.String
+	detail.Semantics = StatusSemantics(semantics.String)
+
+	return detail, nil
+}
+
+//ReadStatusDetails returns the StatusDetails for all Statuses in display order, or an error if one occurred
+func (s *TxStore) ReadStatusDetails(ctx context.Context) ([]*StatusDetail, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT status, color, sort_order, semantics FROM status ORDER BY sort_order, status;")
+	if err != nil {
+		return nil, &Error{Description: "Could not query StatusDetails", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var details []*StatusDetail
+
+	for rows.Next() {
+		detail := new(StatusDetail)
+		var color, semantics sql.NullString
+
+		if err = rows.Scan(&(detail.Status), &color, &(detail.SortOrder), &semantics); err != nil {
+			return nil, &Error{Description: "Could not scan StatusDetail row", Type: ErrorTypeServer, Err: err}
+		}
+
+		detail.Color = color.String
+		detail.Semantics = StatusSemantics(semantics.String)
+
+		details = append(details, detail)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan StatusDetail rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return details, nil
+}
+
+//UpdateStatusDetail updates the metadata fields for the given StatusDetail (using the Status field), or returns an error if one occurred
+func (s *TxStore) UpdateStatusDetail(ctx context.Context, detail *StatusDetail) error {
+	tx := s.tx
+
+	if err := detail.Validate(); err != nil {
+		return &Error{Description: "Could not validate StatusDetail", Type: ErrorTypeUser, Err: err}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE status SET color=?, sort_order=?, semantics=? WHERE status=?;",
+		nullString(detail.Color),
+		detail.SortOrder,
+		nullString(string(detail.Semantics)),
+		detail.Status,
+	)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update StatusDetail(%s)", detail.Status), Type: ErrorTypeServer, Err: err}
+	}
+
+	//sort_order changes the order of ReadStatuses
+	requestCache(ctx).Invalidate(statusesCacheKey)
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+)
+
+//DeviceStore reads and writes Devices
+type DeviceStore interface {
+	CreateDevice(ctx context.Context, device *Device) (id int64, err error)
+	ReadDevice(ctx context.Context, id int64, includeEvents bool) (*Device, error)
+	ReadDeviceBySerialNumber(ctx context.Context, serialNumber string, includeEvents bool) (*Device, error)
+	UpdateDevice(ctx context.Context, device *Device) error
+	QueryDevice(ctx context.Context, serialNumber, manufacturer, model, category, status, location string) ([]*Device, error)
+	SimpleQueryDevice(ctx context.Context, search string) ([]*Device, error)
+	DeleteDevice(ctx context.Context, id int64) error
+	RestoreDevice(ctx context.Context, id int64) error
+}
+
+//ModelStore reads and writes Models
+type ModelStore interface {
+	CreateModel(ctx context.Context, model *Model) (id int64, err error)
+	ReadModel(ctx context.Context, id int64) (*Model, error)
+	ReadModelsByIDs(ctx context.Context, ids []int64) (map[int64]*Model, error)
+	ReadModelByManufacturerAndModel(ctx context.Context, manufacturer, model string) (*Model, error)
+	UpdateModel(ctx context.Context, model *Model) error
+	QueryModel(ctx context.Context, manufacturer, model, category string) ([]*Model, error)
+	DeleteModel(ctx context.Context, id int64) error
+	RestoreModel(ctx context.Context, id int64) error
+}
+
+//UserStore reads and writes Users
+type UserStore interface {
+	CreateUserWithCredentials(ctx context.Context, email, password, name string) (id int64, err error)
+	CreateUser(ctx context.Context, user *User) (id int64, err error)
+	ReadUser(ctx context.Context, id int64) (*User, error)
+	ReadUsersByIDs(ctx context.Context, ids []int64) (map[int64]*User, error)
+	ReadUserByEmail(ctx context.Context, email string) (*User, error)
+	UpdateUser(ctx context.Context, user *User) error
+}
+
+//EventStore reads and writes Events
+type EventStore interface {
+	CreateEvent(ctx context.Context, id int64, el EventLocation, event *Event) (eventID int64, err error)
+	CreateNoteEvent(ctx context.Context, id int64, el EventLocation, note string) (eventID int64, err error)
+	ReadEvents(ctx context.Context, id int64, el EventLocation) ([]*Event, error)
+}
+
+//Store reads and writes Devices, Models, Users, and Events
+type Store interface {
+	DeviceStore
+	ModelStore
+	UserStore
+	EventStore
+}
+
+//TxStore implements Store (and the rest of the API) over a single database transaction.
+//Other request state (the request User, RequestCache, and RequestFeed) is still read from ctx
+type TxStore struct {
+	tx      *sql.Tx
+	db      *sql.DB
+	primary *sql.DB
+}
+
+var _ Store = (*TxStore)(nil)
+
+//NewTxStore returns a new TxStore for the given transaction.
+//db may be nil; if set, it's used for work outside of the transaction (e.g. concurrent read-only Stats queries)
+func NewTxStore(tx *sql.Tx, db *sql.DB) *TxStore {
+	return &TxStore{tx: tx, db: db}
+}
+
+//NewReadOnlyTxStore returns a new TxStore for the given read-only transaction, which may be on a read replica.
+//primary is used for the few writes made while reading (e.g. recording User activity)
+func NewReadOnlyTxStore(tx *sql.Tx, db, primary *sql.DB) *TxStore {
+	return &TxStore{tx: tx, db: db, primary: primary}
+}
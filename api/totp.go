@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//TOTP parameters (RFC 6238 defaults supported by all authenticator apps)
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 //steps accepted before and after the current step
+	totpSecretLen     = 20
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//TOTPEnrollment is a pending TOTP enrollment. URI is an otpauth:// URI for QR codes
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+//totpCode returns the TOTP code for the given secret and counter
+func totpCode(secret []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000)
+}
+
+//matchTOTP returns the counter matching the given code at time t, or 0 if the code doesn't match
+func matchTOTP(secret string, code string, t time.Time) uint64 {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return 0
+	}
+
+	current := uint64(t.Unix() / totpPeriod)
+	for i := current - totpSkew; i <= current+totpSkew; i++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, i)), []byte(code)) == 1 {
+			return i
+		}
+	}
+
+	return 0
+}
+
+//hashRecoveryCode returns a hash of the given recovery code. Recovery codes are random, so a fast hash is sufficient
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+//BeginTOTPEnrollment generates a new TOTP secret for the User, replacing any pending enrollment, and returns it or an error if one occurred.
+//TOTP isn't required until EnableTOTP is called with a valid code
+func (u *User) BeginTOTPEnrollment(ctx context.Context, s *TxStore, issuer string) (*TOTPEnrollment, error) {
+	tx := s.tx
+
+	if u.TOTPEnabled {
+		return nil, &Error{Description: "Could not begin TOTP enrollment", Type: ErrorTypeUser, Err: errors.New("TOTP is already enabled")}
+	}
+
+	key := make([]byte, totpSecretLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, &Error{Description: "Could not generate TOTP secret", Type: ErrorTypeServer, Err: err}
+	}
+	secret := totpEncoding.EncodeToString(key)
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user SET totp_secret=?, totp_counter=0 WHERE id=?;", secret, u.ID); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not update TOTP secret for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("period", fmt.Sprintf("%d", totpPeriod))
+	v.Set("digits", fmt.Sprintf("%d", totpDigits))
+
+	uri := fmt.Sprintf("otpauth://totp/%s:%s?%s", url.PathEscape(issuer), url.PathEscape(u.Email), v.Encode())
+
+	return &TOTPEnrollment{Secret: secret, URI: uri}, nil
+}
+
+//checkTOTP verifies the given TOTP code for the User and records it so it can't be reused, or returns an error if one occurred
+func (u *User) checkTOTP(ctx context.Context, s *TxStore, code string) error {
+	tx := s.tx
+
+	var secret sql.NullString
+	var last uint64
+
+	row := tx.QueryRowContext(ctx, "SELECT totp_secret, totp_counter FROM user WHERE id=? FOR UPDATE;", u.ID)
+	if err := row.Scan(&secret, &last); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not query TOTP secret for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	if !secret.Valid {
+		return &Error{Description: "Could not verify TOTP code", Type: ErrorTypeUser, Err: errors.New("TOTP enrollment has not been started")}
+	}
+
+	counter := matchTOTP(secret.String, strings.TrimSpace(code), time.Now())
+	if counter == 0 || counter <= last {
+		return &Error{Description: "Could not verify TOTP code", Type: ErrorTypeUser, Err: errors.New("invalid TOTP code")}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user SET totp_counter=? WHERE id=?;", counter, u.ID); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update TOTP counter for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//EnableTOTP verifies the given code against the pending TOTP enrollment and enables TOTP for the User.
+//It returns new recovery codes (which are only available now), or an error if one occurred
+func (u *User) EnableTOTP(ctx context.Context, s *TxStore, code string) ([]string, error) {
+	tx := s.tx
+
+	if u.TOTPEnabled {
+		return nil, &Error{Description: "Could not enable TOTP", Type: ErrorTypeUser, Err: errors.New("TOTP is already enabled")}
+	}
+
+	if err := u.checkTOTP(ctx, s, code); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user SET totp_enabled=TRUE WHERE id=?;", u.ID); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not enable TOTP for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+	u.TOTPEnabled = true
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_code WHERE user_id=?;", u.ID); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not delete recovery codes for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	buf := make([]byte, recoveryCodeLen/2)
+
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, &Error{Description: "Could not generate recovery code", Type: ErrorTypeServer, Err: err}
+		}
+		codes[i] = hex.EncodeToString(buf)
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_code(user_id, hash) VALUES(?, ?);", u.ID, hashRecoveryCode(codes[i])); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not insert recovery code for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	return codes, nil
+}
+
+//DisableTOTP disables TOTP for the User and removes their secret and recovery codes, or returns an error if one occurred
+func (u *User) DisableTOTP(ctx context.Context, s *TxStore) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user SET totp_enabled=FALSE, totp_secret=NULL, totp_counter=0 WHERE id=?;", u.ID); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not disable TOTP for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+	u.TOTPEnabled = false
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_code WHERE user_id=?;", u.ID); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete recovery codes for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//VerifySecondFactor verifies the given TOTP or recovery code for the User, or returns an error if one occurred.
+//Recovery codes can only be used once
+func (u *User) VerifySecondFactor(ctx context.Context, s *TxStore, code string) error {
+	tx := s.tx
+
+	if !u.TOTPEnabled {
+		return nil
+	}
+
+	if code == "" {
+		return &Error{Description: "Could not verify second factor", Type: ErrorTypeUser, Err: errors.New("TOTP code required")}
+	}
+
+	if len(strings.TrimSpace(code)) == totpDigits {
+		return u.checkTOTP(ctx, s, code)
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_code WHERE user_id=? AND hash=?;", u.ID, hashRecoveryCode(code))
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not check recovery code for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not check recovery code for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+	if n == 0 {
+		return &Error{Description: "Could not verify second factor", Type: ErrorTypeUser, Err: errors.New("invalid recovery code")}
+	}
+
+	return nil
+}
@@ -6,41 +6,80 @@ import (
 	"errors"
 	"fmt"
 	"net/mail"
+	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-const bcryptCost = 12
+// Roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
 
-// User represents an authencatable user
+// User represents an authencatable user.
+// Users with TOTPEnabled must provide a TOTP or recovery code when authenticating with a password.
+// Users with MustChangePassword can only change their password until they do
 type User struct {
-	ID    int64  `json:"id"`
-	Email string `json:"email"`
-	Hash  []byte `json:"-"`
-	Name  string `json:"name"`
+	ID                 int64      `json:"id"`
+	Email              string     `json:"email"`
+	Hash               []byte     `json:"-"`
+	Name               string     `json:"name"`
+	Role               string     `json:"role"`
+	Disabled           bool       `json:"disabled"`
+	TOTPEnabled        bool       `json:"totp_enabled"`
+	MustChangePassword bool       `json:"must_change_password"`
+	LastLogin          *time.Time `json:"last_login,omitempty"`
+	LastLoginIP        string     `json:"last_login_ip,omitempty"`
+	LastActivity       *time.Time `json:"last_activity,omitempty"`
+	DeletedAt          *time.Time `json:"deleted_at,omitempty"`
+}
+
+// IsAdmin returns true if the User has the admin Role
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
 // Validate validates the given User
 func (u *User) Validate() error {
 	if e, err := mail.ParseAddress(fmt.Sprintf("User <%s>", u.Email)); err != nil || e.Address != u.Email {
 		if err != nil {
-			return fmt.Errorf("email (%s) must be a valid email: %v", u.Email, err)
+			return fieldError("email", "invalid_email", "email (%s) must be a valid email: %v", u.Email, err)
 		}
-		return fmt.Errorf("email (%s) must be a valid email", u.Email)
+		return fieldError("email", "invalid_email", "email (%s) must be a valid email", u.Email)
 	}
 	return ValidateString("name", u.Name, 255)
 }
 
-// Authenticate authenticates against the database with the given credentials and returns nil if success or error on failure
-func (u *User) Authenticate(_ context.Context, password string) error {
-	return bcrypt.CompareHashAndPassword(u.Hash, []byte(password))
+// Authenticate authenticates against the database with the given credentials and returns nil if success or error on failure.
+// If the User's hash wasn't generated with the current PasswordConfig, it is rehashed with the given password
+func (u *User) Authenticate(ctx context.Context, s *TxStore, password string) error {
+	if u.Disabled {
+		return errors.New("user is disabled")
+	}
+
+	if err := comparePassword(u.Hash, password); err != nil {
+		return err
+	}
+
+	if passwordNeedsRehash(u.Hash) {
+		// rehashing is best effort; the password has already been verified
+		if hash, err := hashPassword(password); err == nil {
+			oldHash := u.Hash
+			u.Hash = hash
+			if err = s.UpdateUser(ctx, u); err != nil {
+				u.Hash = oldHash
+			}
+		}
+	}
+
+	return nil
 }
 
 // ChangePassword updates the password hash to the given password
-func (u *User) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
-	if err := u.Authenticate(ctx, oldPassword); err != nil {
+func (u *User) ChangePassword(ctx context.Context, s *TxStore, oldPassword, newPassword string) error {
+	if err := u.Authenticate(ctx, s, oldPassword); err != nil {
 		return &Error{Description: "Could not authenticate password", Type: ErrorTypeUser, Err: errors.New("invalid password")}
 	}
 
@@ -48,42 +87,54 @@ func (u *User) ChangePassword(ctx context.Context, oldPassword, newPassword stri
 		return &Error{Description: "Could not validate password", Type: ErrorTypeUser, Err: errors.New("password cannot be empty")}
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcryptCost)
+	hash, err := hashPassword(newPassword)
 	if err != nil {
-		return &Error{Description: "Could not bcrypt encrypt password", Type: ErrorTypeServer, Err: err}
+		return &Error{Description: "Could not hash password", Type: ErrorTypeServer, Err: err}
 	}
 
 	u.Hash = hash
 
-	return UpdateUser(ctx, u)
+	if err = s.UpdateUser(ctx, u); err != nil {
+		return err
+	}
+
+	tx := s.tx
+
+	if _, err = tx.ExecContext(ctx, "UPDATE user SET must_change_password=FALSE WHERE id=?;", u.ID); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update must_change_password for User(%d)", u.ID), Type: ErrorTypeServer, Err: err}
+	}
+	u.MustChangePassword = false
+
+	return nil
 }
 
-// CreateUserWithCredentials creates a new User with the given information and returns it, or an error if one occurred
-func CreateUserWithCredentials(ctx context.Context, email, password, name string) (id int64, err error) {
+// CreateUserWithCredentials creates a new User with the given information and returns it, or an error if one occurred.
+// The password is temporary: the User must change it before doing anything else
+func (s *TxStore) CreateUserWithCredentials(ctx context.Context, email, password, name string) (id int64, err error) {
 	if password == "" {
 		return 0, &Error{Description: "Could not validate password", Type: ErrorTypeUser, Err: errors.New("password cannot be empty")}
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	hash, err := hashPassword(password)
 	if err != nil {
-		return 0, &Error{Description: "Could not bcrypt encrypt password", Type: ErrorTypeServer, Err: err}
+		return 0, &Error{Description: "Could not hash password", Type: ErrorTypeServer, Err: err}
 	}
 
-	return CreateUser(ctx, &User{Email: email, Hash: hash, Name: name})
+	return s.CreateUser(ctx, &User{Email: email, Hash: hash, Name: name, MustChangePassword: true})
 }
 
 // CreateUser creates a new User with the given fields (ID is ignored and created) and returns its ID, or an error if one occurred
-func CreateUser(ctx context.Context, user *User) (id int64, err error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) CreateUser(ctx context.Context, user *User) (id int64, err error) {
+	tx := s.tx
 
 	if err = user.Validate(); err != nil {
 		return 0, &Error{Description: "Could not validate User", Type: ErrorTypeUser, Err: err}
 	}
 
-	res, err := tx.Exec("INSERT INTO user(email, hash, name) VALUES(?, ?, ?);", user.Email, user.Hash, user.Name)
+	res, err := tx.ExecContext(ctx, "INSERT INTO user(email, hash, name, must_change_password) VALUES(?, ?, ?, ?);", user.Email, user.Hash, user.Name, user.MustChangePassword)
 	if err != nil {
 		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
-			dup, newErr := ReadUserByEmail(ctx, user.Email)
+			dup, newErr := s.ReadUserByEmail(ctx, user.Email)
 			if newErr != nil {
 				return 0, newErr
 			}
@@ -101,13 +152,16 @@ func CreateUser(ctx context.Context, user *User) (id int64, err error) {
 }
 
 // ReadUser returns the User with the given id, or an error if one occurred
-func ReadUser(ctx context.Context, id int64) (*User, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) ReadUser(ctx context.Context, id int64) (*User, error) {
+	tx := s.tx
 
 	user := &User{ID: id}
 
-	row := tx.QueryRow("SELECT email, hash, name FROM user WHERE id=?", id)
-	err := row.Scan(&(user.Email), &(user.Hash), &(user.Name))
+	var lastLogin, lastActivity sql.NullTime
+	var lastLoginIP sql.NullString
+
+	row := tx.QueryRowContext(ctx, "SELECT email, hash, name, role, disabled, totp_enabled, must_change_password, last_login_at, last_login_ip, last_activity_at FROM user WHERE id=? AND deleted_at IS NULL", id)
+	err := row.Scan(&(user.Email), &(user.Hash), &(user.Name), &(user.Role), &(user.Disabled), &(user.TOTPEnabled), &(user.MustChangePassword), &lastLogin, &lastLoginIP, &lastActivity)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -116,17 +170,70 @@ func ReadUser(ctx context.Context, id int64) (*User, error) {
 		return nil, &Error{Description: fmt.Sprintf("Could not query User(%d)", id), Type: ErrorTypeServer, Err: err}
 	}
 
+	user.LastLogin = timePtr(lastLogin)
+	user.LastLoginIP = lastLoginIP.String
+	user.LastActivity = timePtr(lastActivity)
+
 	return user, nil
 }
 
-// ReadUserByEmail returns the User with the given email, or an error if one occurred
-func ReadUserByEmail(ctx context.Context, email string) (*User, error) {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+// ReadUsersByIDs returns the Users with the given ids, keyed by id, or an error if one occurred.
+// Users that don't exist aren't included. Deleted Users are included (with DeletedAt set) so history can still show them
+func (s *TxStore) ReadUsersByIDs(ctx context.Context, ids []int64) (map[int64]*User, error) {
+	tx := s.tx
+
+	users := make(map[int64]*User)
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	parameters := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		parameters[i] = id
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, email, hash, name, role, disabled, totp_enabled, must_change_password, last_login_at, last_login_ip, last_activity_at, deleted_at FROM user WHERE id IN (%s)", strings.Join(placeholders, ", ")), parameters...)
+	if err != nil {
+		return nil, &Error{Description: "Could not query Users", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := new(User)
+		var lastLogin, lastActivity, deleted sql.NullTime
+		var lastLoginIP sql.NullString
+
+		if err = rows.Scan(&(user.ID), &(user.Email), &(user.Hash), &(user.Name), &(user.Role), &(user.Disabled), &(user.TOTPEnabled), &(user.MustChangePassword), &lastLogin, &lastLoginIP, &lastActivity, &deleted); err != nil {
+			return nil, &Error{Description: "Could not scan User row", Type: ErrorTypeServer, Err: err}
+		}
+
+		user.LastLogin = timePtr(lastLogin)
+		user.LastLoginIP = lastLoginIP.String
+		user.LastActivity = timePtr(lastActivity)
+		user.DeletedAt = timePtr(deleted)
+
+		users[user.ID] = user
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan User rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return users, nil
+}
+
+// ReadUserByEmail returns the User with the given email, or an error if one occurred.
+// Deleted Users are returned with DeletedAt set; they can't sign in
+func (s *TxStore) ReadUserByEmail(ctx context.Context, email string) (*User, error) {
+	tx := s.tx
 
 	user := &User{Email: email}
+	var deleted sql.NullTime
 
-	row := tx.QueryRow("SELECT id, hash, name FROM user WHERE email=?", email)
-	err := row.Scan(&(user.ID), &(user.Hash), &(user.Name))
+	row := tx.QueryRowContext(ctx, "SELECT id, hash, name, role, disabled, totp_enabled, must_change_password, deleted_at FROM user WHERE email=?", email)
+	err := row.Scan(&(user.ID), &(user.Hash), &(user.Name), &(user.Role), &(user.Disabled), &(user.TOTPEnabled), &(user.MustChangePassword), &deleted)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -134,22 +241,23 @@ func ReadUserByEmail(ctx context.Context, email string) (*User, error) {
 	case err != nil:
 		return nil, &Error{Description: fmt.Sprintf("Could not query UserByEmail(%s)", email), Type: ErrorTypeServer, Err: err}
 	}
+	user.DeletedAt = timePtr(deleted)
 
 	return user, nil
 }
 
 // UpdateUser updates the fields for the given User (using the ID field), or returns an error if one occurred
-func UpdateUser(ctx context.Context, user *User) error {
-	tx := ctx.Value(TransactionKey).(*sql.Tx)
+func (s *TxStore) UpdateUser(ctx context.Context, user *User) error {
+	tx := s.tx
 
 	if err := user.Validate(); err != nil {
 		return &Error{Description: "Could not validate User", Type: ErrorTypeUser, Err: err}
 	}
 
-	_, err := tx.Exec("UPDATE user SET email=?, hash=?, name=? WHERE id=?;", user.Email, user.Hash, user.Name, user.ID)
+	_, err := tx.ExecContext(ctx, "UPDATE user SET email=?, hash=?, name=? WHERE id=?;", user.Email, user.Hash, user.Name, user.ID)
 	if err != nil {
 		if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
-			dup, newErr := ReadUserByEmail(ctx, user.Email)
+			dup, newErr := s.ReadUserByEmail(ctx, user.Email)
 			if newErr != nil {
 				return newErr
 			}
@@ -160,3 +268,119 @@ func UpdateUser(ctx context.Context, user *User) error {
 
 	return nil
 }
+
+// UpdateUserRole sets the Role for the User with the given id, or returns an error if one occurred
+func (s *TxStore) UpdateUserRole(ctx context.Context, id int64, role string) error {
+	tx := s.tx
+
+	if role != RoleUser && role != RoleAdmin {
+		return &Error{Description: "Could not validate Role", Type: ErrorTypeUser, Err: fieldError("role", "invalid_role", "role (%s) must be %s or %s", role, RoleUser, RoleAdmin)}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user SET role=? WHERE id=?;", role, id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update Role for User(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+// ReadUserLocations returns the Locations the User with the given id is granted, or an error if one occurred.
+// A User with no granted Locations is not restricted by Location
+func (s *TxStore) ReadUserLocations(ctx context.Context, id int64) ([]Location, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT location FROM user_location WHERE user_id=? ORDER BY location;", id)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query Locations for User(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	locations := []Location{}
+
+	for rows.Next() {
+		var l Location
+		if err = rows.Scan(&l); err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan Location row for User(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+		locations = append(locations, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan Location rows for User(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return locations, nil
+}
+
+// UpdateUserLocations replaces the Locations the User with the given id is granted, or returns an error if one occurred
+func (s *TxStore) UpdateUserLocations(ctx context.Context, id int64, locations []Location) error {
+	tx := s.tx
+
+	for _, l := range locations {
+		loc, err := s.ReadLocation(ctx, l)
+		if err != nil {
+			return err
+		}
+		if loc == nil {
+			return &Error{Description: "Could not validate Locations", Type: ErrorTypeUser, Err: fieldError("locations", "invalid_location", "location (%s) must be a valid location", l)}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_location WHERE user_id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Locations for User(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	for _, l := range locations {
+		if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO user_location(user_id, location) VALUES(?, ?);", id, l); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not insert Location(%s) for User(%d)", l, id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// UpdateUserDisabled sets whether or not the User with the given id is disabled, or returns an error if one occurred
+func (s *TxStore) UpdateUserDisabled(ctx context.Context, id int64, disabled bool) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user SET disabled=? WHERE id=?;", disabled, id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update disabled for User(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+// DeleteUser soft deletes the User with the given id, or returns an error if one occurred.
+// The User's Events are still attributed to them, and they can be restored with RestoreUser
+func (s *TxStore) DeleteUser(ctx context.Context, id int64) error {
+	if err := s.softDelete(ctx, "user", "User", id); err != nil {
+		return err
+	}
+
+	// cached Devices don't embed Users, but Events are read with them
+	requestCache(ctx).Flush()
+
+	return nil
+}
+
+// userActivityInterval is how often a User's last activity is updated
+const userActivityInterval = time.Minute
+
+// UpdateUserActivity records activity by the User with the given id at the given time, or returns an error if one occurred.
+// To avoid a write on every request, activity is only recorded if the last activity is older than userActivityInterval
+func (s *TxStore) UpdateUserActivity(ctx context.Context, id int64, t time.Time) error {
+	query := "UPDATE user SET last_activity_at=? WHERE id=? AND (last_activity_at IS NULL OR last_activity_at < ?);"
+
+	var err error
+	if s.primary != nil {
+		// read-only transactions can't write, so activity is recorded on the primary outside of the transaction
+		_, err = s.primary.ExecContext(ctx, query, t, id, t.Add(-userActivityInterval))
+	} else {
+		_, err = s.tx.ExecContext(ctx, query, t, id, t.Add(-userActivityInterval))
+	}
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update activity for User(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
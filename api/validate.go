@@ -1,13 +1,54 @@
 package api
 
-import "fmt"
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
 
 //ValidateString returns an error if the given value is not within the parameters
 func ValidateString(field, value string, max int) error {
 	if value == "" {
-		return fmt.Errorf("%s must not be empty", field)
+		return fieldError(field, "required", "%s must not be empty", field)
 	} else if len(value) > max {
-		return fmt.Errorf("%s length (%d) was more than maximum allowed (%d)", field, len(value), max)
+		return fieldError(field, "too_long", "%s length (%d) was more than maximum allowed (%d)", field, len(value), max)
 	}
 	return nil
 }
+
+//normalizeSpace trims the given value and collapses all internal whitespace to single spaces
+func normalizeSpace(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+//normalizeKey returns the given value normalized for case and whitespace insensitive uniqueness.
+//It must match the backfill in the model_normalized migration
+func normalizeKey(value string) string {
+	return strings.ToLower(normalizeSpace(value))
+}
+
+//nullID returns a NullInt64 for the given foreign key id, treating 0 as NULL
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+//nullString returns a NullString for the given value, treating "" as NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+//nullTime returns a NullTime for the given optional time
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+//timePtr returns a pointer to the time in the given NullTime, or nil if it is NULL
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
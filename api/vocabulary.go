@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//vocabularyDailyLimit is the number of new Models non-admin Users may create per day
+var vocabularyDailyLimit int
+
+//SetVocabularyDailyLimit sets the number of new Models non-admin Users may create in a 24 hour period (only admins create Locations).
+//An unusual number of new Models usually means an import was mapped incorrectly. If limit is less than 1, there is no limit
+func SetVocabularyDailyLimit(limit int) {
+	vocabularyDailyLimit = limit
+}
+
+//VocabularyEntry types
+const (
+	VocabularyTypeModel = "model"
+)
+
+//VocabularyEntry represents a Model that hasn't been reviewed by an admin
+type VocabularyEntry struct {
+	Type    string    `json:"type"`
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+//vocabularyReviewed returns whether or not new Models created by the request User are already reviewed
+func vocabularyReviewed(ctx context.Context) bool {
+	user, _ := ctx.Value(UserKey).(*User)
+	return user != nil && user.IsAdmin()
+}
+
+//checkVocabularyQuota returns an error if the request User isn't an admin and the vocabularyDailyLimit
+//has been reached for new Models
+func (s *TxStore) checkVocabularyQuota(ctx context.Context) error {
+	tx := s.tx
+
+	if vocabularyDailyLimit < 1 || vocabularyReviewed(ctx) {
+		return nil
+	}
+
+	var count int
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM model WHERE created >= ?;", time.Now().Add(-24*time.Hour))
+	if err := row.Scan(&count); err != nil {
+		return &Error{Description: "Could not count new Models", Type: ErrorTypeServer, Err: err}
+	}
+
+	if count >= vocabularyDailyLimit {
+		return &Error{Description: "Could not insert Model", Type: ErrorTypeUser,
+			Err: fmt.Errorf("%d new models were created in the last day; an admin must create any more", count)}
+	}
+
+	return nil
+}
+
+//ReadVocabularyReviewQueue returns all Models that haven't been reviewed, oldest first, or an error if one occurred
+func (s *TxStore) ReadVocabularyReviewQueue(ctx context.Context) ([]*VocabularyEntry, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, CONCAT(manufacturer, ' ', model), created FROM model WHERE NOT reviewed AND deleted_at IS NULL ORDER BY created, id;")
+	if err != nil {
+		return nil, &Error{Description: "Could not query VocabularyEntries", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	entries := []*VocabularyEntry{}
+
+	for rows.Next() {
+		e := &VocabularyEntry{Type: VocabularyTypeModel}
+		if err = rows.Scan(&(e.ID), &(e.Name), &(e.Created)); err != nil {
+			return nil, &Error{Description: "Could not scan VocabularyEntry row", Type: ErrorTypeServer, Err: err}
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan VocabularyEntry rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return entries, nil
+}
+
+//ReviewVocabulary marks the given Models as reviewed, or returns an error if one occurred
+func (s *TxStore) ReviewVocabulary(ctx context.Context, modelIDs []int64) error {
+	tx := s.tx
+
+	for _, id := range modelIDs {
+		if _, err := tx.ExecContext(ctx, "UPDATE model SET reviewed=TRUE WHERE id=?;", id); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not review Model(%d)", id), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	return nil
+}
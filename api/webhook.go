@@ -0,0 +1,468 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//WebhookEventTypes
+const (
+	WebhookEventDeviceCreated       = "device.created"
+	WebhookEventDeviceModified      = "device.modified"
+	WebhookEventDeviceNote          = "device.note"
+	WebhookEventDeviceStatusChanged = "device.status_changed"
+	WebhookEventModelCreated        = "model.created"
+	WebhookEventModelModified       = "model.modified"
+)
+
+var webhookEventTypes = map[string]bool{
+	WebhookEventDeviceCreated:       true,
+	WebhookEventDeviceModified:      true,
+	WebhookEventDeviceNote:          true,
+	WebhookEventDeviceStatusChanged: true,
+	WebhookEventModelCreated:        true,
+	WebhookEventModelModified:       true,
+}
+
+//WebhookDeliveryStatuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+//MaxWebhookAttempts is the number of times a delivery is attempted before it fails
+const MaxWebhookAttempts = 8
+
+//WebhookBackoff returns how long to wait after the given (1-based) failed attempt before retrying
+func WebhookBackoff(attempt int) time.Duration {
+	return time.Minute << uint(attempt-1)
+}
+
+//Webhook represents a registration to receive signed POSTs when inventory events happen.
+//If EventTypes is empty, all event types are delivered. Secret is only returned when the Webhook is created
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	Disabled   bool      `json:"disabled"`
+	Created    time.Time `json:"created"`
+	CreatedBy  int64     `json:"created_by,omitempty"`
+}
+
+//Validate cleans and validates the given Webhook
+func (w *Webhook) Validate() error {
+	w.URL = strings.TrimSpace(w.URL)
+	w.Secret = strings.TrimSpace(w.Secret)
+
+	if err := ValidateString("url", w.URL, 2048); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fieldError("url", "invalid_url", "url (%s) must be a valid http or https URL", w.URL)
+	}
+
+	if len(w.Secret) > 255 {
+		return fieldError("secret", "too_long", "secret length (%d) was more than maximum allowed (%d)", len(w.Secret), 255)
+	}
+
+	if w.EventTypes == nil {
+		w.EventTypes = []string{}
+	}
+	for _, t := range w.EventTypes {
+		if !webhookEventTypes[t] {
+			return fieldError("event_types", "invalid_event_type", "event type (%s) must be a valid event type", t)
+		}
+	}
+
+	return nil
+}
+
+//matches returns true if the Webhook receives the given event type
+func (w *Webhook) matches(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+//CreateWebhook creates a new Webhook with the given fields (ID, Created, and CreatedBy are ignored and created) and returns its ID,
+//or an error if one occurred. If Secret is empty, a random Secret is generated and set on webhook
+func (s *TxStore) CreateWebhook(ctx context.Context, webhook *Webhook) (id int64, err error) {
+	tx := s.tx
+	user := ctx.Value(UserKey).(*User)
+
+	if err = webhook.Validate(); err != nil {
+		return 0, &Error{Description: "Could not validate Webhook", Type: ErrorTypeUser, Err: err}
+	}
+
+	if webhook.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err = rand.Read(buf); err != nil {
+			return 0, &Error{Description: "Could not generate Webhook secret", Type: ErrorTypeServer, Err: err}
+		}
+		webhook.Secret = hex.EncodeToString(buf)
+	}
+
+	webhook.Created = time.Now()
+	webhook.CreatedBy = user.ID
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO webhook(url, secret, event_types, disabled, created, created_by) VALUES(?, ?, ?, ?, ?, ?);",
+		webhook.URL,
+		webhook.Secret,
+		strings.Join(webhook.EventTypes, ","),
+		webhook.Disabled,
+		webhook.Created,
+		nullID(webhook.CreatedBy),
+	)
+	if err != nil {
+		return 0, &Error{Description: "Could not insert Webhook", Type: ErrorTypeServer, Err: err}
+	}
+
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, &Error{Description: "Could not fetch Webhook id", Type: ErrorTypeServer, Err: err}
+	}
+
+	return id, nil
+}
+
+//scanWebhook scans a Webhook (including its Secret) from the given row
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*Webhook, error) {
+	w := new(Webhook)
+	var eventTypes string
+	var createdBy sql.NullInt64
+
+	if err := row.Scan(&(w.ID), &(w.URL), &(w.Secret), &eventTypes, &(w.Disabled), &(w.Created), &createdBy); err != nil {
+		return nil, err
+	}
+
+	w.EventTypes = []string{}
+	if eventTypes != "" {
+		w.EventTypes = strings.Split(eventTypes, ",")
+	}
+	w.CreatedBy = createdBy.Int64
+
+	return w, nil
+}
+
+const webhookColumns = "id, url, secret, event_types, disabled, created, created_by"
+
+//ReadWebhook returns the Webhook (including its Secret) with the given id, or an error if one occurred
+func (s *TxStore) ReadWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	tx := s.tx
+
+	w, err := scanWebhook(tx.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM webhook WHERE id=?;", webhookColumns), id))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, &Error{Description: fmt.Sprintf("Could not query Webhook(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return w, nil
+}
+
+//ReadWebhooks returns all Webhooks (including their Secrets), or an error if one occurred
+func (s *TxStore) ReadWebhooks(ctx context.Context) ([]*Webhook, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM webhook ORDER BY id;", webhookColumns))
+	if err != nil {
+		return nil, &Error{Description: "Could not query Webhooks", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, &Error{Description: "Could not scan Webhook row", Type: ErrorTypeServer, Err: err}
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan Webhook rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return webhooks, nil
+}
+
+//UpdateWebhook updates the URL, EventTypes, and Disabled fields for the given Webhook (using the ID field), or returns an error if one occurred.
+//If Secret is not empty, it replaces the Webhook's Secret
+func (s *TxStore) UpdateWebhook(ctx context.Context, webhook *Webhook) error {
+	tx := s.tx
+
+	if err := webhook.Validate(); err != nil {
+		return &Error{Description: "Could not validate Webhook", Type: ErrorTypeUser, Err: err}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE webhook SET url=?, secret=IF(?='', secret, ?), event_types=?, disabled=? WHERE id=?;",
+		webhook.URL,
+		webhook.Secret,
+		webhook.Secret,
+		strings.Join(webhook.EventTypes, ","),
+		webhook.Disabled,
+		webhook.ID,
+	)
+	if err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update Webhook(%d)", webhook.ID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//DeleteWebhook deletes the Webhook with the given id and its delivery log, or returns an error if one occurred
+func (s *TxStore) DeleteWebhook(ctx context.Context, id int64) error {
+	tx := s.tx
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM webhook WHERE id=?;", id); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not delete Webhook(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
+
+//WebhookPayload is the JSON body POSTed to Webhooks
+type WebhookPayload struct {
+	Event   string      `json:"event"`
+	Date    time.Time   `json:"date"`
+	UserID  int64       `json:"user_id,omitempty"`
+	Type    string      `json:"type"`
+	ID      int64       `json:"id"`
+	Content interface{} `json:"content,omitempty"`
+}
+
+//WebhookDelivery represents a queued, delivered, or failed POST to a Webhook
+type WebhookDelivery struct {
+	ID           int64           `json:"id"`
+	WebhookID    int64           `json:"webhook_id"`
+	EventType    string          `json:"event_type"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	Created      time.Time       `json:"created"`
+	NextAttempt  *time.Time      `json:"next_attempt,omitempty"`
+	LastAttempt  *time.Time      `json:"last_attempt,omitempty"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+//queueWebhookDeliveries queues a WebhookDelivery of the given payload to every enabled Webhook that receives the payload's event type
+func (s *TxStore) queueWebhookDeliveries(ctx context.Context, payload *WebhookPayload) error {
+	tx := s.tx
+
+	webhooks, err := s.ReadWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	now := time.Now()
+
+	for _, w := range webhooks {
+		if w.Disabled || !w.matches(payload.Event) {
+			continue
+		}
+
+		if body == nil {
+			if body, err = json.Marshal(payload); err != nil {
+				return &Error{Description: "Could not marshal Webhook payload", Type: ErrorTypeServer, Err: err}
+			}
+		}
+
+		if _, err = tx.ExecContext(ctx, "INSERT INTO webhook_delivery(webhook_id, event_type, payload, status, created, next_attempt) VALUES(?, ?, ?, ?, ?, ?);",
+			w.ID, payload.Event, body, WebhookDeliveryPending, now, now,
+		); err != nil {
+			return &Error{Description: fmt.Sprintf("Could not queue delivery for Webhook(%d)", w.ID), Type: ErrorTypeServer, Err: err}
+		}
+	}
+
+	return nil
+}
+
+//queueDeviceWebhooks queues WebhookDeliveries for the given Device Event
+func (s *TxStore) queueDeviceWebhooks(ctx context.Context, id int64, event *Event) error {
+	var types []string
+
+	switch event.Type {
+	case "created":
+		types = []string{WebhookEventDeviceCreated}
+	case "modified":
+		types = []string{WebhookEventDeviceModified}
+		if c, ok := event.Content.(*ModifiedContent); ok {
+			for _, f := range c.Fields {
+				if f.Name == "status" {
+					types = append(types, WebhookEventDeviceStatusChanged)
+				}
+			}
+		}
+	case "note":
+		types = []string{WebhookEventDeviceNote}
+	}
+
+	for _, t := range types {
+		p := &WebhookPayload{Event: t, Date: event.Date, UserID: event.UserID, Type: FeedEventTypeDevice, ID: id, Content: event.Content}
+		if err := s.queueWebhookDeliveries(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//queueModelWebhooks queues WebhookDeliveries for the given Model change
+func (s *TxStore) queueModelWebhooks(ctx context.Context, id int64, eventType string) error {
+	p := &WebhookPayload{Event: eventType, Date: time.Now(), Type: FeedEventTypeModel, ID: id}
+	if user, ok := ctx.Value(UserKey).(*User); ok {
+		p.UserID = user.ID
+	}
+	return s.queueWebhookDeliveries(ctx, p)
+}
+
+//scanWebhookDelivery scans a WebhookDelivery from the given row, followed by any extra columns into extra
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*WebhookDelivery, error) {
+	d := new(WebhookDelivery)
+	var payload []byte
+	var nextAttempt, lastAttempt sql.NullTime
+	var responseCode sql.NullInt64
+	var errStr sql.NullString
+
+	dest := append([]interface{}{&(d.ID), &(d.WebhookID), &(d.EventType), &payload, &(d.Status), &(d.Attempts), &(d.Created), &nextAttempt, &lastAttempt, &responseCode, &errStr}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	d.Payload = json.RawMessage(payload)
+	d.NextAttempt = timePtr(nextAttempt)
+	d.LastAttempt = timePtr(lastAttempt)
+	d.ResponseCode = int(responseCode.Int64)
+	d.Error = errStr.String
+
+	return d, nil
+}
+
+const webhookDeliveryColumns = "id, webhook_id, event_type, payload, status, attempts, created, next_attempt, last_attempt, response_code, error"
+
+//ReadWebhookDeliveries returns the latest limit WebhookDeliveries for the Webhook with the given id, newest first, or an error if one occurred
+func (s *TxStore) ReadWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]*WebhookDelivery, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM webhook_delivery WHERE webhook_id=? ORDER BY id DESC LIMIT ?;", webhookDeliveryColumns), webhookID, limit)
+	if err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not query WebhookDeliveries for Webhook(%d)", webhookID), Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, &Error{Description: fmt.Sprintf("Could not scan WebhookDelivery row for Webhook(%d)", webhookID), Type: ErrorTypeServer, Err: err}
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: fmt.Sprintf("Could not scan WebhookDelivery rows for Webhook(%d)", webhookID), Type: ErrorTypeServer, Err: err}
+	}
+
+	return deliveries, nil
+}
+
+//PendingWebhookDelivery is a WebhookDelivery that is due, with the URL and Secret of its Webhook
+type PendingWebhookDelivery struct {
+	*WebhookDelivery
+	URL    string
+	Secret string
+}
+
+//ReadDueWebhookDeliveries returns up to limit pending WebhookDeliveries to enabled Webhooks that are due at now, oldest first,
+//or an error if one occurred
+func (s *TxStore) ReadDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*PendingWebhookDelivery, error) {
+	tx := s.tx
+
+	rows, err := tx.QueryContext(ctx, "SELECT d."+strings.ReplaceAll(webhookDeliveryColumns, ", ", ", d.")+", w.url, w.secret "+
+		"FROM webhook_delivery AS d JOIN webhook AS w ON d.webhook_id = w.id "+
+		"WHERE d.status=? AND d.next_attempt <= ? AND w.disabled = FALSE ORDER BY d.next_attempt, d.id LIMIT ?;",
+		WebhookDeliveryPending, now, limit,
+	)
+	if err != nil {
+		return nil, &Error{Description: "Could not query due WebhookDeliveries", Type: ErrorTypeServer, Err: err}
+	}
+	defer rows.Close()
+
+	var deliveries []*PendingWebhookDelivery
+
+	for rows.Next() {
+		p := new(PendingWebhookDelivery)
+		if p.WebhookDelivery, err = scanWebhookDelivery(rows, &(p.URL), &(p.Secret)); err != nil {
+			return nil, &Error{Description: "Could not scan due WebhookDelivery row", Type: ErrorTypeServer, Err: err}
+		}
+
+		deliveries = append(deliveries, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, &Error{Description: "Could not scan due WebhookDelivery rows", Type: ErrorTypeServer, Err: err}
+	}
+
+	return deliveries, nil
+}
+
+//RecordWebhookAttempt records an attempt to deliver the WebhookDelivery with the given id at now, or returns an error if one occurred.
+//If attemptErr is nil, the delivery is marked delivered. Otherwise it is retried after WebhookBackoff, or marked failed after MaxWebhookAttempts
+func (s *TxStore) RecordWebhookAttempt(ctx context.Context, id int64, now time.Time, responseCode int, attemptErr error) error {
+	tx := s.tx
+
+	var attempts int
+	row := tx.QueryRowContext(ctx, "SELECT attempts FROM webhook_delivery WHERE id=? FOR UPDATE;", id)
+	if err := row.Scan(&attempts); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			//the Webhook was deleted during the attempt
+			return nil
+		}
+		return &Error{Description: fmt.Sprintf("Could not query WebhookDelivery(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+	attempts++
+
+	status := WebhookDeliveryDelivered
+	var next sql.NullTime
+	var errStr sql.NullString
+	if attemptErr != nil {
+		errStr = sql.NullString{String: attemptErr.Error(), Valid: true}
+		status = WebhookDeliveryFailed
+		if attempts < MaxWebhookAttempts {
+			status = WebhookDeliveryPending
+			next = sql.NullTime{Time: now.Add(WebhookBackoff(attempts)), Valid: true}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE webhook_delivery SET status=?, attempts=?, next_attempt=?, last_attempt=?, response_code=?, error=? WHERE id=?;",
+		status, attempts, next, now, sql.NullInt64{Int64: int64(responseCode), Valid: responseCode != 0}, errStr, id,
+	); err != nil {
+		return &Error{Description: fmt.Sprintf("Could not update WebhookDelivery(%d)", id), Type: ErrorTypeServer, Err: err}
+	}
+
+	return nil
+}
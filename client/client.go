@@ -0,0 +1,278 @@
+//Package client is a Go client for the inventory server's HTTP API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/httpapi"
+)
+
+//DefaultMaxRetries is the default number of times a request is retried
+const DefaultMaxRetries = 3
+
+//DefaultRetryWait is the default wait before the first retry. The wait doubles for each following retry
+const DefaultRetryWait = 500 * time.Millisecond
+
+//maxRetryWait is the longest the Client will wait between retries, including waits requested with Retry-After
+const maxRetryWait = 30 * time.Second
+
+//Error is an error response from the server
+type Error struct {
+	StatusCode  int
+	Description string
+	Message     string
+	Fields      []*api.FieldError
+	DuplicateID int64
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Description, e.Message)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Description)
+}
+
+//IsNotFound returns true if err is an *Error with a 404 status
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+//Client is a client for the inventory server's HTTP API. It is safe for concurrent use
+type Client struct {
+	//BaseURL is the server URL including the API prefix, e.g. https://inventory.example.com/api/1.0
+	BaseURL string
+	//HTTPClient is used to make requests
+	HTTPClient *http.Client
+	//MaxRetries is the number of times a failed request is retried.
+	//GET requests are retried on network errors and 429, 502, 503, and 504 responses. Other requests are only retried on 429 responses
+	MaxRetries int
+	//RetryWait is the wait before the first retry
+	RetryWait time.Duration
+
+	sessionKey  string
+	credentials *httpapi.AuthenticateRequest
+	mu          *sync.Mutex
+}
+
+//New returns a new Client for the given base URL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: time.Minute},
+		MaxRetries: DefaultMaxRetries,
+		RetryWait:  DefaultRetryWait,
+		mu:         new(sync.Mutex),
+	}
+}
+
+//SessionKey returns the Client's current session key
+func (c *Client) SessionKey() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionKey
+}
+
+//SetSessionKey sets the session key sent with requests, e.g. for a session created elsewhere
+func (c *Client) SetSessionKey(key string) {
+	c.mu.Lock()
+	c.sessionKey = key
+	c.mu.Unlock()
+}
+
+//Authenticate authenticates with the given credentials and uses the new session for following requests.
+//totp is only required if the User has TOTP enabled.
+//The credentials are kept so the Client can re-authenticate if the session expires, unless totp is given
+func (c *Client) Authenticate(ctx context.Context, email, password, totp string) (*api.User, error) {
+	req := &httpapi.AuthenticateRequest{Email: email, Password: password, TOTP: totp}
+
+	user, err := c.authenticate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.credentials = nil
+	if totp == "" {
+		c.credentials = req
+	}
+	c.mu.Unlock()
+
+	return user, nil
+}
+
+func (c *Client) authenticate(ctx context.Context, req *httpapi.AuthenticateRequest) (*api.User, error) {
+	resp := new(httpapi.AuthenticateResponse)
+	if err := c.send(ctx, http.MethodPost, "/auth", nil, req, resp); err != nil {
+		return nil, err
+	}
+
+	c.SetSessionKey(resp.SessionKey)
+
+	return resp.User, nil
+}
+
+//do sends a request and decodes the response into out (if not nil).
+//If the session has expired and the Client has credentials, it re-authenticates and tries again once
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	key := c.SessionKey()
+	err := c.send(ctx, method, path, query, body, out)
+
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+
+	c.mu.Lock()
+	creds := c.credentials
+	c.mu.Unlock()
+	if creds == nil {
+		return err
+	}
+
+	//another request may have already re-authenticated
+	if c.SessionKey() == key {
+		if _, aErr := c.authenticate(ctx, creds); aErr != nil {
+			return fmt.Errorf("Could not re-authenticate: %w", aErr)
+		}
+	}
+
+	return c.send(ctx, method, path, query, body, out)
+}
+
+//send sends a request, retrying it as configured, and decodes the response into out (if not nil)
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var buf []byte
+	if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("Could not encode request: %w", err)
+		}
+	}
+
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, method, u, buf)
+
+		retry := attempt < c.MaxRetries && c.retryable(method, resp, err)
+		if !retry {
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			return decodeResponse(resp, out)
+		}
+
+		next := wait
+		if resp != nil {
+			if s, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil && s >= 0 {
+				next = time.Duration(s) * time.Second
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if next > maxRetryWait {
+			next = maxRetryWait
+		}
+
+		t := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		wait *= 2
+	}
+}
+
+//attempt sends a single request
+func (c *Client) attempt(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key := c.SessionKey(); key != "" {
+		req.Header.Set("X-Session-Key", key)
+	}
+
+	return c.HTTPClient.Do(req)
+}
+
+//retryable returns true if the given result should be retried
+func (c *Client) retryable(method string, resp *http.Response, err error) bool {
+	if err != nil {
+		return method == http.MethodGet && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return method == http.MethodGet
+	}
+
+	return false
+}
+
+//decodeResponse decodes the response body into out (if not nil), or returns an *Error for error responses
+func decodeResponse(resp *http.Response, out interface{}) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{StatusCode: resp.StatusCode, Description: http.StatusText(resp.StatusCode)}
+
+		buf, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		if err != nil {
+			return e
+		}
+
+		//the error is a string in API version 1.0 and an object in 2.0
+		var v1 *httpapi.ErrorResponse
+		var v2 *httpapi.ErrorResponseV2
+		if err = json.Unmarshal(buf, &v1); err == nil && v1 != nil && v1.Error != "" {
+			e.Description, e.Message, e.Fields, e.DuplicateID = v1.Error, v1.Message, v1.Fields, v1.DuplicateID
+		} else if err = json.Unmarshal(buf, &v2); err == nil && v2 != nil && v2.Error != nil {
+			e.Description, e.Message, e.Fields, e.DuplicateID = v2.Error.Title, v2.Error.Message, v2.Error.Fields, v2.Error.DuplicateID
+		}
+
+		return e
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("Could not decode response: %w", err)
+	}
+
+	return nil
+}
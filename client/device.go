@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/httpapi"
+)
+
+//DeviceQuery is a Device query. Empty fields are ignored.
+//If Search is set, a simple search is done over all fields and the other fields are ignored
+type DeviceQuery struct {
+	SerialNumber string
+	Manufacturer string
+	Model        string
+	Category     string
+	Status       api.Status
+	Location     api.Location
+	Search       string
+}
+
+func (q *DeviceQuery) values() url.Values {
+	v := make(url.Values)
+	if q.Search != "" {
+		v.Set("search", q.Search)
+		return v
+	}
+	for name, value := range map[string]string{
+		"serial_number": q.SerialNumber,
+		"manufacturer":  q.Manufacturer,
+		"model":         q.Model,
+		"category":      q.Category,
+		"status":        string(q.Status),
+		"location":      string(q.Location),
+	} {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	return v
+}
+
+//CreateDevice creates a new Device with an optional note and returns it
+func (c *Client) CreateDevice(ctx context.Context, device *api.Device, note string) (*api.Device, error) {
+	d := new(api.Device)
+	if err := c.do(ctx, http.MethodPost, "/devices/", nil, &httpapi.CreateDeviceRequest{Device: device, Note: note}, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+//ReadDevice returns the Device with the given id, including its Events if events is true
+func (c *Client) ReadDevice(ctx context.Context, id int64, events bool) (*api.Device, error) {
+	var q url.Values
+	if events {
+		q = url.Values{"events": {"true"}}
+	}
+
+	d := new(api.Device)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/devices/%d", id), q, nil, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+//UpdateDevice updates the given Device and returns the updated Device
+func (c *Client) UpdateDevice(ctx context.Context, device *api.Device) (*api.Device, error) {
+	d := new(api.Device)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/devices/%d", device.ID), nil, device, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+//QueryDevices returns the Devices matching the given query
+func (c *Client) QueryDevices(ctx context.Context, query *DeviceQuery) ([]*api.Device, error) {
+	resp := new(httpapi.QueryDeviceResponse)
+	if err := c.do(ctx, http.MethodGet, "/devices/", query.values(), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Devices, nil
+}
+
+//CreateDeviceNote adds a note to the Device with the given id and returns the updated Device
+func (c *Client) CreateDeviceNote(ctx context.Context, id int64, note string) (*api.Device, error) {
+	d := new(api.Device)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/devices/%d/notes/", id), nil, &httpapi.NoteRequest{Note: note}, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+//ReadDeviceChanges returns up to limit Device changes after the given cursor.
+//An empty cursor starts at the beginning, and a limit of 0 uses the server's default
+func (c *Client) ReadDeviceChanges(ctx context.Context, cursor string, limit int) (*api.DeviceChanges, error) {
+	q := make(url.Values)
+	if cursor != "" {
+		q.Set("since", cursor)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	changes := new(api.DeviceChanges)
+	if err := c.do(ctx, http.MethodGet, "/devices/changes", q, nil, changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/httpapi"
+)
+
+//CreateModel creates a new Model and returns it
+func (c *Client) CreateModel(ctx context.Context, model *api.Model) (*api.Model, error) {
+	m := new(api.Model)
+	if err := c.do(ctx, http.MethodPost, "/models/", nil, model, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//ReadModel returns the Model with the given id
+func (c *Client) ReadModel(ctx context.Context, id int64) (*api.Model, error) {
+	m := new(api.Model)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/models/%d", id), nil, nil, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//UpdateModel updates the given Model and returns the updated Model
+func (c *Client) UpdateModel(ctx context.Context, model *api.Model) (*api.Model, error) {
+	m := new(api.Model)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/models/%d", model.ID), nil, model, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//QueryModels returns the Models matching the given fields. Empty fields are ignored
+func (c *Client) QueryModels(ctx context.Context, manufacturer, model, category string) ([]*api.Model, error) {
+	q := make(url.Values)
+	for name, value := range map[string]string{"manufacturer": manufacturer, "model": model, "category": category} {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+
+	resp := new(httpapi.QueryModelResponse)
+	if err := c.do(ctx, http.MethodGet, "/models/", q, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Models, nil
+}
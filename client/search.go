@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/httpapi"
+)
+
+//statsFilterQuery returns the query parameters for filter, which may be nil
+func statsFilterQuery(filter *api.StatsFilter) url.Values {
+	query := url.Values{}
+	if filter == nil {
+		return query
+	}
+	if filter.Location != "" {
+		query.Set("location", string(filter.Location))
+	}
+	if filter.ModelID != 0 {
+		query.Set("model_id", strconv.FormatInt(filter.ModelID, 10))
+	}
+	if filter.Status != "" {
+		query.Set("status", string(filter.Status))
+	}
+	if filter.CategoryID != 0 {
+		query.Set("category_id", strconv.FormatInt(filter.CategoryID, 10))
+	}
+	return query
+}
+
+//ReadStats returns inventory statistics
+func (c *Client) ReadStats(ctx context.Context) (*api.Stats, error) {
+	return c.ReadFilteredStats(ctx, nil)
+}
+
+//ReadFilteredStats returns inventory statistics for devices matching filter, or all devices if filter is nil
+func (c *Client) ReadFilteredStats(ctx context.Context, filter *api.StatsFilter) (*api.Stats, error) {
+	stats := new(api.Stats)
+	if err := c.do(ctx, http.MethodGet, "/stats/", statsFilterQuery(filter), nil, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+//ReadStatsTimeSeries returns device activity per period (day, week, or month) from since to until (inclusive)
+//for devices matching filter, or all devices if filter is nil. Empty or zero values use the server's defaults
+func (c *Client) ReadStatsTimeSeries(ctx context.Context, period api.Period, since, until time.Time, filter *api.StatsFilter) (*api.StatsTimeSeries, error) {
+	query := statsFilterQuery(filter)
+	if period != "" {
+		query.Set("period", string(period))
+	}
+	if !since.IsZero() {
+		query.Set("since", since.Format("2006-01-02"))
+	}
+	if !until.IsZero() {
+		query.Set("until", until.Format("2006-01-02"))
+	}
+
+	ts := new(api.StatsTimeSeries)
+	if err := c.do(ctx, http.MethodGet, "/stats/timeseries", query, nil, ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+//Search returns results matching q, at most limit of each type. A limit of 0 uses the server's default
+func (c *Client) Search(ctx context.Context, q string, limit int) ([]*api.SearchResult, error) {
+	query := url.Values{"q": {q}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp := new(httpapi.SearchResponse)
+	if err := c.do(ctx, http.MethodGet, "/search", query, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+//SearchNotes returns at most limit device notes matching q, most relevant first. A limit of 0 uses the server's default
+func (c *Client) SearchNotes(ctx context.Context, q string, limit int) ([]*api.NoteMatch, error) {
+	query := url.Values{"q": {q}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp := new(httpapi.SearchNotesResponse)
+	if err := c.do(ctx, http.MethodGet, "/events/search", query, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.Notes, nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/httpapi"
+)
+
+//CreateUser creates a new User with the given credentials and returns it
+func (c *Client) CreateUser(ctx context.Context, email, password, name string) (*api.User, error) {
+	u := new(api.User)
+	if err := c.do(ctx, http.MethodPost, "/users/", nil, &httpapi.CreateUserRequest{Email: email, Password: password, Name: name}, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+//ReadUser returns the User with the given id
+func (c *Client) ReadUser(ctx context.Context, id int64) (*api.User, error) {
+	u := new(api.User)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d", id), nil, nil, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+//UpdateUser updates the given User and returns the updated User
+func (c *Client) UpdateUser(ctx context.Context, user *api.User) (*api.User, error) {
+	u := new(api.User)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/users/%d", user.ID), nil, user, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+//ChangeUserPassword changes the password of the User with the given id.
+//The server ends all of the User's sessions, so the Client's stored credentials are updated to re-authenticate with the new password
+func (c *Client) ChangeUserPassword(ctx context.Context, id int64, oldPassword, newPassword string) (*api.User, error) {
+	u := new(api.User)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/users/%d/password", id), nil, &httpapi.ChangeUserPasswordRequest{OldPassword: oldPassword, NewPassword: newPassword}, u); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.credentials != nil && c.credentials.Email == u.Email {
+		c.credentials = &httpapi.AuthenticateRequest{Email: u.Email, Password: newPassword}
+	}
+	c.mu.Unlock()
+
+	return u, nil
+}
@@ -0,0 +1,80 @@
+//Command replay replays requests from an inventory server journal against a server for debugging
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/korylprince/tcea-inventory-server/httpapi"
+)
+
+func main() {
+	journal := flag.String("journal", "", "path to journal file; required")
+	url := flag.String("url", "http://localhost:8080/api/1.0", "base URL of the server to replay against, including the API prefix")
+	key := flag.String("key", "", "session key to send with replayed requests")
+	start := flag.Int("start", 1, "first entry to replay (1-indexed)")
+	count := flag.Int("count", 0, "number of entries to replay; 0 replays all remaining entries")
+	verbose := flag.Bool("v", false, "print response bodies")
+	flag.Parse()
+
+	if *journal == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*journal)
+	if err != nil {
+		log.Fatalln("Could not open journal:", err)
+	}
+	defer f.Close()
+
+	entries, err := httpapi.ReadJournal(f)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *start < 1 || *start > len(entries) {
+		log.Fatalf("start (%d) must be between 1 and %d\n", *start, len(entries))
+	}
+
+	entries = entries[*start-1:]
+	if *count > 0 && *count < len(entries) {
+		entries = entries[:*count]
+	}
+
+	for i, e := range entries {
+		r, err := e.Request(*url)
+		if err != nil {
+			log.Fatalf("Could not create request for entry %d: %v\n", *start+i, err)
+		}
+
+		if *key != "" {
+			r.Header.Set("X-Session-Key", *key)
+		}
+
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			log.Fatalf("Could not replay entry %d: %v\n", *start+i, err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			log.Fatalf("Could not read response for entry %d: %v\n", *start+i, err)
+		}
+
+		match := "match"
+		if resp.StatusCode != e.Code {
+			match = "MISMATCH"
+		}
+
+		fmt.Printf("%d %s %s %s: journaled %d, replayed %d (%s)\n", *start+i, e.Date.Format("2006-01-02:15:04:05 -0700"), e.Method, e.Path, e.Code, resp.StatusCode, match)
+		if *verbose {
+			fmt.Println(string(body))
+		}
+	}
+}
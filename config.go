@@ -10,12 +10,76 @@ import (
 //Config represents options given in the environment
 type Config struct {
 	SessionExpiration int //in minutes; default: 60
+	SessionLimit      int //maximum active sessions per user (the oldest are removed first); default: 5; -1 disables
+	CacheExpiration   int //in seconds; 0 disables the device, model, status, and location cache
+
+	PasswordHash    string //bcrypt or argon2id; default: argon2id
+	BcryptCost      int    //default: 12
+	Argon2idTime    uint32 //default: 3
+	Argon2idMemory  uint32 //in KiB; default: 65536
+	Argon2idThreads uint8  //default: 2
 
 	SQLDriver string //required
 	SQLDSN    string //required
 
+	SQLReplicaDSN string //if set, GET requests are read from this database (e.g. a read replica), using SQLDriver
+
+	SQLMaxOpenConns    int //maximum open connections per database; default: 50; -1 is unlimited
+	SQLMaxIdleConns    int //maximum idle connections kept open per database; default: 10; -1 keeps none
+	SQLConnMaxLifetime int //seconds before a connection is closed and replaced; default: 300; -1 disables
+	SQLConnMaxIdleTime int //seconds before an idle connection is closed; default: 60; -1 disables
+
+	SkipMigrations bool //if true, migrations aren't applied at startup; the server still refuses to start if the schema version doesn't match
+
 	ListenAddr string //addr format used for net.Dial; required
 	Prefix     string //url prefix to mount api to without trailing slash
+
+	GRPCListenAddr string //addr for the gRPC API listener (e.g. :9090); if empty, the gRPC API is disabled
+	GRPCTLSCert    string //PEM certificate file for the gRPC listener; if empty (with GRPCTLSKey), the listener is plaintext
+	GRPCTLSKey     string //PEM private key file for the gRPC listener
+
+	ShutdownTimeout int   //seconds to wait for in-flight requests and background jobs on SIGINT or SIGTERM; default: 30
+	ReadTimeout     int   //seconds to read a request, including the body; default: 30
+	WriteTimeout    int   //seconds to write a response, from the end of reading the request headers; default: 60
+	IdleTimeout     int   //seconds to keep idle keep-alive connections open; default: 120
+	RequestTimeout  int   //seconds before a request's database queries are canceled; default: 30; -1 disables
+	MaxBodyBytes    int64 //maximum request body size; default: 1048576 (1 MiB)
+
+	TrustedProxies []string //IPs or CIDR ranges of proxies whose X-Forwarded-For header gives the client IP; if empty, the header is ignored
+
+	CORSOrigins []string //origins allowed to call the API from a browser; default: *
+	CORSMethods []string //default: GET, POST, DELETE, OPTIONS
+	CORSHeaders []string //request headers allowed from other origins; default: Accept, Content-Type, If-None-Match, Origin, X-Session-Key
+
+	SMTPAddr     string //host:port; if empty, no emails are sent
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string //required if SMTPAddr is set
+
+	InviteURL string //client URL invitation links point to (with a token query parameter); if empty, invitations are disabled
+	RevokeURL string //client URL login notification sign out links point to (with a token query parameter); if empty, sign out links are disabled
+
+	LoginNotifications string //none, new (new device alerts only), or all; default: new
+
+	JournalSize int    //captured requests kept in memory for /admin/journal; default: 1000; -1 disables request capture
+	JournalPath string //if set, captured requests are also appended to this file for replay
+	Debug       bool   //serve runtime stats and pprof profiles to admins under /debug/
+
+	VocabularyDailyLimit int //new models non-admins may create per day (only admins create locations); default: 20; -1 disables
+
+	EventRetentionYears int //modified and note device events older than this are moved to the archive daily; 0 disables
+
+	ReplacementAgeYears int //default device replacement age for the refresh planning report; default: 5
+
+	AssetTagPrefix      string //if set, asset tags are generated for new devices without one
+	AssetTagDigits      int    //zero-padded sequence length; default: 6
+	AssetTagPerLocation bool   //include the nearest location asset tag prefix and use a sequence per prefix
+	AssetTagPerYear     bool   //include the year and use a sequence per year
+
+	OIDCIssuer       string //OpenID Connect issuer URL; if empty, single sign-on is disabled
+	OIDCClientID     string //required if OIDCIssuer is set
+	OIDCClientSecret string //required if OIDCIssuer is set
+	OIDCRedirectURL  string //client URL the provider redirects back to; required if OIDCIssuer is set
 }
 
 var config = &Config{}
@@ -36,6 +100,38 @@ func init() {
 		config.SessionExpiration = 60
 	}
 
+	if config.SessionLimit == 0 {
+		config.SessionLimit = 5
+	}
+
+	if config.JournalSize == 0 {
+		config.JournalSize = 1000
+	}
+
+	if config.JournalSize < -1 {
+		log.Fatalln("INVENTORY_JOURNALSIZE must be -1 or greater")
+	}
+
+	if config.PasswordHash == "" {
+		config.PasswordHash = "argon2id"
+	}
+
+	if config.BcryptCost == 0 {
+		config.BcryptCost = 12
+	}
+
+	if config.Argon2idTime == 0 {
+		config.Argon2idTime = 3
+	}
+
+	if config.Argon2idMemory == 0 {
+		config.Argon2idMemory = 64 * 1024
+	}
+
+	if config.Argon2idThreads == 0 {
+		config.Argon2idThreads = 2
+	}
+
 	checkEmpty(config.SQLDriver, "SQLDRIVER")
 	checkEmpty(config.SQLDSN, "SQLDSN")
 
@@ -43,5 +139,95 @@ func init() {
 		log.Fatalln("mysql DSN must contain \"?parseTime=true\"")
 	}
 
+	if config.SQLDriver == "mysql" && config.SQLReplicaDSN != "" && !strings.Contains(config.SQLReplicaDSN, "?parseTime=true") {
+		log.Fatalln("mysql replica DSN must contain \"?parseTime=true\"")
+	}
+
+	if config.SQLMaxOpenConns == 0 {
+		config.SQLMaxOpenConns = 50
+	}
+
+	if config.SQLMaxIdleConns == 0 {
+		config.SQLMaxIdleConns = 10
+	}
+
+	if config.SQLConnMaxLifetime == 0 {
+		config.SQLConnMaxLifetime = 300
+	}
+
+	if config.SQLConnMaxIdleTime == 0 {
+		config.SQLConnMaxIdleTime = 60
+	}
+
 	checkEmpty(config.ListenAddr, "LISTENADDR")
+
+	if (config.GRPCTLSCert == "") != (config.GRPCTLSKey == "") {
+		log.Fatalln("INVENTORY_GRPCTLSCERT and INVENTORY_GRPCTLSKEY must be configured together")
+	}
+
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 30
+	}
+
+	if config.ReadTimeout == 0 {
+		config.ReadTimeout = 30
+	}
+
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = 60
+	}
+
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 120
+	}
+
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = 30
+	}
+
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = 1 << 20
+	}
+
+	if len(config.CORSOrigins) == 0 {
+		config.CORSOrigins = []string{"*"}
+	}
+
+	if len(config.CORSMethods) == 0 {
+		config.CORSMethods = []string{"GET", "POST", "DELETE", "OPTIONS"}
+	}
+
+	if len(config.CORSHeaders) == 0 {
+		config.CORSHeaders = []string{"Accept", "Content-Type", "If-None-Match", "Origin", "X-Session-Key"}
+	}
+
+	if config.SMTPAddr != "" {
+		checkEmpty(config.MailFrom, "MAILFROM")
+	}
+
+	if config.LoginNotifications == "" {
+		config.LoginNotifications = "new"
+	}
+
+	if config.LoginNotifications != "none" && config.LoginNotifications != "new" && config.LoginNotifications != "all" {
+		log.Fatalln("INVENTORY_LOGINNOTIFICATIONS must be none, new, or all")
+	}
+
+	if config.VocabularyDailyLimit == 0 {
+		config.VocabularyDailyLimit = 20
+	}
+
+	if config.ReplacementAgeYears == 0 {
+		config.ReplacementAgeYears = 5
+	}
+
+	if config.AssetTagDigits == 0 {
+		config.AssetTagDigits = 6
+	}
+
+	if config.OIDCIssuer != "" {
+		checkEmpty(config.OIDCClientID, "OIDCCLIENTID")
+		checkEmpty(config.OIDCClientSecret, "OIDCCLIENTSECRET")
+		checkEmpty(config.OIDCRedirectURL, "OIDCREDIRECTURL")
+	}
 }
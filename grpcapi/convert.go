@@ -0,0 +1,132 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/grpcapi/inventorypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//timestampPB returns t as a Timestamp, or nil if t is nil
+func timestampPB(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+//modelPB returns m as a protobuf Model, or nil if m is nil
+func modelPB(m *api.Model) *inventorypb.Model {
+	if m == nil {
+		return nil
+	}
+
+	pb := &inventorypb.Model{
+		Id:           m.ID,
+		Manufacturer: m.Manufacturer,
+		Model:        m.Model,
+		CategoryId:   m.CategoryID,
+		EolDate:      timestampPB(m.EOLDate),
+		EosDate:      timestampPB(m.EOSDate),
+	}
+
+	if m.Category != nil {
+		pb.Category = &inventorypb.Category{Id: m.Category.ID, Name: m.Category.Name}
+		pb.CategoryId = m.Category.ID
+	}
+
+	return pb
+}
+
+//devicePB returns d as a protobuf Device
+func devicePB(d *api.Device) *inventorypb.Device {
+	pb := &inventorypb.Device{
+		Id:           d.ID,
+		SerialNumber: d.SerialNumber,
+		AssetTag:     d.AssetTag,
+		ModelId:      d.ModelID,
+		Status:       string(d.Status),
+		Location:     string(d.Location),
+		LastEventAt:  timestampPB(d.LastEventAt),
+		Model:        modelPB(d.Model),
+	}
+
+	//queried Devices only have their Model
+	if pb.ModelId == 0 && d.Model != nil {
+		pb.ModelId = d.Model.ID
+	}
+
+	return pb
+}
+
+//statsPB returns s as protobuf Stats
+func statsPB(s *api.Stats) *inventorypb.Stats {
+	pb := &inventorypb.Stats{
+		DeviceCount:   int64(s.DeviceCount),
+		ModelCount:    int64(s.ModelCount),
+		LocationCount: int64(s.LocationCount),
+	}
+
+	location := func(l *api.StatsLocation) *inventorypb.StatsLocation {
+		return &inventorypb.StatsLocation{Location: l.Location, Count: int64(l.Count), Capacity: int64(l.Capacity), Utilization: l.Utilization}
+	}
+
+	for _, l := range s.Locations {
+		pb.Locations = append(pb.Locations, location(l))
+	}
+	for _, l := range s.OverCapacity {
+		pb.OverCapacity = append(pb.OverCapacity, location(l))
+	}
+	for _, m := range s.Models {
+		pb.Models = append(pb.Models, &inventorypb.StatsModel{Id: m.ID, Manufacturer: m.Manufacturer, Model: m.Model, Count: int64(m.Count)})
+	}
+	for _, c := range s.Categories {
+		pb.Categories = append(pb.Categories, &inventorypb.StatsCategory{Id: c.ID, Category: c.Category, Count: int64(c.Count)})
+	}
+	for _, st := range s.Statuses {
+		pb.Statuses = append(pb.Statuses, &inventorypb.StatsStatus{Status: st.Status, Count: int64(st.Count)})
+	}
+	for _, d := range s.Devices {
+		pb.Devices = append(pb.Devices, devicePB(d))
+	}
+
+	return pb
+}
+
+//changePB returns e as a protobuf Change, or an error if its content couldn't be converted
+func changePB(e *api.FeedEvent) (*inventorypb.Change, error) {
+	pb := &inventorypb.Change{
+		Type:     e.Type,
+		Id:       e.ID,
+		Event:    e.Event,
+		Date:     timestamppb.New(e.Date),
+		UserId:   e.UserID,
+		Location: string(e.Location),
+		Status:   string(e.Status),
+	}
+
+	if e.Content == nil {
+		return pb, nil
+	}
+
+	//Event content is converted through its JSON encoding so it matches the HTTP API
+	buf, err := json.Marshal(e.Content)
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode content: %v", err)
+	}
+
+	var content map[string]interface{}
+	if err = json.Unmarshal(buf, &content); err != nil {
+		return nil, fmt.Errorf("Could not decode content: %v", err)
+	}
+
+	if pb.Content, err = structpb.NewStruct(content); err != nil {
+		return nil, fmt.Errorf("Could not convert content: %v", err)
+	}
+
+	return pb, nil
+}
@@ -0,0 +1,215 @@
+package grpcapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/grpcapi/inventorypb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//GetDevice implements inventorypb.InventoryServer
+func (s *server) GetDevice(ctx context.Context, req *inventorypb.GetDeviceRequest) (*inventorypb.Device, error) {
+	var device *api.Device
+
+	err := s.withTransaction(ctx, true, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+
+		switch key := req.Key.(type) {
+		case *inventorypb.GetDeviceRequest_Id:
+			if err = store.CheckDevicePermission(ctx, key.Id); err != nil {
+				return err
+			}
+			device, err = store.ReadDevice(ctx, key.Id, false)
+		case *inventorypb.GetDeviceRequest_SerialNumber:
+			device, err = store.ReadDeviceBySerialNumber(ctx, key.SerialNumber, false)
+			if err != nil || device == nil {
+				return err
+			}
+			if device.DeletedAt != nil {
+				device = nil
+				return nil
+			}
+			err = store.CheckLocationPermission(ctx, device.Location)
+		default:
+			return status.Error(codes.InvalidArgument, "id or serial_number is required")
+		}
+
+		if err != nil || device == nil {
+			return err
+		}
+
+		device.Model, err = store.ReadModel(ctx, device.ModelID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if device == nil {
+		return nil, status.Error(codes.NotFound, "Could not find device")
+	}
+
+	return devicePB(device), nil
+}
+
+//ListDevices implements inventorypb.InventoryServer
+func (s *server) ListDevices(req *inventorypb.ListDevicesRequest, stream inventorypb.Inventory_ListDevicesServer) error {
+	var devices []*api.Device
+
+	err := s.withTransaction(stream.Context(), true, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		if req.Search != "" {
+			devices, err = store.SimpleQueryDevice(ctx, req.Search)
+			return err
+		}
+		devices, err = store.QueryDevice(ctx, req.SerialNumber, req.Manufacturer, req.Model, req.Category, req.Status, req.Location)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	//send after the transaction is committed so slow clients don't hold it open
+	for _, d := range devices {
+		if err = stream.Send(devicePB(d)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//GetModel implements inventorypb.InventoryServer
+func (s *server) GetModel(ctx context.Context, req *inventorypb.GetModelRequest) (*inventorypb.Model, error) {
+	var model *api.Model
+
+	err := s.withTransaction(ctx, true, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		model, err = store.ReadModel(ctx, req.Id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if model == nil {
+		return nil, status.Error(codes.NotFound, "Could not find model")
+	}
+
+	return modelPB(model), nil
+}
+
+//ListModels implements inventorypb.InventoryServer
+func (s *server) ListModels(req *inventorypb.ListModelsRequest, stream inventorypb.Inventory_ListModelsServer) error {
+	var models []*api.Model
+
+	err := s.withTransaction(stream.Context(), true, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		models, err = store.QueryModel(ctx, req.Manufacturer, req.Model, req.Category)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range models {
+		if err = stream.Send(modelPB(m)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//GetStats implements inventorypb.InventoryServer
+func (s *server) GetStats(ctx context.Context, req *inventorypb.GetStatsRequest) (*inventorypb.Stats, error) {
+	var filter *api.StatsFilter
+	if f := (api.StatsFilter{Location: api.Location(req.Location), ModelID: req.ModelId, Status: api.Status(req.Status), CategoryID: req.CategoryId}); f != (api.StatsFilter{}) {
+		filter = &f
+	}
+
+	var stats *api.Stats
+
+	err := s.withTransaction(ctx, true, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		stats, err = store.ReadStats(ctx, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statsPB(stats), nil
+}
+
+//readPermittedLocations returns the Locations the call User may access as a set, or nil if the User may access all Locations
+func (s *server) readPermittedLocations(ctx context.Context) (map[api.Location]bool, error) {
+	var locations []api.Location
+	err := s.withTransaction(ctx, true, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		locations, err = store.ReadPermittedLocations(ctx)
+		return err
+	})
+	if err != nil || locations == nil {
+		return nil, err
+	}
+
+	permitted := make(map[api.Location]bool)
+	for _, l := range locations {
+		permitted[l] = true
+	}
+
+	return permitted, nil
+}
+
+//WatchChanges implements inventorypb.InventoryServer. Device changes are only sent for Locations the User may access.
+//The session and Locations are checked again every streamRecheckInterval, and the stream ends if the session or User is no longer valid
+func (s *server) WatchChanges(_ *inventorypb.WatchChangesRequest, stream inventorypb.Inventory_WatchChangesServer) error {
+	if s.opts.Feed == nil {
+		return status.Error(codes.Unimplemented, "Change stream is disabled")
+	}
+
+	permitted, err := s.readPermittedLocations(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	events := s.opts.Feed.Subscribe()
+	defer s.opts.Feed.Unsubscribe(events)
+
+	recheck := time.NewTicker(streamRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if permitted != nil && e.Type == api.FeedEventTypeDevice && !permitted[e.Location] {
+				continue
+			}
+
+			change, err := changePB(e)
+			if err != nil {
+				return err
+			}
+			if err = stream.Send(change); err != nil {
+				return err
+			}
+		case <-recheck.C:
+			user, err := s.authenticate(stream.Context())
+			if err != nil {
+				return err
+			}
+			if permitted, err = s.readPermittedLocations(context.WithValue(stream.Context(), api.UserKey, user)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
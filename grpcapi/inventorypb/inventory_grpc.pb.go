@@ -0,0 +1,388 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: inventory.proto
+
+package inventorypb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Inventory_GetDevice_FullMethodName    = "/inventory.v1.Inventory/GetDevice"
+	Inventory_ListDevices_FullMethodName  = "/inventory.v1.Inventory/ListDevices"
+	Inventory_GetModel_FullMethodName     = "/inventory.v1.Inventory/GetModel"
+	Inventory_ListModels_FullMethodName   = "/inventory.v1.Inventory/ListModels"
+	Inventory_GetStats_FullMethodName     = "/inventory.v1.Inventory/GetStats"
+	Inventory_WatchChanges_FullMethodName = "/inventory.v1.Inventory/WatchChanges"
+)
+
+// InventoryClient is the client API for Inventory service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InventoryClient interface {
+	// GetDevice returns a device by id or serial number.
+	GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error)
+	// ListDevices streams the devices matching the request, like GET /devices/.
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (Inventory_ListDevicesClient, error)
+	// GetModel returns a model by id.
+	GetModel(ctx context.Context, in *GetModelRequest, opts ...grpc.CallOption) (*Model, error)
+	// ListModels streams the models matching the request, like GET /models/.
+	ListModels(ctx context.Context, in *ListModelsRequest, opts ...grpc.CallOption) (Inventory_ListModelsClient, error)
+	// GetStats returns device statistics, like GET /stats/.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// WatchChanges streams device and model changes as they're committed, like GET /events/stream.
+	WatchChanges(ctx context.Context, in *WatchChangesRequest, opts ...grpc.CallOption) (Inventory_WatchChangesClient, error)
+}
+
+type inventoryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInventoryClient(cc grpc.ClientConnInterface) InventoryClient {
+	return &inventoryClient{cc}
+}
+
+func (c *inventoryClient) GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error) {
+	out := new(Device)
+	err := c.cc.Invoke(ctx, Inventory_GetDevice_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *inventoryClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (Inventory_ListDevicesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Inventory_ServiceDesc.Streams[0], Inventory_ListDevices_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &inventoryListDevicesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Inventory_ListDevicesClient interface {
+	Recv() (*Device, error)
+	grpc.ClientStream
+}
+
+type inventoryListDevicesClient struct {
+	grpc.ClientStream
+}
+
+func (x *inventoryListDevicesClient) Recv() (*Device, error) {
+	m := new(Device)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *inventoryClient) GetModel(ctx context.Context, in *GetModelRequest, opts ...grpc.CallOption) (*Model, error) {
+	out := new(Model)
+	err := c.cc.Invoke(ctx, Inventory_GetModel_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *inventoryClient) ListModels(ctx context.Context, in *ListModelsRequest, opts ...grpc.CallOption) (Inventory_ListModelsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Inventory_ServiceDesc.Streams[1], Inventory_ListModels_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &inventoryListModelsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Inventory_ListModelsClient interface {
+	Recv() (*Model, error)
+	grpc.ClientStream
+}
+
+type inventoryListModelsClient struct {
+	grpc.ClientStream
+}
+
+func (x *inventoryListModelsClient) Recv() (*Model, error) {
+	m := new(Model)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *inventoryClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, Inventory_GetStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *inventoryClient) WatchChanges(ctx context.Context, in *WatchChangesRequest, opts ...grpc.CallOption) (Inventory_WatchChangesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Inventory_ServiceDesc.Streams[2], Inventory_WatchChanges_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &inventoryWatchChangesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Inventory_WatchChangesClient interface {
+	Recv() (*Change, error)
+	grpc.ClientStream
+}
+
+type inventoryWatchChangesClient struct {
+	grpc.ClientStream
+}
+
+func (x *inventoryWatchChangesClient) Recv() (*Change, error) {
+	m := new(Change)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// InventoryServer is the server API for Inventory service.
+// All implementations must embed UnimplementedInventoryServer
+// for forward compatibility
+type InventoryServer interface {
+	// GetDevice returns a device by id or serial number.
+	GetDevice(context.Context, *GetDeviceRequest) (*Device, error)
+	// ListDevices streams the devices matching the request, like GET /devices/.
+	ListDevices(*ListDevicesRequest, Inventory_ListDevicesServer) error
+	// GetModel returns a model by id.
+	GetModel(context.Context, *GetModelRequest) (*Model, error)
+	// ListModels streams the models matching the request, like GET /models/.
+	ListModels(*ListModelsRequest, Inventory_ListModelsServer) error
+	// GetStats returns device statistics, like GET /stats/.
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+	// WatchChanges streams device and model changes as they're committed, like GET /events/stream.
+	WatchChanges(*WatchChangesRequest, Inventory_WatchChangesServer) error
+	mustEmbedUnimplementedInventoryServer()
+}
+
+// UnimplementedInventoryServer must be embedded to have forward compatible implementations.
+type UnimplementedInventoryServer struct {
+}
+
+func (UnimplementedInventoryServer) GetDevice(context.Context, *GetDeviceRequest) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDevice not implemented")
+}
+func (UnimplementedInventoryServer) ListDevices(*ListDevicesRequest, Inventory_ListDevicesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (UnimplementedInventoryServer) GetModel(context.Context, *GetModelRequest) (*Model, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetModel not implemented")
+}
+func (UnimplementedInventoryServer) ListModels(*ListModelsRequest, Inventory_ListModelsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListModels not implemented")
+}
+func (UnimplementedInventoryServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedInventoryServer) WatchChanges(*WatchChangesRequest, Inventory_WatchChangesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchChanges not implemented")
+}
+func (UnimplementedInventoryServer) mustEmbedUnimplementedInventoryServer() {}
+
+// UnsafeInventoryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InventoryServer will
+// result in compilation errors.
+type UnsafeInventoryServer interface {
+	mustEmbedUnimplementedInventoryServer()
+}
+
+func RegisterInventoryServer(s grpc.ServiceRegistrar, srv InventoryServer) {
+	s.RegisterService(&Inventory_ServiceDesc, srv)
+}
+
+func _Inventory_GetDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InventoryServer).GetDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Inventory_GetDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InventoryServer).GetDevice(ctx, req.(*GetDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Inventory_ListDevices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListDevicesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InventoryServer).ListDevices(m, &inventoryListDevicesServer{stream})
+}
+
+type Inventory_ListDevicesServer interface {
+	Send(*Device) error
+	grpc.ServerStream
+}
+
+type inventoryListDevicesServer struct {
+	grpc.ServerStream
+}
+
+func (x *inventoryListDevicesServer) Send(m *Device) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Inventory_GetModel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetModelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InventoryServer).GetModel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Inventory_GetModel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InventoryServer).GetModel(ctx, req.(*GetModelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Inventory_ListModels_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListModelsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InventoryServer).ListModels(m, &inventoryListModelsServer{stream})
+}
+
+type Inventory_ListModelsServer interface {
+	Send(*Model) error
+	grpc.ServerStream
+}
+
+type inventoryListModelsServer struct {
+	grpc.ServerStream
+}
+
+func (x *inventoryListModelsServer) Send(m *Model) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Inventory_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InventoryServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Inventory_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InventoryServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Inventory_WatchChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InventoryServer).WatchChanges(m, &inventoryWatchChangesServer{stream})
+}
+
+type Inventory_WatchChangesServer interface {
+	Send(*Change) error
+	grpc.ServerStream
+}
+
+type inventoryWatchChangesServer struct {
+	grpc.ServerStream
+}
+
+func (x *inventoryWatchChangesServer) Send(m *Change) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Inventory_ServiceDesc is the grpc.ServiceDesc for Inventory service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Inventory_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "inventory.v1.Inventory",
+	HandlerType: (*InventoryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDevice",
+			Handler:    _Inventory_GetDevice_Handler,
+		},
+		{
+			MethodName: "GetModel",
+			Handler:    _Inventory_GetModel_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Inventory_GetStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListDevices",
+			Handler:       _Inventory_ListDevices_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListModels",
+			Handler:       _Inventory_ListModels_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchChanges",
+			Handler:       _Inventory_WatchChanges_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "inventory.proto",
+}
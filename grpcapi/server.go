@@ -0,0 +1,306 @@
+//Package grpcapi serves device, model, and stats reads and a stream of changes over gRPC, alongside the HTTP API
+package grpcapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/grpcapi/inventorypb"
+	"github.com/korylprince/tcea-inventory-server/httpapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//sessionKeyMetadata is the metadata key for the session key, the gRPC equivalent of the X-Session-Key header
+const sessionKeyMetadata = "x-session-key"
+
+//maxTxAttempts is how many times a transaction is attempted if it deadlocks or times out waiting for a lock
+const maxTxAttempts = 3
+
+//txRetryWait is the wait before retrying a transaction. The wait doubles for each following retry
+const txRetryWait = 50 * time.Millisecond
+
+//streamRecheckInterval is how often WatchChanges authenticates the call again and rereads the User's permitted Locations
+const streamRecheckInterval = time.Minute
+
+//Options are optional features for the gRPC API. The zero value disables all of them
+type Options struct {
+	Cache          api.Cache     //if nil, caching is disabled
+	Feed           *api.Feed     //if nil, WatchChanges is disabled
+	RequestTimeout time.Duration //if greater than 0, database queries are canceled after this long
+	ReplicaDB      *sql.DB       //if set, calls are read from this database (e.g. a read replica) instead of db
+}
+
+//server implements inventorypb.InventoryServer
+type server struct {
+	inventorypb.UnimplementedInventoryServer
+	w        io.Writer
+	sessions httpapi.SessionStore
+	db       *sql.DB
+	opts     *Options
+}
+
+//NewServer returns a gRPC server for the Inventory service. Calls are authenticated with sessions from s (shared with the HTTP API)
+//and logged to w. serverOpts are passed to grpc.NewServer (e.g. for TLS credentials)
+func NewServer(w io.Writer, s httpapi.SessionStore, db *sql.DB, opts *Options, serverOpts ...grpc.ServerOption) *grpc.Server {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	srv := &server{w: w, sessions: s, db: db, opts: opts}
+
+	serverOpts = append(serverOpts, grpc.UnaryInterceptor(srv.unaryInterceptor), grpc.StreamInterceptor(srv.streamInterceptor))
+	g := grpc.NewServer(serverOpts...)
+	inventorypb.RegisterInventoryServer(g, srv)
+
+	return g
+}
+
+const logTemplate = "{{.Date}} gRPC {{.Method}} {{.Code}}{{if .User}}, User: {{.User.ID}}:{{.User.Email}}{{end}}{{if .Err}}, Error: {{.Err}}{{end}}\n"
+
+var logTmpl = template.Must(template.New("log").Parse(logTemplate))
+
+type logData struct {
+	Date   string
+	Method string
+	Code   codes.Code
+	User   *api.User
+	Err    error
+}
+
+//contextStream is a grpc.ServerStream with a different context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+//Context implements grpc.ServerStream
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var resp interface{}
+	err := s.intercept(ctx, info.FullMethod, func(ctx context.Context) error {
+		var err error
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (s *server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return s.intercept(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+//intercept authenticates a call and runs it with the User in its context, then logs it.
+//Errors are logged in full and returned to the client as gRPC statuses without server details
+func (s *server) intercept(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	user, err := s.authenticate(ctx)
+	if err == nil {
+		err = call(context.WithValue(ctx, api.UserKey, user))
+	}
+
+	err = statusError(err)
+
+	if lErr := logTmpl.Execute(s.w, &logData{
+		Date:   time.Now().Format("2006-01-02:15:04:05 -0700"),
+		Method: method,
+		Code:   status.Code(err),
+		User:   user,
+		Err:    err,
+	}); lErr != nil {
+		panic(lErr)
+	}
+
+	return status.Convert(err).Err()
+}
+
+//authenticate returns the User for the call's session key, or an error if the session or User isn't valid
+func (s *server) authenticate(ctx context.Context) (*api.User, error) {
+	var key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if keys := md.Get(sessionKeyMetadata); len(keys) > 0 {
+			key = keys[0]
+		}
+	}
+	if key == "" {
+		return nil, status.Errorf(codes.Unauthenticated, "%s metadata empty", sessionKeyMetadata)
+	}
+
+	sess, err := s.sessions.Check(key)
+	if err != nil {
+		return nil, fmt.Errorf("Could not check session key: %v", err)
+	}
+	if sess == nil {
+		return nil, status.Error(codes.Unauthenticated, "Could not find session")
+	}
+
+	var user *api.User
+	err = s.withTransaction(ctx, false, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		if user, err = store.ReadUser(ctx, sess.UserID); err != nil || user == nil || user.Disabled || user.MustChangePassword {
+			return err
+		}
+
+		if err = store.UpdateUserActivity(ctx, user.ID, time.Now()); err != nil {
+			return err
+		}
+
+		//temporary Grants can elevate the User's Role
+		return store.ApplyUserGrants(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.Disabled {
+		return nil, status.Error(codes.Unauthenticated, "User is disabled or deleted")
+	}
+
+	//users with temporary passwords can only change their password, which the gRPC API can't do
+	if user.MustChangePassword {
+		return user, status.Error(codes.PermissionDenied, "User must change password")
+	}
+
+	return user, nil
+}
+
+//statusError returns err as an error with a gRPC status. api.Errors are given the matching code;
+//other errors without a status are internal errors
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	code := codes.Internal
+	if e, ok := err.(*api.Error); ok {
+		switch e.Type {
+		case api.ErrorTypeUser:
+			code = codes.InvalidArgument
+		case api.ErrorTypeDuplicate:
+			code = codes.AlreadyExists
+		case api.ErrorTypeForbidden:
+			code = codes.PermissionDenied
+		}
+	}
+
+	return &loggedError{code: code, err: err}
+}
+
+//loggedError is an error logged in full but returned to the client with only its code
+type loggedError struct {
+	code codes.Code
+	err  error
+}
+
+func (e *loggedError) Error() string {
+	return e.err.Error()
+}
+
+//GRPCStatus is used by the status package to convert the error
+func (e *loggedError) GRPCStatus() *status.Status {
+	msg := e.code.String()
+	if e.code == codes.InvalidArgument {
+		if ae, ok := e.err.(*api.Error); ok && ae.Err != nil {
+			msg = ae.Err.Error()
+		}
+	}
+	return status.New(e.code, msg)
+}
+
+//withTransaction runs f in a transaction for a call, committing it afterwards. Read-only transactions are read from the replica,
+//if set. If the transaction deadlocks or times out waiting for a lock, it's rolled back and retried, up to maxTxAttempts times
+func (s *server) withTransaction(ctx context.Context, readOnly bool, f func(ctx context.Context, store *api.TxStore) error) error {
+	if s.opts.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.RequestTimeout)
+		defer cancel()
+	}
+
+	wait := txRetryWait
+	for attempt := 1; ; attempt++ {
+		err := s.runTransaction(ctx, readOnly, f)
+		if err == nil || !api.IsRetryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		wait *= 2
+	}
+}
+
+//runTransaction runs f once for withTransaction
+func (s *server) runTransaction(ctx context.Context, readOnly bool, f func(ctx context.Context, store *api.TxStore) error) error {
+	var store *api.TxStore
+	var tx *sql.Tx
+	var err error
+	fromReplica := false
+	if readOnly {
+		read := s.db
+		if s.opts.ReplicaDB != nil {
+			read = s.opts.ReplicaDB
+			fromReplica = true
+		}
+		if tx, err = read.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err == nil {
+			store = api.NewReadOnlyTxStore(tx, read, s.db)
+		}
+	} else if tx, err = s.db.BeginTx(ctx, nil); err == nil {
+		store = api.NewTxStore(tx, s.db)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not begin transaction: %v", err)
+	}
+
+	var cache *api.RequestCache
+	if s.opts.Cache != nil {
+		if fromReplica {
+			cache = api.NewReplicaRequestCache(s.opts.Cache)
+		} else {
+			cache = api.NewRequestCache(s.opts.Cache)
+		}
+		ctx = context.WithValue(ctx, api.CacheKey, cache)
+	}
+
+	if err = f(ctx, store); err != nil {
+		if rErr := tx.Rollback(); rErr != nil {
+			return fmt.Errorf("Could not rollback transaction: %v", rErr)
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if rErr := tx.Rollback(); rErr != nil && rErr != sql.ErrTxDone {
+			return fmt.Errorf("Could not rollback transaction: %v", rErr)
+		}
+		return err
+	}
+
+	cache.Commit()
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const (
+	eventArchiveInterval  = 24 * time.Hour
+	eventArchiveBatchSize = 1000
+
+	defaultArchivedEventsLimit = 100
+	maxArchivedEventsLimit     = 1000
+)
+
+//archiveEvents moves Device Events older than years to the archive every eventArchiveInterval.
+//Events are moved in batches of eventArchiveBatchSize, each in its own transaction, so the device log isn't locked for long.
+//Once ctx is done, it returns after the current batch
+func archiveEvents(ctx context.Context, db *sql.DB, c api.Cache, years int) {
+	for {
+		before := time.Now().AddDate(-years, 0, 0)
+
+		var total int64
+		for {
+			var n int64
+			err := withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+				var err error
+				n, err = store.ArchiveEvents(ctx, before, eventArchiveBatchSize)
+				return err
+			})
+			if err != nil {
+				log.Printf("Could not archive events: %v\n", err)
+				break
+			}
+
+			total += n
+			if n < eventArchiveBatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		if total > 0 {
+			log.Printf("Archived %d events from before %s\n", total, before.Format("2006-01-02"))
+		}
+
+		if !sleepContext(ctx, eventArchiveInterval) {
+			return
+		}
+	}
+}
+
+// GET /admin/events/archive
+func handleQueryArchivedEvents(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	q := r.URL.Query()
+
+	var deviceID int64
+	if v := q.Get("device_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode device_id: %v", err))
+		}
+		deviceID = id
+	}
+
+	var since, until time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode since: %v", err))
+		}
+		since = t
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode until: %v", err))
+		}
+		//until is inclusive
+		until = t.AddDate(0, 0, 1)
+	}
+
+	limit := defaultArchivedEventsLimit
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode limit: %v", err))
+		}
+		if l < 1 || l > maxArchivedEventsLimit {
+			return handleError(http.StatusBadRequest, fmt.Errorf("limit (%d) must be between 1 and %d", l, maxArchivedEventsLimit))
+		}
+		limit = l
+	}
+
+	events, err := store.QueryArchivedEvents(r.Context(), deviceID, since, until, limit)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &QueryArchivedEventsResponse{Events: events}}
+}
@@ -0,0 +1,131 @@
+package httpapi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+//auditEntity returns the entity (first path segment) and entity id (from the route variables) for the given request
+func auditEntity(r *http.Request) (entity, id string) {
+	entity = strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 2)[0]
+
+	vars := mux.Vars(r)
+	for _, key := range []string{"id", "location", "status"} {
+		if v, ok := vars[key]; ok {
+			return entity, v
+		}
+	}
+
+	return entity, ""
+}
+
+//auditMiddleware records an AuditEntry for every write request. It must be wrapped by authMiddleware and txMiddleware
+func auditMiddleware(next returnHandler) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			return next(w, r)
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxJournalBody))
+			if err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not read body: %v", err))
+			}
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		}
+
+		resp := next(w, r)
+
+		user := r.Context().Value(api.UserKey).(*api.User)
+		entity, id := auditEntity(r)
+
+		e := &api.AuditEntry{
+			Date:     time.Now(),
+			UserID:   user.ID,
+			UserName: user.Name,
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Entity:   entity,
+			EntityID: id,
+			Summary:  string(redactBody(body, requestRedactedExactKeys)),
+			Code:     resp.Code,
+		}
+
+		//auditing shouldn't change the response
+		if err := store.CreateAuditEntry(r.Context(), e); err != nil {
+			log.Println("Could not write audit entry:", err)
+		}
+
+		return resp
+	}
+}
+
+// GET /audit
+func handleQueryAuditEntries(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	q := r.URL.Query()
+
+	var userID int64
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode user_id: %v", err))
+		}
+		userID = id
+	}
+
+	var since, until time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode since: %v", err))
+		}
+		since = t
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode until: %v", err))
+		}
+		//until is inclusive
+		until = t.AddDate(0, 0, 1)
+	}
+
+	limit := defaultAuditLimit
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode limit: %v", err))
+		}
+		if l < 1 || l > maxAuditLimit {
+			return handleError(http.StatusBadRequest, fmt.Errorf("limit (%d) must be between 1 and %d", l, maxAuditLimit))
+		}
+		limit = l
+	}
+
+	entries, err := store.QueryAuditEntries(r.Context(), userID, q.Get("entity"), q.Get("source"), since, until, limit)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &QueryAuditEntriesResponse{Entries: entries}}
+}
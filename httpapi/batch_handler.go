@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GET /events/batches/:id
+func handleReadEventBatch(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	batch, err := store.ReadEventBatch(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if batch == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find batch"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: batch}
+}
+
+// POST /events/batches/:id/revert
+func handleRevertEventBatch(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	batch, err := store.RevertEventBatch(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: batch}
+}
@@ -0,0 +1,33 @@
+package httpapi
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+)
+
+//BuildInfo describes the running server. Commit, BuildDate, and SchemaVersion are usually set at build time with -ldflags
+type BuildInfo struct {
+	Commit        string   `json:"commit"`
+	BuildDate     string   `json:"build_date"`
+	SchemaVersion string   `json:"schema_version"`
+	GoVersion     string   `json:"go_version"`
+	APIVersions   []string `json:"api_versions"`
+}
+
+// GET /version
+func handleReadVersion(b *BuildInfo) returnHandler {
+	info := &BuildInfo{GoVersion: runtime.Version()}
+	if b != nil {
+		info.Commit, info.BuildDate, info.SchemaVersion = b.Commit, b.BuildDate, b.SchemaVersion
+	}
+
+	for _, prefix := range apiVersionPrefixes {
+		info.APIVersions = append(info.APIVersions, prefix)
+	}
+	sort.Strings(info.APIVersions)
+
+	return func(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
+		return &handlerResponse{Code: http.StatusOK, Body: info}
+	}
+}
@@ -0,0 +1,233 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+// POST /carts/
+func handleCreateCart(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var cart *api.Cart
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&cart)
+	if err != nil || cart == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	id, err := store.CreateCart(r.Context(), cart)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	cart, err = store.ReadCart(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if cart == nil {
+		return handleError(http.StatusInternalServerError, errors.New("Could not find cart, but just created"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: cart}
+}
+
+// GET /carts/
+func handleReadCarts(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	carts, err := store.ReadCarts(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadCartsResponse{Carts: carts}}
+}
+
+//readPermittedCart reads the Cart with the id in the request URL and checks that the request User may access it
+func readPermittedCart(r *http.Request) (*api.Cart, *handlerResponse) {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	cart, err := store.ReadCart(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return nil, resp
+	}
+	if cart == nil {
+		return nil, handleError(http.StatusNotFound, errors.New("Could not find cart"))
+	}
+
+	if resp := checkAPIError(store.CheckLocationPermission(r.Context(), cart.Location)); resp != nil {
+		return nil, resp
+	}
+
+	return cart, nil
+}
+
+// GET /carts/:id
+func handleReadCart(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	cart, resp := readPermittedCart(r)
+	if resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: cart}
+}
+
+// POST /carts/:id
+func handleUpdateCart(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var cart *api.Cart
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&cart)
+	if err != nil || cart == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	if cart.ID != id {
+		return handleError(http.StatusBadRequest, fmt.Errorf("cart id mismatch: URL: %d, Body: %d", id, cart.ID))
+	}
+
+	if _, resp := readPermittedCart(r); resp != nil {
+		return resp
+	}
+
+	err = store.UpdateCart(r.Context(), cart)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	cart, err = store.ReadCart(r.Context(), cart.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if cart == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find cart, but just updated"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: cart}
+}
+
+// DELETE /carts/:id
+func handleDeleteCart(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	cart, resp := readPermittedCart(r)
+	if resp != nil {
+		return resp
+	}
+
+	err := store.DeleteCart(r.Context(), cart.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: cart}
+}
+
+// GET /carts/:id/devices
+func handleReadCartDevices(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	cart, resp := readPermittedCart(r)
+	if resp != nil {
+		return resp
+	}
+
+	devices, err := store.ReadCartDevices(r.Context(), cart.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &QueryDeviceResponse{Devices: devices}}
+}
+
+// POST /carts/:id/devices
+func handleUpdateCartDevices(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	cart, resp := readPermittedCart(r)
+	if resp != nil {
+		return resp
+	}
+
+	var req *UpdateCartDevicesRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	err = store.UpdateCartDevices(r.Context(), cart.ID, req.DeviceIDs)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	devices, err := store.ReadCartDevices(r.Context(), cart.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &QueryDeviceResponse{Devices: devices}}
+}
+
+// POST /carts/:id/status
+func handleUpdateCartStatus(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	cart, resp := readPermittedCart(r)
+	if resp != nil {
+		return resp
+	}
+
+	var req *UpdateCartStatusRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	err = store.UpdateCartStatus(r.Context(), cart.ID, req.Status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	devices, err := store.ReadCartDevices(r.Context(), cart.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &QueryDeviceResponse{Devices: devices}}
+}
+
+// GET /reports/carts
+func handleReadCartReconciliations(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	recs, err := store.ReadCartReconciliations(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadCartReconciliationsResponse{Carts: recs}}
+}
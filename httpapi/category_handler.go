@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+// POST /categories/
+func handleCreateCategory(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var category *api.Category
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&category)
+	if err != nil || category == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	id, err := store.CreateCategory(r.Context(), category)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	category, err = store.ReadCategory(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if category == nil {
+		return handleError(http.StatusInternalServerError, errors.New("Could not find category, but just created"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: category}
+}
+
+// GET /categories/
+func handleReadCategories(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	categories, err := store.ReadCategories(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadCategoriesResponse{Categories: categories}}
+}
+
+// GET /categories/:id
+func handleReadCategory(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	category, err := store.ReadCategory(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if category == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find category"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: category}
+}
+
+// POST /categories/:id
+func handleUpdateCategory(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var category *api.Category
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&category)
+	if err != nil || category == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	if category.ID != id {
+		return handleError(http.StatusBadRequest, fmt.Errorf("category id mismatch: URL: %d, Body: %d", id, category.ID))
+	}
+
+	err = store.UpdateCategory(r.Context(), category)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	category, err = store.ReadCategory(r.Context(), category.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if category == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find category, but just updated"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: category}
+}
+
+// DELETE /categories/:id
+func handleDeleteCategory(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	category, err := store.ReadCategory(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if category == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find category"))
+	}
+
+	err = store.DeleteCategory(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: category}
+}
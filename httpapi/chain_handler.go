@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultEventChainLimit = 10000
+	maxEventChainLimit     = 100000
+)
+
+// GET /admin/events/verify
+func handleVerifyEventChain(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	q := r.URL.Query()
+
+	var after int64
+	if v := q.Get("after"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode after: %v", err))
+		}
+		after = id
+	}
+
+	limit := defaultEventChainLimit
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode limit: %v", err))
+		}
+		if l < 1 || l > maxEventChainLimit {
+			return handleError(http.StatusBadRequest, fmt.Errorf("limit (%d) must be between 1 and %d", l, maxEventChainLimit))
+		}
+		limit = l
+	}
+
+	verification, err := store.VerifyEventChain(r.Context(), after, limit)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: verification}
+}
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const (
+	defaultDeviceChangesLimit = 1000
+	maxDeviceChangesLimit     = 10000
+)
+
+// GET /devices/changes
+func handleReadDeviceChanges(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	cursor, err := api.ParseDeviceChangesCursor(r.URL.Query().Get("since"))
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode since: %v", err))
+	}
+
+	limit := defaultDeviceChangesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode limit: %v", err))
+		}
+		if l < 1 || l > maxDeviceChangesLimit {
+			return handleError(http.StatusBadRequest, fmt.Errorf("limit (%d) must be between 1 and %d", l, maxDeviceChangesLimit))
+		}
+		limit = l
+	}
+
+	changes, err := store.ReadDeviceChanges(r.Context(), cursor, limit)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: changes}
+}
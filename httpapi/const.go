@@ -1,3 +1,5 @@
 package httpapi
 
 const eventsTrue = "true"
+
+const attributionTrue = "true"
@@ -2,8 +2,14 @@ package httpapi
 
 type contextKey int
 
-//TransactionKey is the context key for the database transaction for a request
-const TransactionKey contextKey = 0
+//StoreKey is the context key for the api.TxStore for a request
+const StoreKey contextKey = 0
 
 //UserKey is the context key for the user for a request
 const UserKey contextKey = 1
+
+//AfterCommitKey is the context key for the afterCommit queue for a request
+const AfterCommitKey contextKey = 3
+
+//OIDCKey is the context key for the single sign-on login for a request
+const OIDCKey contextKey = 4
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+// GET /dashboard
+func handleReadDashboard(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	dashboard, err := store.ReadDashboard(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: dashboard}
+}
+
+// GET /dashboard/widgets
+func handleReadDashboardWidgets(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+	user := r.Context().Value(api.UserKey).(*api.User)
+
+	widgets, err := store.ReadDashboardWidgets(r.Context(), user.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadDashboardWidgetsResponse{Widgets: widgets}}
+}
+
+// POST /dashboard/widgets
+func handleUpdateDashboardWidgets(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+	user := r.Context().Value(api.UserKey).(*api.User)
+
+	var req *DashboardWidgetsRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	if resp := checkAPIError(store.UpdateDashboardWidgets(r.Context(), user.ID, req.Widgets)); resp != nil {
+		return resp
+	}
+
+	widgets, err := store.ReadDashboardWidgets(r.Context(), user.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadDashboardWidgetsResponse{Widgets: widgets}}
+}
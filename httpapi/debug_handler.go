@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"database/sql"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+//processStarted is when the server process started
+var processStarted = time.Now()
+
+//RuntimeMemoryStats is a summary of runtime.MemStats
+type RuntimeMemoryStats struct {
+	Alloc        uint64     `json:"alloc_bytes"`
+	TotalAlloc   uint64     `json:"total_alloc_bytes"`
+	Sys          uint64     `json:"sys_bytes"`
+	HeapInuse    uint64     `json:"heap_inuse_bytes"`
+	HeapObjects  uint64     `json:"heap_objects"`
+	NumGC        uint32     `json:"num_gc"`
+	PauseTotal   float64    `json:"gc_pause_total_ms"`
+	LastGC       *time.Time `json:"last_gc,omitempty"`
+	GCCPUPercent float64    `json:"gc_cpu_percent"`
+}
+
+//RuntimeDatabaseStats is a summary of sql.DBStats
+type RuntimeDatabaseStats struct {
+	OpenConnections int     `json:"open_connections"`
+	InUse           int     `json:"in_use"`
+	Idle            int     `json:"idle"`
+	WaitCount       int64   `json:"wait_count"`
+	WaitDuration    float64 `json:"wait_duration_ms"`
+}
+
+//RuntimeStatsResponse is a snapshot of process, memory, and database connection pool statistics
+type RuntimeStatsResponse struct {
+	GoVersion  string                `json:"go_version"`
+	NumCPU     int                   `json:"num_cpu"`
+	GOMAXPROCS int                   `json:"gomaxprocs"`
+	Goroutines int                   `json:"goroutines"`
+	Started    time.Time             `json:"started"`
+	Uptime     float64               `json:"uptime_seconds"`
+	Panics     int64                 `json:"panics"`
+	Memory     *RuntimeMemoryStats   `json:"memory"`
+	Database   *RuntimeDatabaseStats `json:"database"`
+}
+
+// GET /debug/vars
+func handleReadRuntimeStats(db *sql.DB) returnHandler {
+	return func(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+
+		mem := &RuntimeMemoryStats{
+			Alloc:        m.Alloc,
+			TotalAlloc:   m.TotalAlloc,
+			Sys:          m.Sys,
+			HeapInuse:    m.HeapInuse,
+			HeapObjects:  m.HeapObjects,
+			NumGC:        m.NumGC,
+			PauseTotal:   float64(m.PauseTotalNs) / float64(time.Millisecond),
+			GCCPUPercent: m.GCCPUFraction * 100,
+		}
+		if m.LastGC > 0 {
+			t := time.Unix(0, int64(m.LastGC))
+			mem.LastGC = &t
+		}
+
+		dbStats := db.Stats()
+
+		return &handlerResponse{Code: http.StatusOK, Body: &RuntimeStatsResponse{
+			GoVersion:  runtime.Version(),
+			NumCPU:     runtime.NumCPU(),
+			GOMAXPROCS: runtime.GOMAXPROCS(0),
+			Goroutines: runtime.NumGoroutine(),
+			Started:    processStarted,
+			Uptime:     time.Since(processStarted).Seconds(),
+			Panics:     atomic.LoadInt64(&panicCount),
+			Memory:     mem,
+			Database: &RuntimeDatabaseStats{
+				OpenConnections: dbStats.OpenConnections,
+				InUse:           dbStats.InUse,
+				Idle:            dbStats.Idle,
+				WaitCount:       dbStats.WaitCount,
+				WaitDuration:    float64(dbStats.WaitDuration) / float64(time.Millisecond),
+			},
+		}}
+	}
+}
+
+// GET /debug/pprof/
+func handleAuthorizeDebug(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
+	return &handlerResponse{Code: http.StatusOK}
+}
+
+//debugMiddleware serves h if next succeeds, or writes next's error as JSON otherwise.
+//h is served after next's transaction is finished, so long profiles don't hold a database connection
+func debugMiddleware(next returnHandler, h http.Handler) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		resp := next(w, r)
+		if resp.Code != http.StatusOK {
+			return writeJSONResponse(w, r, resp)
+		}
+
+		h.ServeHTTP(w, r)
+
+		return resp
+	}
+}
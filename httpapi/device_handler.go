@@ -13,6 +13,8 @@ import (
 
 // POST /devices
 func handleCreateDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	var req *CreateDeviceRequest
 	d := json.NewDecoder(r.Body)
 
@@ -21,19 +23,19 @@ func handleCreateDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
 	}
 
-	id, err := api.CreateDevice(r.Context(), req.Device)
+	id, err := store.CreateDevice(r.Context(), req.Device)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
 	if req.Note != "" {
-		_, err = api.CreateNoteEvent(r.Context(), id, api.DeviceEventLocation, req.Note)
+		_, err = store.CreateNoteEvent(r.Context(), id, api.DeviceEventLocation, req.Note)
 		if resp := checkAPIError(err); resp != nil {
 			return resp
 		}
 	}
 
-	device, err := api.ReadDevice(r.Context(), id, true)
+	device, err := store.ReadDevice(r.Context(), id, true)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -45,7 +47,9 @@ func handleCreateDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse
 }
 
 // GET /devices/:id
-func handleReadDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+func handleReadDevice(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
@@ -56,7 +60,11 @@ func handleReadDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
 		includeEvents = true
 	}
 
-	device, err := api.ReadDevice(r.Context(), id, includeEvents)
+	if resp := checkAPIError(store.CheckDevicePermission(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	device, err := store.ReadDevice(r.Context(), id, includeEvents)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -64,46 +72,128 @@ func handleReadDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
 		return handleError(http.StatusNotFound, errors.New("Could not find device"))
 	}
 
-	return &handlerResponse{Code: http.StatusOK, Body: device}
+	device.Links, err = store.ReadDeviceLinks(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return handleETag(w, r, device)
 }
 
 // POST /devices/:id
-func handleUpdateDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+func handleUpdateDevice(m api.Mailer) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+		}
+
+		var device *api.Device
+		d := json.NewDecoder(r.Body)
+
+		err = d.Decode(&device)
+		if err != nil || device == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+		}
+
+		if device.ID != id {
+			return handleError(http.StatusBadRequest, fmt.Errorf("device id mismatch: URL: %d, Body: %d", id, device.ID))
+		}
+
+		oldDevice, err := store.ReadDevice(r.Context(), id, false)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+		if oldDevice == nil {
+			return handleError(http.StatusNotFound, errors.New("Could not find device"))
+		}
+
+		err = store.UpdateDevice(r.Context(), device)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		if device.Location != oldDevice.Location {
+			u, err := store.ReadLocationUtilization(r.Context(), device.Location)
+			if resp := checkAPIError(err); resp != nil {
+				return resp
+			}
+			if u != nil && u.OverCapacity() {
+				onCommit(r, func() { notifyCapacity(m, u) })
+			}
+		}
+
+		device, err = store.ReadDevice(r.Context(), device.ID, true)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+		if device == nil {
+			return handleError(http.StatusNotFound, errors.New("Could not find device, but just updated"))
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: device}
+	}
+}
+
+// GET /devices/:id/events/
+func handleReadDeviceEvents(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
 	}
 
-	var device *api.Device
-	d := json.NewDecoder(r.Body)
-
-	err = d.Decode(&device)
-	if err != nil || device == nil {
-		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	if resp := checkAPIError(store.CheckDevicePermission(r.Context(), id)); resp != nil {
+		return resp
 	}
 
-	if device.ID != id {
-		return handleError(http.StatusBadRequest, fmt.Errorf("device id mismatch: URL: %d, Body: %d", id, device.ID))
+	device, err := store.ReadDevice(r.Context(), id, false)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if device == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find device"))
 	}
 
-	err = api.UpdateDevice(r.Context(), device)
+	events, err := store.ReadEvents(r.Context(), id, api.DeviceEventLocation)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
-	device, err = api.ReadDevice(r.Context(), device.ID, true)
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadEventsResponse{Events: events}}
+}
+
+// GET /devices/:id/recommendations/
+func handleReadDeviceRecommendations(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	if resp := checkAPIError(store.CheckDevicePermission(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	recs, err := store.ReadDeviceRecommendations(r.Context(), id)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
-	if device == nil {
-		return handleError(http.StatusNotFound, errors.New("Could not find device, but just updated"))
+	if recs == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find device"))
 	}
 
-	return &handlerResponse{Code: http.StatusOK, Body: device}
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadRecommendationsResponse{Recommendations: recs}}
 }
 
 // POST /devices/:id/notes/
 func handleCreateDeviceNoteEvent(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
@@ -117,12 +207,16 @@ func handleCreateDeviceNoteEvent(_ http.ResponseWriter, r *http.Request) *handle
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
 	}
 
-	_, err = api.CreateNoteEvent(r.Context(), id, api.DeviceEventLocation, note.Note)
+	if resp := checkAPIError(store.CheckDevicePermission(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	_, err = store.CreateNoteEvent(r.Context(), id, api.DeviceEventLocation, note.Note)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
-	device, err := api.ReadDevice(r.Context(), id, true)
+	device, err := store.ReadDevice(r.Context(), id, true)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -135,14 +229,17 @@ func handleCreateDeviceNoteEvent(_ http.ResponseWriter, r *http.Request) *handle
 
 // GET /devices/
 func handleQueryDevice(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	if r.URL.Query().Get("search") != "" {
 		return handleSimpleQueryDevice(w, r)
 	}
 
-	devices, err := api.QueryDevice(r.Context(),
+	devices, err := store.QueryDevice(r.Context(),
 		r.URL.Query().Get("serial_number"),
 		r.URL.Query().Get("manufacturer"),
 		r.URL.Query().Get("model"),
+		r.URL.Query().Get("category"),
 		r.URL.Query().Get("status"),
 		r.URL.Query().Get("location"),
 	)
@@ -150,15 +247,74 @@ func handleQueryDevice(w http.ResponseWriter, r *http.Request) *handlerResponse
 		return resp
 	}
 
+	if r.URL.Query().Get("attribution") == attributionTrue {
+		if resp := checkAPIError(store.ReadDeviceAttributions(r.Context(), devices)); resp != nil {
+			return resp
+		}
+	}
+
 	return &handlerResponse{Code: http.StatusOK, Body: &QueryDeviceResponse{Devices: devices}}
 }
 
 // GET /devices/
 func handleSimpleQueryDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
-	devices, err := api.SimpleQueryDevice(r.Context(), r.URL.Query().Get("search"))
+	store := requestStore(r)
+
+	devices, err := store.SimpleQueryDevice(r.Context(), r.URL.Query().Get("search"))
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
+	if r.URL.Query().Get("attribution") == attributionTrue {
+		if resp := checkAPIError(store.ReadDeviceAttributions(r.Context(), devices)); resp != nil {
+			return resp
+		}
+	}
+
 	return &handlerResponse{Code: http.StatusOK, Body: &QueryDeviceResponse{Devices: devices}}
 }
+
+// DELETE /devices/:id
+func handleDeleteDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	device, err := store.ReadDevice(r.Context(), id, false)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if device == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find device"))
+	}
+
+	if resp := checkAPIError(store.DeleteDevice(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: device}
+}
+
+// POST /devices/:id/restore
+func handleRestoreDevice(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	if resp := checkAPIError(store.RestoreDevice(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	device, err := store.ReadDevice(r.Context(), id, false)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: device}
+}
@@ -8,10 +8,40 @@ import (
 )
 
 // ErrorResponse represents an HTTP error. If the error is 409 Conflict, the DuplicateID field will be populated.
+// If the error is 400 Bad Request, Message will describe the problem and Fields will be populated if it was caused by a specific field.
 type ErrorResponse struct {
-	Code        int    `json:"code"`
-	Error       string `json:"error"`
-	DuplicateID int64  `json:"duplicate_id,omitempty"`
+	Code        int               `json:"code"`
+	Error       string            `json:"error"`
+	Message     string            `json:"message,omitempty"`
+	Fields      []*api.FieldError `json:"fields,omitempty"`
+	DuplicateID int64             `json:"duplicate_id,omitempty"`
+}
+
+// ErrorResponseV2 is the APIVersion2 format of ErrorResponse. The error is nested so it can't be confused with a successful response body.
+type ErrorResponseV2 struct {
+	Error *ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an HTTP error in an ErrorResponseV2
+type ErrorDetail struct {
+	Status      int               `json:"status"`
+	Title       string            `json:"title"`
+	Message     string            `json:"message,omitempty"`
+	Fields      []*api.FieldError `json:"fields,omitempty"`
+	DuplicateID int64             `json:"duplicate_id,omitempty"`
+}
+
+func (e *ErrorResponse) forVersion(v APIVersion) interface{} {
+	if v < APIVersion2 {
+		return e
+	}
+	return &ErrorResponseV2{Error: &ErrorDetail{
+		Status:      e.Code,
+		Title:       e.Error,
+		Message:     e.Message,
+		Fields:      e.Fields,
+		DuplicateID: e.DuplicateID,
+	}}
 }
 
 // handleError returns a handlerResponse response for the given code
@@ -19,6 +49,19 @@ func handleError(code int, err error) *handlerResponse {
 	return &handlerResponse{Code: code, Body: &ErrorResponse{Code: code, Error: http.StatusText(code)}, Err: err}
 }
 
+// handleUserError returns a 400 handlerResponse describing the given api.Error
+func handleUserError(e *api.Error) *handlerResponse {
+	body := &ErrorResponse{Code: http.StatusBadRequest, Error: http.StatusText(http.StatusBadRequest)}
+	if e.Err != nil {
+		body.Message = e.Err.Error()
+		var fe *api.FieldError
+		if errors.As(e.Err, &fe) {
+			body.Fields = []*api.FieldError{fe}
+		}
+	}
+	return &handlerResponse{Code: http.StatusBadRequest, Body: body, Err: e}
+}
+
 // notFoundHandler returns a 401 handlerResponse
 func notFoundHandler(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
 	return handleError(http.StatusNotFound, errors.New("Could not find handler"))
@@ -34,7 +77,9 @@ func checkAPIError(err error) *handlerResponse {
 	if e.Type == api.ErrorTypeServer {
 		return handleError(http.StatusInternalServerError, err)
 	} else if e.Type == api.ErrorTypeUser {
-		return handleError(http.StatusBadRequest, err)
+		return handleUserError(e)
+	} else if e.Type == api.ErrorTypeForbidden {
+		return handleError(http.StatusForbidden, err)
 	} else {
 		return &handlerResponse{Code: http.StatusConflict, Body: &ErrorResponse{
 			Code:        http.StatusConflict,
@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+//etag returns a strong ETag for the JSON encoding of the given body, so it changes whenever any field in the response changes
+func etag(body interface{}) (string, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+//etagMatches returns true if the given If-None-Match header value matches tag
+func etagMatches(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+//handleETag sets the ETag header for body and returns a 304 handlerResponse if the request's If-None-Match header matches it.
+//Otherwise it returns a 200 handlerResponse for body
+func handleETag(w http.ResponseWriter, r *http.Request, body interface{}) *handlerResponse {
+	tag, err := etag(body)
+	if err != nil {
+		//serve the response without an ETag; the error will surface when the body is encoded
+		return &handlerResponse{Code: http.StatusOK, Body: body}
+	}
+
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, tag) {
+		return &handlerResponse{Code: http.StatusNotModified}
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: body}
+}
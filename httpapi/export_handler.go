@@ -0,0 +1,256 @@
+package httpapi
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//Event export formats
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+)
+
+//eventExport is a validated event export request. Zero values match all Events
+type eventExport struct {
+	Format   string
+	DeviceID int64
+	Since    time.Time
+	Until    time.Time
+}
+
+// GET /events/export
+// GET /devices/:id/events/export
+func handleAuthorizeEventExport(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	q := r.URL.Query()
+
+	export := &eventExport{Format: exportFormatJSON}
+
+	if v := q.Get("format"); v != "" {
+		if v != exportFormatJSON && v != exportFormatCSV {
+			return handleError(http.StatusBadRequest, fmt.Errorf("format (%s) must be %s or %s", v, exportFormatJSON, exportFormatCSV))
+		}
+		export.Format = v
+	}
+
+	if v, ok := mux.Vars(r)["id"]; ok {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+		}
+		export.DeviceID = id
+	}
+
+	if v := q.Get("since"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode since: %v", err))
+		}
+		export.Since = t
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode until: %v", err))
+		}
+		//until is inclusive
+		export.Until = t.AddDate(0, 0, 1)
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: export}
+}
+
+//eventExportWriter writes ExportedEvents in an export format
+type eventExportWriter interface {
+	Write(*api.ExportedEvent) error
+	Close() error
+}
+
+type jsonEventExportWriter struct {
+	w     http.ResponseWriter
+	wrote bool
+}
+
+func (j *jsonEventExportWriter) Write(e *api.ExportedEvent) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	prefix := ","
+	if !j.wrote {
+		prefix = `{"events":[`
+		j.wrote = true
+	}
+
+	_, err = fmt.Fprintf(j.w, "%s%s", prefix, buf)
+	return err
+}
+
+func (j *jsonEventExportWriter) Close() error {
+	if !j.wrote {
+		_, err := fmt.Fprint(j.w, "{\"events\":[]}\n")
+		return err
+	}
+	_, err := fmt.Fprint(j.w, "]}\n")
+	return err
+}
+
+type csvEventExportWriter struct {
+	w     *csv.Writer
+	wrote bool
+}
+
+var csvEventExportHeader = []string{"id", "date", "device_id", "serial_number", "user_id", "user_name", "type", "content", "source", "source_conversation_id"}
+
+func (c *csvEventExportWriter) Write(e *api.ExportedEvent) error {
+	if !c.wrote {
+		if err := c.w.Write(csvEventExportHeader); err != nil {
+			return err
+		}
+		c.wrote = true
+	}
+
+	var userID string
+	if e.UserID != 0 {
+		userID = strconv.FormatInt(e.UserID, 10)
+	}
+
+	var source, conversationID string
+	if e.Source != nil {
+		source, conversationID = e.Source.Type, e.Source.ConversationID
+	}
+
+	if err := c.w.Write([]string{
+		strconv.FormatInt(e.ID, 10),
+		e.Date.Format(time.RFC3339),
+		strconv.FormatInt(e.DeviceID, 10),
+		e.SerialNumber,
+		userID,
+		e.UserName,
+		e.Type,
+		string(e.Content),
+		source,
+		conversationID,
+	}); err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvEventExportWriter) Close() error {
+	if !c.wrote {
+		if err := c.w.Write(csvEventExportHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+//clearWriteDeadline removes the server's write timeout for the response, or returns an error if the ResponseWriter doesn't support it.
+//This is what http.ResponseController does (Go 1.20): wrapped ResponseWriters are unwrapped until one can set the deadline
+func clearWriteDeadline(w http.ResponseWriter) error {
+	for {
+		switch rw := w.(type) {
+		case interface{ SetWriteDeadline(time.Time) error }:
+			return rw.SetWriteDeadline(time.Time{})
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return errors.New("ResponseWriter doesn't support write deadlines")
+		}
+	}
+}
+
+//exportMiddleware streams the Events matching the *eventExport returned by next, or writes next's error as JSON otherwise.
+//The export is read in its own read-only transaction (from replica, if not nil) after next's transaction is finished,
+//so it isn't limited by the request timeout, and the server's write timeout is cleared so large exports aren't cut off.
+//Events are written as they're read instead of being buffered
+func exportMiddleware(next returnHandler, db, replica *sql.DB) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		resp := next(w, r)
+
+		export, ok := resp.Body.(*eventExport)
+		if !ok {
+			return writeJSONResponse(w, r, resp)
+		}
+
+		read := db
+		if replica != nil {
+			read = replica
+		}
+
+		tx, err := read.BeginTx(r.Context(), &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			e := handleError(http.StatusInternalServerError, fmt.Errorf("Could not begin transaction: %v", err))
+			e.User = resp.User
+			return writeJSONResponse(w, r, e)
+		}
+		defer tx.Rollback()
+
+		store := api.NewReadOnlyTxStore(tx, read, db)
+
+		if err = clearWriteDeadline(w); err != nil {
+			log.Printf("Could not clear write deadline for event export; it may be cut off by the write timeout: %v\n", err)
+		}
+
+		//headers are written with the first Event, so errors before then can still be returned as JSON
+		var ew eventExportWriter
+		start := func() {
+			filename := "events"
+			if export.DeviceID != 0 {
+				filename = fmt.Sprintf("device-%d-events", export.DeviceID)
+			}
+
+			if export.Format == exportFormatCSV {
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				ew = &csvEventExportWriter{w: csv.NewWriter(w)}
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+				ew = &jsonEventExportWriter{w: w}
+			}
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, export.Format))
+			w.WriteHeader(http.StatusOK)
+		}
+
+		err = store.ExportEvents(r.Context(), export.DeviceID, export.Since, export.Until, func(e *api.ExportedEvent) error {
+			if ew == nil {
+				start()
+			}
+			return ew.Write(e)
+		})
+
+		if err != nil {
+			//the response has already started, so the error can only be logged
+			if ew != nil {
+				resp.Err = fmt.Errorf("Could not write event export: %v", err)
+				return resp
+			}
+			e := checkAPIError(err)
+			e.User = resp.User
+			return writeJSONResponse(w, r, e)
+		}
+
+		if ew == nil {
+			start()
+		}
+		if err = ew.Close(); err != nil {
+			resp.Err = fmt.Errorf("Could not write event export: %v", err)
+		}
+
+		return resp
+	}
+}
@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+// POST /glossary/
+func handleCreateGlossaryTerm(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var term *api.GlossaryTerm
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&term)
+	if err != nil || term == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	id, err := store.CreateGlossaryTerm(r.Context(), term)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	term, err = store.ReadGlossaryTerm(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if term == nil {
+		return handleError(http.StatusInternalServerError, errors.New("Could not find term, but just created"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: term}
+}
+
+// GET /glossary/
+func handleReadGlossaryTerms(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	terms, err := store.ReadGlossaryTerms(r.Context(), r.URL.Query().Get("q"))
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadGlossaryTermsResponse{Terms: terms}}
+}
+
+// GET /glossary/:id
+func handleReadGlossaryTerm(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	term, err := store.ReadGlossaryTerm(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if term == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find term"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: term}
+}
+
+// POST /glossary/:id
+func handleUpdateGlossaryTerm(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var term *api.GlossaryTerm
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&term)
+	if err != nil || term == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	if term.ID != id {
+		return handleError(http.StatusBadRequest, fmt.Errorf("term id mismatch: URL: %d, Body: %d", id, term.ID))
+	}
+
+	err = store.UpdateGlossaryTerm(r.Context(), term)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	term, err = store.ReadGlossaryTerm(r.Context(), term.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if term == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find term, but just updated"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: term}
+}
+
+// DELETE /glossary/:id
+func handleDeleteGlossaryTerm(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	term, err := store.ReadGlossaryTerm(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if term == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find term"))
+	}
+
+	err = store.DeleteGlossaryTerm(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: term}
+}
@@ -0,0 +1,163 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const grantExpiryInterval = time.Minute
+
+//expireGrants records expired Grants every grantExpiryInterval. Grants stop applying at their expiry either way;
+//this only records the expiry Events. It returns once ctx is done
+func expireGrants(ctx context.Context, db *sql.DB, c api.Cache) {
+	for {
+		err := withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+			_, err := store.ExpireGrants(ctx)
+			return err
+		})
+		if err != nil {
+			log.Printf("Could not expire grants: %v\n", err)
+		}
+		if !sleepContext(ctx, grantExpiryInterval) {
+			return
+		}
+	}
+}
+
+//readUserGrant reads the Grant with the user id and grant id in the request URL
+func readUserGrant(r *http.Request) (*api.Grant, *handlerResponse) {
+	store := requestStore(r)
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	grantID, err := strconv.ParseInt(mux.Vars(r)["grant_id"], 10, 64)
+	if err != nil {
+		return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode grant id: %v", err))
+	}
+
+	grant, err := store.ReadGrant(r.Context(), grantID)
+	if resp := checkAPIError(err); resp != nil {
+		return nil, resp
+	}
+	if grant == nil || grant.UserID != userID {
+		return nil, handleError(http.StatusNotFound, errors.New("Could not find grant"))
+	}
+
+	return grant, nil
+}
+
+// GET /users/:id/grants/
+func handleReadUserGrants(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	user, err := store.ReadUser(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if user == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find user"))
+	}
+
+	grants, err := store.ReadUserGrants(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadGrantsResponse{Grants: grants}}
+}
+
+// POST /users/:id/grants/
+func handleCreateUserGrant(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var grant *api.Grant
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&grant)
+	if err != nil || grant == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	user, err := store.ReadUser(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if user == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find user"))
+	}
+
+	grant.UserID = id
+
+	grantID, err := store.CreateGrant(r.Context(), grant)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	grant, err = store.ReadGrant(r.Context(), grantID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: grant}
+}
+
+// DELETE /users/:id/grants/:grant_id
+func handleRevokeUserGrant(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	grant, resp := readUserGrant(r)
+	if resp != nil {
+		return resp
+	}
+
+	if resp = checkAPIError(store.RevokeGrant(r.Context(), grant.ID)); resp != nil {
+		return resp
+	}
+
+	grant, err := store.ReadGrant(r.Context(), grant.ID)
+	if resp = checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: grant}
+}
+
+// GET /users/:id/grants/:grant_id/events/
+func handleReadUserGrantEvents(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	grant, resp := readUserGrant(r)
+	if resp != nil {
+		return resp
+	}
+
+	events, err := store.ReadEvents(r.Context(), grant.ID, api.GrantEventLocation)
+	if resp = checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadEventsResponse{Events: events}}
+}
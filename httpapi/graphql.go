@@ -0,0 +1,580 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//graphQLMaxDepth is the deepest selection set (or list value) allowed in a query, and graphQLMaxFields the most fields.
+//The deepest useful query is devices { events { user { ... } } }, and each field may run a query, so both are kept small
+const (
+	graphQLMaxDepth  = 5
+	graphQLMaxFields = 100
+)
+
+//graphQLField is a field selected in a GraphQL query. Arguments have variables already substituted
+type graphQLField struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	selections []*graphQLField
+}
+
+//key returns the name of the field in the response
+func (f *graphQLField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+//graphQLParser parses the subset of GraphQL used for reads: a single query operation with fields, aliases, arguments, and variables.
+//Fragments and directives are not supported
+type graphQLParser struct {
+	src       string
+	pos       int
+	fields    int
+	variables map[string]interface{}
+}
+
+//parseGraphQLQuery parses the given query with the given variables and returns its root selection set
+func parseGraphQLQuery(query string, variables map[string]interface{}) ([]*graphQLField, error) {
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	p := &graphQLParser{src: query, variables: variables}
+
+	p.skipIgnored()
+	if p.peek() != '{' {
+		switch name := p.name(); name {
+		case "query":
+		case "mutation", "subscription":
+			return nil, fmt.Errorf("%s operations are not supported", name)
+		case "fragment":
+			return nil, errors.New("Fragments are not supported")
+		default:
+			return nil, p.errorf("expected query")
+		}
+
+		p.skipIgnored()
+		if p.peek() != '(' && p.peek() != '{' {
+			if p.name() == "" {
+				return nil, p.errorf("expected operation name")
+			}
+		}
+
+		p.skipIgnored()
+		if p.peek() == '(' {
+			if err := p.variableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fields, err := p.selectionSet(1)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipIgnored()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("only one operation is supported")
+	}
+
+	return fields, nil
+}
+
+func (p *graphQLParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("Syntax error at position %d: %s", p.pos, fmt.Sprintf(format, a...))
+}
+
+//skipIgnored skips whitespace, commas, and comments
+func (p *graphQLParser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+//peek returns the next byte, or 0 at the end of the query
+func (p *graphQLParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+//expect skips ignored characters and consumes c, or returns an error
+func (p *graphQLParser) expect(c byte) error {
+	p.skipIgnored()
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+//name consumes and returns a name, or returns an empty string if there isn't one
+func (p *graphQLParser) name() string {
+	p.skipIgnored()
+	start := p.pos
+	if !isNameStart(p.peek()) {
+		return ""
+	}
+	for p.pos < len(p.src) && (isNameStart(p.src[p.pos]) || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+//variableDefinitions parses variable definitions, applying default values (or null) for variables that weren't given
+func (p *graphQLParser) variableDefinitions() error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+
+	for {
+		p.skipIgnored()
+		if p.peek() == ')' {
+			p.pos++
+			return nil
+		}
+
+		if err := p.expect('$'); err != nil {
+			return err
+		}
+		name := p.name()
+		if name == "" {
+			return p.errorf("expected variable name")
+		}
+		if err := p.expect(':'); err != nil {
+			return err
+		}
+		if err := p.typeRef(1); err != nil {
+			return err
+		}
+
+		p.skipIgnored()
+		if p.peek() == '=' {
+			p.pos++
+			v, err := p.value(true, 1)
+			if err != nil {
+				return err
+			}
+			if _, ok := p.variables[name]; !ok {
+				p.variables[name] = v
+			}
+		}
+
+		//declared variables that weren't given and have no default are null
+		if _, ok := p.variables[name]; !ok {
+			p.variables[name] = nil
+		}
+	}
+}
+
+//typeRef parses and discards a type reference at the given list depth. Argument types are checked by the resolvers
+func (p *graphQLParser) typeRef(depth int) error {
+	if depth > graphQLMaxDepth {
+		return fmt.Errorf("Type is deeper than %d levels", graphQLMaxDepth)
+	}
+
+	p.skipIgnored()
+	if p.peek() == '[' {
+		p.pos++
+		if err := p.typeRef(depth + 1); err != nil {
+			return err
+		}
+		if err := p.expect(']'); err != nil {
+			return err
+		}
+	} else if p.name() == "" {
+		return p.errorf("expected type")
+	}
+
+	p.skipIgnored()
+	if p.peek() == '!' {
+		p.pos++
+	}
+	return nil
+}
+
+//selectionSet parses a selection set at the given depth
+func (p *graphQLParser) selectionSet(depth int) ([]*graphQLField, error) {
+	if depth > graphQLMaxDepth {
+		return nil, fmt.Errorf("Query is deeper than %d levels", graphQLMaxDepth)
+	}
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	var fields []*graphQLField
+	for {
+		p.skipIgnored()
+		switch p.peek() {
+		case '}':
+			p.pos++
+			if len(fields) == 0 {
+				return nil, p.errorf("selection set cannot be empty")
+			}
+			return fields, nil
+		case '.':
+			return nil, errors.New("Fragments are not supported")
+		case '@':
+			return nil, errors.New("Directives are not supported")
+		}
+
+		f, err := p.field(depth)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+}
+
+//field parses a field with an optional alias, arguments, and selection set
+func (p *graphQLParser) field(depth int) (*graphQLField, error) {
+	f := &graphQLField{name: p.name()}
+	if f.name == "" {
+		return nil, p.errorf("expected field name")
+	}
+
+	if p.fields++; p.fields > graphQLMaxFields {
+		return nil, fmt.Errorf("Query has more than %d fields", graphQLMaxFields)
+	}
+
+	p.skipIgnored()
+	if p.peek() == ':' {
+		p.pos++
+		f.alias = f.name
+		if f.name = p.name(); f.name == "" {
+			return nil, p.errorf("expected field name")
+		}
+	}
+
+	p.skipIgnored()
+	if p.peek() == '(' {
+		p.pos++
+		f.args = make(map[string]interface{})
+		for {
+			p.skipIgnored()
+			if p.peek() == ')' {
+				p.pos++
+				break
+			}
+			name := p.name()
+			if name == "" {
+				return nil, p.errorf("expected argument name")
+			}
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			v, err := p.value(false, 1)
+			if err != nil {
+				return nil, err
+			}
+			f.args[name] = v
+		}
+	}
+
+	p.skipIgnored()
+	if p.peek() == '@' {
+		return nil, errors.New("Directives are not supported")
+	}
+	if p.peek() == '{' {
+		sel, err := p.selectionSet(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		f.selections = sel
+	}
+
+	return f, nil
+}
+
+//value parses a value at the given list depth. Variables are substituted unless constant is true
+func (p *graphQLParser) value(constant bool, depth int) (interface{}, error) {
+	if depth > graphQLMaxDepth {
+		return nil, fmt.Errorf("Value is deeper than %d levels", graphQLMaxDepth)
+	}
+
+	p.skipIgnored()
+	switch c := p.peek(); {
+	case c == '$':
+		if constant {
+			return nil, p.errorf("variables are not allowed here")
+		}
+		p.pos++
+		name := p.name()
+		v, ok := p.variables[name]
+		if !ok {
+			return nil, fmt.Errorf("Variable $%s is not defined", name)
+		}
+		return v, nil
+	case c == '"':
+		return p.stringValue()
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		if i, err := strconv.ParseInt(p.src[start:p.pos], 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return f, nil
+	case c == '[':
+		p.pos++
+		list := []interface{}{}
+		for {
+			p.skipIgnored()
+			if p.peek() == ']' {
+				p.pos++
+				return list, nil
+			}
+			v, err := p.value(constant, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case c == '{':
+		return nil, errors.New("Input objects are not supported")
+	case isNameStart(c):
+		switch name := p.name(); name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			//enum values are treated as strings
+			return name, nil
+		}
+	}
+
+	return nil, p.errorf("expected value")
+}
+
+//stringValue parses a double quoted string. Block strings are not supported
+func (p *graphQLParser) stringValue() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '"':
+			p.pos++
+			var s string
+			if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+				return "", p.errorf("invalid string: %v", err)
+			}
+			return s, nil
+		}
+		p.pos++
+	}
+	return "", p.errorf("unterminated string")
+}
+
+//graphQLObject is an object type in the GraphQL schema
+type graphQLObject struct {
+	name string
+	//scalars are fields read from the object's JSON encoding
+	scalars map[string]bool
+	//objects are fields resolved to other objects
+	objects map[string]*graphQLRelation
+}
+
+//graphQLResolver resolves a field of parent to an object, a slice of objects, or nil
+type graphQLResolver func(ctx context.Context, x *graphQLExecutor, parent interface{}, args map[string]interface{}) (interface{}, error)
+
+//graphQLPrefetcher loads a field for all parents in a list at once so its resolver doesn't query once per parent
+type graphQLPrefetcher func(ctx context.Context, x *graphQLExecutor, parents []interface{}, args map[string]interface{}) error
+
+//graphQLRelation is a field resolved to another object type. prefetch is optional
+type graphQLRelation struct {
+	typ      *graphQLObject
+	resolve  graphQLResolver
+	prefetch graphQLPrefetcher
+}
+
+//graphQLResult is a GraphQL result object. Fields are encoded in the order they were selected
+type graphQLResult []*graphQLResultField
+
+type graphQLResultField struct {
+	key   string
+	value interface{}
+}
+
+//MarshalJSON implements json.Marshaler
+func (r graphQLResult) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+//graphQLExecutor executes a query with the request TxStore. It memoizes Users since many Events share the same User,
+//and holds Device Events prefetched for lists of Devices
+type graphQLExecutor struct {
+	store  *api.TxStore
+	users  map[int64]interface{}
+	events map[int64][]*api.Event
+}
+
+//execute resolves the given selections on obj, which has the given type
+func (x *graphQLExecutor) execute(ctx context.Context, typ *graphQLObject, obj interface{}, selections []*graphQLField) (graphQLResult, error) {
+	var raw map[string]json.RawMessage
+	result := make(graphQLResult, 0, len(selections))
+
+	for _, sel := range selections {
+		var value interface{}
+
+		if sel.name == "__typename" {
+			value = typ.name
+		} else if rel, ok := typ.objects[sel.name]; ok {
+			if len(sel.selections) == 0 {
+				return nil, fmt.Errorf("Field %q of type %s must have a selection of subfields", sel.name, rel.typ.name)
+			}
+			v, err := rel.resolve(ctx, x, obj, sel.args)
+			if err != nil {
+				return nil, err
+			}
+			if value, err = x.executeValue(ctx, rel.typ, v, sel.selections); err != nil {
+				return nil, err
+			}
+		} else if typ.scalars[sel.name] {
+			if len(sel.selections) != 0 {
+				return nil, fmt.Errorf("Field %q must not have a selection since it is a scalar", sel.name)
+			}
+			if raw == nil {
+				buf, err := json.Marshal(obj)
+				if err != nil {
+					return nil, fmt.Errorf("Could not encode %s: %v", typ.name, err)
+				}
+				if err = json.Unmarshal(buf, &raw); err != nil {
+					return nil, fmt.Errorf("Could not decode %s: %v", typ.name, err)
+				}
+			}
+			if v, ok := raw[sel.name]; ok {
+				value = v
+			}
+		} else {
+			return nil, fmt.Errorf("Cannot query field %q on type %s", sel.name, typ.name)
+		}
+
+		result = append(result, &graphQLResultField{key: sel.key(), value: value})
+	}
+
+	return result, nil
+}
+
+//executeValue executes selections on v, which is nil, an object, or a slice of objects
+func (x *graphQLExecutor) executeValue(ctx context.Context, typ *graphQLObject, v interface{}, selections []*graphQLField) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || ((rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Slice) && rv.IsNil()) {
+		return nil, nil
+	}
+
+	if rv.Kind() != reflect.Slice {
+		return x.execute(ctx, typ, v, selections)
+	}
+
+	parents := make([]interface{}, rv.Len())
+	for i := range parents {
+		parents[i] = rv.Index(i).Interface()
+	}
+
+	for _, sel := range selections {
+		if rel, ok := typ.objects[sel.name]; ok && rel.prefetch != nil {
+			if err := rel.prefetch(ctx, x, parents, sel.args); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	list := make([]graphQLResult, len(parents))
+	for i := range list {
+		r, err := x.execute(ctx, typ, parents[i], selections)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = r
+	}
+	return list, nil
+}
+
+//graphQLInt returns the named integer argument. IDs may also be given as strings
+func graphQLInt(args map[string]interface{}, name string) (int64, bool, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return 0, false, nil
+	case int64:
+		return v, true, nil
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), true, nil
+		}
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("Argument %q must be an integer", name)
+}
+
+//graphQLString returns the named string argument
+func graphQLString(args map[string]interface{}, name string) (string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("Argument %q must be a string", name)
+}
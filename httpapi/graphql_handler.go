@@ -0,0 +1,246 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+var graphQLCategory = &graphQLObject{
+	name:    "Category",
+	scalars: map[string]bool{"id": true, "name": true},
+}
+
+var graphQLModel = &graphQLObject{
+	name:    "Model",
+	scalars: map[string]bool{"id": true, "manufacturer": true, "model": true, "category_id": true, "eol_date": true, "eos_date": true},
+	objects: map[string]*graphQLRelation{
+		"category": {typ: graphQLCategory, resolve: func(_ context.Context, x *graphQLExecutor, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(*api.Model).Category, nil
+		}},
+	},
+}
+
+var graphQLUser = &graphQLObject{
+	name:    "User",
+	scalars: map[string]bool{"id": true, "email": true, "name": true, "role": true, "disabled": true, "totp_enabled": true, "last_login": true, "last_login_ip": true, "last_activity": true},
+}
+
+var graphQLEvent = &graphQLObject{
+	name:    "Event",
+	scalars: map[string]bool{"date": true, "user_id": true, "type": true, "content": true},
+	objects: map[string]*graphQLRelation{
+		"user": {typ: graphQLUser, resolve: func(ctx context.Context, x *graphQLExecutor, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return x.readUser(ctx, parent.(*api.Event).UserID)
+		}},
+	},
+}
+
+var graphQLDevice = &graphQLObject{
+	name:    "Device",
+	scalars: map[string]bool{"id": true, "serial_number": true, "asset_tag": true, "model_id": true, "status": true, "location": true, "last_event_at": true},
+	objects: map[string]*graphQLRelation{
+		"model": {typ: graphQLModel, resolve: func(ctx context.Context, x *graphQLExecutor, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			d := parent.(*api.Device)
+			id := d.ModelID
+			if d.Model != nil && d.Model.ID != 0 {
+				id = d.Model.ID
+			}
+			return x.store.ReadModel(ctx, id)
+		}},
+		"events": {typ: graphQLEvent, resolve: resolveGraphQLDeviceEvents, prefetch: prefetchGraphQLDeviceEvents},
+	},
+}
+
+//graphQLQuery is the root query type
+var graphQLQuery = &graphQLObject{
+	name: "Query",
+	objects: map[string]*graphQLRelation{
+		"device":  {typ: graphQLDevice, resolve: resolveGraphQLDevice},
+		"devices": {typ: graphQLDevice, resolve: resolveGraphQLDevices},
+		"model": {typ: graphQLModel, resolve: func(ctx context.Context, x *graphQLExecutor, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			id, ok, err := graphQLInt(args, "id")
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, errors.New("Argument \"id\" is required")
+			}
+			return x.store.ReadModel(ctx, id)
+		}},
+		"models": {typ: graphQLModel, resolve: func(ctx context.Context, x *graphQLExecutor, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			var query [3]string
+			for i, name := range []string{"manufacturer", "model", "category"} {
+				var err error
+				if query[i], err = graphQLString(args, name); err != nil {
+					return nil, err
+				}
+			}
+			return x.store.QueryModel(ctx, query[0], query[1], query[2])
+		}},
+		"user": {typ: graphQLUser, resolve: func(ctx context.Context, x *graphQLExecutor, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			id, ok, err := graphQLInt(args, "id")
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, errors.New("Argument \"id\" is required")
+			}
+			return x.readUser(ctx, id)
+		}},
+	},
+}
+
+//resolveGraphQLDevice resolves device(id:) or device(serial_number:)
+func resolveGraphQLDevice(ctx context.Context, x *graphQLExecutor, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	id, ok, err := graphQLInt(args, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		if err = x.store.CheckDevicePermission(ctx, id); err != nil {
+			return nil, err
+		}
+		device, err := x.store.ReadDevice(ctx, id, false)
+		if err != nil || device == nil {
+			return nil, err
+		}
+		return device, nil
+	}
+
+	serial, err := graphQLString(args, "serial_number")
+	if err != nil {
+		return nil, err
+	}
+	if serial == "" {
+		return nil, errors.New("Argument \"id\" or \"serial_number\" is required")
+	}
+
+	device, err := x.store.ReadDeviceBySerialNumber(ctx, serial, false)
+	if err != nil || device == nil || device.DeletedAt != nil {
+		return nil, err
+	}
+	if err = x.store.CheckLocationPermission(ctx, device.Location); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+//resolveGraphQLDevices resolves devices with the same filters as GET /devices/
+func resolveGraphQLDevices(ctx context.Context, x *graphQLExecutor, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	search, err := graphQLString(args, "search")
+	if err != nil {
+		return nil, err
+	}
+	if search != "" {
+		return x.store.SimpleQueryDevice(ctx, search)
+	}
+
+	var query [6]string
+	for i, name := range []string{"serial_number", "manufacturer", "model", "category", "status", "location"} {
+		if query[i], err = graphQLString(args, name); err != nil {
+			return nil, err
+		}
+	}
+	return x.store.QueryDevice(ctx, query[0], query[1], query[2], query[3], query[4], query[5])
+}
+
+//resolveGraphQLDeviceEvents resolves a Device's events, using prefetched Events if they exist
+func resolveGraphQLDeviceEvents(ctx context.Context, x *graphQLExecutor, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+	id := parent.(*api.Device).ID
+	if events, ok := x.events[id]; ok {
+		return events, nil
+	}
+	return x.store.ReadEvents(ctx, id, api.DeviceEventLocation)
+}
+
+//prefetchGraphQLDeviceEvents reads the events for a list of Devices in one query
+func prefetchGraphQLDeviceEvents(ctx context.Context, x *graphQLExecutor, parents []interface{}, _ map[string]interface{}) error {
+	var ids []int64
+	for _, p := range parents {
+		id := p.(*api.Device).ID
+		if _, ok := x.events[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	events, err := x.store.ReadEventsByIDs(ctx, ids, api.DeviceEventLocation)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		x.events[id] = events[id]
+	}
+	return nil
+}
+
+//readUser returns the User with the given id, or nil if it doesn't exist
+func (x *graphQLExecutor) readUser(ctx context.Context, id int64) (interface{}, error) {
+	if u, ok := x.users[id]; ok {
+		return u, nil
+	}
+
+	user, err := x.store.ReadUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var u interface{}
+	if user != nil {
+		//only admins and the user can see where they logged in from
+		if self := ctx.Value(api.UserKey).(*api.User); !self.IsAdmin() && self.ID != user.ID {
+			user.LastLoginIP = ""
+		}
+		u = user
+	}
+
+	x.users[id] = u
+	return u, nil
+}
+
+//graphQLErrorResponse returns a handlerResponse for an error returned while parsing or executing a query
+func graphQLErrorResponse(err error) *handlerResponse {
+	if e, ok := err.(*api.Error); ok {
+		return checkAPIError(e)
+	}
+	return handleUserError(&api.Error{Description: "Could not execute query", Type: api.ErrorTypeUser, Err: err})
+}
+
+// GET /graphql
+// POST /graphql
+func handleGraphQL(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	var req *GraphQLRequest
+
+	if r.Method == http.MethodGet {
+		req = &GraphQLRequest{Query: r.URL.Query().Get("query")}
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &(req.Variables)); err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode variables: %v", err))
+			}
+		}
+	} else {
+		d := json.NewDecoder(r.Body)
+		if err := d.Decode(&req); err != nil || req == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+		}
+	}
+
+	selections, err := parseGraphQLQuery(req.Query, req.Variables)
+	if err != nil {
+		return graphQLErrorResponse(err)
+	}
+
+	x := &graphQLExecutor{store: requestStore(r), users: make(map[int64]interface{}), events: make(map[int64][]*api.Event)}
+	data, err := x.execute(r.Context(), graphQLQuery, nil, selections)
+	if err != nil {
+		return graphQLErrorResponse(err)
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &GraphQLResponse{Data: data}}
+}
@@ -0,0 +1,207 @@
+package httpapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//fieldTree returns a comparable representation of fields: key, name, args, and nested selections
+func fieldTree(fields []*graphQLField) []interface{} {
+	var tree []interface{}
+	for _, f := range fields {
+		node := []interface{}{f.key(), f.name}
+		if f.args != nil {
+			node = append(node, f.args)
+		}
+		if f.selections != nil {
+			node = append(node, fieldTree(f.selections))
+		}
+		tree = append(tree, node)
+	}
+	return tree
+}
+
+func TestParseGraphQLQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      []interface{}
+	}{
+		{
+			name:  "shorthand",
+			query: `{ device(id: 1) { id serial_number } }`,
+			want: []interface{}{
+				[]interface{}{"device", "device", map[string]interface{}{"id": int64(1)}, []interface{}{
+					[]interface{}{"id", "id"},
+					[]interface{}{"serial_number", "serial_number"},
+				}},
+			},
+		},
+		{
+			name: "named with comments and commas",
+			query: `query Device {
+				# a comment
+				device(id: 1,) { id, },
+			}`,
+			want: []interface{}{
+				[]interface{}{"device", "device", map[string]interface{}{"id": int64(1)}, []interface{}{
+					[]interface{}{"id", "id"},
+				}},
+			},
+		},
+		{
+			name:  "aliases",
+			query: `{ a: device(id: 1) { id } b: device(serial_number: "X1") { sn: serial_number } }`,
+			want: []interface{}{
+				[]interface{}{"a", "device", map[string]interface{}{"id": int64(1)}, []interface{}{
+					[]interface{}{"id", "id"},
+				}},
+				[]interface{}{"b", "device", map[string]interface{}{"serial_number": "X1"}, []interface{}{
+					[]interface{}{"sn", "serial_number"},
+				}},
+			},
+		},
+		{
+			name:      "variables and defaults",
+			query:     `query ($id: ID!, $status: String = "Available", $ids: [Int!]) { device(id: $id) { id } devices(status: $status, ids: $ids) { id } }`,
+			variables: map[string]interface{}{"id": "5"},
+			want: []interface{}{
+				[]interface{}{"device", "device", map[string]interface{}{"id": "5"}, []interface{}{
+					[]interface{}{"id", "id"},
+				}},
+				[]interface{}{"devices", "devices", map[string]interface{}{"status": "Available", "ids": nil}, []interface{}{
+					[]interface{}{"id", "id"},
+				}},
+			},
+		},
+		{
+			name:      "given variables override defaults",
+			query:     `query ($status: String = "Available") { devices(status: $status) { id } }`,
+			variables: map[string]interface{}{"status": "Broken"},
+			want: []interface{}{
+				[]interface{}{"devices", "devices", map[string]interface{}{"status": "Broken"}, []interface{}{
+					[]interface{}{"id", "id"},
+				}},
+			},
+		},
+		{
+			name:  "values",
+			query: `{ f(s: "a\"bé\n", i: -12, f: 1.5e2, t: true, n: null, e: ENUM, l: [1, "x", [false]]) { id } }`,
+			want: []interface{}{
+				[]interface{}{"f", "f", map[string]interface{}{
+					"s": "a\"bé\n",
+					"i": int64(-12),
+					"f": float64(150),
+					"t": true,
+					"n": nil,
+					"e": "ENUM",
+					"l": []interface{}{int64(1), "x", []interface{}{false}},
+				}, []interface{}{
+					[]interface{}{"id", "id"},
+				}},
+			},
+		},
+		{
+			name:  "typename",
+			query: `{ devices { __typename } }`,
+			want: []interface{}{
+				[]interface{}{"devices", "devices", []interface{}{
+					[]interface{}{"__typename", "__typename"},
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := parseGraphQLQuery(test.query, test.variables)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := fieldTree(fields); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{"empty", ``, "expected query"},
+		{"mutation", `mutation { device { id } }`, "mutation operations are not supported"},
+		{"subscription", `subscription { device { id } }`, "subscription operations are not supported"},
+		{"fragment definition", `fragment F on Device { id }`, "Fragments are not supported"},
+		{"fragment spread", `{ device(id: 1) { ...F } }`, "Fragments are not supported"},
+		{"directive", `{ device(id: 1) @include(if: true) { id } }`, "Directives are not supported"},
+		{"empty selection", `{ device(id: 1) { } }`, "selection set cannot be empty"},
+		{"unclosed selection", `{ device(id: 1) { id }`, "expected field name"},
+		{"multiple operations", `{ device(id: 1) { id } } { devices { id } }`, "only one operation is supported"},
+		{"unterminated string", `{ device(serial_number: "X1) { id } }`, "unterminated string"},
+		{"undefined variable", `{ device(id: $id) { id } }`, "Variable $id is not defined"},
+		{"variable in default", `query ($a: Int = $b) { device(id: $a) { id } }`, "variables are not allowed here"},
+		{"input object", `{ devices(filter: {status: "x"}) { id } }`, "Input objects are not supported"},
+		{"missing argument value", `{ device(id:) { id } }`, "expected value"},
+		{"bad number", `{ device(id: 1.2.3) { id } }`, "invalid number"},
+		{"too deep", `{ a { b { c { d { e { f } } } } } }`, "Query is deeper than 5 levels"},
+		{"list too deep", `{ device(id: [[[[[[1]]]]]]) { id } }`, "Value is deeper than 5 levels"},
+		{"type too deep", `query ($a: [[[[[[Int]]]]]]) { device(id: 1) { id } }`, "Type is deeper than 5 levels"},
+		{"too many fields", `{ devices { ` + strings.Repeat("id ", graphQLMaxFields) + `} }`, "Query has more than 100 fields"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseGraphQLQuery(test.query, nil)
+			if err == nil {
+				t.Fatalf("expected error containing %q", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %q, want error containing %q", err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestGraphQLResultMarshalJSON(t *testing.T) {
+	r := graphQLResult{
+		{key: "b", value: 1},
+		{key: "a", value: []graphQLResult{{{key: "z", value: "x"}, {key: "y", value: nil}}}},
+	}
+
+	buf, err := r.MarshalJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"b":1,"a":[{"z":"x","y":null}]}`; string(buf) != want {
+		t.Errorf("got %s, want %s", buf, want)
+	}
+}
+
+func TestGraphQLInt(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int64
+		ok    bool
+		err   bool
+	}{
+		{nil, 0, false, false},
+		{int64(3), 3, true, false},
+		{float64(4), 4, true, false},
+		{"5", 5, true, false},
+		{float64(1.5), 0, false, true},
+		{"x", 0, false, true},
+		{true, 0, false, true},
+	}
+
+	for _, test := range tests {
+		got, ok, err := graphQLInt(map[string]interface{}{"id": test.value}, "id")
+		if got != test.want || ok != test.ok || (err != nil) != test.err {
+			t.Errorf("graphQLInt(%#v) = %d, %v, %v; want %d, %v, error %v", test.value, got, ok, err, test.want, test.ok, test.err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const (
+	healthCheckInterval = time.Minute
+	healthCheckTimeout  = 5 * time.Second
+
+	//healthHistoryRetention is how long HealthChecks are kept in the database
+	healthHistoryRetention = 30 * 24 * time.Hour
+
+	//healthPendingLength is the maximum number of HealthChecks kept in memory while the database is unavailable
+	healthPendingLength = 24 * 60
+)
+
+//HealthResponse is the current service health and uptime
+type HealthResponse struct {
+	OK      bool      `json:"ok"`
+	Started time.Time `json:"started"`
+	Uptime  float64   `json:"uptime_seconds"`
+}
+
+//HealthMonitor periodically checks the database and queue depths and records the results.
+//Checks made while the database is unavailable are recorded once it's available again
+type HealthMonitor struct {
+	db      *sql.DB
+	started time.Time
+	last    *api.HealthCheck
+	pending []*api.HealthCheck
+	mu      *sync.Mutex
+}
+
+//NewHealthMonitor returns a new HealthMonitor for the given database and starts checking it with workers
+func NewHealthMonitor(db *sql.DB, workers *Workers) *HealthMonitor {
+	h := &HealthMonitor{db: db, started: time.Now(), mu: new(sync.Mutex)}
+	workers.Go(h.run)
+	return h
+}
+
+//run checks the database every healthCheckInterval until ctx is done
+func (h *HealthMonitor) run(ctx context.Context) {
+	for {
+		h.check()
+		if !sleepContext(ctx, healthCheckInterval) {
+			return
+		}
+	}
+}
+
+//check pings the database, reads the queue depths, and records the result
+func (h *HealthMonitor) check() *api.HealthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.db.PingContext(ctx)
+
+	c := &api.HealthCheck{Date: start, OK: err == nil, DBLatency: float64(time.Since(start)) / float64(time.Millisecond)}
+	if err != nil {
+		c.Error = err.Error()
+	}
+
+	h.mu.Lock()
+	h.last = c
+	h.pending = append(h.pending, c)
+	if len(h.pending) > healthPendingLength {
+		h.pending = h.pending[len(h.pending)-healthPendingLength:]
+	}
+	pending := h.pending
+	h.mu.Unlock()
+
+	if !c.OK {
+		return c
+	}
+
+	err = withTransaction(h.db, nil, func(ctx context.Context, store *api.TxStore) error {
+		if err := store.ReadQueueDepths(ctx, c); err != nil {
+			return err
+		}
+		for _, p := range pending {
+			if err := store.CreateHealthCheck(ctx, p, healthHistoryRetention); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Could not record health check: %v\n", err)
+		return c
+	}
+
+	h.mu.Lock()
+	h.pending = h.pending[len(pending):]
+	h.mu.Unlock()
+
+	return c
+}
+
+//Status returns the current HealthResponse
+func (h *HealthMonitor) Status() *HealthResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return &HealthResponse{
+		OK:      h.last != nil && h.last.OK,
+		Started: h.started,
+		Uptime:  time.Since(h.started).Seconds(),
+	}
+}
+
+// GET /health
+func handleReadHealth(h *HealthMonitor) returnHandler {
+	return func(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
+		status := h.Status()
+		if !status.OK {
+			return &handlerResponse{Code: http.StatusServiceUnavailable, Body: status}
+		}
+		return &handlerResponse{Code: http.StatusOK, Body: status}
+	}
+}
+
+// GET /admin/health/history
+func handleReadHealthHistory(h *HealthMonitor) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+		q := r.URL.Query()
+
+		//default to the last day
+		since, until := time.Now().Add(-24*time.Hour), time.Time{}
+		if v := q.Get("since"); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			if err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode since: %v", err))
+			}
+			since = t
+		}
+		if v := q.Get("until"); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			if err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode until: %v", err))
+			}
+			//until is inclusive
+			until = t.AddDate(0, 0, 1)
+		}
+
+		checks, err := store.ReadHealthChecks(r.Context(), since, until)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		status := h.Status()
+		resp := &HealthHistoryResponse{
+			OK:      status.OK,
+			Started: status.Started,
+			Uptime:  status.Uptime,
+			Panics:  atomic.LoadInt64(&panicCount),
+			Checks:  checks,
+		}
+
+		ok := 0
+		for _, c := range checks {
+			if c.OK {
+				ok++
+			}
+		}
+		if len(checks) > 0 {
+			resp.Availability = float64(ok) / float64(len(checks))
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: resp}
+	}
+}
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// POST /users/invite
+func handleInviteUser(m api.Mailer, inviteURL string) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		var req *InviteUserRequest
+		d := json.NewDecoder(r.Body)
+
+		err := d.Decode(&req)
+		if err != nil || req == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+		}
+
+		user := r.Context().Value(api.UserKey).(*api.User)
+
+		inv, token, err := store.CreateInvitation(r.Context(), req.Email, user.ID, invitationTTL)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		//the token is only valid once the invitation is committed
+		onCommit(r, func() {
+			if err := sendInvitation(m, inviteURL, inv, token, user); err != nil {
+				log.Printf("Could not send Invitation(%d): %v\n", inv.ID, err)
+			}
+		})
+
+		return &handlerResponse{Code: http.StatusOK, Body: inv}
+	}
+}
+
+// POST /users/invite/accept
+func handleAcceptInvitation(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var req *AcceptInvitationRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+	}
+
+	id, err := store.AcceptInvitation(r.Context(), req.Token, req.Name, req.Password)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	user, err := store.ReadUser(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	if user == nil {
+		return handleError(http.StatusInternalServerError, errors.New("Could not find user, but just created"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: user}
+}
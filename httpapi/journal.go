@@ -0,0 +1,302 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//maxJournalBody is the maximum request or response body size recorded in a JournalEntry
+const maxJournalBody = 1 << 20
+
+//defaultJournalCaptureDuration is how long a JournalCapture lasts if Until isn't set
+const defaultJournalCaptureDuration = time.Hour
+
+//redacted replaces sensitive values in recorded request bodies
+const redacted = "[REDACTED]"
+
+//JournalEntry is a recorded API request that can be replayed
+type JournalEntry struct {
+	Date        time.Time       `json:"date"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Query       string          `json:"query,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	UserID      int64           `json:"user_id,omitempty"`
+	Code        int             `json:"code"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	Err         string          `json:"error,omitempty"`
+}
+
+//JournalCapture selects the requests recorded by a Journal: requests by the User with UserID and/or to paths starting with Path, until Until
+type JournalCapture struct {
+	UserID int64     `json:"user_id,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+//matches returns true if the JournalCapture is active and matches the given path and User id
+func (c *JournalCapture) matches(path string, userID int64) bool {
+	if c == nil || time.Now().After(c.Until) {
+		return false
+	}
+	if c.UserID != 0 && c.UserID != userID {
+		return false
+	}
+	return strings.HasPrefix(path, c.Path)
+}
+
+//Request returns a new http.Request replaying the JournalEntry against the given base URL (including the API prefix)
+func (e *JournalEntry) Request(baseURL string) (*http.Request, error) {
+	url := strings.TrimSuffix(baseURL, "/") + e.Path
+	if e.Query != "" {
+		url += "?" + e.Query
+	}
+
+	r, err := http.NewRequest(e.Method, url, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	if e.ContentType != "" {
+		r.Header.Set("Content-Type", e.ContentType)
+	}
+
+	return r, nil
+}
+
+//ReadJournal returns all JournalEntries written to r, or an error if one occurred
+func ReadJournal(r io.Reader) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 4*maxJournalBody)
+
+	for s.Scan() {
+		e := new(JournalEntry)
+		if err := json.Unmarshal(s.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("Could not decode journal entry %d: %v", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read journal: %v", err)
+	}
+
+	return entries, nil
+}
+
+//Journal records the requests selected by an admin's JournalCapture (nothing is recorded until one is set)
+//into a ring buffer and, if w isn't nil, as JSON lines for replay.
+//Passwords, TOTP codes, tokens, secrets, and session keys in request and response bodies are redacted
+type Journal struct {
+	w       io.Writer
+	entries []*JournalEntry
+	next    int
+	full    bool
+	capture *JournalCapture
+	mu      *sync.Mutex
+}
+
+//NewJournal returns a new Journal keeping the last size entries in memory and writing them to w, if it's not nil
+func NewJournal(size int, w io.Writer) *Journal {
+	return &Journal{w: w, entries: make([]*JournalEntry, size), mu: new(sync.Mutex)}
+}
+
+//Capture returns the current JournalCapture, or nil if requests aren't being recorded
+func (j *Journal) Capture() *JournalCapture {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.capture == nil || time.Now().After(j.capture.Until) {
+		return nil
+	}
+	c := *j.capture
+	return &c
+}
+
+//SetCapture replaces the current JournalCapture. If c is nil, requests are no longer recorded
+func (j *Journal) SetCapture(c *JournalCapture) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.capture = c
+}
+
+//Entries returns the JournalEntries in memory, oldest first
+func (j *Journal) Entries() []*JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.full {
+		return append([]*JournalEntry{}, j.entries[:j.next]...)
+	}
+	return append(append([]*JournalEntry{}, j.entries[j.next:]...), j.entries[:j.next]...)
+}
+
+//Clear removes all JournalEntries from memory
+func (j *Journal) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := range j.entries {
+		j.entries[i] = nil
+	}
+	j.next, j.full = 0, false
+}
+
+//Write records the given JournalEntry
+func (j *Journal) Write(e *JournalEntry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.entries) > 0 {
+		j.entries[j.next] = e
+		j.next = (j.next + 1) % len(j.entries)
+		if j.next == 0 {
+			j.full = true
+		}
+	}
+
+	if j.w == nil {
+		return nil
+	}
+
+	_, err = j.w.Write(append(buf, '\n'))
+	return err
+}
+
+//redactedKeys are substrings of JSON keys whose values are redacted from recorded bodies
+var redactedKeys = []string{"password", "totp", "token", "secret", "session", "recovery"}
+
+//requestRedactedExactKeys and responseRedactedExactKeys are JSON keys whose values are redacted from recorded request and response bodies.
+//They're too short to match as substrings. TOTP and authorization codes are only in requests; validation error codes in responses are kept
+var (
+	requestRedactedExactKeys  = []string{"code", "uri"}
+	responseRedactedExactKeys = []string{"uri"}
+)
+
+//redactBody returns the given JSON body with the values of any keys containing one of the redactedKeys
+//or matching one of exactKeys redacted. Bodies that aren't JSON are dropped
+func redactBody(body []byte, exactKeys []string) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(redactValue(v, exactKeys))
+	if err != nil {
+		return nil
+	}
+
+	return buf
+}
+
+func isRedactedKey(k string, exactKeys []string) bool {
+	k = strings.ToLower(k)
+	for _, r := range redactedKeys {
+		if strings.Contains(k, r) {
+			return true
+		}
+	}
+	for _, r := range exactKeys {
+		if k == r {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValue(v interface{}, exactKeys []string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if isRedactedKey(k, exactKeys) {
+				val[k] = redacted
+			} else {
+				val[k] = redactValue(child, exactKeys)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(child, exactKeys)
+		}
+	}
+	return v
+}
+
+//journalMiddleware records requests matching the Journal's JournalCapture. The admin journal routes are never recorded
+func journalMiddleware(next returnHandler, j *Journal) returnHandler {
+	if j == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		//the User isn't known until the request is authenticated, so only the path can be checked now
+		c := j.Capture()
+		if c == nil || !strings.HasPrefix(r.URL.Path, c.Path) || strings.HasPrefix(r.URL.Path, "/admin/journal") {
+			return next(w, r)
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxJournalBody))
+			if err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not read body: %v", err))
+			}
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		}
+
+		resp := next(w, r)
+
+		var userID int64
+		if resp.User != nil {
+			userID = resp.User.ID
+		}
+		if !c.matches(r.URL.Path, userID) {
+			return resp
+		}
+
+		e := &JournalEntry{
+			Date:        time.Now(),
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Query:       r.URL.RawQuery,
+			ContentType: r.Header.Get("Content-Type"),
+			Body:        redactBody(body, requestRedactedExactKeys),
+			UserID:      userID,
+			Code:        resp.Code,
+		}
+		if resp.Body != nil {
+			if buf, err := json.Marshal(resp.Body); err == nil && len(buf) <= maxJournalBody {
+				e.Response = redactBody(buf, responseRedactedExactKeys)
+			}
+		}
+		if resp.Err != nil {
+			e.Err = resp.Err.Error()
+		}
+
+		if err := j.Write(e); err != nil {
+			log.Println("Could not write journal entry:", err)
+		}
+
+		return resp
+	}
+}
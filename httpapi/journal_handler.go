@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GET /admin/journal
+func handleReadJournal(j *Journal) returnHandler {
+	return func(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
+		return &handlerResponse{Code: http.StatusOK, Body: &JournalResponse{Capture: j.Capture(), Entries: j.Entries()}}
+	}
+}
+
+// POST /admin/journal/capture
+func handleSetJournalCapture(j *Journal) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		var c *JournalCapture
+		d := json.NewDecoder(r.Body)
+
+		err := d.Decode(&c)
+		if err != nil || c == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+		}
+
+		if c.UserID == 0 && c.Path == "" {
+			return handleError(http.StatusBadRequest, errors.New("user_id or path is required"))
+		}
+		if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+			return handleError(http.StatusBadRequest, fmt.Errorf("path (%s) must start with /", c.Path))
+		}
+
+		if c.Until.IsZero() {
+			c.Until = time.Now().Add(defaultJournalCaptureDuration)
+		}
+		if c.Until.Before(time.Now()) {
+			return handleError(http.StatusBadRequest, errors.New("until must be in the future"))
+		}
+
+		j.SetCapture(c)
+
+		return &handlerResponse{Code: http.StatusOK, Body: &JournalResponse{Capture: j.Capture(), Entries: j.Entries()}}
+	}
+}
+
+// DELETE /admin/journal
+func handleClearJournal(j *Journal) returnHandler {
+	return func(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
+		j.SetCapture(nil)
+		j.Clear()
+
+		return &handlerResponse{Code: http.StatusOK, Body: &JournalResponse{Entries: j.Entries()}}
+	}
+}
@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//readPermittedDeviceLink reads the DeviceLink with the device id and link id in the request URL
+//and checks that the request User may access its Device
+func readPermittedDeviceLink(r *http.Request) (*api.DeviceLink, *handlerResponse) {
+	store := requestStore(r)
+
+	deviceID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	linkID, err := strconv.ParseInt(mux.Vars(r)["link_id"], 10, 64)
+	if err != nil {
+		return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode link id: %v", err))
+	}
+
+	link, err := store.ReadDeviceLink(r.Context(), linkID)
+	if resp := checkAPIError(err); resp != nil {
+		return nil, resp
+	}
+	if link == nil || link.DeviceID != deviceID {
+		return nil, handleError(http.StatusNotFound, errors.New("Could not find link"))
+	}
+
+	if resp := checkAPIError(store.CheckDevicePermission(r.Context(), deviceID)); resp != nil {
+		return nil, resp
+	}
+
+	return link, nil
+}
+
+// GET /devices/:id/links/
+func handleReadDeviceLinks(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	if resp := checkAPIError(store.CheckDevicePermission(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	links, err := store.ReadDeviceLinks(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadDeviceLinksResponse{Links: links}}
+}
+
+// POST /devices/:id/links/
+func handleCreateDeviceLink(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var link *api.DeviceLink
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&link)
+	if err != nil || link == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	device, err := store.ReadDevice(r.Context(), id, false)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if device == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find device"))
+	}
+
+	link.DeviceID = id
+
+	linkID, err := store.CreateDeviceLink(r.Context(), link)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	link, err = store.ReadDeviceLink(r.Context(), linkID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if link == nil {
+		return handleError(http.StatusInternalServerError, errors.New("Could not find link, but just created"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: link}
+}
+
+// POST /devices/:id/links/:link_id
+func handleUpdateDeviceLink(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	old, resp := readPermittedDeviceLink(r)
+	if resp != nil {
+		return resp
+	}
+
+	var link *api.DeviceLink
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&link)
+	if err != nil || link == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	link.ID = old.ID
+	link.DeviceID = old.DeviceID
+
+	err = store.UpdateDeviceLink(r.Context(), link)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	link, err = store.ReadDeviceLink(r.Context(), link.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if link == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find link, but just updated"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: link}
+}
+
+// DELETE /devices/:id/links/:link_id
+func handleDeleteDeviceLink(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	link, resp := readPermittedDeviceLink(r)
+	if resp != nil {
+		return resp
+	}
+
+	err := store.DeleteDeviceLink(r.Context(), link.ID)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: link}
+}
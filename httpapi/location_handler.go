@@ -1,17 +1,166 @@
 package httpapi
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/gorilla/mux"
 	"github.com/korylprince/tcea-inventory-server/api"
 )
 
 // GET /locations/
-func handleReadLocations(_ http.ResponseWriter, r *http.Request) *handlerResponse {
-	locations, err := api.ReadLocations(r.Context())
+func handleReadLocations(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	locations, err := store.ReadLocations(r.Context())
 	if err := checkAPIError(err); err != nil {
 		return err
 	}
 
-	return &handlerResponse{Code: http.StatusOK, Body: &ReadLocationsResponse{Locations: locations}}
+	return handleETag(w, r, &ReadLocationsResponse{Locations: locations})
+}
+
+// POST /locations/
+func handleCreateLocation(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var req *LocationRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	err = store.CreateLocation(r.Context(), req.Location)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return handleReadLocations(w, r)
+}
+
+// POST /locations/:location
+func handleRenameLocation(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	location := api.Location(mux.Vars(r)["location"])
+
+	var req *RenameLocationRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	l, err := store.ReadLocation(r.Context(), location)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if l == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find location"))
+	}
+
+	err = store.RenameLocation(r.Context(), location, req.Location, req.Cascade)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return handleReadLocations(w, r)
+}
+
+// DELETE /locations/:location
+func handleDeleteLocation(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	location := api.Location(mux.Vars(r)["location"])
+
+	l, err := store.ReadLocation(r.Context(), location)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if l == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find location"))
+	}
+
+	err = store.DeleteLocation(r.Context(), location)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return handleReadLocations(w, r)
+}
+
+// GET /locations/:location
+func handleReadLocationDetail(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	location := api.Location(mux.Vars(r)["location"])
+
+	detail, err := store.ReadLocationDetail(r.Context(), location)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if detail == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find location"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: detail}
+}
+
+// POST /locations/:location/detail
+func handleUpdateLocationDetail(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	location := api.Location(mux.Vars(r)["location"])
+
+	var detail *api.LocationDetail
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&detail)
+	if err != nil || detail == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	if detail.Location != location {
+		return handleError(http.StatusBadRequest, fmt.Errorf("location mismatch: URL: %s, Body: %s", location, detail.Location))
+	}
+
+	l, err := store.ReadLocation(r.Context(), location)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if l == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find location"))
+	}
+
+	err = store.UpdateLocationDetail(r.Context(), detail)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	detail, err = store.ReadLocationDetail(r.Context(), location)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if detail == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find location, but just updated"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: detail}
+}
+
+// GET /locations/tree/
+func handleReadLocationTree(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	tree, err := store.ReadLocationTree(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadLocationTreeResponse{Locations: tree}}
 }
@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -62,7 +63,7 @@ func jsonMiddleware(next returnHandler) returnHandler {
 	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
 		var resp *handlerResponse
 
-		if r.Method != "GET" {
+		if r.Method != "GET" && r.Method != "DELETE" {
 			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 			if err != nil {
 				resp = handleError(http.StatusBadRequest, errors.New("Could not parse Content-Type"))
@@ -79,8 +80,11 @@ func jsonMiddleware(next returnHandler) returnHandler {
 
 	serve:
 		w.WriteHeader(resp.Code)
+		if resp.Code == http.StatusNotModified {
+			return resp
+		}
 		e := json.NewEncoder(w)
-		err := e.Encode(resp.Body)
+		err := e.Encode(versionBody(resp.Body, requestVersion(r)))
 		if err != nil {
 			return handleError(http.StatusInternalServerError, fmt.Errorf("Could encode json: %v", err))
 		}
@@ -88,8 +92,36 @@ func jsonMiddleware(next returnHandler) returnHandler {
 	}
 }
 
+//maxConversationIDLength is the longest chatbot conversation ID stored with Events
+const maxConversationIDLength = 255
+
+//requestEventSource returns the EventSource declared by the X-Inventory-Source (web or chatbot; default: web)
+//and X-Inventory-Conversation (required for chatbot) headers, or an error if they're invalid
+func requestEventSource(r *http.Request) (*api.EventSource, error) {
+	source := &api.EventSource{Type: api.EventSourceWeb}
+
+	switch typ := r.Header.Get("X-Inventory-Source"); typ {
+	case "", api.EventSourceWeb:
+	case api.EventSourceChatbot:
+		source.Type = typ
+		source.ConversationID = r.Header.Get("X-Inventory-Conversation")
+		if source.ConversationID == "" {
+			return nil, errors.New("X-Inventory-Conversation header must be set for chatbot requests")
+		}
+		if len(source.ConversationID) > maxConversationIDLength {
+			return nil, fmt.Errorf("X-Inventory-Conversation header must be at most %d characters", maxConversationIDLength)
+		}
+	default:
+		return nil, fmt.Errorf("X-Inventory-Source header (%s) must be %s or %s", typ, api.EventSourceWeb, api.EventSourceChatbot)
+	}
+
+	return source, nil
+}
+
 func authMiddleware(next returnHandler, s SessionStore) returnHandler {
 	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
 		key := r.Header.Get("X-Session-Key")
 		if key == "" {
 			return handleError(http.StatusUnauthorized, errors.New("X-Session-Key header empty"))
@@ -103,12 +135,39 @@ func authMiddleware(next returnHandler, s SessionStore) returnHandler {
 			return handleError(http.StatusUnauthorized, errors.New("Could not find session"))
 		}
 
-		user, err := api.ReadUser(r.Context(), sess.UserID)
+		user, err := store.ReadUser(r.Context(), sess.UserID)
 		if resp := checkAPIError(err); resp != nil {
 			return resp
 		}
+		if user == nil || user.Disabled {
+			return handleError(http.StatusUnauthorized, errors.New("User is disabled or deleted"))
+		}
+
+		//users with temporary passwords can only change their password
+		if user.MustChangePassword && !(r.Method == http.MethodPost && r.URL.Path == fmt.Sprintf("/users/%d/password", user.ID)) {
+			resp := handleError(http.StatusForbidden, errors.New("User must change password"))
+			resp.User = user
+			return resp
+		}
+
+		if resp := checkAPIError(store.UpdateUserActivity(r.Context(), user.ID, time.Now())); resp != nil {
+			return resp
+		}
+
+		//temporary Grants can elevate the User's Role
+		if resp := checkAPIError(store.ApplyUserGrants(r.Context(), user)); resp != nil {
+			return resp
+		}
+
+		source, err := requestEventSource(r)
+		if err != nil {
+			resp := handleError(http.StatusBadRequest, err)
+			resp.User = user
+			return resp
+		}
 
 		ctx := context.WithValue(r.Context(), api.UserKey, user)
+		ctx = context.WithValue(ctx, api.SourceKey, source)
 		resp := next(w, r.WithContext(ctx))
 		resp.User = user
 
@@ -116,23 +175,241 @@ func authMiddleware(next returnHandler, s SessionStore) returnHandler {
 	}
 }
 
-func txMiddleware(next returnHandler, db *sql.DB) returnHandler {
+//limitMiddleware limits request bodies to max bytes. Reading past the limit returns an error, so the request fails to decode
+func limitMiddleware(next http.Handler, max int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//adminMiddleware rejects requests from Users without the admin Role. It must be wrapped by authMiddleware
+func adminMiddleware(next returnHandler) returnHandler {
 	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
-		tx, err := db.Begin()
-		if err != nil {
-			return handleError(http.StatusInternalServerError, fmt.Errorf("Could not begin transaction: %v", err))
+		user := r.Context().Value(api.UserKey).(*api.User)
+		if !user.IsAdmin() {
+			return handleError(http.StatusForbidden, errors.New("User must be an admin"))
 		}
 
-		ctx := context.WithValue(r.Context(), api.TransactionKey, tx)
-		resp := next(w, r.WithContext(ctx))
+		return next(w, r)
+	}
+}
+
+//maxTxAttempts is how many times a transaction is attempted if it deadlocks or times out waiting for a lock
+const maxTxAttempts = 3
+
+//txRetryWait is the wait before retrying a transaction. The wait doubles for each following retry
+const txRetryWait = 50 * time.Millisecond
+
+//txMiddleware runs next in a transaction, committing it afterwards. If timeout is greater than 0,
+//queries are canceled (and the transaction is rolled back) after timeout. FeedEvents are published to f and functions queued with onCommit are run
+//after the transaction is committed, so a rolled back or retried request doesn't send emails or other external side effects.
+//GET requests run in a read-only transaction on replica, or db if replica is nil.
+//If the transaction deadlocks or times out waiting for a lock, it's rolled back and the whole request is retried, up to maxTxAttempts times
+func txMiddleware(next returnHandler, db, replica *sql.DB, c api.Cache, f *api.Feed, timeout time.Duration) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		ctx := r.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		r = r.WithContext(ctx)
 
-		if err = tx.Commit(); err != nil {
-			if rErr := tx.Rollback(); rErr != nil && rErr != sql.ErrTxDone {
-				return handleError(http.StatusInternalServerError, fmt.Errorf("Could not rollback transaction: %v", rErr))
+		//keep the body so it can be read again if the request is retried
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			if body, err = io.ReadAll(r.Body); err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not read body: %v", err))
 			}
-			return handleError(http.StatusInternalServerError, fmt.Errorf("Could not commit transaction: %v", err))
 		}
 
-		return resp
+		wait := txRetryWait
+		for attempt := 1; ; attempt++ {
+			if body != nil {
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			resp, err := runTx(next, w, r, db, replica, c, f)
+			if err == nil {
+				return resp
+			}
+
+			if attempt == maxTxAttempts {
+				w.Header().Set("Retry-After", "1")
+				e := handleError(http.StatusServiceUnavailable, fmt.Errorf("Could not complete transaction after %d attempts: %v", attempt, err))
+				e.User = resp.User
+				return e
+			}
+
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return handleError(http.StatusServiceUnavailable, fmt.Errorf("Could not retry transaction: %v", ctx.Err()))
+			case <-t.C:
+			}
+			wait *= 2
+		}
 	}
 }
+
+//runTx runs next in a single transaction. If the transaction deadlocked or timed out waiting for a lock,
+//it's rolled back and the error is returned so the request can be retried
+func runTx(next returnHandler, w http.ResponseWriter, r *http.Request, db, replica *sql.DB, c api.Cache, f *api.Feed) (*handlerResponse, error) {
+	ctx := r.Context()
+
+	//GET requests don't change anything, so they can be read from the replica
+	var store *api.TxStore
+	var tx *sql.Tx
+	var err error
+	fromReplica := false
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		read := db
+		if replica != nil {
+			read = replica
+			fromReplica = true
+		}
+		if tx, err = read.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err == nil {
+			store = api.NewReadOnlyTxStore(tx, read, db)
+		}
+	} else if tx, err = db.BeginTx(ctx, nil); err == nil {
+		store = api.NewTxStore(tx, db)
+	}
+	if err != nil {
+		return handleError(http.StatusInternalServerError, fmt.Errorf("Could not begin transaction: %v", err)), nil
+	}
+
+	//don't commit a panicking request's changes; recoverMiddleware handles the panic
+	defer func() {
+		if v := recover(); v != nil {
+			tx.Rollback()
+			panic(v)
+		}
+	}()
+
+	ctx = context.WithValue(ctx, StoreKey, store)
+
+	var cache *api.RequestCache
+	if c != nil {
+		if fromReplica {
+			cache = api.NewReplicaRequestCache(c)
+		} else {
+			cache = api.NewRequestCache(c)
+		}
+		ctx = context.WithValue(ctx, api.CacheKey, cache)
+	}
+
+	var feed *api.RequestFeed
+	if f != nil {
+		feed = api.NewRequestFeed(f)
+		ctx = context.WithValue(ctx, api.FeedKey, feed)
+	}
+
+	after := new(afterCommit)
+	ctx = context.WithValue(ctx, AfterCommitKey, after)
+
+	resp := next(w, r.WithContext(ctx))
+
+	if api.IsRetryable(resp.Err) {
+		tx.Rollback()
+		return resp, resp.Err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if rErr := tx.Rollback(); rErr != nil && rErr != sql.ErrTxDone {
+			return handleError(http.StatusInternalServerError, fmt.Errorf("Could not rollback transaction: %v", rErr)), nil
+		}
+		if api.IsRetryable(err) {
+			return resp, err
+		}
+		return handleError(http.StatusInternalServerError, fmt.Errorf("Could not commit transaction: %v", err)), nil
+	}
+
+	cache.Commit()
+	feed.Commit()
+	after.run()
+
+	return resp, nil
+}
+
+//afterCommit is a queue of external side effects (e.g. emails) for a single request transaction
+type afterCommit struct {
+	funcs []func()
+}
+
+//run runs the queued functions in order
+func (a *afterCommit) run() {
+	for _, f := range a.funcs {
+		f()
+	}
+}
+
+//onCommit queues f to be run after the request transaction started by txMiddleware is committed.
+//f isn't run if the transaction is rolled back or retried. If there is no request transaction, f is run immediately
+func onCommit(r *http.Request, f func()) {
+	a, ok := r.Context().Value(AfterCommitKey).(*afterCommit)
+	if !ok {
+		f()
+		return
+	}
+	a.funcs = append(a.funcs, f)
+}
+
+//requestStore returns the TxStore for the request transaction started by txMiddleware
+func requestStore(r *http.Request) *api.TxStore {
+	return r.Context().Value(StoreKey).(*api.TxStore)
+}
+
+//withTransaction runs f with a TxStore for its own transaction, outside of a request, committing if f returns nil.
+//If the transaction deadlocks or times out waiting for a lock, f is run again in a new transaction, up to maxTxAttempts times.
+//c may be nil
+func withTransaction(db *sql.DB, c api.Cache, f func(ctx context.Context, store *api.TxStore) error) error {
+	wait := txRetryWait
+	for attempt := 1; ; attempt++ {
+		err := runTransaction(db, c, f)
+		if err == nil || !api.IsRetryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+//runTransaction runs f once for withTransaction
+func runTransaction(db *sql.DB, c api.Cache, f func(ctx context.Context, store *api.TxStore) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not begin transaction: %v", err)
+	}
+
+	//changes made outside of requests are made by the server itself
+	ctx := context.WithValue(context.Background(), api.SourceKey, &api.EventSource{Type: api.EventSourceSystem})
+
+	var cache *api.RequestCache
+	if c != nil {
+		cache = api.NewRequestCache(c)
+		ctx = context.WithValue(ctx, api.CacheKey, cache)
+	}
+
+	if err = f(ctx, api.NewTxStore(tx, db)); err != nil {
+		if rErr := tx.Rollback(); rErr != nil {
+			return fmt.Errorf("Could not rollback transaction: %v", rErr)
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		if api.IsRetryable(err) {
+			return err
+		}
+		return fmt.Errorf("Could not commit transaction: %v", err)
+	}
+
+	cache.Commit()
+
+	return nil
+}
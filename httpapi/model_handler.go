@@ -1,9 +1,12 @@
 package httpapi
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -11,8 +14,29 @@ import (
 	"github.com/korylprince/tcea-inventory-server/api"
 )
 
+//recordMigratedModelMerges adds Merged Events to the Devices moved when a migration merged duplicate Models.
+//It runs once when the server starts
+func recordMigratedModelMerges(db *sql.DB, c api.Cache) {
+	var n int
+	err := withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		n, err = store.RecordMigratedModelMerges(ctx)
+		return err
+	})
+	if err != nil {
+		log.Printf("Could not record migrated model merges: %v\n", err)
+		return
+	}
+
+	if n > 0 {
+		log.Printf("Recorded %d merged events for models merged by a migration\n", n)
+	}
+}
+
 // POST /models
 func handleCreateModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	var model *api.Model
 	d := json.NewDecoder(r.Body)
 
@@ -21,12 +45,12 @@ func handleCreateModel(_ http.ResponseWriter, r *http.Request) *handlerResponse
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
 	}
 
-	id, err := api.CreateModel(r.Context(), model)
+	id, err := store.CreateModel(r.Context(), model)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
-	model, err = api.ReadModel(r.Context(), id)
+	model, err = store.ReadModel(r.Context(), id)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -38,13 +62,15 @@ func handleCreateModel(_ http.ResponseWriter, r *http.Request) *handlerResponse
 }
 
 // GET /models/:id
-func handleReadModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+func handleReadModel(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
 	}
 
-	model, err := api.ReadModel(r.Context(), id)
+	model, err := store.ReadModel(r.Context(), id)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -52,11 +78,13 @@ func handleReadModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
 		return handleError(http.StatusNotFound, errors.New("Could not find model"))
 	}
 
-	return &handlerResponse{Code: http.StatusOK, Body: model}
+	return handleETag(w, r, model)
 }
 
 // POST /models/:id
 func handleUpdateModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
@@ -74,12 +102,12 @@ func handleUpdateModel(_ http.ResponseWriter, r *http.Request) *handlerResponse
 		return handleError(http.StatusBadRequest, fmt.Errorf("model id mismatch: URL: %d, Body: %d", id, model.ID))
 	}
 
-	err = api.UpdateModel(r.Context(), model)
+	err = store.UpdateModel(r.Context(), model)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
-	model, err = api.ReadModel(r.Context(), model.ID)
+	model, err = store.ReadModel(r.Context(), model.ID)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -92,9 +120,12 @@ func handleUpdateModel(_ http.ResponseWriter, r *http.Request) *handlerResponse
 
 // GET /models/
 func handleQueryModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
-	models, err := api.QueryModel(r.Context(),
+	store := requestStore(r)
+
+	models, err := store.QueryModel(r.Context(),
 		r.URL.Query().Get("manufacturer"),
 		r.URL.Query().Get("model"),
+		r.URL.Query().Get("category"),
 	)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
@@ -102,3 +133,95 @@ func handleQueryModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
 
 	return &handlerResponse{Code: http.StatusOK, Body: &QueryModelResponse{Models: models}}
 }
+
+// GET /models/:id/merge?into=:into
+func handlePreviewModelMerge(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	into, err := strconv.ParseInt(r.URL.Query().Get("into"), 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode into: %v", err))
+	}
+
+	merge, err := store.PreviewModelMerge(r.Context(), id, into)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: merge}
+}
+
+// POST /models/:id/merge
+func handleMergeModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var req *MergeModelRequest
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	merge, err := store.MergeModel(r.Context(), id, req.Into)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: merge}
+}
+
+// DELETE /models/:id
+func handleDeleteModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	model, err := store.ReadModel(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if model == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find model"))
+	}
+
+	if resp := checkAPIError(store.DeleteModel(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: model}
+}
+
+// POST /models/:id/restore
+func handleRestoreModel(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	if resp := checkAPIError(store.RestoreModel(r.Context(), id)); resp != nil {
+		return resp
+	}
+
+	model, err := store.ReadModel(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: model}
+}
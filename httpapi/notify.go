@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//LoginNotifications are the login notification modes
+const (
+	LoginNotificationsNone      = "none"
+	LoginNotificationsNewDevice = "new"
+	LoginNotificationsAll       = "all"
+)
+
+//loginRevokeTTL is how long the sign out link in a login notification is valid
+const loginRevokeTTL = 7 * 24 * time.Hour
+
+const loginNotificationTemplate = `Hello {{.User.Name}},
+
+{{if .NewDevice}}Your inventory account was just signed in to from a new device or IP address.{{else}}Your inventory account was just signed in to.{{end}}
+
+Date: {{.Login.Date.Format "2006-01-02 15:04:05 -0700"}}
+IP Address: {{.Login.IP}}
+Device: {{.Login.UserAgent}}
+{{if .URL}}
+If this wasn't you, use the link below to sign your account out everywhere, then change your password immediately. The link can only be used once:
+
+{{.URL}}
+{{else}}
+If this wasn't you, change your password immediately.
+{{end}}`
+
+var loginNotificationTmpl = template.Must(template.New("login").Parse(loginNotificationTemplate))
+
+type loginNotificationData struct {
+	User      *api.User
+	Login     *api.Login
+	NewDevice bool
+	URL       string
+}
+
+//loginNotifier emails users about their logins
+type loginNotifier struct {
+	mailer    api.Mailer //if nil, no notifications are sent
+	mode      string     //one of the LoginNotifications modes
+	revokeURL string     //client URL sign out tokens are appended to; if empty, notifications don't have a sign out link
+}
+
+//enabled returns true if a login should be notified
+func (n *loginNotifier) enabled(newDevice bool) bool {
+	return n.mailer != nil && n.mode != LoginNotificationsNone && (n.mode != LoginNotificationsNewDevice || newDevice)
+}
+
+//notify emails the user about the given login with a sign out link for the given token, if it's not empty. Errors are logged
+func (n *loginNotifier) notify(user *api.User, login *api.Login, newDevice bool, token string) {
+	subject := "Inventory sign in"
+	if newDevice {
+		subject = "Inventory sign in from a new device"
+	}
+
+	data := &loginNotificationData{User: user, Login: login, NewDevice: newDevice}
+
+	if token != "" {
+		u, err := url.Parse(n.revokeURL)
+		if err != nil {
+			log.Printf("Could not parse sign out URL: %v\n", err)
+			return
+		}
+		q := u.Query()
+		q.Set("token", token)
+		u.RawQuery = q.Encode()
+		data.URL = u.String()
+	}
+
+	body := new(bytes.Buffer)
+	if err := loginNotificationTmpl.Execute(body, data); err != nil {
+		log.Printf("Could not render login notification for User(%d): %v\n", user.ID, err)
+		return
+	}
+
+	go func() {
+		if err := n.mailer.Send([]string{user.Email}, subject, body.String()); err != nil {
+			log.Printf("Could not send login notification for User(%d): %v\n", user.ID, err)
+		}
+	}()
+}
+
+const invitationTemplate = `Hello,
+
+{{.InvitedBy.Name}} has invited you to the inventory system. Use the link below to choose your name and password:
+
+{{.URL}}
+
+This invitation expires {{.Invitation.Expires.Format "2006-01-02 15:04:05 -0700"}}.
+`
+
+var invitationTmpl = template.Must(template.New("invitation").Parse(invitationTemplate))
+
+type invitationData struct {
+	Invitation *api.Invitation
+	InvitedBy  *api.User
+	URL        string
+}
+
+//sendInvitation emails the given Invitation with a link to the given client URL, or returns an error if one occurred
+func sendInvitation(m api.Mailer, inviteURL string, inv *api.Invitation, token string, invitedBy *api.User) error {
+	u, err := url.Parse(inviteURL)
+	if err != nil {
+		return fmt.Errorf("Could not parse invitation URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	body := new(bytes.Buffer)
+	if err = invitationTmpl.Execute(body, &invitationData{Invitation: inv, InvitedBy: invitedBy, URL: u.String()}); err != nil {
+		return fmt.Errorf("Could not render invitation: %v", err)
+	}
+
+	if err = m.Send([]string{inv.Email}, "Inventory invitation", body.String()); err != nil {
+		return fmt.Errorf("Could not send invitation: %v", err)
+	}
+
+	return nil
+}
+
+const capacityNotificationTemplate = `Hello{{if .ContactName}} {{.ContactName}}{{end}},
+
+{{.Location}} is over capacity after a device was moved there.
+
+Devices: {{.Count}}
+Capacity: {{.Capacity}}
+`
+
+var capacityNotificationTmpl = template.Must(template.New("capacity").Parse(capacityNotificationTemplate))
+
+//notifyCapacity emails the Location's contact that it is over capacity. Errors are logged
+func notifyCapacity(m api.Mailer, u *api.LocationUtilization) {
+	log.Printf("Location(%s) is over capacity: %d/%d\n", u.Location, u.Count, u.Capacity)
+
+	if m == nil || u.ContactEmail == "" {
+		return
+	}
+
+	body := new(bytes.Buffer)
+	if err := capacityNotificationTmpl.Execute(body, u); err != nil {
+		log.Printf("Could not render capacity notification for Location(%s): %v\n", u.Location, err)
+		return
+	}
+
+	go func() {
+		if err := m.Send([]string{u.ContactEmail}, fmt.Sprintf("Inventory location over capacity: %s", u.Location), body.String()); err != nil {
+			log.Printf("Could not send capacity notification for Location(%s): %v\n", u.Location, err)
+		}
+	}()
+}
@@ -0,0 +1,494 @@
+package httpapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//oidcStateDuration is how long a login attempt has to complete the callback
+const oidcStateDuration = 10 * time.Minute
+
+//oidcStateCookie is the cookie that binds a login attempt to the browser that started it
+const oidcStateCookie = "inventory_oidc_state"
+
+//oidcKeyRefreshInterval is the minimum time between fetching the provider's signing keys because of an unknown key id
+const oidcKeyRefreshInterval = time.Minute
+
+//OIDCConfig configures an OpenID Connect identity provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string //the client page the provider redirects back to with code and state
+}
+
+//OIDCProvider performs the OpenID Connect authorization code flow with an identity provider.
+//The state and nonce of a login attempt are kept in a signed cookie, so a callback must come from the browser that started the login.
+//ID Tokens must be signed (RS256) by one of the provider's published keys
+type OIDCProvider struct {
+	config        *OIDCConfig
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+	client        *http.Client
+
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+	mu          *sync.Mutex
+}
+
+//NewOIDCProvider returns a new OIDCProvider using the provider's discovery document, or an error if one occurred
+func NewOIDCProvider(config *OIDCConfig) (*OIDCProvider, error) {
+	p := &OIDCProvider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		mu:     new(sync.Mutex),
+	}
+
+	resp, err := p.client.Get(strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch discovery document: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not fetch discovery document: %s", resp.Status)
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("Could not decode discovery document: %v", err)
+	}
+
+	if discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("discovery issuer (%s) doesn't match configured issuer (%s)", discovery.Issuer, config.Issuer)
+	}
+
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document doesn't contain a jwks_uri")
+	}
+
+	p.authEndpoint = discovery.AuthorizationEndpoint
+	p.tokenEndpoint = discovery.TokenEndpoint
+	p.jwksURI = discovery.JWKSURI
+
+	if p.keys, err = p.fetchKeys(); err != nil {
+		return nil, err
+	}
+	p.keysFetched = time.Now()
+
+	return p, nil
+}
+
+//fetchKeys returns the provider's RSA signing keys by key id, or an error if one occurred
+func (p *OIDCProvider) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	resp, err := p.client.Get(p.jwksURI)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch signing keys: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not fetch signing keys: %s", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Type string `json:"kty"`
+			ID   string `json:"kid"`
+			Use  string `json:"use"`
+			N    string `json:"n"`
+			E    string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("Could not decode signing keys: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Type != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("Could not decode signing key %s modulus: %v", k.ID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("Could not decode signing key %s exponent", k.ID)
+		}
+
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+
+		keys[k.ID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}
+	}
+
+	return keys, nil
+}
+
+//key returns the signing key with the given id, fetching the provider's keys again (at most every oidcKeyRefreshInterval) if it's unknown.
+//An empty id matches the only key if the provider has just one
+func (p *OIDCProvider) key(id string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	find := func() *rsa.PublicKey {
+		if k, ok := p.keys[id]; ok {
+			return k
+		}
+		if id == "" && len(p.keys) == 1 {
+			for _, k := range p.keys {
+				return k
+			}
+		}
+		return nil
+	}
+
+	if k := find(); k != nil {
+		return k, nil
+	}
+
+	if time.Since(p.keysFetched) < oidcKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key (%s)", id)
+	}
+
+	keys, err := p.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if k := find(); k != nil {
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key (%s)", id)
+}
+
+//signState returns a cookie value containing the given state, nonce, and expiration signed with the client secret
+func (p *OIDCProvider) signState(state, nonce string, expires time.Time) string {
+	v := fmt.Sprintf("%s.%s.%d", state, nonce, expires.Unix())
+	mac := hmac.New(sha256.New, []byte(p.config.ClientSecret))
+	mac.Write([]byte(v))
+	return v + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//stateCookie returns the login attempt cookie with the given value and max age
+func stateCookie(value string, maxAge int) *http.Cookie {
+	//the client and API may be on different sites, so the cookie must be sent with cross-site requests
+	return &http.Cookie{Name: oidcStateCookie, Value: value, Path: "/", MaxAge: maxAge, HttpOnly: true, Secure: true, SameSite: http.SameSiteNoneMode}
+}
+
+//AuthURL returns a new authorization URL to send the user to and sets a cookie binding the login attempt to the browser
+func (p *OIDCProvider) AuthURL(w http.ResponseWriter) string {
+	state := randString(32)
+	nonce := randString(32)
+
+	http.SetCookie(w, stateCookie(p.signState(state, nonce, time.Now().Add(oidcStateDuration)), int(oidcStateDuration.Seconds())))
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("scope", "openid email profile")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.authEndpoint + sep + v.Encode()
+}
+
+//checkState returns the nonce of the login attempt with the given state started by the request's browser, or an error if there isn't one
+func (p *OIDCProvider) checkState(r *http.Request, state string) (nonce string, err error) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return "", errors.New("login wasn't started by this browser")
+	}
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 4 {
+		return "", errors.New("invalid state cookie")
+	}
+
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", errors.New("invalid state cookie")
+	}
+
+	if !hmac.Equal([]byte(p.signState(parts[0], parts[1], time.Unix(expires, 0))), []byte(cookie.Value)) {
+		return "", errors.New("invalid state cookie signature")
+	}
+
+	if time.Unix(expires, 0).Before(time.Now()) {
+		return "", errors.New("expired state")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(parts[0]), []byte(state)) != 1 {
+		return "", errors.New("state doesn't match")
+	}
+
+	return parts[1], nil
+}
+
+//verifyIDToken checks the signature of the given ID Token and returns its payload, or an error if one occurred
+func (p *OIDCProvider) verifyIDToken(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid id_token")
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode id_token header: %v", err)
+	}
+
+	var h struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+
+	if err = json.Unmarshal(header, &h); err != nil {
+		return nil, fmt.Errorf("Could not decode id_token header: %v", err)
+	}
+
+	if h.Algorithm != "RS256" {
+		return nil, fmt.Errorf("unsupported id_token algorithm (%s)", h.Algorithm)
+	}
+
+	key, err := p.key(h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode id_token signature: %v", err)
+	}
+
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig); err != nil {
+		return nil, errors.New("invalid id_token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode id_token: %v", err)
+	}
+
+	return payload, nil
+}
+
+//Exchange exchanges the given code for the verified email of the authenticated user, checking the ID Token has the given nonce,
+//or returns an error if one occurred
+func (p *OIDCProvider) Exchange(code, nonce string) (email string, err error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("client_id", p.config.ClientID)
+	v.Set("client_secret", p.config.ClientSecret)
+
+	resp, err := p.client.PostForm(p.tokenEndpoint, v)
+	if err != nil {
+		return "", fmt.Errorf("Could not exchange code: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Could not exchange code: %s", resp.Status)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("Could not decode token response: %v", err)
+	}
+
+	payload, err := p.verifyIDToken(token.IDToken)
+	if err != nil {
+		return "", err
+	}
+
+	var claims struct {
+		Issuer        string          `json:"iss"`
+		Audience      json.RawMessage `json:"aud"`
+		Expires       int64           `json:"exp"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified bool            `json:"email_verified"`
+	}
+
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("Could not decode id_token claims: %v", err)
+	}
+
+	if claims.Issuer != p.config.Issuer {
+		return "", fmt.Errorf("id_token issuer (%s) doesn't match", claims.Issuer)
+	}
+
+	//aud may be a string or a list of strings
+	var audiences []string
+	if err = json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var aud string
+		if err = json.Unmarshal(claims.Audience, &aud); err != nil {
+			return "", fmt.Errorf("Could not decode id_token audience: %v", err)
+		}
+		audiences = []string{aud}
+	}
+
+	found := false
+	for _, aud := range audiences {
+		if aud == p.config.ClientID {
+			found = true
+		}
+	}
+	if !found {
+		return "", errors.New("id_token audience doesn't match")
+	}
+
+	if time.Unix(claims.Expires, 0).Before(time.Now()) {
+		return "", errors.New("id_token is expired")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return "", errors.New("id_token nonce doesn't match")
+	}
+
+	//the email is only trusted if the provider says it has verified it
+	if claims.Email == "" || !claims.EmailVerified {
+		return "", errors.New("id_token doesn't contain a verified email")
+	}
+
+	return claims.Email, nil
+}
+
+//oidcLogin is a single sign-on login whose authorization code has been exchanged
+type oidcLogin struct {
+	email string
+	totp  string
+}
+
+//oidcMiddleware checks the request's browser started the login and exchanges the authorization code before calling next.
+//The code can only be exchanged once, so this must run outside of txMiddleware, which may retry next
+func oidcMiddleware(next returnHandler, p *OIDCProvider) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		var req *OIDCCallbackRequest
+		d := json.NewDecoder(r.Body)
+
+		err := d.Decode(&req)
+		if err != nil || req == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+		}
+
+		if req.Code == "" || req.State == "" {
+			return handleError(http.StatusBadRequest, errors.New("code or state empty"))
+		}
+
+		nonce, err := p.checkState(r, req.State)
+
+		//each login attempt can only be used once
+		http.SetCookie(w, stateCookie("", -1))
+
+		if err != nil {
+			return handleError(http.StatusUnauthorized, fmt.Errorf("Could not verify login: %v", err))
+		}
+
+		email, err := p.Exchange(req.Code, nonce)
+		if err != nil {
+			return handleError(http.StatusUnauthorized, fmt.Errorf("Could not authenticate with identity provider: %v", err))
+		}
+
+		ctx := context.WithValue(r.Context(), OIDCKey, &oidcLogin{email: email, totp: req.TOTP})
+		return next(w, r.WithContext(ctx))
+	}
+}
+
+// GET /auth/oidc/login
+func handleOIDCLogin(p *OIDCProvider) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		return &handlerResponse{Code: http.StatusOK, Body: &OIDCLoginResponse{URL: p.AuthURL(w)}}
+	}
+}
+
+// POST /auth/oidc/callback
+func handleOIDCCallback(s SessionStore, n *loginNotifier, t *AuthThrottle) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+		login := r.Context().Value(OIDCKey).(*oidcLogin)
+
+		ip := remoteIP(r)
+		keys := []string{accountKey(strings.ToLower(login.email)), ipKey(ip)}
+
+		if wait := t.Check(keys...); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			return handleError(http.StatusTooManyRequests, fmt.Errorf("Could not authenticate %s: locked out for %v", login.email, wait))
+		}
+
+		user, err := store.ReadUserByEmail(r.Context(), login.email)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+		if user == nil || user.DeletedAt != nil {
+			return handleError(http.StatusUnauthorized, fmt.Errorf("Could not find user %s", login.email))
+		}
+		if user.Disabled {
+			return handleError(http.StatusUnauthorized, fmt.Errorf("Could not authenticate user %d:%s: user is disabled", user.ID, user.Email))
+		}
+
+		//the identity provider replaces the password, not the second factor
+		if err = user.VerifySecondFactor(r.Context(), store, login.totp); err != nil {
+			if e, ok := err.(*api.Error); ok && e.Type == api.ErrorTypeServer {
+				return checkAPIError(err)
+			}
+			t.Failure(keys...)
+			log.Printf("auth failure: email=%q user_id=%d ip=%s reason=%q\n", login.email, user.ID, ip, "invalid second factor")
+			if resp := checkAPIError(store.CreateAuthFailure(r.Context(), &api.AuthFailure{
+				Email: login.email, UserID: user.ID, Date: time.Now(), IP: ip, UserAgent: r.UserAgent(), Reason: "invalid second factor",
+			})); resp != nil {
+				return resp
+			}
+			return handleError(http.StatusUnauthorized, fmt.Errorf("Could not authenticate user %d:%s: %v", user.ID, user.Email, err))
+		}
+
+		t.Success(keys[0])
+
+		return createSession(r, s, n, user)
+	}
+}
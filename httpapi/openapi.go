@@ -0,0 +1,420 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//openAPIVersion is the version of the API described by the OpenAPI document
+const openAPIVersion = "1.0"
+
+//openAPIOperation documents a route. Request and Response are example values whose types are used to generate schemas
+type openAPIOperation struct {
+	Summary  string
+	Request  interface{}
+	Response interface{}
+	Code     int               //success status code; defaults to 200
+	Query    map[string]string //query parameter name to OpenAPI type
+	Admin    bool              //requires the admin role
+	Public   bool              //doesn't require a session
+}
+
+var eventExportQuery = map[string]string{"format": "string", "since": "string", "until": "string"}
+
+var reportRangeQuery = map[string]string{"period": "string", "since": "string", "until": "string"}
+
+var statsFilterQuery = map[string]string{"location": "string", "model_id": "integer", "status": "string", "category_id": "integer"}
+
+var statsTimeSeriesQuery = map[string]string{
+	"period":      "string",
+	"since":       "string",
+	"until":       "string",
+	"location":    "string",
+	"model_id":    "integer",
+	"status":      "string",
+	"category_id": "integer",
+}
+
+var deviceQuery = map[string]string{
+	"search":        "string",
+	"serial_number": "string",
+	"manufacturer":  "string",
+	"model":         "string",
+	"category":      "string",
+	"status":        "string",
+	"location":      "string",
+	"attribution":   "boolean",
+}
+
+//openAPIOperations documents every route by "METHOD path"; routes missing here are still listed, without schemas
+var openAPIOperations = map[string]*openAPIOperation{
+	"GET /statuses/":                 {Summary: "List statuses", Response: &ReadStatusesResponse{}},
+	"POST /statuses/":                {Summary: "Create a status", Admin: true, Request: &StatusRequest{}, Response: &ReadStatusesResponse{}},
+	"GET /statuses/details/":         {Summary: "List statuses with their details", Response: &ReadStatusDetailsResponse{}},
+	"GET /statuses/{status}":         {Summary: "Read a status's details", Response: &api.StatusDetail{}},
+	"POST /statuses/{status}":        {Summary: "Rename a status", Admin: true, Request: &RenameStatusRequest{}, Response: &ReadStatusesResponse{}},
+	"POST /statuses/{status}/detail": {Summary: "Update a status's details", Admin: true, Request: &api.StatusDetail{}, Response: &api.StatusDetail{}},
+	"DELETE /statuses/{status}":      {Summary: "Delete an unused status", Admin: true, Response: &ReadStatusesResponse{}},
+
+	"GET /locations/":                   {Summary: "List locations", Response: &ReadLocationsResponse{}},
+	"POST /locations/":                  {Summary: "Create a location", Admin: true, Request: &LocationRequest{}, Response: &ReadLocationsResponse{}},
+	"GET /locations/tree/":              {Summary: "List locations as a tree", Response: &ReadLocationTreeResponse{}},
+	"GET /locations/{location}":         {Summary: "Read a location's details", Response: &api.LocationDetail{}},
+	"POST /locations/{location}":        {Summary: "Rename a location", Admin: true, Request: &RenameLocationRequest{}, Response: &ReadLocationsResponse{}},
+	"POST /locations/{location}/detail": {Summary: "Update a location's details", Admin: true, Request: &api.LocationDetail{}, Response: &api.LocationDetail{}},
+	"DELETE /locations/{location}":      {Summary: "Delete an unused location", Admin: true, Response: &ReadLocationsResponse{}},
+
+	"GET /carts/":              {Summary: "List carts", Response: &ReadCartsResponse{}},
+	"POST /carts/":             {Summary: "Create a cart", Admin: true, Request: &api.Cart{}, Response: &api.Cart{}},
+	"GET /carts/{id}":          {Summary: "Read a cart", Response: &api.Cart{}},
+	"POST /carts/{id}":         {Summary: "Update a cart", Admin: true, Request: &api.Cart{}, Response: &api.Cart{}},
+	"DELETE /carts/{id}":       {Summary: "Delete a cart", Admin: true, Response: &api.Cart{}},
+	"GET /carts/{id}/devices":  {Summary: "List a cart's devices", Response: &QueryDeviceResponse{}},
+	"POST /carts/{id}/devices": {Summary: "Set a cart's devices", Request: &UpdateCartDevicesRequest{}, Response: &QueryDeviceResponse{}},
+	"POST /carts/{id}/status":  {Summary: "Set the status of every device in a cart", Request: &UpdateCartStatusRequest{}, Response: &QueryDeviceResponse{}},
+
+	"GET /glossary/":        {Summary: "List glossary terms", Query: map[string]string{"q": "string"}, Response: &ReadGlossaryTermsResponse{}},
+	"POST /glossary/":       {Summary: "Create a glossary term", Admin: true, Request: &api.GlossaryTerm{}, Response: &api.GlossaryTerm{}},
+	"GET /glossary/{id}":    {Summary: "Read a glossary term", Response: &api.GlossaryTerm{}},
+	"POST /glossary/{id}":   {Summary: "Update a glossary term", Admin: true, Request: &api.GlossaryTerm{}, Response: &api.GlossaryTerm{}},
+	"DELETE /glossary/{id}": {Summary: "Delete a glossary term", Admin: true, Response: &api.GlossaryTerm{}},
+
+	"GET /categories/":        {Summary: "List categories", Response: &ReadCategoriesResponse{}},
+	"POST /categories/":       {Summary: "Create a category", Admin: true, Request: &api.Category{}, Response: &api.Category{}},
+	"GET /categories/{id}":    {Summary: "Read a category", Response: &api.Category{}},
+	"POST /categories/{id}":   {Summary: "Update a category", Admin: true, Request: &api.Category{}, Response: &api.Category{}},
+	"DELETE /categories/{id}": {Summary: "Delete a category", Admin: true, Response: &api.Category{}},
+
+	"GET /models/":              {Summary: "Query models", Query: map[string]string{"manufacturer": "string", "model": "string", "category": "string"}, Response: &QueryModelResponse{}},
+	"POST /models/":             {Summary: "Create a model", Request: &api.Model{}, Response: &api.Model{}},
+	"GET /models/{id}":          {Summary: "Read a model", Response: &api.Model{}},
+	"POST /models/{id}":         {Summary: "Update a model", Request: &api.Model{}, Response: &api.Model{}},
+	"GET /models/{id}/merge":    {Summary: "Preview merging a model into another", Query: map[string]string{"into": "integer"}, Response: &api.ModelMerge{}},
+	"POST /models/{id}/merge":   {Summary: "Merge a model into another", Request: &MergeModelRequest{}, Response: &api.ModelMerge{}},
+	"DELETE /models/{id}":       {Summary: "Delete a model", Admin: true, Response: &api.Model{}},
+	"POST /models/{id}/restore": {Summary: "Restore a deleted model", Admin: true, Response: &api.Model{}},
+
+	"GET /devices/":                        {Summary: "Query devices", Query: deviceQuery, Response: &QueryDeviceResponse{}},
+	"POST /devices/":                       {Summary: "Create a device", Request: &CreateDeviceRequest{}, Response: &api.Device{}},
+	"GET /devices/changes":                 {Summary: "Read device changes since a cursor", Query: map[string]string{"since": "string", "limit": "integer"}, Response: &api.DeviceChanges{}},
+	"GET /devices/{id}":                    {Summary: "Read a device", Query: map[string]string{"events": "boolean"}, Response: &api.Device{}},
+	"POST /devices/{id}":                   {Summary: "Update a device", Request: &api.Device{}, Response: &api.Device{}},
+	"GET /devices/{id}/events/":            {Summary: "List a device's events", Response: &ReadEventsResponse{}},
+	"GET /devices/{id}/recommendations/":   {Summary: "List recommended changes for a device", Response: &ReadRecommendationsResponse{}},
+	"POST /devices/{id}/notes/":            {Summary: "Add a note to a device", Request: &NoteRequest{}, Response: &api.Device{}},
+	"GET /devices/{id}/links/":             {Summary: "List a device's links", Response: &ReadDeviceLinksResponse{}},
+	"POST /devices/{id}/links/":            {Summary: "Add a link to a device", Request: &api.DeviceLink{}, Response: &api.DeviceLink{}},
+	"POST /devices/{id}/links/{link_id}":   {Summary: "Update a device link", Request: &api.DeviceLink{}, Response: &api.DeviceLink{}},
+	"DELETE /devices/{id}/links/{link_id}": {Summary: "Delete a device link", Response: &api.DeviceLink{}},
+	"DELETE /devices/{id}":                 {Summary: "Delete a device", Admin: true, Response: &api.Device{}},
+	"POST /devices/{id}/restore":           {Summary: "Restore a deleted device", Admin: true, Response: &api.Device{}},
+
+	"POST /users/":                              {Summary: "Create a user", Admin: true, Request: &CreateUserRequest{}, Response: &api.User{}},
+	"POST /users/invite":                        {Summary: "Invite someone to create a user", Admin: true, Request: &InviteUserRequest{}, Response: &api.Invitation{}},
+	"POST /users/invite/accept":                 {Summary: "Create a user from an invitation", Public: true, Request: &AcceptInvitationRequest{}, Response: &api.User{}},
+	"GET /users/{id}":                           {Summary: "Read a user", Response: &api.User{}},
+	"POST /users/{id}":                          {Summary: "Update the authenticated user", Request: &api.User{}, Response: &api.User{}},
+	"DELETE /users/{id}":                        {Summary: "Delete a user", Admin: true},
+	"POST /users/{id}/password":                 {Summary: "Change the authenticated user's password", Request: &ChangeUserPasswordRequest{}, Response: &api.User{}},
+	"POST /users/{id}/totp":                     {Summary: "Begin TOTP enrollment", Response: &api.TOTPEnrollment{}},
+	"POST /users/{id}/totp/verify":              {Summary: "Enable TOTP", Request: &TOTPCodeRequest{}, Response: &RecoveryCodesResponse{}},
+	"DELETE /users/{id}/totp":                   {Summary: "Disable TOTP", Request: &DisableTOTPRequest{}, Response: &api.User{}},
+	"GET /users/{id}/locations":                 {Summary: "List the locations a user may access", Admin: true, Response: &ReadLocationsResponse{}},
+	"POST /users/{id}/locations":                {Summary: "Set the locations a user may access", Admin: true, Request: &UserLocationsRequest{}, Response: &ReadLocationsResponse{}},
+	"POST /users/{id}/role":                     {Summary: "Set a user's role", Admin: true, Request: &UserRoleRequest{}, Response: &api.User{}},
+	"GET /users/{id}/grants/":                   {Summary: "List a user's temporary access grants", Admin: true, Response: &ReadGrantsResponse{}},
+	"POST /users/{id}/grants/":                  {Summary: "Grant a user temporary access", Admin: true, Request: &api.Grant{}, Response: &api.Grant{}},
+	"DELETE /users/{id}/grants/{grant_id}":      {Summary: "Revoke a temporary access grant", Admin: true, Response: &api.Grant{}},
+	"GET /users/{id}/grants/{grant_id}/events/": {Summary: "List a grant's events", Admin: true, Response: &ReadEventsResponse{}},
+
+	"GET /webhooks/":                 {Summary: "List webhooks", Admin: true, Response: &ReadWebhooksResponse{}},
+	"POST /webhooks/":                {Summary: "Register a webhook. The secret is only returned now", Admin: true, Request: &api.Webhook{}, Response: &api.Webhook{}},
+	"GET /webhooks/{id}":             {Summary: "Read a webhook", Admin: true, Response: &api.Webhook{}},
+	"POST /webhooks/{id}":            {Summary: "Update a webhook. An empty secret keeps the current secret", Admin: true, Request: &api.Webhook{}, Response: &api.Webhook{}},
+	"DELETE /webhooks/{id}":          {Summary: "Delete a webhook and its delivery log", Admin: true, Response: &api.Webhook{}},
+	"GET /webhooks/{id}/deliveries/": {Summary: "List a webhook's latest deliveries", Admin: true, Query: map[string]string{"limit": "integer"}, Response: &ReadWebhookDeliveriesResponse{}},
+
+	"GET /admin/report-schedules/":          {Summary: "List scheduled reports", Admin: true, Response: &ReadReportSchedulesResponse{}},
+	"POST /admin/report-schedules/":         {Summary: "Schedule a report to be emailed", Admin: true, Request: &api.ReportSchedule{}, Response: &api.ReportSchedule{}},
+	"GET /admin/report-schedules/{id}":      {Summary: "Read a scheduled report", Admin: true, Response: &api.ReportSchedule{}},
+	"POST /admin/report-schedules/{id}":     {Summary: "Update a scheduled report", Admin: true, Request: &api.ReportSchedule{}, Response: &api.ReportSchedule{}},
+	"DELETE /admin/report-schedules/{id}":   {Summary: "Delete a scheduled report", Admin: true, Response: &api.ReportSchedule{}},
+	"POST /admin/report-schedules/{id}/run": {Summary: "Run a scheduled report within a minute", Admin: true, Response: &api.ReportSchedule{}},
+	"POST /users/{id}/disabled":             {Summary: "Disable or enable a user", Admin: true, Request: &UserDisabledRequest{}, Response: &api.User{}},
+	"POST /users/{id}/restore":              {Summary: "Restore a deleted user", Admin: true, Response: &api.User{}},
+
+	"GET /dashboard":          {Summary: "Read the user's dashboard widgets with their data", Response: &api.Dashboard{}},
+	"GET /dashboard/widgets":  {Summary: "List the user's dashboard widgets", Response: &ReadDashboardWidgetsResponse{}},
+	"POST /dashboard/widgets": {Summary: "Set the user's dashboard widgets. An empty list restores the defaults", Request: &DashboardWidgetsRequest{}, Response: &ReadDashboardWidgetsResponse{}},
+
+	"GET /stats/":                      {Summary: "Read inventory statistics", Query: statsFilterQuery, Response: &api.Stats{}},
+	"GET /stats/timeseries":            {Summary: "Read device activity per period", Query: statsTimeSeriesQuery, Response: &api.StatsTimeSeries{}},
+	"GET /search":                      {Summary: "Search devices, models, users, locations, and notes", Query: map[string]string{"q": "string", "limit": "integer"}, Response: &SearchResponse{}},
+	"GET /events/batches/{id}":         {Summary: "Read the device events created by a bulk operation", Admin: true, Response: &api.EventBatch{}},
+	"POST /events/batches/{id}/revert": {Summary: "Revert the changes made by a bulk operation", Admin: true, Response: &api.EventBatch{}},
+	"GET /events/search":               {Summary: "Search device notes", Query: map[string]string{"q": "string", "limit": "integer"}, Response: &SearchNotesResponse{}},
+	"GET /graphql":                     {Summary: "Run a read-only GraphQL query", Query: map[string]string{"query": "string", "variables": "string"}, Response: &GraphQLResponse{}},
+	"POST /graphql":                    {Summary: "Run a read-only GraphQL query", Request: &GraphQLRequest{}, Response: &GraphQLResponse{}},
+	"GET /audit":                       {Summary: "Query the audit log", Admin: true, Query: map[string]string{"user_id": "integer", "entity": "string", "source": "string", "since": "string", "until": "string", "limit": "integer"}, Response: &QueryAuditEntriesResponse{}},
+
+	"GET /admin/vocabulary":         {Summary: "List new models awaiting review", Admin: true, Response: &ReadVocabularyReviewQueueResponse{}},
+	"POST /admin/vocabulary/review": {Summary: "Mark new models as reviewed", Admin: true, Request: &ReviewVocabularyRequest{}, Response: &ReadVocabularyReviewQueueResponse{}},
+	"POST /admin/recompute":         {Summary: "Start recomputing derived device data", Admin: true, Code: http.StatusAccepted, Response: &RecomputeJob{}},
+	"GET /admin/recompute/{id}":     {Summary: "Read a recompute job's progress", Admin: true, Response: &RecomputeJob{}},
+	"GET /admin/events/archive":     {Summary: "Query archived device events", Admin: true, Query: map[string]string{"device_id": "integer", "since": "string", "until": "string", "limit": "integer"}, Response: &QueryArchivedEventsResponse{}},
+	"GET /admin/events/verify":      {Summary: "Verify the device event hash chain", Admin: true, Query: map[string]string{"after": "integer", "limit": "integer"}, Response: &api.EventChainVerification{}},
+
+	"GET /reports/eol":              {Summary: "Report models past or near end-of-life", Query: map[string]string{"days": "integer"}, Response: &api.EOLReport{}},
+	"GET /reports/status-durations": {Summary: "Report how long devices spend in a status", Query: map[string]string{"status": "string", "over_days": "integer"}, Response: &api.StatusDurationReport{}},
+	"GET /reports/carts":            {Summary: "Report cart capacity and misplaced devices", Response: &ReadCartReconciliationsResponse{}},
+	"GET /reports/refresh":          {Summary: "Report device ages and project replacements", Query: map[string]string{"age_years": "integer", "months": "integer"}, Response: &api.RefreshReport{}},
+	"GET /reports/contributions":    {Summary: "Report the device events each user created per period", Query: reportRangeQuery, Response: &api.ContributionReport{}},
+	"GET /reports/snapshot":         {Summary: "Report the inventory as of a date", Query: map[string]string{"date": "string"}, Response: &api.InventorySnapshot{}},
+	"POST /reports/simulate":        {Summary: "Simulate bulk changes without committing them", Request: &SimulateRequest{}, Response: &api.Simulation{}},
+	"POST /reports/run":             {Summary: "Run a custom report definition", Request: &api.ReportDefinition{}, Response: &api.ReportResult{}},
+
+	"POST /events/token":              {Summary: "Create a single use token for opening an event stream or WebSocket without the X-Session-Key header", Response: &StreamTokenResponse{}},
+	"GET /events/stream":              {Summary: "Stream device and model changes as Server-Sent Events (text/event-stream)", Query: map[string]string{"token": "string"}},
+	"GET /events/export":              {Summary: "Export device events as JSON or CSV", Admin: true, Query: eventExportQuery, Response: &ExportEventsResponse{}},
+	"GET /devices/{id}/events/export": {Summary: "Export a device's events as JSON or CSV", Admin: true, Query: eventExportQuery, Response: &ExportEventsResponse{}},
+	"GET /ws/updates":                 {Summary: "Subscribe to device changes as JSON Patches over a WebSocket", Query: map[string]string{"token": "string"}, Code: http.StatusSwitchingProtocols},
+
+	"POST /auth":               {Summary: "Authenticate with an email and password", Public: true, Request: &AuthenticateRequest{}, Response: &AuthenticateResponse{}},
+	"GET /auth/oidc/login":     {Summary: "Read the single sign-on login URL", Public: true, Response: &OIDCLoginResponse{}},
+	"POST /auth/oidc/callback": {Summary: "Authenticate with a single sign-on authorization code", Public: true, Request: &OIDCCallbackRequest{}, Response: &AuthenticateResponse{}},
+	"POST /auth/revoke":        {Summary: "Sign a user out everywhere with a login notification token", Public: true, Request: &RevokeLoginRequest{}, Response: &api.Login{}},
+
+	"GET /debug/vars":             {Summary: "Read runtime, memory, and database connection statistics", Admin: true, Response: &RuntimeStatsResponse{}},
+	"GET /health":                 {Summary: "Read service health", Public: true, Response: &HealthResponse{}},
+	"GET /admin/journal":          {Summary: "Read the request journal and capture filter", Admin: true, Response: &JournalResponse{}},
+	"DELETE /admin/journal":       {Summary: "Stop capturing requests and clear the request journal", Admin: true, Response: &JournalResponse{}},
+	"POST /admin/journal/capture": {Summary: "Record requests by a user or to a path in the request journal", Admin: true, Request: &JournalCapture{}, Response: &JournalResponse{}},
+	"GET /admin/health/history":   {Summary: "Read service health and recorded self-checks", Admin: true, Query: map[string]string{"since": "string", "until": "string"}, Response: &HealthHistoryResponse{}},
+	"GET /version":                {Summary: "Read the server's build information", Public: true, Response: &BuildInfo{}},
+	"GET /openapi.json":           {Summary: "Read this OpenAPI document", Public: true},
+}
+
+//openAPIPathVar matches a mux path variable, with an optional pattern
+var openAPIPathVar = regexp.MustCompile(`\{([^}:]+)(?::([^}]*))?\}`)
+
+//openAPISchemas generates OpenAPI schemas from Go types, collecting named structs as components
+type openAPISchemas struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		sc := s.schema(t.Elem())
+		if _, ok := sc["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{sc}, "nullable": true}
+		}
+		sc["nullable"] = true
+		return sc
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s.components[t.Name()]; !ok {
+			//reserve the name first so recursive types terminate
+			s.components[t.Name()] = nil
+			s.components[t.Name()] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	//interface{} and anything else can be any value
+	return map[string]interface{}{}
+}
+
+//object returns the schema for the exported, JSON encoded fields of the given struct type
+func (s *openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+
+		properties[name] = s.schema(f.Type)
+	}
+
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+//content returns an OpenAPI JSON media type for the given example value
+func (s *openAPISchemas) content(v interface{}) map[string]interface{} {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": s.schema(t)},
+	}
+}
+
+//newOpenAPIDocument returns an OpenAPI 3 document describing the routes registered on r
+func newOpenAPIDocument(r *mux.Router) map[string]interface{} {
+	s := &openAPISchemas{components: make(map[string]interface{})}
+	errorResponse := map[string]interface{}{"description": "Error", "content": s.content(&ErrorResponse{})}
+
+	paths := make(map[string]map[string]interface{})
+
+	//Walk only returns errors from the walk function, which never returns one
+	_ = r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		var parameters []interface{}
+		for _, m := range openAPIPathVar.FindAllStringSubmatch(tmpl, -1) {
+			typ := "string"
+			if m[2] == "[0-9]+" {
+				typ = "integer"
+			}
+			parameters = append(parameters, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": typ},
+			})
+		}
+		path := openAPIPathVar.ReplaceAllString(tmpl, "{$1}")
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+
+		for _, method := range methods {
+			doc := openAPIOperations[method+" "+path]
+			if doc == nil {
+				doc = new(openAPIOperation)
+			}
+
+			code := doc.Code
+			if code == 0 {
+				code = http.StatusOK
+			}
+			success := map[string]interface{}{"description": http.StatusText(code)}
+			if doc.Response != nil {
+				success["content"] = s.content(doc.Response)
+			}
+
+			op := map[string]interface{}{
+				"operationId": strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_", ".", "_").Replace(strings.TrimSuffix(path, "/")),
+				"tags":        []string{strings.Split(strings.TrimPrefix(path, "/"), "/")[0]},
+				"responses":   map[string]interface{}{strconv.Itoa(code): success, "default": errorResponse},
+			}
+			if doc.Summary != "" {
+				op["summary"] = doc.Summary
+			}
+			if doc.Admin {
+				op["description"] = "Requires the admin role."
+			}
+			if doc.Public {
+				op["security"] = []interface{}{}
+			}
+			if doc.Request != nil {
+				op["requestBody"] = map[string]interface{}{"required": true, "content": s.content(doc.Request)}
+			}
+
+			params := append([]interface{}{}, parameters...)
+			var names []string
+			for name := range doc.Query {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				params = append(params, map[string]interface{}{
+					"name": name, "in": "query", "schema": map[string]interface{}{"type": doc.Query[name]},
+				})
+			}
+			if len(params) > 0 {
+				op["parameters"] = params
+			}
+
+			paths[path][strings.ToLower(method)] = op
+		}
+
+		return nil
+	})
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "TCEA Inventory API",
+			"version": openAPIVersion,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": "/api/" + openAPIVersion}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": s.components,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Session-Key"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"session": []string{}}},
+	}
+}
+
+// GET /openapi.json
+func handleReadOpenAPI(doc map[string]interface{}) returnHandler {
+	//encode once; the document doesn't change after the router is built
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+	raw := json.RawMessage(buf)
+
+	return func(_ http.ResponseWriter, _ *http.Request) *handlerResponse {
+		return &handlerResponse{Code: http.StatusOK, Body: raw}
+	}
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//ParseTrustedProxies parses the given IP addresses and CIDR ranges (e.g. 10.0.0.1 or 10.0.0.0/8), or returns an error if one is invalid
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %s", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range: %s", p)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+//trustedIP returns true if ip is in one of the trusted ranges
+func trustedIP(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+//forwardedIP returns the client IP for a request from a trusted proxy: the last X-Forwarded-For address that isn't
+//a trusted proxy itself (addresses before it could be set by the client), or peer if there is no such address
+func forwardedIP(peer string, header []string, trusted []*net.IPNet) string {
+	var hops []string
+	for _, h := range header {
+		for _, hop := range strings.Split(h, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	ip := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		ip = hops[i]
+		if !trustedIP(ip, trusted) {
+			break
+		}
+	}
+
+	return ip
+}
+
+//proxyMiddleware sets the request RemoteAddr to the client IP from X-Forwarded-For if the request came from a trusted proxy,
+//so logins, throttling, and lockouts see the client instead of the proxy. The header is ignored from other peers
+func proxyMiddleware(next http.Handler, trusted []*net.IPNet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := remoteIP(r)
+		if trustedIP(peer, trusted) {
+			if header := r.Header.Values("X-Forwarded-For"); len(header) > 0 {
+				r.RemoteAddr = net.JoinHostPort(forwardedIP(peer, header, trusted), "0")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const recomputeBatchSize = 500
+
+//RecomputeJob statuses
+const (
+	RecomputeRunning  = "running"
+	RecomputeComplete = "complete"
+	RecomputeFailed   = "failed"
+)
+
+//RecomputeJob represents a background job rebuilding derived data (Device last events and cached stats)
+type RecomputeJob struct {
+	ID       int64      `json:"id"`
+	Status   string     `json:"status"`
+	Total    int64      `json:"total"`
+	Done     int64      `json:"done"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+//Recomputer runs RecomputeJobs, one at a time, and keeps their progress
+type Recomputer struct {
+	db      *sql.DB
+	cache   api.Cache
+	workers *Workers
+	jobs    map[int64]*RecomputeJob
+	next    int64
+	mu      *sync.Mutex
+}
+
+//NewRecomputer returns a new Recomputer for the given database and Cache (which may be nil). Jobs are run with workers
+func NewRecomputer(db *sql.DB, cache api.Cache, workers *Workers) *Recomputer {
+	return &Recomputer{db: db, cache: cache, workers: workers, jobs: make(map[int64]*RecomputeJob), next: 1, mu: new(sync.Mutex)}
+}
+
+//Start starts a new RecomputeJob and returns a copy of it. If a job is already running, a copy of it is returned with ok false
+func (rc *Recomputer) Start() (job RecomputeJob, ok bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for _, j := range rc.jobs {
+		if j.Status == RecomputeRunning {
+			return *j, false
+		}
+	}
+
+	j := &RecomputeJob{ID: rc.next, Status: RecomputeRunning, Started: time.Now()}
+	rc.jobs[j.ID] = j
+	rc.next++
+
+	rc.workers.Go(func(ctx context.Context) { rc.run(ctx, j) })
+
+	return *j, true
+}
+
+//Job returns a copy of the RecomputeJob with the given id, or nil if it doesn't exist
+func (rc *Recomputer) Job(id int64) *RecomputeJob {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	j, ok := rc.jobs[id]
+	if !ok {
+		return nil
+	}
+
+	job := *j
+	return &job
+}
+
+//update updates the given job while holding the Recomputer lock
+func (rc *Recomputer) update(j *RecomputeJob, f func(j *RecomputeJob)) {
+	rc.mu.Lock()
+	f(j)
+	rc.mu.Unlock()
+}
+
+//run runs the given job to completion, or until ctx is done
+func (rc *Recomputer) run(ctx context.Context, j *RecomputeJob) {
+	err := rc.recompute(ctx, j)
+
+	rc.update(j, func(j *RecomputeJob) {
+		now := time.Now()
+		j.Finished = &now
+		if err != nil {
+			j.Status = RecomputeFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = RecomputeComplete
+	})
+
+	if err != nil {
+		log.Printf("Recompute job %d failed: %v\n", j.ID, err)
+	}
+}
+
+//recompute rebuilds derived data in batches, updating the job's progress.
+//If ctx is done, it returns an error after the current batch
+func (rc *Recomputer) recompute(ctx context.Context, j *RecomputeJob) error {
+	err := withTransaction(rc.db, rc.cache, func(ctx context.Context, store *api.TxStore) error {
+		total, err := store.CountDevices(ctx)
+		if err != nil {
+			return err
+		}
+		rc.update(j, func(j *RecomputeJob) { j.Total = total })
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var last int64
+	for {
+		var n int
+		err = withTransaction(rc.db, rc.cache, func(ctx context.Context, store *api.TxStore) error {
+			var err error
+			last, n, err = store.RecomputeDevices(ctx, last, recomputeBatchSize)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		rc.update(j, func(j *RecomputeJob) { j.Done += int64(n) })
+
+		if n < recomputeBatchSize {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return errors.New("Server shut down before the job finished")
+		}
+	}
+
+	//stats and other cached aggregates are rebuilt on the next read
+	if rc.cache != nil {
+		rc.cache.Flush()
+	}
+
+	return nil
+}
+
+// POST /admin/recompute
+func handleStartRecompute(rc *Recomputer) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		job, ok := rc.Start()
+		if !ok {
+			return handleError(http.StatusConflict, fmt.Errorf("Recompute job %d is already running", job.ID))
+		}
+
+		return &handlerResponse{Code: http.StatusAccepted, Body: &job}
+	}
+}
+
+// GET /admin/recompute/{id}
+func handleReadRecompute(rc *Recomputer) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+		}
+
+		job := rc.Job(id)
+		if job == nil {
+			return handleError(http.StatusNotFound, errors.New("Could not find recompute job"))
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: job}
+	}
+}
@@ -0,0 +1,28 @@
+package httpapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+//panicCount is the number of handler panics recovered since the server started
+var panicCount int64
+
+//recoverMiddleware recovers from panics in next, logging the stack and returning a 500 handlerResponse.
+//It must be wrapped by jsonMiddleware so the error is written
+func recoverMiddleware(next returnHandler) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) (resp *handlerResponse) {
+		defer func() {
+			if v := recover(); v != nil {
+				atomic.AddInt64(&panicCount, 1)
+				log.Printf("Recovered from panic in %s %s: %v\n%s", r.Method, r.URL.Path, v, debug.Stack())
+				resp = handleError(http.StatusInternalServerError, fmt.Errorf("Recovered from panic: %v", v))
+			}
+		}()
+
+		return next(w, r)
+	}
+}
@@ -0,0 +1,216 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const (
+	defaultEOLReportDays = 365
+
+	defaultRefreshReportMonths = 12
+	maxRefreshReportMonths     = 120
+
+	defaultReportPeriod    = api.PeriodWeek
+	defaultReportRangeDays = 30
+)
+
+//parseReportRange returns the period and date range (since inclusive, until exclusive) from the request's period, since, and until
+//(inclusive) query parameters, or an error response. By default, the range is the defaultReportRangeDays days ending today
+func parseReportRange(r *http.Request) (period api.Period, since, until time.Time, resp *handlerResponse) {
+	q := r.URL.Query()
+
+	period = defaultReportPeriod
+	if v := q.Get("period"); v != "" {
+		period = api.Period(v)
+	}
+
+	now := time.Now()
+	until = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+	if v := q.Get("until"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return "", since, until, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode until: %v", err))
+		}
+		//until is inclusive
+		until = t.AddDate(0, 0, 1)
+	}
+
+	since = until.AddDate(0, 0, -defaultReportRangeDays)
+	if v := q.Get("since"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return "", since, until, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode since: %v", err))
+		}
+		since = t
+	}
+
+	return period, since, until, nil
+}
+
+// GET /reports/eol
+func handleReadEOLReport(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	days := defaultEOLReportDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode days: %v", err))
+		}
+		if d < 0 {
+			return handleError(http.StatusBadRequest, fmt.Errorf("days (%d) must not be negative", d))
+		}
+		days = d
+	}
+
+	report, err := store.ReadEOLReport(r.Context(), days)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: report}
+}
+
+// GET /reports/status-durations
+func handleReadStatusDurationReport(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var overDays int
+	if v := r.URL.Query().Get("over_days"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode over_days: %v", err))
+		}
+		overDays = d
+	}
+
+	report, err := store.ReadStatusDurationReport(r.Context(), api.Status(r.URL.Query().Get("status")), overDays)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: report}
+}
+
+// GET /reports/contributions
+func handleReadContributionReport(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	period, since, until, resp := parseReportRange(r)
+	if resp != nil {
+		return resp
+	}
+
+	report, err := store.ReadContributionReport(r.Context(), period, since, until)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: report}
+}
+
+// GET /reports/refresh
+func handleReadRefreshReport(ageYears int) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		q := r.URL.Query()
+
+		age := ageYears
+		if v := q.Get("age_years"); v != "" {
+			a, err := strconv.Atoi(v)
+			if err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode age_years: %v", err))
+			}
+			age = a
+		}
+
+		months := defaultRefreshReportMonths
+		if v := q.Get("months"); v != "" {
+			m, err := strconv.Atoi(v)
+			if err != nil {
+				return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode months: %v", err))
+			}
+			if m < 0 || m > maxRefreshReportMonths {
+				return handleError(http.StatusBadRequest, fmt.Errorf("months (%d) must be between 0 and %d", m, maxRefreshReportMonths))
+			}
+			months = m
+		}
+
+		report, err := store.ReadRefreshReport(r.Context(), age, months)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: report}
+	}
+}
+
+// GET /reports/snapshot
+func handleReadInventorySnapshot(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	v := r.URL.Query().Get("date")
+	if v == "" {
+		return handleError(http.StatusBadRequest, errors.New("date cannot be empty"))
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode date: %v", err))
+	}
+
+	snapshot, err := store.ReadInventorySnapshot(r.Context(), date)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: snapshot}
+}
+
+// POST /reports/simulate
+func handleSimulate(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var req *SimulateRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	sim, err := store.Simulate(r.Context(), req.Changes)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: sim}
+}
+
+// POST /reports/run
+func handleRunReport(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var def *api.ReportDefinition
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&def)
+	if err != nil || def == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	result, err := store.RunReport(r.Context(), def)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: result}
+}
@@ -15,6 +15,48 @@ type CreateUserRequest struct {
 	Name     string `json:"name"`
 }
 
+//InviteUserRequest is a request to invite someone to create their own User
+type InviteUserRequest struct {
+	Email string `json:"email"`
+}
+
+//AcceptInvitationRequest is a request to create a User from an invitation
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+//RevokeLoginRequest is a request to sign a User out everywhere from a login notification
+type RevokeLoginRequest struct {
+	Token string `json:"token"`
+}
+
+//UpdateCartDevicesRequest is a request to set the Devices in a Cart
+type UpdateCartDevicesRequest struct {
+	DeviceIDs []int64 `json:"device_ids"`
+}
+
+//UpdateCartStatusRequest is a request to set the Status of every Device in a Cart
+type UpdateCartStatusRequest struct {
+	Status api.Status `json:"status"`
+}
+
+//ReviewVocabularyRequest is a request to mark new Models as reviewed
+type ReviewVocabularyRequest struct {
+	ModelIDs []int64 `json:"model_ids"`
+}
+
+//SimulateRequest is a request to simulate bulk changes to the inventory
+type SimulateRequest struct {
+	Changes []*api.SimulationChange `json:"changes"`
+}
+
+//DashboardWidgetsRequest is a request to set the request User's DashboardWidgets. An empty list restores the defaults
+type DashboardWidgetsRequest struct {
+	Widgets []*api.DashboardWidget `json:"widgets"`
+}
+
 //ChangeUserPasswordRequest is a request to change a User's password
 type ChangeUserPasswordRequest struct {
 	OldPassword string `json:"old_password"`
@@ -26,8 +68,85 @@ type NoteRequest struct {
 	Note string `json:"note"`
 }
 
-//AuthenticateRequest is an email/password authentication request
+//AuthenticateRequest is an email/password authentication request.
+//TOTP is a TOTP or recovery code and is required if the User has TOTP enabled
 type AuthenticateRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	TOTP     string `json:"totp,omitempty"`
+}
+
+//OIDCCallbackRequest is the code and state the identity provider redirected back to the client with,
+//and a TOTP or recovery code if the User has TOTP enabled
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+	TOTP  string `json:"totp,omitempty"`
+}
+
+//LocationRequest is a Location encapsulated in a JSON object
+type LocationRequest struct {
+	Location api.Location `json:"location"`
+}
+
+//RenameLocationRequest is a request to rename a Location. If Cascade is true, Devices at the Location are moved to the new name
+type RenameLocationRequest struct {
+	Location api.Location `json:"location"`
+	Cascade  bool         `json:"cascade"`
+}
+
+//StatusRequest is a Status encapsulated in a JSON object
+type StatusRequest struct {
+	Status api.Status `json:"status"`
+}
+
+//RenameStatusRequest is a request to rename a Status. If Cascade is true, Devices with the Status are changed to the new name
+type RenameStatusRequest struct {
+	Status  api.Status `json:"status"`
+	Cascade bool       `json:"cascade"`
+}
+
+//MergeModelRequest is a request to merge a Model into the Model with the Into ID
+type MergeModelRequest struct {
+	Into int64 `json:"into"`
+}
+
+//UserLocationsRequest is a list of Locations granted to a User
+type UserLocationsRequest struct {
+	Locations []api.Location `json:"locations"`
+}
+
+//TOTPCodeRequest is a TOTP code encapsulated in a JSON object
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+//DisableTOTPRequest confirms disabling TOTP with the current password or, for the User's own TOTP, a TOTP or recovery code
+type DisableTOTPRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+//UserDisabledRequest is a request to disable or enable a User
+type UserDisabledRequest struct {
+	Disabled bool `json:"disabled"`
+}
+
+//UserRoleRequest is a Role encapsulated in a JSON object
+type UserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+//UpdateSubscriptionRequest is a WebSocket message replacing the client's update subscription.
+//Devices match if they are (or were) at one of the Locations and have (or had) one of the Statuses; empty lists match everything
+type UpdateSubscriptionRequest struct {
+	Locations []api.Location `json:"locations"`
+	Statuses  []api.Status   `json:"statuses"`
+}
+
+//GraphQLRequest is a GraphQL query with optional variables
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
 }
@@ -1,6 +1,10 @@
 package httpapi
 
-import "github.com/korylprince/tcea-inventory-server/api"
+import (
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
 
 //AuthenticateResponse is a successful authentication response including the session key and User
 type AuthenticateResponse struct {
@@ -8,6 +12,16 @@ type AuthenticateResponse struct {
 	User       *api.User `json:"user"`
 }
 
+//RecoveryCodesResponse contains TOTP recovery codes. They are only returned once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+//OIDCLoginResponse contains the identity provider URL to send the user to
+type OIDCLoginResponse struct {
+	URL string `json:"url"`
+}
+
 //QueryModelResponse contains a list of Models
 type QueryModelResponse struct {
 	Models []*api.Model `json:"models"`
@@ -18,12 +32,155 @@ type QueryDeviceResponse struct {
 	Devices []*api.Device `json:"devices"`
 }
 
+//ReadDeviceLinksResponse contains a list of DeviceLinks
+type ReadDeviceLinksResponse struct {
+	Links []*api.DeviceLink `json:"links"`
+}
+
+//ReadWebhooksResponse contains a list of Webhooks
+type ReadWebhooksResponse struct {
+	Webhooks []*api.Webhook `json:"webhooks"`
+}
+
+//ReadWebhookDeliveriesResponse contains a list of WebhookDeliveries
+type ReadWebhookDeliveriesResponse struct {
+	Deliveries []*api.WebhookDelivery `json:"deliveries"`
+}
+
+//ReadReportSchedulesResponse contains a list of ReportSchedules
+type ReadReportSchedulesResponse struct {
+	Schedules []*api.ReportSchedule `json:"schedules"`
+}
+
+//ReadDashboardWidgetsResponse contains a list of DashboardWidgets
+type ReadDashboardWidgetsResponse struct {
+	Widgets []*api.DashboardWidget `json:"widgets"`
+}
+
+//ReadGrantsResponse contains a list of Grants
+type ReadGrantsResponse struct {
+	Grants []*api.Grant `json:"grants"`
+}
+
+//ReadEventsResponse contains a list of Events
+type ReadEventsResponse struct {
+	Events []*api.Event `json:"events"`
+}
+
 //ReadStatusesResponse contains a list of allowed Statuses
 type ReadStatusesResponse struct {
 	Statuses []api.Status `json:"statuses"`
 }
 
+//ReadStatusDetailsResponse contains a list of StatusDetails
+type ReadStatusDetailsResponse struct {
+	Statuses []*api.StatusDetail `json:"statuses"`
+}
+
 //ReadLocationsResponse contains a list of allowed Locations
 type ReadLocationsResponse struct {
 	Locations []api.Location `json:"locations"`
 }
+
+//ReadLocationTreeResponse contains the top-level LocationTrees of the location hierarchy
+type ReadLocationTreeResponse struct {
+	Locations []*api.LocationTree `json:"locations"`
+}
+
+//ReadCartsResponse contains a list of Carts
+type ReadCartsResponse struct {
+	Carts []*api.Cart `json:"carts"`
+}
+
+//ReadCartReconciliationsResponse contains a list of CartReconciliations
+type ReadCartReconciliationsResponse struct {
+	Carts []*api.CartReconciliation `json:"carts"`
+}
+
+//ReadGlossaryTermsResponse contains a list of GlossaryTerms
+type ReadGlossaryTermsResponse struct {
+	Terms []*api.GlossaryTerm `json:"terms"`
+}
+
+//ReadVocabularyReviewQueueResponse contains a list of unreviewed VocabularyEntries
+type ReadVocabularyReviewQueueResponse struct {
+	Entries []*api.VocabularyEntry `json:"entries"`
+}
+
+//ReadCategoriesResponse contains a list of Categories
+type ReadCategoriesResponse struct {
+	Categories []*api.Category `json:"categories"`
+}
+
+//ReadRecommendationsResponse contains a list of Recommendations for a Device
+type ReadRecommendationsResponse struct {
+	Recommendations []*api.Recommendation `json:"recommendations"`
+}
+
+//SearchResponse contains a list of SearchResults
+type SearchResponse struct {
+	Results []*api.SearchResult `json:"results"`
+}
+
+//ExportEventsResponse is the JSON format of an event export. It's streamed by exportMiddleware rather than encoded
+type ExportEventsResponse struct {
+	Events []*api.ExportedEvent `json:"events"`
+}
+
+//QueryArchivedEventsResponse contains a list of ArchivedEvents
+type QueryArchivedEventsResponse struct {
+	Events []*api.ArchivedEvent `json:"events"`
+}
+
+//StreamTokenResponse is a single use token for opening an event stream, valid until Expires
+type StreamTokenResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+//JournalResponse is the current JournalCapture (nil if requests aren't being recorded) and the recorded JournalEntries, oldest first
+type JournalResponse struct {
+	Capture *JournalCapture `json:"capture"`
+	Entries []*JournalEntry `json:"entries"`
+}
+
+//HealthHistoryResponse is the current service health and the recorded HealthChecks for a time range
+type HealthHistoryResponse struct {
+	OK           bool               `json:"ok"`
+	Started      time.Time          `json:"started"`
+	Uptime       float64            `json:"uptime_seconds"`
+	Panics       int64              `json:"panics"`
+	Availability float64            `json:"availability"`
+	Checks       []*api.HealthCheck `json:"checks"`
+}
+
+//SearchNotesResponse contains a list of NoteMatches
+type SearchNotesResponse struct {
+	Notes []*api.NoteMatch `json:"notes"`
+}
+
+//QueryAuditEntriesResponse contains a list of AuditEntries
+type QueryAuditEntriesResponse struct {
+	Entries []*api.AuditEntry `json:"entries"`
+}
+
+//JSONPatchOperation is an RFC 6902 JSON Patch operation
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+//DeviceUpdateMessage is a WebSocket message describing a change to a Device as a JSON Patch against the Device
+type DeviceUpdateMessage struct {
+	ID     int64                 `json:"id"`
+	Event  string                `json:"event"`
+	Date   time.Time             `json:"date"`
+	UserID int64                 `json:"user_id,omitempty"`
+	Patch  []*JSONPatchOperation `json:"patch"`
+}
+
+//GraphQLResponse is the result of a GraphQL query
+type GraphQLResponse struct {
+	Data interface{} `json:"data"`
+}
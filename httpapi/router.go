@@ -1,47 +1,263 @@
 package httpapi
 
 import (
+	"context"
 	"database/sql"
 	"io"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
 )
 
-//NewRouter returns an HTTP router for the HTTP API
-func NewRouter(w io.Writer, s SessionStore, db *sql.DB) http.Handler {
+//RouterOptions are optional features for the HTTP API. The zero value disables all of them
+type RouterOptions struct {
+	Cache              api.Cache     //if nil, caching is disabled
+	Mailer             api.Mailer    //if nil, no emails are sent
+	LoginNotifications string        //one of the LoginNotifications modes
+	Journal            *Journal      //if nil, requests can't be journaled
+	OIDC               *OIDCProvider //if nil, single sign-on is disabled
+	InviteURL          string        //client URL invitation tokens are appended to; if empty (or Mailer is nil), invitations are disabled
+	RevokeURL          string        //client URL login notification sign out tokens are appended to; if empty (or Mailer is nil), sign out links are disabled
+	MaxBodyBytes       int64         //if greater than 0, request bodies are limited to this size
+	RequestTimeout     time.Duration //if greater than 0, database queries are canceled after this long
+	Feed               *api.Feed     //if nil, the event stream is disabled
+	StreamDuration     time.Duration //if greater than 0, event streams are closed after this long so clients reconnect before the server's write timeout
+	Origins            []string      //browser origins (besides the server's) allowed to open WebSockets; "*" allows all
+	Debug              bool          //if true, runtime stats and pprof profiles are served to admins under /debug/
+	Build              *BuildInfo    //returned by /version
+	ReplicaDB          *sql.DB       //if set, GET requests are read from this database (e.g. a read replica) instead of db
+	EventRetention     int           //if greater than 0, modified and note Device Events older than this many years are moved to the archive
+	ReplacementAge     int           //default replacement age in years for the refresh planning report
+	TrustedProxies     []*net.IPNet  //peers whose X-Forwarded-For header gives the client IP (e.g. a TLS-terminating proxy)
+	Workers            *Workers      //runs background workers; if nil, they can't be stopped before the database is closed
+}
+
+//NewRouter returns an HTTP router for the HTTP API, served under the prefix of every APIVersion
+func NewRouter(w io.Writer, s SessionStore, db *sql.DB, opts *RouterOptions) http.Handler {
+	if opts == nil {
+		opts = new(RouterOptions)
+	}
+	workers := opts.Workers
+	if workers == nil {
+		workers = NewWorkers()
+	}
 
 	//construct middleware
 	var m = func(h returnHandler) http.Handler {
-		return logMiddleware(jsonMiddleware(txMiddleware(authMiddleware(h, s), db)), w)
+		return logMiddleware(journalMiddleware(jsonMiddleware(recoverMiddleware(txMiddleware(authMiddleware(auditMiddleware(h), s), db, opts.ReplicaDB, opts.Cache, opts.Feed, opts.RequestTimeout))), opts.Journal), w)
 	}
 
 	r := mux.NewRouter()
 
 	r.Path("/statuses/").Methods("GET").Handler(m(handleReadStatuses))
+	r.Path("/statuses/").Methods("POST").Handler(m(adminMiddleware(handleCreateStatus)))
+	r.Path("/statuses/details/").Methods("GET").Handler(m(handleReadStatusDetails))
+	r.Path("/statuses/{status}").Methods("GET").Handler(m(handleReadStatusDetail))
+	r.Path("/statuses/{status}").Methods("POST").Handler(m(adminMiddleware(handleRenameStatus)))
+	r.Path("/statuses/{status}/detail").Methods("POST").Handler(m(adminMiddleware(handleUpdateStatusDetail)))
+	r.Path("/statuses/{status}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteStatus)))
 	r.Path("/locations/").Methods("GET").Handler(m(handleReadLocations))
+	r.Path("/locations/").Methods("POST").Handler(m(adminMiddleware(handleCreateLocation)))
+	r.Path("/locations/tree/").Methods("GET").Handler(m(handleReadLocationTree))
+	r.Path("/locations/{location}").Methods("GET").Handler(m(handleReadLocationDetail))
+	r.Path("/locations/{location}").Methods("POST").Handler(m(adminMiddleware(handleRenameLocation)))
+	r.Path("/locations/{location}/detail").Methods("POST").Handler(m(adminMiddleware(handleUpdateLocationDetail)))
+	r.Path("/locations/{location}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteLocation)))
+
+	r.Path("/carts/").Methods("POST").Handler(m(adminMiddleware(handleCreateCart)))
+	r.Path("/carts/").Methods("GET").Handler(m(handleReadCarts))
+	r.Path("/carts/{id:[0-9]+}").Methods("GET").Handler(m(handleReadCart))
+	r.Path("/carts/{id:[0-9]+}").Methods("POST").Handler(m(adminMiddleware(handleUpdateCart)))
+	r.Path("/carts/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteCart)))
+	r.Path("/carts/{id:[0-9]+}/devices").Methods("GET").Handler(m(handleReadCartDevices))
+	r.Path("/carts/{id:[0-9]+}/devices").Methods("POST").Handler(m(handleUpdateCartDevices))
+	r.Path("/carts/{id:[0-9]+}/status").Methods("POST").Handler(m(handleUpdateCartStatus))
+
+	r.Path("/glossary/").Methods("POST").Handler(m(adminMiddleware(handleCreateGlossaryTerm)))
+	r.Path("/glossary/").Methods("GET").Handler(m(handleReadGlossaryTerms))
+	r.Path("/glossary/{id:[0-9]+}").Methods("GET").Handler(m(handleReadGlossaryTerm))
+	r.Path("/glossary/{id:[0-9]+}").Methods("POST").Handler(m(adminMiddleware(handleUpdateGlossaryTerm)))
+	r.Path("/glossary/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteGlossaryTerm)))
+
+	r.Path("/categories/").Methods("POST").Handler(m(adminMiddleware(handleCreateCategory)))
+	r.Path("/categories/").Methods("GET").Handler(m(handleReadCategories))
+	r.Path("/categories/{id:[0-9]+}").Methods("GET").Handler(m(handleReadCategory))
+	r.Path("/categories/{id:[0-9]+}").Methods("POST").Handler(m(adminMiddleware(handleUpdateCategory)))
+	r.Path("/categories/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteCategory)))
 
 	r.Path("/models/").Methods("POST").Handler(m(handleCreateModel))
 	r.Path("/models/").Methods("GET").Handler(m(handleQueryModel))
 	r.Path("/models/{id:[0-9]+}").Methods("GET").Handler(m(handleReadModel))
 	r.Path("/models/{id:[0-9]+}").Methods("POST").Handler(m(handleUpdateModel))
+	r.Path("/models/{id:[0-9]+}/merge").Methods("GET").Handler(m(handlePreviewModelMerge))
+	r.Path("/models/{id:[0-9]+}/merge").Methods("POST").Handler(m(handleMergeModel))
+	r.Path("/models/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteModel)))
+	r.Path("/models/{id:[0-9]+}/restore").Methods("POST").Handler(m(adminMiddleware(handleRestoreModel)))
 
 	r.Path("/devices/").Methods("POST").Handler(m(handleCreateDevice))
 	r.Path("/devices/").Methods("GET").Handler(m(handleQueryDevice))
+	r.Path("/devices/changes").Methods("GET").Handler(m(handleReadDeviceChanges))
 	r.Path("/devices/{id:[0-9]+}").Methods("GET").Handler(m(handleReadDevice))
-	r.Path("/devices/{id:[0-9]+}").Methods("POST").Handler(m(handleUpdateDevice))
+	r.Path("/devices/{id:[0-9]+}").Methods("POST").Handler(m(handleUpdateDevice(opts.Mailer)))
+	r.Path("/devices/{id:[0-9]+}/events/").Methods("GET").Handler(m(handleReadDeviceEvents))
+	r.Path("/devices/{id:[0-9]+}/recommendations/").Methods("GET").Handler(m(handleReadDeviceRecommendations))
 	r.Path("/devices/{id:[0-9]+}/notes/").Methods("POST").Handler(m(handleCreateDeviceNoteEvent))
+	r.Path("/devices/{id:[0-9]+}/links/").Methods("GET").Handler(m(handleReadDeviceLinks))
+	r.Path("/devices/{id:[0-9]+}/links/").Methods("POST").Handler(m(handleCreateDeviceLink))
+	r.Path("/devices/{id:[0-9]+}/links/{link_id:[0-9]+}").Methods("POST").Handler(m(handleUpdateDeviceLink))
+	r.Path("/devices/{id:[0-9]+}/links/{link_id:[0-9]+}").Methods("DELETE").Handler(m(handleDeleteDeviceLink))
+	r.Path("/devices/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteDevice)))
+	r.Path("/devices/{id:[0-9]+}/restore").Methods("POST").Handler(m(adminMiddleware(handleRestoreDevice)))
 
-	r.Path("/users/").Methods("POST").Handler(m(handleCreateUserWithCredentials))
+	r.Path("/users/").Methods("POST").Handler(m(adminMiddleware(handleCreateUserWithCredentials)))
+	if opts.Mailer != nil && opts.InviteURL != "" {
+		r.Path("/users/invite").Methods("POST").Handler(m(adminMiddleware(handleInviteUser(opts.Mailer, opts.InviteURL))))
+		r.Path("/users/invite/accept").Methods("POST").Handler(logMiddleware(journalMiddleware(jsonMiddleware(recoverMiddleware(txMiddleware(handleAcceptInvitation, db, opts.ReplicaDB, opts.Cache, opts.Feed, opts.RequestTimeout))), opts.Journal), w))
+	}
 	r.Path("/users/{id:[0-9]+}").Methods("GET").Handler(m(handleReadUser))
 	r.Path("/users/{id:[0-9]+}").Methods("POST").Handler(m(handleUpdateUser))
-	r.Path("/users/{id:[0-9]+}/password").Methods("POST").Handler(m(handleChangeUserPassword))
+	r.Path("/users/{id:[0-9]+}/password").Methods("POST").Handler(m(handleChangeUserPassword(s)))
+	r.Path("/users/{id:[0-9]+}/totp").Methods("POST").Handler(m(handleBeginTOTPEnrollment))
+	r.Path("/users/{id:[0-9]+}/totp/verify").Methods("POST").Handler(m(handleEnableTOTP))
+	r.Path("/users/{id:[0-9]+}/totp").Methods("DELETE").Handler(m(handleDisableTOTP))
+	r.Path("/users/{id:[0-9]+}/locations").Methods("GET").Handler(m(adminMiddleware(handleReadUserLocations)))
+	r.Path("/users/{id:[0-9]+}/locations").Methods("POST").Handler(m(adminMiddleware(handleUpdateUserLocations)))
+	r.Path("/users/{id:[0-9]+}/role").Methods("POST").Handler(m(adminMiddleware(handleUpdateUserRole(s))))
+	r.Path("/users/{id:[0-9]+}/grants/").Methods("GET").Handler(m(adminMiddleware(handleReadUserGrants)))
+	r.Path("/users/{id:[0-9]+}/grants/").Methods("POST").Handler(m(adminMiddleware(handleCreateUserGrant)))
+	r.Path("/users/{id:[0-9]+}/grants/{grant_id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleRevokeUserGrant)))
+	r.Path("/users/{id:[0-9]+}/grants/{grant_id:[0-9]+}/events/").Methods("GET").Handler(m(adminMiddleware(handleReadUserGrantEvents)))
+
+	r.Path("/webhooks/").Methods("GET").Handler(m(adminMiddleware(handleReadWebhooks)))
+	r.Path("/webhooks/").Methods("POST").Handler(m(adminMiddleware(handleCreateWebhook)))
+	r.Path("/webhooks/{id:[0-9]+}").Methods("GET").Handler(m(adminMiddleware(handleReadWebhook)))
+	r.Path("/webhooks/{id:[0-9]+}").Methods("POST").Handler(m(adminMiddleware(handleUpdateWebhook)))
+	r.Path("/webhooks/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteWebhook)))
+	r.Path("/webhooks/{id:[0-9]+}/deliveries/").Methods("GET").Handler(m(adminMiddleware(handleReadWebhookDeliveries)))
+	if opts.Mailer != nil {
+		r.Path("/admin/report-schedules/").Methods("GET").Handler(m(adminMiddleware(handleReadReportSchedules)))
+		r.Path("/admin/report-schedules/").Methods("POST").Handler(m(adminMiddleware(handleCreateReportSchedule)))
+		r.Path("/admin/report-schedules/{id:[0-9]+}").Methods("GET").Handler(m(adminMiddleware(handleReadReportSchedule)))
+		r.Path("/admin/report-schedules/{id:[0-9]+}").Methods("POST").Handler(m(adminMiddleware(handleUpdateReportSchedule)))
+		r.Path("/admin/report-schedules/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteReportSchedule)))
+		r.Path("/admin/report-schedules/{id:[0-9]+}/run").Methods("POST").Handler(m(adminMiddleware(handleRunReportSchedule)))
+	}
+	r.Path("/users/{id:[0-9]+}/disabled").Methods("POST").Handler(m(adminMiddleware(handleUpdateUserDisabled(s))))
+	r.Path("/users/{id:[0-9]+}").Methods("DELETE").Handler(m(adminMiddleware(handleDeleteUser(s))))
+	r.Path("/users/{id:[0-9]+}/restore").Methods("POST").Handler(m(adminMiddleware(handleRestoreUser)))
+
+	r.Path("/dashboard").Methods("GET").Handler(m(handleReadDashboard))
+	r.Path("/dashboard/widgets").Methods("GET").Handler(m(handleReadDashboardWidgets))
+	r.Path("/dashboard/widgets").Methods("POST").Handler(m(handleUpdateDashboardWidgets))
 
 	r.Path("/stats/").Methods("GET").Handler(m(handleReadStats))
+	r.Path("/stats/timeseries").Methods("GET").Handler(m(handleReadStatsTimeSeries))
+
+	r.Path("/search").Methods("GET").Handler(m(handleSearch))
+	r.Path("/events/search").Methods("GET").Handler(m(handleSearchNotes))
+	r.Path("/events/batches/{id:[0-9]+}").Methods("GET").Handler(m(adminMiddleware(handleReadEventBatch)))
+	r.Path("/events/batches/{id:[0-9]+}/revert").Methods("POST").Handler(m(adminMiddleware(handleRevertEventBatch)))
+	r.Path("/graphql").Methods("GET", "POST").Handler(m(handleGraphQL))
+
+	r.Path("/audit").Methods("GET").Handler(m(adminMiddleware(handleQueryAuditEntries)))
+
+	r.Path("/admin/vocabulary").Methods("GET").Handler(m(adminMiddleware(handleReadVocabularyReviewQueue)))
+	r.Path("/admin/vocabulary/review").Methods("POST").Handler(m(adminMiddleware(handleReviewVocabulary)))
+
+	workers.Go(func(context.Context) { recordMigratedModelMerges(db, opts.Cache) })
+	workers.Go(func(ctx context.Context) { expireGrants(ctx, db, opts.Cache) })
+	workers.Go(func(ctx context.Context) { deliverWebhooks(ctx, db, opts.Cache) })
+	if opts.Mailer != nil {
+		workers.Go(func(ctx context.Context) { runReportSchedules(ctx, db, opts.Cache, opts.Mailer) })
+	}
+	if opts.EventRetention > 0 {
+		workers.Go(func(ctx context.Context) { archiveEvents(ctx, db, opts.Cache, opts.EventRetention) })
+	}
+	r.Path("/admin/events/archive").Methods("GET").Handler(m(adminMiddleware(handleQueryArchivedEvents)))
+	r.Path("/admin/events/verify").Methods("GET").Handler(m(adminMiddleware(handleVerifyEventChain)))
+
+	if opts.Journal != nil {
+		r.Path("/admin/journal").Methods("GET").Handler(m(adminMiddleware(handleReadJournal(opts.Journal))))
+		r.Path("/admin/journal").Methods("DELETE").Handler(m(adminMiddleware(handleClearJournal(opts.Journal))))
+		r.Path("/admin/journal/capture").Methods("POST").Handler(m(adminMiddleware(handleSetJournalCapture(opts.Journal))))
+	}
+
+	health := NewHealthMonitor(db, workers)
+	r.Path("/admin/health/history").Methods("GET").Handler(m(adminMiddleware(handleReadHealthHistory(health))))
 
-	r.Path("/auth").Methods("POST").Handler(logMiddleware(jsonMiddleware(txMiddleware(handleAuthenticate(s), db)), w))
+	rc := NewRecomputer(db, opts.Cache, workers)
+	r.Path("/admin/recompute").Methods("POST").Handler(m(adminMiddleware(handleStartRecompute(rc))))
+	r.Path("/admin/recompute/{id:[0-9]+}").Methods("GET").Handler(m(adminMiddleware(handleReadRecompute(rc))))
+
+	r.Path("/reports/eol").Methods("GET").Handler(m(handleReadEOLReport))
+	r.Path("/reports/status-durations").Methods("GET").Handler(m(handleReadStatusDurationReport))
+	r.Path("/reports/carts").Methods("GET").Handler(m(handleReadCartReconciliations))
+	r.Path("/reports/snapshot").Methods("GET").Handler(m(handleReadInventorySnapshot))
+	r.Path("/reports/contributions").Methods("GET").Handler(m(handleReadContributionReport))
+	r.Path("/reports/refresh").Methods("GET").Handler(m(handleReadRefreshReport(opts.ReplacementAge)))
+	r.Path("/reports/simulate").Methods("POST").Handler(m(handleSimulate))
+	r.Path("/reports/run").Methods("POST").Handler(m(handleRunReport))
+
+	var export = func(h returnHandler) http.Handler {
+		return logMiddleware(recoverMiddleware(exportMiddleware(txMiddleware(authMiddleware(adminMiddleware(h), s), db, opts.ReplicaDB, opts.Cache, nil, opts.RequestTimeout), db, opts.ReplicaDB)), w)
+	}
+	r.Path("/events/export").Methods("GET").Handler(export(handleAuthorizeEventExport))
+	r.Path("/devices/{id:[0-9]+}/events/export").Methods("GET").Handler(export(handleAuthorizeEventExport))
+
+	if opts.Feed != nil {
+		tokens := newStreamTokens()
+		r.Path("/events/token").Methods("POST").Handler(m(handleCreateStreamToken(tokens)))
+		r.Path("/events/stream").Methods("GET").Handler(logMiddleware(recoverMiddleware(streamMiddleware(streamTokenMiddleware(txMiddleware(authMiddleware(handleReadEventStreamScope, s), db, opts.ReplicaDB, opts.Cache, nil, opts.RequestTimeout), tokens), opts.Feed, opts.StreamDuration)), w))
+		r.Path("/ws/updates").Methods("GET").Handler(logMiddleware(recoverMiddleware(websocketMiddleware(streamTokenMiddleware(txMiddleware(authMiddleware(handleReadEventStreamScope, s), db, opts.ReplicaDB, opts.Cache, nil, opts.RequestTimeout), tokens), opts.Feed, opts.Origins)), w))
+	}
+
+	if opts.Debug {
+		var debug = func(h http.Handler) http.Handler {
+			return logMiddleware(recoverMiddleware(debugMiddleware(txMiddleware(authMiddleware(adminMiddleware(handleAuthorizeDebug), s), db, opts.ReplicaDB, opts.Cache, nil, opts.RequestTimeout), h)), w)
+		}
+
+		r.Path("/debug/vars").Methods("GET").Handler(m(adminMiddleware(handleReadRuntimeStats(db))))
+		r.Path("/debug/pprof/cmdline").Methods("GET").Handler(debug(http.HandlerFunc(pprof.Cmdline)))
+		r.Path("/debug/pprof/profile").Methods("GET").Handler(debug(http.HandlerFunc(pprof.Profile)))
+		r.Path("/debug/pprof/symbol").Methods("GET", "POST").Handler(debug(http.HandlerFunc(pprof.Symbol)))
+		r.Path("/debug/pprof/trace").Methods("GET").Handler(debug(http.HandlerFunc(pprof.Trace)))
+		r.PathPrefix("/debug/pprof/").Methods("GET").Handler(debug(http.HandlerFunc(pprof.Index)))
+	}
+
+	notifier := &loginNotifier{mailer: opts.Mailer, mode: opts.LoginNotifications, revokeURL: opts.RevokeURL}
+	throttle := NewAuthThrottle()
+
+	r.Path("/auth").Methods("POST").Handler(logMiddleware(journalMiddleware(jsonMiddleware(recoverMiddleware(txMiddleware(handleAuthenticate(s, notifier, throttle), db, opts.ReplicaDB, opts.Cache, opts.Feed, opts.RequestTimeout))), opts.Journal), w))
+
+	if opts.Mailer != nil && opts.RevokeURL != "" {
+		r.Path("/auth/revoke").Methods("POST").Handler(logMiddleware(journalMiddleware(jsonMiddleware(recoverMiddleware(txMiddleware(handleRevokeLogin(s), db, opts.ReplicaDB, opts.Cache, opts.Feed, opts.RequestTimeout))), opts.Journal), w))
+	}
+
+	if opts.OIDC != nil {
+		r.Path("/auth/oidc/login").Methods("GET").Handler(logMiddleware(jsonMiddleware(recoverMiddleware(handleOIDCLogin(opts.OIDC))), w))
+		r.Path("/auth/oidc/callback").Methods("POST").Handler(logMiddleware(journalMiddleware(jsonMiddleware(recoverMiddleware(oidcMiddleware(txMiddleware(handleOIDCCallback(s, notifier, throttle), db, opts.ReplicaDB, opts.Cache, opts.Feed, opts.RequestTimeout), opts.OIDC))), opts.Journal), w))
+	}
+
+	r.Path("/health").Methods("GET").Handler(logMiddleware(jsonMiddleware(recoverMiddleware(handleReadHealth(health))), w))
+	r.Path("/version").Methods("GET").Handler(logMiddleware(jsonMiddleware(recoverMiddleware(handleReadVersion(opts.Build))), w))
+
+	//the document is generated from the registered routes, so this must be the last route added
+	spec := r.Path("/openapi.json").Methods("GET")
+	spec.Handler(logMiddleware(jsonMiddleware(recoverMiddleware(handleReadOpenAPI(newOpenAPIDocument(r)))), w))
 
 	r.NotFoundHandler = m(notFoundHandler)
 
-	return http.StripPrefix("/api/1.0", r)
+	var h http.Handler = r
+	if opts.MaxBodyBytes > 0 {
+		h = limitMiddleware(h, opts.MaxBodyBytes)
+	}
+	if len(opts.TrustedProxies) > 0 {
+		h = proxyMiddleware(h, opts.TrustedProxies)
+	}
+
+	return newVersionMux(h)
 }
@@ -0,0 +1,315 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const (
+	reportScheduleInterval  = time.Minute
+	reportScheduleBatchSize = 10
+)
+
+const scheduledReportTextTemplate = `{{.Schedule.Name}}
+
+Generated {{.Date.Format "2006-01-02 15:04:05 -0700"}}
+{{range .Tables}}
+{{.Title}}: {{len .Rows}} rows{{end}}
+{{if .CSV}}
+The results are attached as CSV files.
+{{end}}`
+
+var scheduledReportTextTmpl = template.Must(template.New("report").Parse(scheduledReportTextTemplate))
+
+const scheduledReportHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<h2>{{.Schedule.Name}}</h2>
+<p>Generated {{.Date.Format "2006-01-02 15:04:05 -0700"}}</p>
+{{range .Tables}}
+<h3>{{.Title}}</h3>
+{{if .Rows}}<table border="1" cellpadding="4" cellspacing="0" style="border-collapse: collapse;">
+<tr>{{range .Columns}}<th align="left">{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p>None</p>{{end}}
+{{end}}
+</body>
+</html>
+`
+
+var scheduledReportHTMLTmpl = htmltemplate.Must(htmltemplate.New("report").Parse(scheduledReportHTMLTemplate))
+
+type scheduledReportData struct {
+	Schedule *api.ReportSchedule
+	Date     time.Time
+	Tables   []*api.ReportTable
+	CSV      bool
+}
+
+//reportFileName returns a file name for the given ReportTable's CSV attachment
+func reportFileName(t *api.ReportTable) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, t.Title)
+	return name + ".csv"
+}
+
+//renderScheduledReport renders the given ReportTables as an email for the given ReportSchedule, or returns an error if one occurred.
+//HTML reports are rendered in the email body; CSV reports have an attachment for each ReportTable
+func renderScheduledReport(schedule *api.ReportSchedule, date time.Time, tables []*api.ReportTable) (*api.Message, error) {
+	data := &scheduledReportData{Schedule: schedule, Date: date, Tables: tables, CSV: schedule.Format == api.ScheduledReportFormatCSV}
+	msg := &api.Message{Subject: fmt.Sprintf("Inventory report: %s", schedule.Name)}
+
+	body := new(bytes.Buffer)
+	if err := scheduledReportTextTmpl.Execute(body, data); err != nil {
+		return nil, fmt.Errorf("Could not render report: %v", err)
+	}
+	msg.Body = body.String()
+
+	if !data.CSV {
+		html := new(bytes.Buffer)
+		if err := scheduledReportHTMLTmpl.Execute(html, data); err != nil {
+			return nil, fmt.Errorf("Could not render HTML report: %v", err)
+		}
+		msg.HTML = html.String()
+		return msg, nil
+	}
+
+	for _, t := range tables {
+		buf := new(bytes.Buffer)
+		w := csv.NewWriter(buf)
+		w.Write(t.Columns)
+		w.WriteAll(t.Rows)
+		if err := w.Error(); err != nil {
+			return nil, fmt.Errorf("Could not write CSV for %s: %v", t.Title, err)
+		}
+		msg.Attachments = append(msg.Attachments, &api.Attachment{Name: reportFileName(t), ContentType: "text/csv; charset=utf-8", Data: buf.Bytes()})
+	}
+
+	return msg, nil
+}
+
+//runReportSchedule generates and emails the given ReportSchedule's report, or returns an error if one occurred
+func runReportSchedule(db *sql.DB, c api.Cache, m api.Mailer, schedule *api.ReportSchedule) error {
+	var tables []*api.ReportTable
+	err := withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+		var err error
+		tables, err = store.ReadScheduledReport(ctx, schedule)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Could not read report: %v", err)
+	}
+
+	msg, err := renderScheduledReport(schedule, time.Now(), tables)
+	if err != nil {
+		return err
+	}
+
+	if err = m.SendMessage(schedule.Recipients, msg); err != nil {
+		return fmt.Errorf("Could not send report: %v", err)
+	}
+
+	return nil
+}
+
+//runReportSchedules runs due ReportSchedules every reportScheduleInterval.
+//Runs are claimed in one transaction and emailed outside of it, so a slow mail server doesn't hold database locks.
+//A claimed run isn't retried if it fails; the error is recorded on the ReportSchedule.
+//Once ctx is done, it returns after the claimed runs are sent and recorded
+func runReportSchedules(ctx context.Context, db *sql.DB, c api.Cache, m api.Mailer) {
+	for {
+		var schedules []*api.ReportSchedule
+		err := withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+			var err error
+			schedules, err = store.ClaimDueReportSchedules(ctx, time.Now(), reportScheduleBatchSize)
+			return err
+		})
+		if err != nil {
+			log.Printf("Could not read report schedules: %v\n", err)
+		}
+
+		for _, schedule := range schedules {
+			runErr := runReportSchedule(db, c, m, schedule)
+			if runErr != nil {
+				log.Printf("Could not run report schedule %d: %v\n", schedule.ID, runErr)
+			}
+
+			err = withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+				return store.RecordReportScheduleRun(ctx, schedule.ID, runErr)
+			})
+			if err != nil {
+				log.Printf("Could not record report schedule %d run: %v\n", schedule.ID, err)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		//keep going without waiting if there may be more due schedules
+		if len(schedules) < reportScheduleBatchSize && !sleepContext(ctx, reportScheduleInterval) {
+			return
+		}
+	}
+}
+
+//readReportSchedule reads the ReportSchedule with the id in the request URL
+func readReportSchedule(r *http.Request) (*api.ReportSchedule, *handlerResponse) {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	schedule, err := store.ReadReportSchedule(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return nil, resp
+	}
+	if schedule == nil {
+		return nil, handleError(http.StatusNotFound, errors.New("Could not find report schedule"))
+	}
+
+	return schedule, nil
+}
+
+// GET /admin/report-schedules/
+func handleReadReportSchedules(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	schedules, err := store.ReadReportSchedules(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadReportSchedulesResponse{Schedules: schedules}}
+}
+
+// POST /admin/report-schedules/
+func handleCreateReportSchedule(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var schedule *api.ReportSchedule
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&schedule)
+	if err != nil || schedule == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	id, err := store.CreateReportSchedule(r.Context(), schedule)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	schedule, err = store.ReadReportSchedule(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: schedule}
+}
+
+// GET /admin/report-schedules/:id
+func handleReadReportSchedule(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	schedule, resp := readReportSchedule(r)
+	if resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: schedule}
+}
+
+// POST /admin/report-schedules/:id
+func handleUpdateReportSchedule(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	schedule, resp := readReportSchedule(r)
+	if resp != nil {
+		return resp
+	}
+
+	var update *api.ReportSchedule
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&update)
+	if err != nil || update == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	update.ID = schedule.ID
+
+	if resp = checkAPIError(store.UpdateReportSchedule(r.Context(), update)); resp != nil {
+		return resp
+	}
+
+	schedule, err = store.ReadReportSchedule(r.Context(), schedule.ID)
+	if resp = checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: schedule}
+}
+
+// DELETE /admin/report-schedules/:id
+func handleDeleteReportSchedule(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	schedule, resp := readReportSchedule(r)
+	if resp != nil {
+		return resp
+	}
+
+	if resp = checkAPIError(store.DeleteReportSchedule(r.Context(), schedule.ID)); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: schedule}
+}
+
+// POST /admin/report-schedules/:id/run
+func handleRunReportSchedule(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	schedule, resp := readReportSchedule(r)
+	if resp != nil {
+		return resp
+	}
+
+	if schedule.Disabled {
+		return handleError(http.StatusBadRequest, errors.New("Could not run disabled report schedule"))
+	}
+
+	if resp = checkAPIError(store.QueueReportSchedule(r.Context(), schedule.ID, time.Now())); resp != nil {
+		return resp
+	}
+
+	schedule, err := store.ReadReportSchedule(r.Context(), schedule.ID)
+	if resp = checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: schedule}
+}
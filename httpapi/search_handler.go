@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 50
+
+	defaultNoteSearchLimit = 25
+	maxNoteSearchLimit     = 100
+)
+
+// GET /search
+func handleSearch(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode limit: %v", err))
+		}
+		if l < 1 || l > maxSearchLimit {
+			return handleError(http.StatusBadRequest, fmt.Errorf("limit (%d) must be between 1 and %d", l, maxSearchLimit))
+		}
+		limit = l
+	}
+
+	results, err := store.Search(r.Context(), r.URL.Query().Get("q"), limit)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &SearchResponse{Results: results}}
+}
+
+// GET /events/search
+func handleSearchNotes(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	limit := defaultNoteSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode limit: %v", err))
+		}
+		if l < 1 || l > maxNoteSearchLimit {
+			return handleError(http.StatusBadRequest, fmt.Errorf("limit (%d) must be between 1 and %d", l, maxNoteSearchLimit))
+		}
+		limit = l
+	}
+
+	notes, err := store.SearchNotes(r.Context(), r.URL.Query().Get("q"), limit)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &SearchNotesResponse{Notes: notes}}
+}
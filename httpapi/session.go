@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -15,11 +16,15 @@ type SessionStore interface {
 	//If sessionID is not valid, session will be nil.
 	//If the backend malfunctions, session will be nil and err will be non-nil.
 	Check(sessionID string) (session *Session, err error)
+
+	//Revoke removes all sessions for the given User id. If the backend malfunctions, err will be non-nil.
+	Revoke(userID int64) error
 }
 
 //Session represents a login session
 type Session struct {
 	UserID  int64
+	Created time.Time
 	Expires time.Time
 }
 
@@ -27,6 +32,7 @@ type Session struct {
 type MemorySessionStore struct {
 	store    map[string]*Session
 	duration time.Duration
+	limit    int
 	mu       *sync.Mutex
 }
 
@@ -46,23 +52,62 @@ func scavenge(m *MemorySessionStore) {
 }
 
 //NewMemorySessionStore returns a new MemorySessionStore with the given expiration duration.
-func NewMemorySessionStore(duration time.Duration) *MemorySessionStore {
+//Each User can have at most limit active sessions (the oldest are removed first), or unlimited sessions if limit is less than 1
+func NewMemorySessionStore(duration time.Duration, limit int) *MemorySessionStore {
 	m := &MemorySessionStore{
 		store:    make(map[string]*Session),
 		duration: duration,
+		limit:    limit,
 		mu:       new(sync.Mutex),
 	}
 	go scavenge(m)
 	return m
 }
 
-//Create returns a new sessionID with the given User id. err will always be nil.
+//evict removes the given User's oldest sessions until they have fewer than the session limit. m.mu must be held
+func (m *MemorySessionStore) evict(userID int64) {
+	if m.limit <= 0 {
+		return
+	}
+
+	now := time.Now()
+	var ids []string
+
+	for id, s := range m.store {
+		if s.UserID != userID {
+			continue
+		}
+		if s.Expires.Before(now) {
+			delete(m.store, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) < m.limit {
+		return
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return m.store[ids[i]].Created.Before(m.store[ids[j]].Created)
+	})
+
+	for _, id := range ids[:len(ids)-m.limit+1] {
+		delete(m.store, id)
+	}
+}
+
+//Create returns a new sessionID with the given User id, removing the User's oldest sessions if they are at the session limit.
+//err will always be nil.
 func (m *MemorySessionStore) Create(userID int64) (sessionID string, err error) {
 	id := randString(128)
+	now := time.Now()
 	m.mu.Lock()
+	m.evict(userID)
 	m.store[id] = &Session{
 		UserID:  userID,
-		Expires: time.Now().Add(m.duration),
+		Created: now,
+		Expires: now.Add(m.duration),
 	}
 	m.mu.Unlock()
 	return id, nil
@@ -82,3 +127,15 @@ func (m *MemorySessionStore) Check(sessionID string) (session *Session, err erro
 	}
 	return nil, nil
 }
+
+//Revoke removes all sessions for the given User id. err will always be nil.
+func (m *MemorySessionStore) Revoke(userID int64) error {
+	m.mu.Lock()
+	for id, s := range m.store {
+		if s.UserID == userID {
+			delete(m.store, id)
+		}
+	}
+	m.mu.Unlock()
+	return nil
+}
@@ -1,17 +1,81 @@
 package httpapi
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/korylprince/tcea-inventory-server/api"
 )
 
+//parseStatsFilter returns the StatsFilter from the request's location, model_id, status, and category_id query parameters
+//(nil if none are set), or an error response
+func parseStatsFilter(r *http.Request) (*api.StatsFilter, *handlerResponse) {
+	q := r.URL.Query()
+
+	filter := &api.StatsFilter{
+		Location: api.Location(q.Get("location")),
+		Status:   api.Status(q.Get("status")),
+	}
+
+	if v := q.Get("model_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode model_id: %v", err))
+		}
+		filter.ModelID = id
+	}
+
+	if v := q.Get("category_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode category_id: %v", err))
+		}
+		filter.CategoryID = id
+	}
+
+	if *filter == (api.StatsFilter{}) {
+		return nil, nil
+	}
+
+	return filter, nil
+}
+
 // GET /stats/
 func handleReadStats(_ http.ResponseWriter, r *http.Request) *handlerResponse {
-	stats, err := api.ReadStats(r.Context())
+	store := requestStore(r)
+
+	filter, resp := parseStatsFilter(r)
+	if resp != nil {
+		return resp
+	}
+
+	stats, err := store.ReadStats(r.Context(), filter)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
 	return &handlerResponse{Code: http.StatusOK, Body: stats}
 }
+
+// GET /stats/timeseries
+func handleReadStatsTimeSeries(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	period, since, until, resp := parseReportRange(r)
+	if resp != nil {
+		return resp
+	}
+
+	filter, resp := parseStatsFilter(r)
+	if resp != nil {
+		return resp
+	}
+
+	ts, err := store.ReadStatsTimeSeries(r.Context(), period, since, until, filter)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: ts}
+}
@@ -1,17 +1,166 @@
 package httpapi
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/gorilla/mux"
 	"github.com/korylprince/tcea-inventory-server/api"
 )
 
 // GET /statuses/
-func handleReadStatuses(_ http.ResponseWriter, r *http.Request) *handlerResponse {
-	statuses, err := api.ReadStatuses(r.Context())
+func handleReadStatuses(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	statuses, err := store.ReadStatuses(r.Context())
 	if err := checkAPIError(err); err != nil {
 		return err
 	}
 
-	return &handlerResponse{Code: http.StatusOK, Body: &ReadStatusesResponse{Statuses: statuses}}
+	return handleETag(w, r, &ReadStatusesResponse{Statuses: statuses})
+}
+
+// POST /statuses/
+func handleCreateStatus(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var req *StatusRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	err = store.CreateStatus(r.Context(), req.Status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return handleReadStatuses(w, r)
+}
+
+// POST /statuses/:status
+func handleRenameStatus(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	status := api.Status(mux.Vars(r)["status"])
+
+	var req *RenameStatusRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	st, err := store.ReadStatus(r.Context(), status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if st == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find status"))
+	}
+
+	err = store.RenameStatus(r.Context(), status, req.Status, req.Cascade)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return handleReadStatuses(w, r)
+}
+
+// DELETE /statuses/:status
+func handleDeleteStatus(w http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	status := api.Status(mux.Vars(r)["status"])
+
+	st, err := store.ReadStatus(r.Context(), status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if st == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find status"))
+	}
+
+	err = store.DeleteStatus(r.Context(), status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return handleReadStatuses(w, r)
+}
+
+// GET /statuses/details/
+func handleReadStatusDetails(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	details, err := store.ReadStatusDetails(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadStatusDetailsResponse{Statuses: details}}
+}
+
+// GET /statuses/:status
+func handleReadStatusDetail(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	status := api.Status(mux.Vars(r)["status"])
+
+	detail, err := store.ReadStatusDetail(r.Context(), status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if detail == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find status"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: detail}
+}
+
+// POST /statuses/:status/detail
+func handleUpdateStatusDetail(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	status := api.Status(mux.Vars(r)["status"])
+
+	var detail *api.StatusDetail
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&detail)
+	if err != nil || detail == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	if detail.Status != status {
+		return handleError(http.StatusBadRequest, fmt.Errorf("status mismatch: URL: %s, Body: %s", status, detail.Status))
+	}
+
+	st, err := store.ReadStatus(r.Context(), status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if st == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find status"))
+	}
+
+	err = store.UpdateStatusDetail(r.Context(), detail)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	detail, err = store.ReadStatusDetail(r.Context(), status)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if detail == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find status, but just updated"))
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: detail}
 }
@@ -0,0 +1,245 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//streamHeartbeatInterval is how often a comment is sent to keep idle streams open through proxies
+const streamHeartbeatInterval = 30 * time.Second
+
+//streamRecheckInterval is how often an open stream's session and scope are checked again, so streams end soon after
+//the session is revoked or the User is disabled, and scope changes (e.g. an expired Grant) are applied
+const streamRecheckInterval = time.Minute
+
+//streamTokenDuration is how long a stream token can be used to open an event stream
+const streamTokenDuration = time.Minute
+
+//streamTokens are single use, short lived tokens for opening event streams from browsers, which can't send the X-Session-Key header with them.
+//A token is only as valid as the session it was created with
+type streamTokens struct {
+	tokens map[string]*streamToken
+	mu     *sync.Mutex
+}
+
+type streamToken struct {
+	sessionKey string
+	expires    time.Time
+}
+
+//newStreamTokens returns a new streamTokens
+func newStreamTokens() *streamTokens {
+	return &streamTokens{tokens: make(map[string]*streamToken), mu: new(sync.Mutex)}
+}
+
+//Create returns a new token for the given session key and when it expires
+func (t *streamTokens) Create(sessionKey string) (token string, expires time.Time) {
+	token = randString(32)
+	now := time.Now()
+	expires = now.Add(streamTokenDuration)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for k, st := range t.tokens {
+		if st.expires.Before(now) {
+			delete(t.tokens, k)
+		}
+	}
+	t.tokens[token] = &streamToken{sessionKey: sessionKey, expires: expires}
+
+	return token, expires
+}
+
+//Redeem returns the session key for the given token and removes it, or false if the token doesn't exist or has expired
+func (t *streamTokens) Redeem(token string) (sessionKey string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.tokens[token]
+	if !ok {
+		return "", false
+	}
+	delete(t.tokens, token)
+
+	if st.expires.Before(time.Now()) {
+		return "", false
+	}
+
+	return st.sessionKey, true
+}
+
+//streamTokenMiddleware authenticates requests without the X-Session-Key header with the stream token in the token query parameter
+//or offered as a WebSocket subprotocol.
+//The token is redeemed before next runs, so it must be outside of txMiddleware, which may retry next.
+//Tokens are single use, so logging the query parameter doesn't leak a usable token
+func streamTokenMiddleware(next returnHandler, t *streamTokens) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = websocketToken(r)
+		}
+		if r.Header.Get("X-Session-Key") != "" || token == "" {
+			return next(w, r)
+		}
+
+		key, ok := t.Redeem(token)
+		if !ok {
+			return handleError(http.StatusUnauthorized, errors.New("Could not find stream token"))
+		}
+
+		r = r.Clone(r.Context())
+		r.Header.Set("X-Session-Key", key)
+
+		return next(w, r)
+	}
+}
+
+// POST /events/token
+func handleCreateStreamToken(t *streamTokens) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		token, expires := t.Create(r.Header.Get("X-Session-Key"))
+		return &handlerResponse{Code: http.StatusOK, Body: &StreamTokenResponse{Token: token, Expires: expires}}
+	}
+}
+
+//eventStreamScope is the Locations a stream subscriber may see Device FeedEvents for. If Locations is nil, all Locations are permitted.
+//sessionKey is the session the stream was opened with, used to check the scope again
+type eventStreamScope struct {
+	Locations  []api.Location
+	sessionKey string
+}
+
+//recheckStreamScope runs next again for an open stream with the session key it was opened with, which authenticates the session
+//and reads the current scope. If the session or User is no longer valid, a nil scope and the reason are returned
+func recheckStreamScope(next returnHandler, w http.ResponseWriter, r *http.Request, scope *eventStreamScope) (*eventStreamScope, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("X-Session-Key", scope.sessionKey)
+
+	resp := next(w, r)
+	if s, ok := resp.Body.(*eventStreamScope); ok {
+		return s, nil
+	}
+	if resp.Err != nil {
+		return nil, fmt.Errorf("Stream closed: %v", resp.Err)
+	}
+	return nil, fmt.Errorf("Stream closed: status %d", resp.Code)
+}
+
+//allows returns true if the subscriber may see the given FeedEvent
+func (s *eventStreamScope) allows(e *api.FeedEvent) bool {
+	if s.Locations == nil || e.Type != api.FeedEventTypeDevice {
+		return true
+	}
+	for _, l := range s.Locations {
+		if l == e.Location {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /events/stream
+// GET /ws/updates
+func handleReadEventStreamScope(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	locations, err := store.ReadPermittedLocations(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &eventStreamScope{Locations: locations, sessionKey: r.Header.Get("X-Session-Key")}}
+}
+
+//writeJSONResponse writes resp as JSON for handlers that don't use jsonMiddleware
+func writeJSONResponse(w http.ResponseWriter, r *http.Request, resp *handlerResponse) *handlerResponse {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Code)
+	if err := json.NewEncoder(w).Encode(versionBody(resp.Body, requestVersion(r))); err != nil {
+		return handleError(http.StatusInternalServerError, fmt.Errorf("Could encode json: %v", err))
+	}
+	return resp
+}
+
+//streamMiddleware streams FeedEvents from f as Server-Sent Events if next returns an *eventStreamScope,
+//or writes next's error as JSON otherwise. If duration is greater than 0, the stream is closed after duration so the client reconnects.
+//next is run again every streamRecheckInterval, and the stream is closed if it no longer returns a scope
+func streamMiddleware(next returnHandler, f *api.Feed, duration time.Duration) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		resp := next(w, r)
+
+		scope, ok := resp.Body.(*eventStreamScope)
+		if !ok {
+			return writeJSONResponse(w, r, resp)
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return handleError(http.StatusInternalServerError, errors.New("Streaming is not supported"))
+		}
+
+		events := f.Subscribe()
+		defer f.Unsubscribe(events)
+
+		var timeout <-chan time.Time
+		if duration > 0 {
+			timer := time.NewTimer(duration)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		recheck := time.NewTicker(streamRecheckInterval)
+		defer recheck.Stop()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 5000\n\n")
+		flusher.Flush()
+
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return resp
+				}
+				if !scope.allows(e) {
+					continue
+				}
+				buf, err := json.Marshal(e)
+				if err != nil {
+					resp.Err = fmt.Errorf("Could not encode event: %v", err)
+					return resp
+				}
+				if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, buf); err != nil {
+					return resp
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return resp
+				}
+			case <-recheck.C:
+				//the client reconnects and gets the error
+				if scope, resp.Err = recheckStreamScope(next, w, r, scope); scope == nil {
+					return resp
+				}
+				continue
+			case <-timeout:
+				return resp
+			case <-r.Context().Done():
+				return resp
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+//AuthThrottle defaults
+const (
+	authThrottleAccountLimit = 5
+	authThrottleIPLimit      = 20
+	authThrottleBaseLockout  = time.Minute
+	authThrottleMaxLockout   = time.Hour
+)
+
+type throttleEntry struct {
+	failures    int
+	lockedUntil time.Time
+	last        time.Time
+}
+
+//AuthThrottle tracks failed authentications per key (e.g. account or IP address).
+//Once a key reaches its limit, it is locked out for a duration that doubles with each further failure
+type AuthThrottle struct {
+	entries map[string]*throttleEntry
+	mu      *sync.Mutex
+}
+
+//scavengeThrottle removes records that haven't failed in the maximum lockout duration every hour
+func scavengeThrottle(t *AuthThrottle) {
+	for {
+		time.Sleep(time.Hour)
+		now := time.Now()
+		t.mu.Lock()
+		for key, e := range t.entries {
+			if e.last.Add(authThrottleMaxLockout).Before(now) {
+				delete(t.entries, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+//NewAuthThrottle returns a new AuthThrottle
+func NewAuthThrottle() *AuthThrottle {
+	t := &AuthThrottle{entries: make(map[string]*throttleEntry), mu: new(sync.Mutex)}
+	go scavengeThrottle(t)
+	return t
+}
+
+//accountKey returns the AuthThrottle key for the given email
+func accountKey(email string) string {
+	return "account:" + email
+}
+
+//ipKey returns the AuthThrottle key for the given IP address
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+//throttleLimit returns the failure limit for the given key
+func throttleLimit(key string) int {
+	if strings.HasPrefix(key, "ip:") {
+		return authThrottleIPLimit
+	}
+	return authThrottleAccountLimit
+}
+
+//Check returns how long until the given keys may authenticate again, or 0 if none of them are locked out
+func (t *AuthThrottle) Check(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var wait time.Duration
+	now := time.Now()
+
+	for _, key := range keys {
+		if e, ok := t.entries[key]; ok && e.lockedUntil.After(now) {
+			if d := e.lockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+
+	return wait
+}
+
+//Failure records a failed authentication for the given keys
+func (t *AuthThrottle) Failure(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+
+	for _, key := range keys {
+		e, ok := t.entries[key]
+		if !ok {
+			e = new(throttleEntry)
+			t.entries[key] = e
+		}
+
+		e.failures++
+		e.last = now
+
+		if over := e.failures - throttleLimit(key); over >= 0 {
+			lockout := authThrottleMaxLockout
+			if over < 16 {
+				if d := authThrottleBaseLockout << uint(over); d < lockout {
+					lockout = d
+				}
+			}
+			e.lockedUntil = now.Add(lockout)
+		}
+	}
+}
+
+//Success clears failed authentications for the given keys
+func (t *AuthThrottle) Success(keys ...string) {
+	t.mu.Lock()
+	for _, key := range keys {
+		delete(t.entries, key)
+	}
+	t.mu.Unlock()
+}
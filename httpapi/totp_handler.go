@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//totpIssuer is the issuer shown in authenticator apps
+const totpIssuer = "TCEA Inventory"
+
+// POST /users/:id/totp
+func handleBeginTOTPEnrollment(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	user := r.Context().Value(api.UserKey).(*api.User)
+
+	if user.ID != id {
+		return handleError(http.StatusBadRequest, fmt.Errorf("user id mismatch: URL: %d, Authenticated: %d", id, user.ID))
+	}
+
+	enrollment, err := user.BeginTOTPEnrollment(r.Context(), store, totpIssuer)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: enrollment}
+}
+
+// POST /users/:id/totp/verify
+func handleEnableTOTP(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var req *TOTPCodeRequest
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+	}
+
+	user := r.Context().Value(api.UserKey).(*api.User)
+
+	if user.ID != id {
+		return handleError(http.StatusBadRequest, fmt.Errorf("user id mismatch: URL: %d, Authenticated: %d", id, user.ID))
+	}
+
+	codes, err := user.EnableTOTP(r.Context(), store, req.Code)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &RecoveryCodesResponse{RecoveryCodes: codes}}
+}
+
+// DELETE /users/:id/totp
+func handleDisableTOTP(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var req *DisableTOTPRequest
+	d := json.NewDecoder(r.Body)
+
+	err = d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+	}
+
+	authUser := r.Context().Value(api.UserKey).(*api.User)
+
+	//admins can reset TOTP for users who have lost their device and recovery codes
+	if authUser.ID != id && !authUser.IsAdmin() {
+		return handleError(http.StatusForbidden, errors.New("User must be an admin to disable TOTP for another user"))
+	}
+
+	user, err := store.ReadUser(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if user == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find user"))
+	}
+
+	//a stolen session can't remove the second factor: the authenticated User must confirm their password,
+	//or their own TOTP or recovery code
+	switch {
+	case req.Password != "":
+		if err = authUser.Authenticate(r.Context(), store, req.Password); err != nil {
+			return handleError(http.StatusForbidden, errors.New("Could not authenticate password"))
+		}
+	case req.Code != "" && authUser.ID == user.ID && user.TOTPEnabled:
+		if resp := checkAPIError(user.VerifySecondFactor(r.Context(), store, req.Code)); resp != nil {
+			return resp
+		}
+	default:
+		return handleError(http.StatusBadRequest, errors.New("password, or a TOTP or recovery code, is required to disable TOTP"))
+	}
+
+	err = user.DisableTOTP(r.Context(), store)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: user}
+}
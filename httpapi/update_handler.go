@@ -0,0 +1,213 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+//updatePingInterval is how often WebSocket clients are pinged to keep idle connections open through proxies
+const updatePingInterval = 30 * time.Second
+
+//updateSubscription is a client's Device filter. A nil subscription matches nothing
+type updateSubscription struct {
+	locations map[api.Location]bool
+	statuses  map[api.Status]bool
+}
+
+//newUpdateSubscription returns an updateSubscription for the given request
+func newUpdateSubscription(req *UpdateSubscriptionRequest) *updateSubscription {
+	s := &updateSubscription{locations: make(map[api.Location]bool), statuses: make(map[api.Status]bool)}
+	for _, l := range req.Locations {
+		s.locations[l] = true
+	}
+	for _, st := range req.Statuses {
+		s.statuses[st] = true
+	}
+	return s
+}
+
+//matches returns true if the Device in the given FeedEvent matches the subscription before or after the change,
+//so clients see Devices leaving their filter as well as entering it
+func (s *updateSubscription) matches(e *api.FeedEvent) bool {
+	if s == nil || e.Type != api.FeedEventTypeDevice {
+		return false
+	}
+
+	locations := []api.Location{e.Location}
+	statuses := []api.Status{e.Status}
+	if c, ok := e.Content.(*api.ModifiedContent); ok {
+		for _, f := range c.Fields {
+			switch f.Name {
+			case "location":
+				if l, ok := f.OldValue.(api.Location); ok {
+					locations = append(locations, l)
+				}
+			case "status":
+				if st, ok := f.OldValue.(api.Status); ok {
+					statuses = append(statuses, st)
+				}
+			}
+		}
+	}
+
+	return (len(s.locations) == 0 || anyLocation(s.locations, locations)) && (len(s.statuses) == 0 || anyStatus(s.statuses, statuses))
+}
+
+func anyLocation(set map[api.Location]bool, locations []api.Location) bool {
+	for _, l := range locations {
+		if set[l] {
+			return true
+		}
+	}
+	return false
+}
+
+func anyStatus(set map[api.Status]bool, statuses []api.Status) bool {
+	for _, s := range statuses {
+		if set[s] {
+			return true
+		}
+	}
+	return false
+}
+
+//patchPath returns the JSON Pointer for the given Device field name
+func patchPath(name string) string {
+	return "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+//newDeviceUpdateMessage returns a DeviceUpdateMessage for the given Device FeedEvent
+func newDeviceUpdateMessage(e *api.FeedEvent) *DeviceUpdateMessage {
+	msg := &DeviceUpdateMessage{ID: e.ID, Event: e.Event, Date: e.Date, UserID: e.UserID, Patch: []*JSONPatchOperation{}}
+
+	switch c := e.Content.(type) {
+	case *api.CreatedContent:
+		msg.Patch = append(msg.Patch, &JSONPatchOperation{Op: "add", Path: "/id", Value: e.ID})
+		for _, f := range c.Fields {
+			msg.Patch = append(msg.Patch, &JSONPatchOperation{Op: "add", Path: patchPath(f.Name), Value: f.Value})
+		}
+	case *api.ModifiedContent:
+		for _, f := range c.Fields {
+			msg.Patch = append(msg.Patch, &JSONPatchOperation{Op: "replace", Path: patchPath(f.Name), Value: f.NewValue})
+		}
+	case *api.NoteContent:
+		msg.Patch = append(msg.Patch, &JSONPatchOperation{Op: "add", Path: "/events/-", Value: &api.Event{Date: e.Date, UserID: e.UserID, Type: e.Event, Content: c}})
+	}
+
+	return msg
+}
+
+//websocketMiddleware upgrades the connection to a WebSocket and sends DeviceUpdateMessages for FeedEvents from f
+//that match the client's subscription if next returns an *eventStreamScope, or writes next's error as JSON otherwise.
+//Browsers on origins other than the server's or one of origins are refused. next is run again every streamRecheckInterval,
+//and the connection is closed if it no longer returns a scope
+func websocketMiddleware(next returnHandler, f *api.Feed, origins []string) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		if !isWebsocketUpgrade(r) {
+			return writeJSONResponse(w, r, handleError(http.StatusBadRequest, errors.New("Request is not a WebSocket upgrade")))
+		}
+
+		if err := checkWebsocketOrigin(r, origins); err != nil {
+			return writeJSONResponse(w, r, handleError(http.StatusForbidden, err))
+		}
+
+		resp := next(w, r)
+
+		scope, ok := resp.Body.(*eventStreamScope)
+		if !ok {
+			return writeJSONResponse(w, r, resp)
+		}
+
+		conn, err := upgradeWebsocket(w, r)
+		if err != nil {
+			return writeJSONResponse(w, r, handleError(http.StatusBadRequest, err))
+		}
+		resp.Code = http.StatusSwitchingProtocols
+		resp.Body = nil
+
+		events := f.Subscribe()
+		defer f.Unsubscribe(events)
+
+		var sub *updateSubscription
+		mu := new(sync.Mutex)
+
+		//read subscription changes until the client disconnects
+		closed := make(chan error, 1)
+		go func() {
+			for {
+				buf, err := conn.ReadMessage()
+				if err != nil {
+					closed <- err
+					return
+				}
+
+				var req *UpdateSubscriptionRequest
+				if err = json.Unmarshal(buf, &req); err != nil || req == nil {
+					conn.WriteText([]byte(`{"error":"Could not decode subscription"}`))
+					continue
+				}
+
+				mu.Lock()
+				sub = newUpdateSubscription(req)
+				mu.Unlock()
+			}
+		}()
+
+		ping := time.NewTicker(updatePingInterval)
+		defer ping.Stop()
+
+		recheck := time.NewTicker(streamRecheckInterval)
+		defer recheck.Stop()
+
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					conn.Close(websocketCloseNormal)
+					return resp
+				}
+
+				mu.Lock()
+				matches := sub.matches(e)
+				mu.Unlock()
+				if !matches || !scope.allows(e) {
+					continue
+				}
+
+				buf, err := json.Marshal(newDeviceUpdateMessage(e))
+				if err != nil {
+					resp.Err = fmt.Errorf("Could not encode update: %v", err)
+					conn.Close(websocketCloseNormal)
+					return resp
+				}
+				if err = conn.WriteText(buf); err != nil {
+					conn.Close(websocketCloseNormal)
+					return resp
+				}
+			case <-ping.C:
+				if err := conn.Ping(); err != nil {
+					conn.Close(websocketCloseNormal)
+					return resp
+				}
+			case <-recheck.C:
+				if scope, resp.Err = recheckStreamScope(next, w, r, scope); scope == nil {
+					conn.Close(websocketClosePolicy)
+					return resp
+				}
+			case err := <-closed:
+				if err != errWebsocketClosed {
+					resp.Err = err
+					conn.Close(websocketCloseNormal)
+				}
+				return resp
+			}
+		}
+	}
+}
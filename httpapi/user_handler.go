@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/korylprince/tcea-inventory-server/api"
@@ -13,6 +17,8 @@ import (
 
 // POST /users
 func handleCreateUserWithCredentials(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	var req *CreateUserRequest
 	d := json.NewDecoder(r.Body)
 
@@ -21,12 +27,12 @@ func handleCreateUserWithCredentials(_ http.ResponseWriter, r *http.Request) *ha
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
 	}
 
-	id, err := api.CreateUserWithCredentials(r.Context(), req.Email, req.Password, req.Name)
+	id, err := store.CreateUserWithCredentials(r.Context(), req.Email, req.Password, req.Name)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
-	user, err := api.ReadUser(r.Context(), id)
+	user, err := store.ReadUser(r.Context(), id)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -40,12 +46,14 @@ func handleCreateUserWithCredentials(_ http.ResponseWriter, r *http.Request) *ha
 
 // GET /users/:id
 func handleReadUser(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
 	}
 
-	user, err := api.ReadUser(r.Context(), id)
+	user, err := store.ReadUser(r.Context(), id)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -53,11 +61,18 @@ func handleReadUser(_ http.ResponseWriter, r *http.Request) *handlerResponse {
 		return handleError(http.StatusNotFound, errors.New("Could not find user"))
 	}
 
+	//only admins and the user can see where they logged in from
+	if self := r.Context().Value(api.UserKey).(*api.User); !self.IsAdmin() && self.ID != user.ID {
+		user.LastLoginIP = ""
+	}
+
 	return &handlerResponse{Code: http.StatusOK, Body: user}
 }
 
 // POST /users/:id
 func handleUpdateUser(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
@@ -84,12 +99,12 @@ func handleUpdateUser(_ http.ResponseWriter, r *http.Request) *handlerResponse {
 	//use authenticated user hash since it is not sent in request
 	user.Hash = authUser.Hash
 
-	err = api.UpdateUser(r.Context(), user)
+	err = store.UpdateUser(r.Context(), user)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
-	user, err = api.ReadUser(r.Context(), user.ID)
+	user, err = store.ReadUser(r.Context(), user.ID)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
@@ -101,13 +116,234 @@ func handleUpdateUser(_ http.ResponseWriter, r *http.Request) *handlerResponse {
 }
 
 // POST /users/:id/password
-func handleChangeUserPassword(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+func handleChangeUserPassword(s SessionStore) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+		}
+
+		var req *ChangeUserPasswordRequest
+		d := json.NewDecoder(r.Body)
+
+		err = d.Decode(&req)
+		if err != nil || req == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+		}
+
+		user := r.Context().Value(api.UserKey).(*api.User)
+
+		if user.ID != id {
+			return handleError(http.StatusBadRequest, fmt.Errorf("user id mismatch: URL: %d, Authenticated: %d", id, user.ID))
+		}
+
+		err = user.ChangePassword(r.Context(), store, req.OldPassword, req.NewPassword)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		user, err = store.ReadUser(r.Context(), user.ID)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+		if user == nil {
+			return handleError(http.StatusNotFound, errors.New("Could not find user, but just updated"))
+		}
+
+		//sessions created with the old password must re-authenticate
+		if err = s.Revoke(id); err != nil {
+			return handleError(http.StatusInternalServerError, fmt.Errorf("Could not revoke sessions: %v", err))
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: user}
+	}
+}
+
+// POST /auth
+func handleAuthenticate(s SessionStore, n *loginNotifier, t *AuthThrottle) returnHandler {
+	return func(w http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		var req *AuthenticateRequest
+		d := json.NewDecoder(r.Body)
+
+		err := d.Decode(&req)
+		if err != nil || req == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+		}
+
+		if req.Email == "" || req.Password == "" {
+			return handleError(http.StatusBadRequest, errors.New("email or password empty"))
+		}
+
+		ip := remoteIP(r)
+		keys := []string{accountKey(strings.ToLower(req.Email)), ipKey(ip)}
+
+		//fail records the failed attempt and returns an Unauthorized response
+		fail := func(userID int64, reason string, err error) *handlerResponse {
+			t.Failure(keys...)
+			log.Printf("auth failure: email=%q user_id=%d ip=%s reason=%q\n", req.Email, userID, ip, reason)
+			if resp := checkAPIError(store.CreateAuthFailure(r.Context(), &api.AuthFailure{
+				Email: req.Email, UserID: userID, Date: time.Now(), IP: ip, UserAgent: r.UserAgent(), Reason: reason,
+			})); resp != nil {
+				return resp
+			}
+			return handleError(http.StatusUnauthorized, err)
+		}
+
+		if wait := t.Check(keys...); wait > 0 {
+			log.Printf("auth failure: email=%q user_id=0 ip=%s reason=%q\n", req.Email, ip, "locked out")
+			if resp := checkAPIError(store.CreateAuthFailure(r.Context(), &api.AuthFailure{
+				Email: req.Email, Date: time.Now(), IP: ip, UserAgent: r.UserAgent(), Reason: "locked out",
+			})); resp != nil {
+				return resp
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			return handleError(http.StatusTooManyRequests, fmt.Errorf("Could not authenticate %s: locked out for %v", req.Email, wait))
+		}
+
+		user, err := store.ReadUserByEmail(r.Context(), req.Email)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+		if user == nil || user.DeletedAt != nil {
+			return fail(0, "unknown user", errors.New("Could not find user"))
+		}
+
+		err = user.Authenticate(r.Context(), store, req.Password)
+		if err != nil {
+			return fail(user.ID, "invalid password", fmt.Errorf("Could not authenticate user %d:%s: %v", user.ID, user.Email, err))
+		}
+
+		if err = user.VerifySecondFactor(r.Context(), store, req.TOTP); err != nil {
+			if e, ok := err.(*api.Error); ok && e.Type == api.ErrorTypeServer {
+				return checkAPIError(err)
+			}
+			return fail(user.ID, "invalid second factor", fmt.Errorf("Could not authenticate user %d:%s: %v", user.ID, user.Email, err))
+		}
+
+		t.Success(keys[0])
+
+		return createSession(r, s, n, user)
+	}
+}
+
+// POST /auth/revoke
+func handleRevokeLogin(s SessionStore) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		var req *RevokeLoginRequest
+		d := json.NewDecoder(r.Body)
+
+		err := d.Decode(&req)
+		if err != nil || req == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+		}
+
+		if req.Token == "" {
+			return handleError(http.StatusBadRequest, errors.New("token empty"))
+		}
+
+		login, err := store.RevokeLogin(r.Context(), req.Token)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		if err = s.Revoke(login.UserID); err != nil {
+			return handleError(http.StatusInternalServerError, fmt.Errorf("Could not revoke sessions for User(%d): %v", login.UserID, err))
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: login}
+	}
+}
+
+//remoteIP returns the IP address of the request client
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+//createSession records the login for the authenticated user, then creates a session and sends login notifications.
+//The session is created after the request transaction commits, so a rolled back or retried request doesn't leave
+//an unused session that counts against the user's session limit
+func createSession(r *http.Request, s SessionStore, n *loginNotifier, user *api.User) *handlerResponse {
+	store := requestStore(r)
+
+	login := &api.Login{UserID: user.ID, Date: time.Now(), IP: remoteIP(r), UserAgent: r.UserAgent()}
+	newDevice, err := store.CreateLogin(r.Context(), login)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	var token string
+	notify := n.enabled(newDevice)
+	if notify && n.revokeURL != "" {
+		token, err = store.CreateLoginRevocation(r.Context(), login.ID, loginRevokeTTL)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+	}
+
+	body := &AuthenticateResponse{User: user}
+	resp := &handlerResponse{Code: http.StatusOK, Body: body}
+
+	onCommit(r, func() {
+		key, err := s.Create(user.ID)
+		if err != nil {
+			*resp = *handleError(http.StatusInternalServerError, fmt.Errorf("Could not create session: %v", err))
+			return
+		}
+		body.SessionKey = key
+
+		if notify {
+			n.notify(user, login, newDevice, token)
+		}
+	})
+
+	return resp
+}
+
+// GET /users/:id/locations
+func handleReadUserLocations(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
 	}
 
-	var req *ChangeUserPasswordRequest
+	user, err := store.ReadUser(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if user == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find user"))
+	}
+
+	locations, err := store.ReadUserLocations(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadLocationsResponse{Locations: locations}}
+}
+
+// POST /users/:id/locations
+func handleUpdateUserLocations(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	var req *UserLocationsRequest
 	d := json.NewDecoder(r.Body)
 
 	err = d.Decode(&req)
@@ -115,61 +351,168 @@ func handleChangeUserPassword(_ http.ResponseWriter, r *http.Request) *handlerRe
 		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
 	}
 
-	user := r.Context().Value(api.UserKey).(*api.User)
-
-	if user.ID != id {
-		return handleError(http.StatusBadRequest, fmt.Errorf("user id mismatch: URL: %d, Authenticated: %d", id, user.ID))
+	user, err := store.ReadUser(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	if user == nil {
+		return handleError(http.StatusNotFound, errors.New("Could not find user"))
 	}
 
-	err = user.ChangePassword(r.Context(), req.OldPassword, req.NewPassword)
+	err = store.UpdateUserLocations(r.Context(), id, req.Locations)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
 
-	user, err = api.ReadUser(r.Context(), user.ID)
+	locations, err := store.ReadUserLocations(r.Context(), id)
 	if resp := checkAPIError(err); resp != nil {
 		return resp
 	}
-	if user == nil {
-		return handleError(http.StatusNotFound, errors.New("Could not find user, but just updated"))
-	}
 
-	return &handlerResponse{Code: http.StatusOK, Body: user}
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadLocationsResponse{Locations: locations}}
 }
 
-// POST /auth
-func handleAuthenticate(s SessionStore) returnHandler {
+// POST /users/:id/role
+func handleUpdateUserRole(s SessionStore) returnHandler {
 	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
-		var req *AuthenticateRequest
+		store := requestStore(r)
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+		}
+
+		var req *UserRoleRequest
 		d := json.NewDecoder(r.Body)
 
-		err := d.Decode(&req)
+		err = d.Decode(&req)
 		if err != nil || req == nil {
 			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
 		}
 
-		if req.Email == "" || req.Password == "" {
-			return handleError(http.StatusBadRequest, errors.New("email or password empty"))
+		prev, err := store.ReadUser(r.Context(), id)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+		if prev == nil {
+			return handleError(http.StatusNotFound, errors.New("Could not find user"))
 		}
 
-		user, err := api.ReadUserByEmail(r.Context(), req.Email)
+		err = store.UpdateUserRole(r.Context(), id, req.Role)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		user, err := store.ReadUser(r.Context(), id)
 		if resp := checkAPIError(err); resp != nil {
 			return resp
 		}
 		if user == nil {
-			return handleError(http.StatusUnauthorized, errors.New("Could not find user"))
+			return handleError(http.StatusNotFound, errors.New("Could not find user"))
+		}
+
+		//existing sessions would otherwise keep the old Role's privileges in clients
+		if user.Role != prev.Role {
+			if err = s.Revoke(id); err != nil {
+				return handleError(http.StatusInternalServerError, fmt.Errorf("Could not revoke sessions: %v", err))
+			}
 		}
 
-		err = user.Authenticate(r.Context(), req.Password)
+		return &handlerResponse{Code: http.StatusOK, Body: user}
+	}
+}
+
+// POST /users/:id/disabled
+func handleUpdateUserDisabled(s SessionStore) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 		if err != nil {
-			return handleError(http.StatusUnauthorized, fmt.Errorf("Could not authenticate user %d:%s: %v", user.ID, user.Email, err))
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
 		}
 
-		key, err := s.Create(user.ID)
+		var req *UserDisabledRequest
+		d := json.NewDecoder(r.Body)
+
+		err = d.Decode(&req)
+		if err != nil || req == nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode json: %v", err))
+		}
+
+		authUser := r.Context().Value(api.UserKey).(*api.User)
+		if authUser.ID == id && req.Disabled {
+			return handleError(http.StatusBadRequest, errors.New("Could not disable user: users cannot disable themselves"))
+		}
+
+		err = store.UpdateUserDisabled(r.Context(), id, req.Disabled)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		user, err := store.ReadUser(r.Context(), id)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+		if user == nil {
+			return handleError(http.StatusNotFound, errors.New("Could not find user"))
+		}
+
+		if user.Disabled {
+			if err = s.Revoke(id); err != nil {
+				return handleError(http.StatusInternalServerError, fmt.Errorf("Could not revoke sessions: %v", err))
+			}
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: user}
+	}
+}
+
+// DELETE /users/:id
+func handleDeleteUser(s SessionStore) returnHandler {
+	return func(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+		store := requestStore(r)
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 		if err != nil {
-			return handleError(http.StatusInternalServerError, fmt.Errorf("Could not create session: %v", err))
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+		}
+
+		authUser := r.Context().Value(api.UserKey).(*api.User)
+		if authUser.ID == id {
+			return handleError(http.StatusBadRequest, errors.New("Could not delete user: users cannot delete themselves"))
 		}
 
-		return &handlerResponse{Code: http.StatusOK, Body: &AuthenticateResponse{SessionKey: key, User: user}}
+		err = store.DeleteUser(r.Context(), id)
+		if resp := checkAPIError(err); resp != nil {
+			return resp
+		}
+
+		if err = s.Revoke(id); err != nil {
+			return handleError(http.StatusInternalServerError, fmt.Errorf("Could not revoke sessions: %v", err))
+		}
+
+		return &handlerResponse{Code: http.StatusOK, Body: nil}
+	}
+}
+
+// POST /users/:id/restore
+func handleRestoreUser(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	if resp := checkAPIError(store.RestoreUser(r.Context(), id)); resp != nil {
+		return resp
 	}
+
+	user, err := store.ReadUser(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: user}
 }
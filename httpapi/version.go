@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+)
+
+//APIVersion is a major version of the HTTP API. Each version is served under its own /api/{version} prefix
+type APIVersion int
+
+//APIVersions
+const (
+	APIVersion1 APIVersion = 1
+	APIVersion2 APIVersion = 2
+)
+
+//apiVersionPrefixes are the URL prefixes for each APIVersion
+var apiVersionPrefixes = map[APIVersion]string{
+	APIVersion1: "/api/1.0",
+	APIVersion2: "/api/2.0",
+}
+
+//VersionKey is the context key for the APIVersion for a request
+const VersionKey contextKey = 2
+
+//requestVersion returns the APIVersion for the given request. Requests without a version are APIVersion1
+func requestVersion(r *http.Request) APIVersion {
+	if v, ok := r.Context().Value(VersionKey).(APIVersion); ok {
+		return v
+	}
+	return APIVersion1
+}
+
+//versionedBody is a response body whose format depends on the APIVersion.
+//Breaking format changes are made by implementing it so that older versions keep their original format
+type versionedBody interface {
+	forVersion(v APIVersion) interface{}
+}
+
+//versionBody returns the body to encode for the given APIVersion
+func versionBody(body interface{}, v APIVersion) interface{} {
+	if b, ok := body.(versionedBody); ok {
+		return b.forVersion(v)
+	}
+	return body
+}
+
+//versionMiddleware strips the prefix for the given APIVersion and adds the APIVersion to the request context
+func versionMiddleware(next http.Handler, v APIVersion) http.Handler {
+	return http.StripPrefix(apiVersionPrefixes[v], http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), VersionKey, v)))
+	}))
+}
+
+//newVersionMux returns a handler that serves next under the prefix of every APIVersion
+func newVersionMux(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	for v, prefix := range apiVersionPrefixes {
+		mux.Handle(prefix+"/", versionMiddleware(next, v))
+	}
+	return mux
+}
@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GET /admin/vocabulary
+func handleReadVocabularyReviewQueue(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	entries, err := store.ReadVocabularyReviewQueue(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadVocabularyReviewQueueResponse{Entries: entries}}
+}
+
+// POST /admin/vocabulary/review
+func handleReviewVocabulary(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var req *ReviewVocabularyRequest
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&req)
+	if err != nil || req == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	err = store.ReviewVocabulary(r.Context(), req.ModelIDs)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	entries, err := store.ReadVocabularyReviewQueue(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadVocabularyReviewQueueResponse{Entries: entries}}
+}
@@ -0,0 +1,292 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/tcea-inventory-server/api"
+)
+
+const (
+	webhookDeliveryInterval  = 15 * time.Second
+	webhookDeliveryBatchSize = 50
+	webhookDeliveryTimeout   = 10 * time.Second
+
+	//webhookConcurrency is the maximum concurrent deliveries to each Webhook, and webhookDeliveryWorkers the maximum overall
+	webhookConcurrency     = 2
+	webhookDeliveryWorkers = 10
+
+	defaultWebhookDeliveriesLimit = 100
+	maxWebhookDeliveriesLimit     = 1000
+)
+
+//webhookSignature returns the signature header value for the given payload sent at timestamp (Unix seconds):
+//the hex HMAC-SHA256 of the timestamp, a period, and the payload using secret. The timestamp is signed so receivers can reject replayed deliveries
+func webhookSignature(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//deliverWebhook POSTs the given delivery and returns the response code (if one was received) and an error if the delivery failed
+func deliverWebhook(client *http.Client, d *api.PendingWebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("Could not create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tcea-inventory-server")
+	req.Header.Set("X-Inventory-Event", d.EventType)
+	req.Header.Set("X-Inventory-Delivery", strconv.FormatInt(d.ID, 10))
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Inventory-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Inventory-Signature", webhookSignature(d.Secret, timestamp, d.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Unexpected response: %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+//deliverWebhooks attempts due WebhookDeliveries every webhookDeliveryInterval.
+//Requests are made outside of a transaction so slow receivers don't hold database locks, and concurrently
+//(up to webhookConcurrency per Webhook) so a slow receiver doesn't hold up deliveries to the others.
+//Once ctx is done, it returns after the current batch is delivered and recorded
+func deliverWebhooks(ctx context.Context, db *sql.DB, c api.Cache) {
+	client := &http.Client{Timeout: webhookDeliveryTimeout}
+
+	for {
+		var deliveries []*api.PendingWebhookDelivery
+		err := withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+			var err error
+			deliveries, err = store.ReadDueWebhookDeliveries(ctx, time.Now(), webhookDeliveryBatchSize)
+			return err
+		})
+		if err != nil {
+			log.Printf("Could not read webhook deliveries: %v\n", err)
+		}
+
+		workers := make(chan struct{}, webhookDeliveryWorkers)
+		webhooks := make(map[int64]chan struct{})
+		wg := new(sync.WaitGroup)
+
+		for _, d := range deliveries {
+			webhook, ok := webhooks[d.WebhookID]
+			if !ok {
+				webhook = make(chan struct{}, webhookConcurrency)
+				webhooks[d.WebhookID] = webhook
+			}
+
+			wg.Add(1)
+			go func(d *api.PendingWebhookDelivery, webhook chan struct{}) {
+				defer wg.Done()
+
+				//wait for the Webhook first so deliveries waiting on a slow receiver don't hold workers
+				webhook <- struct{}{}
+				defer func() { <-webhook }()
+				workers <- struct{}{}
+				defer func() { <-workers }()
+
+				code, dErr := deliverWebhook(client, d)
+				err := withTransaction(db, c, func(ctx context.Context, store *api.TxStore) error {
+					return store.RecordWebhookAttempt(ctx, d.ID, time.Now(), code, dErr)
+				})
+				if err != nil {
+					log.Printf("Could not record webhook delivery %d: %v\n", d.ID, err)
+				}
+			}(d, webhook)
+		}
+
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		//keep going without waiting if there may be more due deliveries
+		if len(deliveries) < webhookDeliveryBatchSize && !sleepContext(ctx, webhookDeliveryInterval) {
+			return
+		}
+	}
+}
+
+//readWebhook reads the Webhook with the id in the request URL
+func readWebhook(r *http.Request) (*api.Webhook, *handlerResponse) {
+	store := requestStore(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, handleError(http.StatusBadRequest, fmt.Errorf("Could not decode id: %v", err))
+	}
+
+	webhook, err := store.ReadWebhook(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return nil, resp
+	}
+	if webhook == nil {
+		return nil, handleError(http.StatusNotFound, errors.New("Could not find webhook"))
+	}
+
+	return webhook, nil
+}
+
+// GET /webhooks/
+func handleReadWebhooks(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	webhooks, err := store.ReadWebhooks(r.Context())
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	for _, w := range webhooks {
+		w.Secret = ""
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadWebhooksResponse{Webhooks: webhooks}}
+}
+
+// POST /webhooks/
+func handleCreateWebhook(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	var webhook *api.Webhook
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&webhook)
+	if err != nil || webhook == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	id, err := store.CreateWebhook(r.Context(), webhook)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	//the Secret is only returned now
+	secret := webhook.Secret
+
+	webhook, err = store.ReadWebhook(r.Context(), id)
+	if resp := checkAPIError(err); resp != nil {
+		return resp
+	}
+	webhook.Secret = secret
+
+	return &handlerResponse{Code: http.StatusOK, Body: webhook}
+}
+
+// GET /webhooks/:id
+func handleReadWebhook(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	webhook, resp := readWebhook(r)
+	if resp != nil {
+		return resp
+	}
+
+	webhook.Secret = ""
+
+	return &handlerResponse{Code: http.StatusOK, Body: webhook}
+}
+
+// POST /webhooks/:id
+func handleUpdateWebhook(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	webhook, resp := readWebhook(r)
+	if resp != nil {
+		return resp
+	}
+
+	var update *api.Webhook
+	d := json.NewDecoder(r.Body)
+
+	err := d.Decode(&update)
+	if err != nil || update == nil {
+		return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode JSON: %v", err))
+	}
+
+	update.ID = webhook.ID
+
+	if resp = checkAPIError(store.UpdateWebhook(r.Context(), update)); resp != nil {
+		return resp
+	}
+
+	webhook, err = store.ReadWebhook(r.Context(), webhook.ID)
+	if resp = checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	webhook.Secret = ""
+
+	return &handlerResponse{Code: http.StatusOK, Body: webhook}
+}
+
+// DELETE /webhooks/:id
+func handleDeleteWebhook(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	webhook, resp := readWebhook(r)
+	if resp != nil {
+		return resp
+	}
+
+	if resp = checkAPIError(store.DeleteWebhook(r.Context(), webhook.ID)); resp != nil {
+		return resp
+	}
+
+	webhook.Secret = ""
+
+	return &handlerResponse{Code: http.StatusOK, Body: webhook}
+}
+
+// GET /webhooks/:id/deliveries/
+func handleReadWebhookDeliveries(_ http.ResponseWriter, r *http.Request) *handlerResponse {
+	store := requestStore(r)
+
+	webhook, resp := readWebhook(r)
+	if resp != nil {
+		return resp
+	}
+
+	limit := defaultWebhookDeliveriesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			return handleError(http.StatusBadRequest, fmt.Errorf("Could not decode limit: %v", err))
+		}
+		if l < 1 || l > maxWebhookDeliveriesLimit {
+			return handleError(http.StatusBadRequest, fmt.Errorf("limit (%d) must be between 1 and %d", l, maxWebhookDeliveriesLimit))
+		}
+		limit = l
+	}
+
+	deliveries, err := store.ReadWebhookDeliveries(r.Context(), webhook.ID, limit)
+	if resp = checkAPIError(err); resp != nil {
+		return resp
+	}
+
+	return &handlerResponse{Code: http.StatusOK, Body: &ReadWebhookDeliveriesResponse{Deliveries: deliveries}}
+}
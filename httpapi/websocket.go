@@ -0,0 +1,311 @@
+package httpapi
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//websocketGUID is appended to the client's key to compute Sec-WebSocket-Accept (RFC 6455 section 1.3)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+//websocketProtocol is the WebSocket subprotocol selected by the server. Browsers can't send the X-Session-Key header,
+//so they offer it along with a second subprotocol of websocketTokenProtocol followed by a stream token
+const (
+	websocketProtocol      = "inventory"
+	websocketTokenProtocol = "inventory.token."
+)
+
+//websocketMaxMessageSize is the largest message accepted from a client
+const websocketMaxMessageSize = 64 * 1024
+
+//websocketWriteTimeout is how long a single frame write may take before the connection is closed
+const websocketWriteTimeout = 10 * time.Second
+
+//WebSocket opcodes
+const (
+	websocketOpContinuation = 0x0
+	websocketOpText         = 0x1
+	websocketOpBinary       = 0x2
+	websocketOpClose        = 0x8
+	websocketOpPing         = 0x9
+	websocketOpPong         = 0xA
+)
+
+//WebSocket close codes
+const (
+	websocketCloseNormal      = 1000
+	websocketCloseUnsupported = 1003
+	websocketClosePolicy      = 1008
+	websocketCloseTooLarge    = 1009
+)
+
+//errWebsocketClosed is returned by ReadMessage when the client closes the connection
+var errWebsocketClosed = errors.New("WebSocket closed")
+
+//errWebsocketTooLarge is returned by ReadMessage when a client message is larger than websocketMaxMessageSize
+var errWebsocketTooLarge = errors.New("WebSocket message too large")
+
+//websocketConn is a minimal server side WebSocket connection that exchanges text messages
+type websocketConn struct {
+	conn net.Conn
+	buf  *bufio.ReadWriter
+	mu   *sync.Mutex
+}
+
+//isWebsocketUpgrade returns true if the request is a WebSocket handshake
+func isWebsocketUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+//headerContains returns true if the comma separated header contains token (case-insensitive)
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//websocketToken returns the stream token offered as a subprotocol, or an empty string if there isn't one
+func websocketToken(r *http.Request) string {
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, websocketTokenProtocol) {
+				return strings.TrimPrefix(p, websocketTokenProtocol)
+			}
+		}
+	}
+	return ""
+}
+
+//checkWebsocketOrigin returns an error if the request is from a browser on an origin that isn't the server's or one of origins.
+//"*" allows all origins. Requests without an Origin header aren't from browsers, so they're allowed
+func checkWebsocketOrigin(r *http.Request, origins []string) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("Could not parse origin: %v", err)
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+
+	for _, o := range origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Origin (%s) is not allowed", origin)
+}
+
+//upgradeWebsocket completes the WebSocket handshake and returns the hijacked connection
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	if !isWebsocketUpgrade(r) {
+		return nil, errors.New("Request is not a WebSocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errors.New("Unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("Sec-WebSocket-Key header empty")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("WebSockets are not supported")
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("Could not hijack connection: %v", err)
+	}
+
+	//the server's read and write timeouts still apply to the hijacked connection
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Could not clear connection deadline: %v", err)
+	}
+
+	//browsers fail the handshake unless the server selects one of the offered subprotocols
+	var protocol string
+	if headerContains(r.Header, "Sec-WebSocket-Protocol", websocketProtocol) {
+		protocol = "Sec-WebSocket-Protocol: " + websocketProtocol + "\r\n"
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n%s\r\n", base64.StdEncoding.EncodeToString(sum[:]), protocol)
+	if err = buf.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Could not write handshake: %v", err)
+	}
+
+	return &websocketConn{conn: conn, buf: buf, mu: new(sync.Mutex)}, nil
+}
+
+//writeFrame writes a single unfragmented frame
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout)); err != nil {
+		return err
+	}
+	if _, err := c.buf.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.buf.Write(payload); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+//WriteText writes a text message
+func (c *websocketConn) WriteText(msg []byte) error {
+	return c.writeFrame(websocketOpText, msg)
+}
+
+//Ping writes a ping frame
+func (c *websocketConn) Ping() error {
+	return c.writeFrame(websocketOpPing, nil)
+}
+
+//Close sends a close frame with the given code and closes the connection
+func (c *websocketConn) Close(code int) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	c.writeFrame(websocketOpClose, payload)
+	return c.conn.Close()
+}
+
+//readFrame reads a single frame and returns its FIN bit, opcode, and unmasked payload
+func (c *websocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(c.buf, header); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("Client frame is not masked")
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(c.buf, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(c.buf, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if length > websocketMaxMessageSize {
+		return false, 0, nil, errWebsocketTooLarge
+	}
+
+	mask := make([]byte, 4)
+	if _, err = io.ReadFull(c.buf, mask); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.buf, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+//ReadMessage returns the next text message from the client, answering pings while it waits.
+//errWebsocketClosed is returned if the client closes the connection
+func (c *websocketConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	var started bool
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			if err == errWebsocketTooLarge {
+				c.Close(websocketCloseTooLarge)
+			}
+			return nil, err
+		}
+
+		switch opcode {
+		case websocketOpPing:
+			if err = c.writeFrame(websocketOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case websocketOpPong:
+			continue
+		case websocketOpClose:
+			c.Close(websocketCloseNormal)
+			return nil, errWebsocketClosed
+		case websocketOpBinary:
+			c.Close(websocketCloseUnsupported)
+			return nil, errors.New("Binary WebSocket messages are not supported")
+		case websocketOpText:
+			if started {
+				return nil, errors.New("WebSocket message interrupted by a new message")
+			}
+			started = true
+		case websocketOpContinuation:
+			if !started {
+				return nil, errors.New("Unexpected WebSocket continuation frame")
+			}
+		default:
+			return nil, fmt.Errorf("Unknown WebSocket opcode: %d", opcode)
+		}
+
+		msg = append(msg, payload...)
+		if len(msg) > websocketMaxMessageSize {
+			c.Close(websocketCloseTooLarge)
+			return nil, errWebsocketTooLarge
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
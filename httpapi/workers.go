@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//Workers runs the HTTP API's background workers (grant expiry, webhook delivery, report schedules, event archiving,
+//health checks, and recompute jobs) so they can be stopped before the database is closed.
+//Workers finish the batch they're working on before returning, so it isn't cut off mid-transaction
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     *sync.WaitGroup
+}
+
+//NewWorkers returns a new Workers
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{ctx: ctx, cancel: cancel, wg: new(sync.WaitGroup)}
+}
+
+//Go runs f in a new goroutine. ctx is canceled when the Workers are stopped, and f should return soon after
+func (w *Workers) Go(f func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		f(w.ctx)
+	}()
+}
+
+//Stop stops the workers and waits for them to return, or returns ctx's error if ctx is done first
+func (w *Workers) Stop(ctx context.Context) error {
+	w.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//sleepContext waits for d and returns true, or returns false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
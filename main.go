@@ -1,33 +1,288 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strconv"
+	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/handlers"
+	"github.com/korylprince/tcea-inventory-server/api"
+	"github.com/korylprince/tcea-inventory-server/grpcapi"
 	"github.com/korylprince/tcea-inventory-server/httpapi"
+	"github.com/korylprince/tcea-inventory-server/migrate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+//build information, set with e.g. -ldflags "-X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ) -X main.schemaVersion=1"
+var (
+	commit        = "unknown"
+	buildDate     = "unknown"
+	schemaVersion = "unknown"
+)
+
+//configurePool sets db's connection pool limits from the config. -1 values are passed through, which the sql package treats as unlimited (or no idle connections)
+func configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(config.SQLMaxOpenConns)
+	db.SetMaxIdleConns(config.SQLMaxIdleConns)
+	db.SetConnMaxLifetime(time.Second * time.Duration(config.SQLConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Second * time.Duration(config.SQLConnMaxIdleTime))
+}
+
 func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "apply database migrations and exit")
+	flag.Parse()
+
+	//fall back to the commit recorded by the go tool when building from a checkout
+	if info, ok := debug.ReadBuildInfo(); ok && commit == "unknown" {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				commit = s.Value
+			}
+		}
+	}
+
+	err := api.SetPasswordConfig(&api.PasswordConfig{
+		Algorithm:       config.PasswordHash,
+		BcryptCost:      config.BcryptCost,
+		Argon2idTime:    config.Argon2idTime,
+		Argon2idMemory:  config.Argon2idMemory,
+		Argon2idThreads: config.Argon2idThreads,
+	})
+	if err != nil {
+		log.Fatalln("Could not configure password hashing:", err)
+	}
+
+	api.SetVocabularyDailyLimit(config.VocabularyDailyLimit)
+
+	if config.AssetTagPrefix != "" {
+		api.SetAssetTagGenerator(&api.SequenceAssetTagGenerator{
+			Prefix:      config.AssetTagPrefix,
+			Digits:      config.AssetTagDigits,
+			PerLocation: config.AssetTagPerLocation,
+			PerYear:     config.AssetTagPerYear,
+		})
+	}
+
 	db, err := sql.Open(config.SQLDriver, config.SQLDSN)
 	if err != nil {
 		log.Fatalln("Could not open database:", err)
 	}
+	configurePool(db)
 
-	s := httpapi.NewMemorySessionStore(time.Minute * time.Duration(config.SessionExpiration))
+	if !config.SkipMigrations || *migrateOnly {
+		applied, err := migrate.Up(context.Background(), db)
+		if err != nil {
+			log.Fatalln("Could not migrate database:", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s\n", m.Version, m.Name)
+		}
+	}
 
-	r := httpapi.NewRouter(os.Stdout, s, db)
+	if *migrateOnly {
+		db.Close()
+		return
+	}
 
-	chain := handlers.CompressHandler(handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Accept", "Content-Type", "Origin", "X-Session-Key"}),
-	)(http.StripPrefix(config.Prefix, r)))
+	if err = migrate.Check(context.Background(), db); err != nil {
+		log.Fatalln("Could not start:", err)
+	}
+
+	var replica *sql.DB
+	if config.SQLReplicaDSN != "" {
+		if replica, err = sql.Open(config.SQLDriver, config.SQLReplicaDSN); err != nil {
+			log.Fatalln("Could not open replica database:", err)
+		}
+		configurePool(replica)
+	}
+
+	if schemaVersion == "unknown" {
+		schemaVersion = strconv.Itoa(migrate.LatestVersion())
+	}
+
+	s := httpapi.NewMemorySessionStore(time.Minute*time.Duration(config.SessionExpiration), config.SessionLimit)
+
+	opts := &httpapi.RouterOptions{
+		LoginNotifications: config.LoginNotifications,
+		InviteURL:          config.InviteURL,
+		RevokeURL:          config.RevokeURL,
+		Origins:            config.CORSOrigins,
+		MaxBodyBytes:       config.MaxBodyBytes,
+		RequestTimeout:     time.Second * time.Duration(config.RequestTimeout),
+		Feed:               api.NewFeed(),
+		Debug:              config.Debug,
+		Build:              &httpapi.BuildInfo{Commit: commit, BuildDate: buildDate, SchemaVersion: schemaVersion},
+		ReplicaDB:          replica,
+		EventRetention:     config.EventRetentionYears,
+		ReplacementAge:     config.ReplacementAgeYears,
+		Workers:            httpapi.NewWorkers(),
+	}
+
+	//close event streams before the write timeout so clients reconnect instead of seeing an error
+	opts.StreamDuration = time.Second * time.Duration(config.WriteTimeout) * 9 / 10
+
+	if opts.TrustedProxies, err = httpapi.ParseTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalln("Could not parse INVENTORY_TRUSTEDPROXIES:", err)
+	}
+
+	if config.CacheExpiration > 0 {
+		opts.Cache = api.NewMemoryCache(time.Second * time.Duration(config.CacheExpiration))
+	}
+
+	if config.SMTPAddr != "" {
+		opts.Mailer = api.NewSMTPMailer(config.SMTPAddr, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	}
+
+	if config.JournalSize != -1 {
+		var w io.Writer
+		if config.JournalPath != "" {
+			f, err := os.OpenFile(config.JournalPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				log.Fatalln("Could not open journal:", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		opts.Journal = httpapi.NewJournal(config.JournalSize, w)
+	}
+
+	if config.OIDCIssuer != "" {
+		opts.OIDC, err = httpapi.NewOIDCProvider(&httpapi.OIDCConfig{
+			Issuer:       config.OIDCIssuer,
+			ClientID:     config.OIDCClientID,
+			ClientSecret: config.OIDCClientSecret,
+			RedirectURL:  config.OIDCRedirectURL,
+		})
+		if err != nil {
+			log.Fatalln("Could not configure OpenID Connect:", err)
+		}
+	}
+
+	r := httpapi.NewRouter(os.Stdout, s, db, opts)
+
+	cors := []handlers.CORSOption{
+		handlers.AllowedOrigins(config.CORSOrigins),
+		handlers.AllowedMethods(config.CORSMethods),
+		handlers.AllowedHeaders(config.CORSHeaders),
+		handlers.ExposedHeaders([]string{"ETag"}),
+	}
+
+	//single sign-on binds login attempts to the browser with a cookie
+	if config.OIDCIssuer != "" {
+		cors = append(cors, handlers.AllowCredentials())
+	}
+
+	chain := handlers.CompressHandler(handlers.CORS(cors...)(http.StripPrefix(config.Prefix, r)))
+
+	srv := &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           chain,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Second * time.Duration(config.ReadTimeout),
+		WriteTimeout:      time.Second * time.Duration(config.WriteTimeout),
+		IdleTimeout:       time.Second * time.Duration(config.IdleTimeout),
+	}
+
+	//event streams never finish on their own, so end them when shutting down
+	srv.RegisterOnShutdown(opts.Feed.Close)
+
+	var g *grpc.Server
+	if config.GRPCListenAddr != "" {
+		var serverOpts []grpc.ServerOption
+		if config.GRPCTLSCert != "" {
+			creds, err := credentials.NewServerTLSFromFile(config.GRPCTLSCert, config.GRPCTLSKey)
+			if err != nil {
+				log.Fatalln("Could not load gRPC TLS certificate:", err)
+			}
+			serverOpts = append(serverOpts, grpc.Creds(creds))
+		}
+
+		g = grpcapi.NewServer(os.Stdout, s, db, &grpcapi.Options{
+			Cache:          opts.Cache,
+			Feed:           opts.Feed,
+			RequestTimeout: opts.RequestTimeout,
+			ReplicaDB:      replica,
+		}, serverOpts...)
+
+		l, err := net.Listen("tcp", config.GRPCListenAddr)
+		if err != nil {
+			log.Fatalln("Could not listen for gRPC:", err)
+		}
+
+		go func() {
+			log.Println("Listening for gRPC on:", config.GRPCListenAddr)
+			if err := g.Serve(l); err != nil {
+				log.Println("Could not serve gRPC:", err)
+			}
+		}()
+	}
+
+	//on SIGINT or SIGTERM, stop accepting connections and let in-flight requests finish (and their transactions commit)
+	done := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		log.Println("Received signal:", <-sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(config.ShutdownTimeout))
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println("Could not drain connections:", err)
+		}
+
+		//change streams were ended with the HTTP event streams when the Feed was closed
+		if g != nil {
+			stopped := make(chan struct{})
+			go func() {
+				g.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				log.Println("Could not drain gRPC calls:", ctx.Err())
+				g.Stop()
+			}
+		}
+
+		//let background workers finish their current batch before the database is closed
+		if err := opts.Workers.Stop(ctx); err != nil {
+			log.Println("Could not stop background workers:", err)
+		}
+
+		close(done)
+	}()
 
 	log.Println("Listening on:", config.ListenAddr)
-	log.Println(http.ListenAndServe(config.ListenAddr, chain))
+	if err = srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Println(err)
+		return
+	}
+
+	<-done
+
+	if err = db.Close(); err != nil {
+		log.Println("Could not close database:", err)
+	}
+
+	if replica != nil {
+		if err = replica.Close(); err != nil {
+			log.Println("Could not close replica database:", err)
+		}
+	}
+
+	log.Println("Shut down")
 }
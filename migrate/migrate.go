@@ -0,0 +1,251 @@
+//Package migrate applies the versioned database schema migrations embedded in the binary
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+//lockName is the MySQL named lock held while migrating so multiple servers starting at once don't race
+const lockName = "inventory_schema_migration"
+
+//lockTimeout is how long to wait for another server's migrations to finish
+const lockTimeout = 5 * time.Minute
+
+//baselineTable is a table created by the first migration, which is the original model.sql schema.
+//Databases created from model.sql before migrations were tracked have it but not the schema_migration table,
+//and are treated as already being at version 1
+const baselineTable = "device"
+
+//Migration is a single schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+//Migrations returns all embedded Migrations in version order.
+//Migration files are named <version>_<name>.sql, e.g. 0002_add_device_notes.sql
+func Migrations() ([]*Migration, error) {
+	entries, err := files.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Could not read migrations: %v", err)
+	}
+
+	var migrations []*Migration
+	versions := make(map[int]string)
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || version < 1 {
+			return nil, fmt.Errorf("Invalid migration file name: %s", e.Name())
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("Duplicate migration version %d: %s and %s", version, other, e.Name())
+		}
+		versions[version] = e.Name()
+
+		buf, err := files.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("Could not read migration %s: %v", e.Name(), err)
+		}
+
+		migrations = append(migrations, &Migration{Version: version, Name: parts[1], SQL: string(buf)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+//LatestVersion returns the version of the newest embedded Migration
+func LatestVersion() int {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+//Version returns the database's schema version, or 0 if no migrations have been applied
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Could not connect to database: %v", err)
+	}
+	defer conn.Close()
+
+	return version(ctx, conn)
+}
+
+//tableExists returns true if the given table exists in the current database
+func tableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+	row := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=DATABASE() AND table_name=?;", table)
+	if err := row.Scan(&count); err != nil {
+		return false, fmt.Errorf("Could not check for table %s: %v", table, err)
+	}
+	return count > 0, nil
+}
+
+func version(ctx context.Context, conn *sql.Conn) (int, error) {
+	exists, err := tableExists(ctx, conn, "schema_migration")
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		baseline, err := tableExists(ctx, conn, baselineTable)
+		if err != nil || !baseline {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	var v sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migration;").Scan(&v); err != nil {
+		return 0, fmt.Errorf("Could not query schema version: %v", err)
+	}
+
+	return int(v.Int64), nil
+}
+
+//Up applies all Migrations newer than the database's schema version and returns the applied Migrations.
+//MySQL commits schema changes immediately, so a failed Migration may be partially applied and must be fixed by hand
+func Up(ctx context.Context, db *sql.DB) ([]*Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to database: %v", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?);", lockName, int(lockTimeout.Seconds())).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("Could not lock schema: %v", err)
+	}
+	if locked.Int64 != 1 {
+		return nil, fmt.Errorf("Could not lock schema: timed out after %v", lockTimeout)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?);", lockName)
+
+	current, err := version(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migration (
+    version int PRIMARY KEY,
+    name varchar(255) NOT NULL,
+    applied datetime NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create schema_migration table: %v", err)
+	}
+
+	//record the baseline for databases created before migrations were tracked
+	if current == 1 {
+		if _, err = conn.ExecContext(ctx, "INSERT IGNORE INTO schema_migration(version, name, applied) VALUES(?, ?, ?);", migrations[0].Version, migrations[0].Name, time.Now()); err != nil {
+			return nil, fmt.Errorf("Could not record baseline migration: %v", err)
+		}
+	}
+
+	var applied []*Migration
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		for i, stmt := range splitStatements(m.SQL) {
+			if _, err = conn.ExecContext(ctx, stmt); err != nil {
+				return applied, fmt.Errorf("Could not apply migration %04d_%s (statement %d): %v", m.Version, m.Name, i+1, err)
+			}
+		}
+
+		if _, err = conn.ExecContext(ctx, "INSERT INTO schema_migration(version, name, applied) VALUES(?, ?, ?);", m.Version, m.Name, time.Now()); err != nil {
+			return applied, fmt.Errorf("Could not record migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+//Check returns an error if the database's schema version doesn't match the newest embedded Migration
+func Check(ctx context.Context, db *sql.DB) error {
+	v, err := Version(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	switch latest := LatestVersion(); {
+	case v < latest:
+		return fmt.Errorf("Database schema version (%d) is older than this server (%d); apply migrations", v, latest)
+	case v > latest:
+		return fmt.Errorf("Database schema version (%d) is newer than this server (%d); upgrade the server", v, latest)
+	}
+
+	return nil
+}
+
+//splitStatements splits the given SQL into statements on semicolons outside of quotes and comments
+func splitStatements(src string) []string {
+	var stmts []string
+	var b strings.Builder
+	var quote byte
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		if quote != 0 {
+			b.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(src) {
+				i++
+				b.WriteByte(src[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			b.WriteByte(c)
+		case c == '-' && strings.HasPrefix(src[i:], "-- "), c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == ';':
+			if s := strings.TrimSpace(b.String()); s != "" {
+				stmts = append(stmts, s)
+			}
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	if s := strings.TrimSpace(b.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+
+	return stmts
+}
@@ -0,0 +1,7 @@
+CREATE TABLE category (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) UNIQUE NOT NULL
+);
+
+ALTER TABLE model ADD COLUMN category_id INTEGER UNSIGNED, ADD FOREIGN KEY(category_id) REFERENCES category(id) ON DELETE SET NULL;
+CREATE INDEX model_category_id ON model(category_id);
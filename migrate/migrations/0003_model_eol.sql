@@ -0,0 +1,3 @@
+ALTER TABLE model ADD COLUMN eol_date DATE, ADD COLUMN eos_date DATE;
+CREATE INDEX model_eol_date ON model(eol_date);
+CREATE INDEX model_eos_date ON model(eos_date);
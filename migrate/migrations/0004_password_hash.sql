@@ -0,0 +1,2 @@
+-- argon2id hashes are longer than bcrypt's 60 characters
+ALTER TABLE user MODIFY COLUMN hash VARCHAR(255) NOT NULL;
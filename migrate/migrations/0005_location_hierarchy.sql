@@ -0,0 +1,3 @@
+ALTER TABLE location ADD COLUMN type ENUM ('campus', 'building', 'room'), ADD COLUMN parent VARCHAR(255),
+    ADD FOREIGN KEY(parent) REFERENCES location(location);
+CREATE INDEX location_parent ON location(parent);
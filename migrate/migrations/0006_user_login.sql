@@ -0,0 +1,10 @@
+CREATE TABLE user_login (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER UNSIGNED NOT NULL,
+    date DATETIME NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_login_user_id ON user_login(user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE location ADD COLUMN description TEXT, ADD COLUMN contact_name VARCHAR(255),
+    ADD COLUMN contact_email VARCHAR(255), ADD COLUMN contact_phone VARCHAR(50);
@@ -0,0 +1,2 @@
+ALTER TABLE status ADD COLUMN color CHAR(7), ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN semantics ENUM ('in_service', 'out_of_service', 'retired');
@@ -0,0 +1,2 @@
+-- merging models is recorded in the log of each reassigned device
+ALTER TABLE device_log MODIFY COLUMN type ENUM ('created', 'modified', 'note', 'merged') NOT NULL;
@@ -0,0 +1,9 @@
+ALTER TABLE user ADD COLUMN role ENUM ('user', 'admin') NOT NULL DEFAULT 'user';
+
+CREATE TABLE user_location (
+    user_id INTEGER UNSIGNED NOT NULL,
+    location VARCHAR(255) NOT NULL,
+    PRIMARY KEY(user_id, location),
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE,
+    FOREIGN KEY(location) REFERENCES location(location) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+ALTER TABLE user ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- deleting a user keeps their device events; user_name is shown once user_id is cleared.
+-- device_log_ibfk_2 is the user_id foreign key created by the initial migration
+ALTER TABLE device_log DROP FOREIGN KEY device_log_ibfk_2;
+ALTER TABLE device_log MODIFY COLUMN user_id INTEGER UNSIGNED, ADD COLUMN user_name VARCHAR(255),
+    ADD FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE SET NULL;
+UPDATE device_log AS e JOIN user AS u ON e.user_id = u.id SET e.user_name = u.name;
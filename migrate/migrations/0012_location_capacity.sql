@@ -0,0 +1 @@
+ALTER TABLE location ADD COLUMN capacity INTEGER UNSIGNED;
@@ -0,0 +1,22 @@
+-- reporting views for BI tools; grant a read-only user SELECT on these instead of the tables
+
+CREATE VIEW report_device AS
+    SELECT d.id, d.serial_number, m.manufacturer, m.model, c.name AS category, d.status, s.semantics AS status_semantics,
+        d.location, l.type AS location_type, l.parent AS location_parent, m.eol_date, m.eos_date
+    FROM device AS d
+    JOIN model AS m ON d.model_id = m.id
+    LEFT JOIN category AS c ON m.category_id = c.id
+    JOIN status AS s ON d.status = s.status
+    JOIN location AS l ON d.location = l.location;
+
+CREATE VIEW report_device_event AS
+    SELECT e.id, e.device_id, d.serial_number, e.date, e.type, IFNULL(u.name, e.user_name) AS user_name
+    FROM device_log AS e
+    JOIN device AS d ON e.device_id = d.id
+    LEFT JOIN user AS u ON e.user_id = u.id;
+
+CREATE VIEW report_location AS
+    SELECT l.location, l.type, l.parent, l.capacity, COUNT(d.id) AS device_count
+    FROM location AS l
+    LEFT JOIN device AS d ON d.location = l.location
+    GROUP BY l.location, l.type, l.parent, l.capacity;
@@ -0,0 +1,16 @@
+ALTER TABLE location ADD COLUMN asset_tag_prefix VARCHAR(20);
+ALTER TABLE device ADD COLUMN asset_tag VARCHAR(255) UNIQUE;
+
+CREATE TABLE asset_tag_sequence (
+    scope VARCHAR(255) PRIMARY KEY,
+    next INTEGER UNSIGNED NOT NULL
+);
+
+CREATE OR REPLACE VIEW report_device AS
+    SELECT d.id, d.serial_number, d.asset_tag, m.manufacturer, m.model, c.name AS category, d.status, s.semantics AS status_semantics,
+        d.location, l.type AS location_type, l.parent AS location_parent, m.eol_date, m.eos_date
+    FROM device AS d
+    JOIN model AS m ON d.model_id = m.id
+    LEFT JOIN category AS c ON m.category_id = c.id
+    JOIN status AS s ON d.status = s.status
+    JOIN location AS l ON d.location = l.location;
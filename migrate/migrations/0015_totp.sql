@@ -0,0 +1,9 @@
+ALTER TABLE user ADD COLUMN totp_secret VARCHAR(64), ADD COLUMN totp_counter BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE user_recovery_code (
+    user_id INTEGER UNSIGNED NOT NULL,
+    hash CHAR(64) NOT NULL,
+    PRIMARY KEY(user_id, hash),
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE
+);
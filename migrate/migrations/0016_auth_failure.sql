@@ -0,0 +1,14 @@
+CREATE TABLE auth_failure (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    user_id INTEGER UNSIGNED,
+    date DATETIME NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX auth_failure_email ON auth_failure(email);
+CREATE INDEX auth_failure_ip ON auth_failure(ip);
+CREATE INDEX auth_failure_date ON auth_failure(date);
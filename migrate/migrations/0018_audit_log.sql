@@ -0,0 +1,17 @@
+CREATE TABLE audit_log (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    date DATETIME NOT NULL,
+    user_id INTEGER UNSIGNED,
+    user_name VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(512) NOT NULL,
+    entity VARCHAR(50) NOT NULL,
+    entity_id VARCHAR(255),
+    summary TEXT,
+    code SMALLINT UNSIGNED NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX audit_log_date ON audit_log(date);
+CREATE INDEX audit_log_user_id ON audit_log(user_id);
+CREATE INDEX audit_log_entity ON audit_log(entity);
@@ -0,0 +1,3 @@
+ALTER TABLE device ADD COLUMN last_event_at DATETIME;
+CREATE INDEX device_last_event_at ON device(last_event_at);
+UPDATE device AS d SET last_event_at=(SELECT MAX(e.date) FROM device_log AS e WHERE e.device_id = d.id);
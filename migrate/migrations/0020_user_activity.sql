@@ -0,0 +1 @@
+ALTER TABLE user ADD COLUMN last_login_at DATETIME, ADD COLUMN last_login_ip VARCHAR(45), ADD COLUMN last_activity_at DATETIME;
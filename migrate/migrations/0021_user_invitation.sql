@@ -0,0 +1,11 @@
+CREATE TABLE user_invitation (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    hash CHAR(64) UNIQUE NOT NULL,
+    invited_by INTEGER UNSIGNED,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    FOREIGN KEY(invited_by) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX user_invitation_email ON user_invitation(email);
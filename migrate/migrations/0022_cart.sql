@@ -0,0 +1,12 @@
+CREATE TABLE cart (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    number VARCHAR(50) UNIQUE NOT NULL,
+    location VARCHAR(255) NOT NULL,
+    capacity INTEGER UNSIGNED,
+    FOREIGN KEY(location) REFERENCES location(location)
+);
+
+CREATE INDEX cart_location ON cart(location);
+
+ALTER TABLE device ADD COLUMN cart_id INTEGER UNSIGNED, ADD FOREIGN KEY(cart_id) REFERENCES cart(id) ON DELETE SET NULL;
+CREATE INDEX device_cart_id ON device(cart_id);
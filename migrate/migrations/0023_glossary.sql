@@ -0,0 +1,5 @@
+CREATE TABLE glossary (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    term VARCHAR(255) UNIQUE NOT NULL,
+    definition TEXT NOT NULL
+);
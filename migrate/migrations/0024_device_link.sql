@@ -0,0 +1,9 @@
+CREATE TABLE device_link (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    device_id INTEGER UNSIGNED NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    FOREIGN KEY(device_id) REFERENCES device(id) ON DELETE CASCADE
+);
+
+CREATE INDEX device_link_device_id ON device_link(device_id);
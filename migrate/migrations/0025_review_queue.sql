@@ -0,0 +1,5 @@
+-- models and locations created by non-admins are queued for review; existing rows are already reviewed
+ALTER TABLE model ADD COLUMN created DATETIME, ADD COLUMN reviewed BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE INDEX model_created ON model(created);
+ALTER TABLE location ADD COLUMN created DATETIME, ADD COLUMN reviewed BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE INDEX location_created ON location(created);
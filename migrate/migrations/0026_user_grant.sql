@@ -0,0 +1,32 @@
+-- temporary access; the admin role and/or a location from starts until expires
+CREATE TABLE user_grant (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER UNSIGNED NOT NULL,
+    role ENUM ('admin'),
+    location VARCHAR(255),
+    starts DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    granted_by INTEGER UNSIGNED,
+    revoked DATETIME,
+    expired BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE,
+    FOREIGN KEY(location) REFERENCES location(location) ON DELETE CASCADE,
+    FOREIGN KEY(granted_by) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX user_grant_user_id ON user_grant(user_id);
+CREATE INDEX user_grant_expires ON user_grant(expires);
+
+CREATE TABLE user_grant_log (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    grant_id INTEGER UNSIGNED NOT NULL,
+    user_id INTEGER UNSIGNED,
+    user_name VARCHAR(255),
+    date DATETIME NOT NULL,
+    type ENUM ('created', 'modified', 'expired') NOT NULL,
+    content TEXT,
+    FOREIGN KEY(grant_id) REFERENCES user_grant(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX user_grant_log_grant_id ON user_grant_log(grant_id);
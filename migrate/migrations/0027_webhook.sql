@@ -0,0 +1,28 @@
+CREATE TABLE webhook (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types VARCHAR(1024) NOT NULL,
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created DATETIME NOT NULL,
+    created_by INTEGER UNSIGNED,
+    FOREIGN KEY(created_by) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE TABLE webhook_delivery (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    webhook_id INTEGER UNSIGNED NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload MEDIUMTEXT NOT NULL,
+    status ENUM ('pending', 'delivered', 'failed') NOT NULL,
+    attempts INTEGER UNSIGNED NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    next_attempt DATETIME,
+    last_attempt DATETIME,
+    response_code INTEGER,
+    error TEXT,
+    FOREIGN KEY(webhook_id) REFERENCES webhook(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_delivery_webhook_id ON webhook_delivery(webhook_id);
+CREATE INDEX webhook_delivery_due ON webhook_delivery(status, next_attempt);
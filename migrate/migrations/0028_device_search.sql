@@ -0,0 +1,3 @@
+-- full-text indexes used by SimpleQueryDevice; LIKE can't use an index for '%term%' searches
+CREATE FULLTEXT INDEX device_search ON device(serial_number, asset_tag, status, location);
+CREATE FULLTEXT INDEX model_search ON model(manufacturer, model);
@@ -0,0 +1,26 @@
+-- soft deletes: rows with deleted_at set are hidden from reads and queries until they're restored
+ALTER TABLE device ADD COLUMN deleted_at DATETIME;
+ALTER TABLE model ADD COLUMN deleted_at DATETIME;
+ALTER TABLE user ADD COLUMN deleted_at DATETIME;
+CREATE INDEX device_deleted_at ON device(deleted_at);
+CREATE INDEX model_deleted_at ON model(deleted_at);
+CREATE INDEX user_deleted_at ON user(deleted_at);
+
+-- deleting and restoring a device is recorded in its log
+ALTER TABLE device_log MODIFY COLUMN type ENUM ('created', 'modified', 'note', 'merged', 'deleted', 'restored') NOT NULL;
+
+CREATE OR REPLACE VIEW report_device AS
+    SELECT d.id, d.serial_number, d.asset_tag, m.manufacturer, m.model, c.name AS category, d.status, s.semantics AS status_semantics,
+        d.location, l.type AS location_type, l.parent AS location_parent, m.eol_date, m.eos_date
+    FROM device AS d
+    JOIN model AS m ON d.model_id = m.id
+    LEFT JOIN category AS c ON m.category_id = c.id
+    JOIN status AS s ON d.status = s.status
+    JOIN location AS l ON d.location = l.location
+    WHERE d.deleted_at IS NULL;
+
+CREATE OR REPLACE VIEW report_location AS
+    SELECT l.location, l.type, l.parent, l.capacity, COUNT(d.id) AS device_count
+    FROM location AS l
+    LEFT JOIN device AS d ON d.location = l.location AND d.deleted_at IS NULL
+    GROUP BY l.location, l.type, l.parent, l.capacity;
@@ -0,0 +1,2 @@
+-- full-text index used by note searches; LIKE can't use an index for '%term%' searches
+CREATE FULLTEXT INDEX device_log_search ON device_log(content);
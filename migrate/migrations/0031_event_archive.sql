@@ -0,0 +1,16 @@
+-- device events moved out of device_log by the event retention job; rows keep their device_log id
+CREATE TABLE device_log_archive (
+    id INTEGER UNSIGNED PRIMARY KEY,
+    device_id INTEGER UNSIGNED NOT NULL,
+    user_id INTEGER UNSIGNED,
+    user_name VARCHAR(255),
+    date DATETIME NOT NULL,
+    type ENUM ('created', 'modified', 'note', 'merged', 'deleted', 'restored') NOT NULL,
+    content TEXT,
+    archived DATETIME NOT NULL,
+    FOREIGN KEY(device_id) REFERENCES device(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX device_log_archive_device_id ON device_log_archive(device_id);
+CREATE INDEX device_log_archive_date ON device_log_archive(date);
@@ -0,0 +1,5 @@
+-- how each event (and audited request) was made: web, chatbot, or system, and the chatbot conversation it was made in
+ALTER TABLE device_log ADD COLUMN source VARCHAR(20), ADD COLUMN source_conversation_id VARCHAR(255);
+ALTER TABLE device_log_archive ADD COLUMN source VARCHAR(20), ADD COLUMN source_conversation_id VARCHAR(255);
+ALTER TABLE user_grant_log ADD COLUMN source VARCHAR(20), ADD COLUMN source_conversation_id VARCHAR(255);
+ALTER TABLE audit_log ADD COLUMN source VARCHAR(20), ADD COLUMN source_conversation_id VARCHAR(255);
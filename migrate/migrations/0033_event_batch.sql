@@ -0,0 +1,17 @@
+-- events created by one bulk operation share a batch, so the operation can be viewed and reverted as a whole
+CREATE TABLE event_batch (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    date DATETIME NOT NULL,
+    user_id INTEGER UNSIGNED,
+    description VARCHAR(255) NOT NULL,
+    reverted_by INTEGER UNSIGNED,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE SET NULL,
+    FOREIGN KEY(reverted_by) REFERENCES event_batch(id) ON DELETE SET NULL
+);
+
+CREATE INDEX event_batch_date ON event_batch(date);
+
+ALTER TABLE device_log ADD COLUMN batch_id INTEGER UNSIGNED, ADD FOREIGN KEY(batch_id) REFERENCES event_batch(id) ON DELETE SET NULL;
+CREATE INDEX device_log_batch_id ON device_log(batch_id);
+ALTER TABLE device_log_archive ADD COLUMN batch_id INTEGER UNSIGNED;
+ALTER TABLE user_grant_log ADD COLUMN batch_id INTEGER UNSIGNED, ADD FOREIGN KEY(batch_id) REFERENCES event_batch(id) ON DELETE SET NULL;
@@ -0,0 +1,13 @@
+-- device events are hash chained: each stores the hash of the event before it, so changed, removed, or reordered events can be detected.
+-- event_chain has a single row with the first and last chained events; it's locked while an event is added
+CREATE TABLE event_chain (
+    id TINYINT UNSIGNED PRIMARY KEY,
+    first_id INTEGER UNSIGNED,
+    last_id INTEGER UNSIGNED,
+    hash CHAR(64)
+);
+
+INSERT INTO event_chain(id) VALUES(1);
+
+ALTER TABLE device_log ADD COLUMN prev_hash CHAR(64), ADD COLUMN hash CHAR(64);
+ALTER TABLE device_log_archive ADD COLUMN prev_hash CHAR(64), ADD COLUMN hash CHAR(64);
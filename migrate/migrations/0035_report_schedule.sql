@@ -0,0 +1,20 @@
+-- reports emailed on a cron schedule. next_run is NULL while a schedule is disabled
+CREATE TABLE report_schedule (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    report ENUM ('stats', 'overdue', 'broken') NOT NULL,
+    schedule VARCHAR(255) NOT NULL,
+    format ENUM ('csv', 'html') NOT NULL,
+    recipients VARCHAR(4096) NOT NULL,
+    status VARCHAR(50),
+    days INTEGER UNSIGNED NOT NULL DEFAULT 0,
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created DATETIME NOT NULL,
+    created_by INTEGER UNSIGNED,
+    next_run DATETIME,
+    last_run DATETIME,
+    last_error TEXT,
+    FOREIGN KEY(created_by) REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX report_schedule_next_run ON report_schedule(next_run);
@@ -0,0 +1,7 @@
+-- each user's dashboard widgets as JSON; users without a row get the default widgets
+CREATE TABLE user_dashboard (
+    user_id INTEGER UNSIGNED PRIMARY KEY,
+    widgets MEDIUMTEXT NOT NULL,
+    updated DATETIME NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE
+);
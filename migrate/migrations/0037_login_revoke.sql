@@ -0,0 +1,2 @@
+-- one-time "this wasn't me" links in login notifications that sign the User out everywhere
+ALTER TABLE user_login ADD COLUMN revoke_hash CHAR(64) UNIQUE, ADD COLUMN revoke_expires DATETIME;
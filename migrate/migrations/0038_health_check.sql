@@ -0,0 +1,13 @@
+-- periodic service self-checks for /admin/health/history
+CREATE TABLE health_check (
+    id INTEGER UNSIGNED PRIMARY KEY AUTO_INCREMENT,
+    date DATETIME NOT NULL,
+    ok BOOLEAN NOT NULL,
+    db_latency_ms DOUBLE NOT NULL,
+    webhook_queue INTEGER UNSIGNED NOT NULL DEFAULT 0,
+    report_queue INTEGER UNSIGNED NOT NULL DEFAULT 0,
+    review_queue INTEGER UNSIGNED NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+CREATE INDEX health_check_date ON health_check(date);
@@ -0,0 +1,58 @@
+-- case and whitespace insensitive model uniqueness. The keys are set by the server (see normalizeKey in api/validate.go)
+ALTER TABLE model ADD COLUMN manufacturer_key VARCHAR(255), ADD COLUMN model_key VARCHAR(255);
+
+UPDATE model SET
+    manufacturer_key = LOWER(TRIM(REGEXP_REPLACE(manufacturer, '[[:space:]]+', ' '))),
+    model_key = LOWER(TRIM(REGEXP_REPLACE(model, '[[:space:]]+', ' ')));
+
+-- merge duplicates into the first model that isn't deleted (or the first model, if all are deleted).
+-- Events can't be added to the hash chain here, so each merge and the devices it moved are recorded in model_key_merge
+-- and model_key_merge_device, and the server adds a merged event to each moved device when it starts
+CREATE TEMPORARY TABLE model_dedupe AS
+SELECT m.id AS from_id, (
+    SELECT c.id FROM model c
+    WHERE c.manufacturer_key = m.manufacturer_key AND c.model_key = m.model_key
+    ORDER BY c.deleted_at IS NOT NULL, c.id LIMIT 1
+) AS to_id
+FROM model m;
+
+DELETE FROM model_dedupe WHERE from_id = to_id;
+
+CREATE TABLE model_key_merge (
+    from_model_id INTEGER UNSIGNED PRIMARY KEY,
+    manufacturer VARCHAR(255) NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    category_id INTEGER UNSIGNED,
+    to_model_id INTEGER UNSIGNED NOT NULL,
+    merged DATETIME NOT NULL
+);
+
+CREATE TABLE model_key_merge_device (
+    from_model_id INTEGER UNSIGNED NOT NULL,
+    device_id INTEGER UNSIGNED NOT NULL,
+    recorded BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY(from_model_id, device_id),
+    FOREIGN KEY(from_model_id) REFERENCES model_key_merge(from_model_id) ON DELETE CASCADE,
+    FOREIGN KEY(device_id) REFERENCES device(id) ON DELETE CASCADE
+);
+
+INSERT INTO model_key_merge(from_model_id, manufacturer, model, category_id, to_model_id, merged)
+SELECT m.id, m.manufacturer, m.model, m.category_id, x.to_id, NOW() FROM model m JOIN model_dedupe x ON m.id = x.from_id;
+
+INSERT INTO model_key_merge_device(from_model_id, device_id)
+SELECT x.from_id, d.id FROM device d JOIN model_dedupe x ON d.model_id = x.from_id;
+
+UPDATE device d JOIN model_dedupe x ON d.model_id = x.from_id SET d.model_id = x.to_id;
+
+-- a model stays reviewed if any of its duplicates were
+UPDATE model c JOIN (
+    SELECT x.to_id FROM model_dedupe x JOIN model m ON m.id = x.from_id WHERE m.reviewed GROUP BY x.to_id
+) r ON c.id = r.to_id
+SET c.reviewed = TRUE;
+
+DELETE m FROM model m JOIN model_dedupe x ON m.id = x.from_id;
+
+DROP TEMPORARY TABLE model_dedupe;
+
+ALTER TABLE model MODIFY COLUMN manufacturer_key VARCHAR(255) NOT NULL, MODIFY COLUMN model_key VARCHAR(255) NOT NULL;
+CREATE UNIQUE INDEX model_key ON model(manufacturer_key, model_key);
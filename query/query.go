@@ -1,4 +1,4 @@
-package api
+package query
 
 //SortType is a SQL sort type
 type SortType int